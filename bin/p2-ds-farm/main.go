@@ -2,21 +2,28 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/square/p2/pkg/alerting"
+	"github.com/square/p2/pkg/farmstatus"
 	"github.com/square/p2/pkg/health/checker"
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/shard"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/dsstore"
 	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/store/consul/shardstore"
 	"github.com/square/p2/pkg/store/consul/statusstore"
 	"github.com/square/p2/pkg/store/consul/statusstore/daemonsetstatus"
+	"github.com/square/p2/pkg/util/stream"
 
 	ds_farm "github.com/square/p2/pkg/ds"
 
@@ -25,6 +32,10 @@ import (
 
 var (
 	useCachePodMatches = kingpin.Flag("use-cached-pod-matches", "If enabled, create a local cache of the pod label tree and match against that instead of querying on all pod selector queries").Bool()
+	farmStatusPort     = kingpin.Flag("farm-status-port", "If set, serve the daemon sets this farm holds locks for on this port at /farms").Int()
+	shardFarms         = kingpin.Flag("shard", "Split daemon sets with the other farms passing this flag instead of competing for all of them").Bool()
+
+	pagerdutyServiceKey = kingpin.Flag("pagerduty-service-key", "Pagerduty Service Key to use for alerting if provided").String()
 )
 
 // SessionName returns a node identifier for use when creating Consul sessions.
@@ -58,6 +69,28 @@ func main() {
 		Behavior:  api.SessionBehaviorDelete,
 		TTL:       "15s",
 	}, client, sessions, quitCh, logger)
+	pub := stream.NewStringValuePublisher(sessions, "")
+
+	alerter := alerting.NewNop()
+	if *pagerdutyServiceKey != "" {
+		var err error
+		// just use the same key for high and low urgency
+		alerter, err = alerting.NewPagerduty(*pagerdutyServiceKey, *pagerdutyServiceKey, cleanhttp.DefaultClient())
+		if err != nil {
+			logger.WithError(err).Fatalln(
+				"Unable to initialize pagerduty alerter",
+			)
+		}
+	}
+
+	// The interface must stay nil when not sharding, rather than holding a
+	// nil *shard.RingSharder
+	var sharder shard.Sharder
+	if *shardFarms {
+		s := shard.NewRingSharder(shardstore.NewConsul(client), "p2-ds-farm", SessionName(), pub.Subscribe().Chan(), logger)
+		go s.Start(quitCh)
+		sharder = s
+	}
 
 	dsf := ds_farm.NewFarm(
 		consulStore,
@@ -67,18 +100,28 @@ func main() {
 		statusStore,
 		labeler,
 		labels.NewConsulApplicator(client, 0, 1*time.Minute),
-		sessions,
+		pub.Subscribe().Chan(),
 		logger,
-		nil,
+		alerter,
 		&healthChecker,
 		1*time.Second,
 		false,
 		*useCachePodMatches,
 		1*time.Second,
 		ds_farm.DefaultRetryInterval,
-		ds_farm.DSFarmConfig{},
+		ds_farm.DSFarmConfig{Sharder: sharder},
 	)
 
+	if *farmStatusPort != 0 {
+		handler := farmstatus.NewHandler(map[string]farmstatus.Farm{
+			"ds": dsf,
+		})
+		go func() {
+			err := http.ListenAndServe(fmt.Sprintf(":%d", *farmStatusPort), handler)
+			logger.WithError(err).Errorln("Farm status server exited")
+		}()
+	}
+
 	go func() {
 		// clear lock immediately on ctrl-C
 		signals := make(chan os.Signal, 1)
@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/user"
 	"strconv"
+	"strings"
+	"text/tabwriter"
 	"time"
 
 	"gopkg.in/alecthomas/kingpin.v2"
@@ -18,10 +21,15 @@ import (
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pods"
 	"github.com/square/p2/pkg/scheduler"
 	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/auditlogstore"
+	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/dsstore"
 	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/daemonsetstatus"
 	"github.com/square/p2/pkg/store/consul/transaction"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
@@ -37,6 +45,11 @@ const (
 	CmdDelete       = "delete"
 	CmdUpdate       = "update"
 	CmdTestSelector = "test-selector"
+	CmdStatus       = "status"
+	CmdHistory      = "history"
+	CmdRollback     = "rollback"
+	CmdExclude      = "exclude"
+	CmdPin          = "pin"
 
 	TimeoutNotSpecified = time.Duration(-1)
 )
@@ -49,13 +62,15 @@ func flagUsed(marker *bool) kingpin.Action {
 }
 
 var (
-	cmdCreate        = kingpin.Command(CmdCreate, "Create a daemon set.")
-	createSelector   = cmdCreate.Flag("selector", "The node selector, uses the same syntax as the test-selector command").Required().String()
-	createManifest   = cmdCreate.Flag("manifest", "Path to signed manifest file").Required().String()
-	createMinHealth  = cmdCreate.Flag("minhealth", "The minimum health of the daemon set").Required().String()
-	createName       = cmdCreate.Flag("name", "The cluster name (ie. staging, production)").Required().String()
-	createTimeout    = cmdCreate.Flag("timeout", "Non-zero timeout for replicating hosts. e.g. 1m2s for 1 minute and 2 seconds").Required().Duration()
-	createEverywhere = cmdCreate.Flag("everywhere", "Sets selector to match everything regardless of its value").Bool()
+	cmdCreate         = kingpin.Command(CmdCreate, "Create a daemon set.")
+	createSelector    = cmdCreate.Flag("selector", "The node selector, uses the same syntax as the test-selector command").Required().String()
+	createManifest    = cmdCreate.Flag("manifest", "Path to signed manifest file").Required().String()
+	createMinHealth   = cmdCreate.Flag("minhealth", "The minimum health of the daemon set").Required().String()
+	createName        = cmdCreate.Flag("name", "The cluster name (ie. staging, production)").Required().String()
+	createTimeout     = cmdCreate.Flag("timeout", "Non-zero timeout for replicating hosts. e.g. 1m2s for 1 minute and 2 seconds").Required().Duration()
+	createEverywhere  = cmdCreate.Flag("everywhere", "Sets selector to match everything regardless of its value").Bool()
+	createMaxInFlight = cmdCreate.Flag("max-in-flight", fmt.Sprintf("The number of nodes to update at once, either absolute (e.g. 5) or a percentage of eligible nodes (e.g. 10%%). Defaults to %d", ds_fields.DefaultMaxInFlight)).String()
+	createBatchPause  = cmdCreate.Flag("batch-pause", "How long to wait after each batch of max-in-flight nodes is updated before starting the next, e.g. 5m. Defaults to not pausing").Duration()
 
 	cmdGet = kingpin.Command(CmdGet, "Show a daemon set.")
 	getID  = cmdGet.Arg("id", "The uuid for the daemon set").Required().String()
@@ -73,15 +88,43 @@ var (
 	cmdDelete = kingpin.Command(CmdDelete, "Delete daemon set.")
 	deleteID  = cmdDelete.Arg("id", "The uuid for the daemon set").Required().String()
 
-	cmdUpdate           = kingpin.Command(CmdUpdate, "Update a daemon set.")
-	updateID            = cmdUpdate.Arg("id", "The uuid for the daemon set").Required().String()
-	updateSelectorGiven = false
-	updateSelector      = cmdUpdate.Flag("selector", "The node selector, uses the same syntax as the test-selector command").Action(flagUsed(&updateSelectorGiven)).String()
-	updateManifest      = cmdUpdate.Flag("manifest", "Path to signed manifest file").String()
-	updateMinHealth     = cmdUpdate.Flag("minhealth", "The minimum health of the daemon set").String()
-	updateName          = cmdUpdate.Flag("name", "The cluster name (ie. staging, production)").String()
-	updateTimeout       = cmdUpdate.Flag("timeout", "Non-zero timeout for replicating hosts. e.g. 1m2s for 1 minute and 2 seconds").Default(TimeoutNotSpecified.String()).Duration()
-	updateEverywhere    = cmdUpdate.Flag("everywhere", "Sets selector to match everything regardless of its value").Bool()
+	cmdUpdate                = kingpin.Command(CmdUpdate, "Update a daemon set.")
+	updateID                 = cmdUpdate.Arg("id", "The uuid for the daemon set").Required().String()
+	updateSelectorGiven      = false
+	updateSelector           = cmdUpdate.Flag("selector", "The node selector, uses the same syntax as the test-selector command").Action(flagUsed(&updateSelectorGiven)).String()
+	updateManifest           = cmdUpdate.Flag("manifest", "Path to signed manifest file").String()
+	updateMinHealth          = cmdUpdate.Flag("minhealth", "The minimum health of the daemon set").String()
+	updateName               = cmdUpdate.Flag("name", "The cluster name (ie. staging, production)").String()
+	updateTimeout            = cmdUpdate.Flag("timeout", "Non-zero timeout for replicating hosts. e.g. 1m2s for 1 minute and 2 seconds").Default(TimeoutNotSpecified.String()).Duration()
+	updateEverywhere         = cmdUpdate.Flag("everywhere", "Sets selector to match everything regardless of its value").Bool()
+	updateMaxInFlight        = cmdUpdate.Flag("max-in-flight", "The number of nodes to update at once, either absolute (e.g. 5) or a percentage of eligible nodes (e.g. 10%). Takes effect during an in-progress update").String()
+	updateBatchPauseGiven    = false
+	updateBatchPause         = cmdUpdate.Flag("batch-pause", "How long to wait after each batch of max-in-flight nodes is updated before starting the next. 0 disables pausing. Takes effect during an in-progress update").Action(flagUsed(&updateBatchPauseGiven)).Duration()
+	updateFailureBudgetGiven = false
+	updateFailureBudget      = cmdUpdate.Flag("failure-budget", "The number of nodes that may end up unhealthy or timed out before the daemon set disables itself, either absolute (e.g. 2) or a percentage of eligible nodes (e.g. 5%). An empty value removes the budget").Action(flagUsed(&updateFailureBudgetGiven)).String()
+
+	cmdStatus   = kingpin.Command(CmdStatus, "Show the progress of a daemon set's deployment on each of its nodes.")
+	statusID    = cmdStatus.Arg("id", "The uuid for the daemon set").Required().String()
+	statusWatch = cmdStatus.Flag("watch", "keep printing the status as it changes").Short('w').Bool()
+	statusNodes = cmdStatus.Flag("nodes", "list the nodes in each state rather than only counting them").Bool()
+
+	cmdHistory = kingpin.Command(CmdHistory, "List the prior manifests of a daemon set that it can be rolled back to.")
+	historyID  = cmdHistory.Arg("id", "The uuid for the daemon set").Required().String()
+
+	cmdRollback = kingpin.Command(CmdRollback, "Set a daemon set's manifest back to a prior one, which is then replicated to its nodes like any manifest update.")
+	rollbackID  = cmdRollback.Arg("id", "The uuid for the daemon set").Required().String()
+	rollbackTo  = cmdRollback.Flag("to", "The SHA, or a unique prefix of it, of the prior manifest to roll back to. Defaults to the most recent prior manifest").String()
+
+	cmdExclude     = kingpin.Command(CmdExclude, "Keep a daemon set's pod off of nodes regardless of its node selector. The pod is removed from excluded nodes that have it.")
+	excludeID      = cmdExclude.Arg("id", "The uuid for the daemon set").Required().String()
+	excludeNodes   = cmdExclude.Arg("nodes", "The nodes to exclude").Required().Strings()
+	excludeInclude = cmdExclude.Flag("remove", "Remove the nodes from the exclusion list instead").Bool()
+
+	cmdPin    = kingpin.Command(CmdPin, "Pin a node to a manifest. The daemon set leaves the pod on the node alone until its own manifest is the pinned one.")
+	pinID     = cmdPin.Arg("id", "The uuid for the daemon set").Required().String()
+	pinNode   = cmdPin.Arg("node", "The node to pin").Required().String()
+	pinSHA    = cmdPin.Flag("sha", "The SHA, or a unique prefix of it, of the manifest to pin the node to. It must be the node's manifest or one of the daemon set's current or prior manifests. Defaults to the node's manifest").String()
+	pinRemove = cmdPin.Flag("remove", "Unpin the node instead, so that it is given the daemon set's manifest").Bool()
 
 	cmdTestSelector = kingpin.Command(CmdTestSelector, `
 		This will output the hosts that match the selector,
@@ -118,6 +161,14 @@ func main() {
 			log.Fatalf("Timeout must be a positive non-zero value, got '%v'", *createTimeout)
 		}
 
+		maxInFlight, err := ds_fields.ParseMaxInFlight(*createMaxInFlight)
+		if err != nil {
+			log.Fatalf("Invalid value for max in flight: %v", err)
+		}
+		if *createBatchPause < time.Duration(0) {
+			log.Fatalf("Batch pause must not be negative, got '%v'", *createBatchPause)
+		}
+
 		selectorString := *createSelector
 		if *createEverywhere {
 			selectorString = klabels.Everything().String()
@@ -136,7 +187,7 @@ func main() {
 
 		ctx, cancelFunc := transaction.New(context.Background())
 		defer cancelFunc()
-		newDS, err := dsstore.Create(ctx, manifest, minHealth, name, selector, podID, *createTimeout)
+		newDS, err := dsstore.Create(ctx, manifest, minHealth, name, selector, podID, *createTimeout, maxInFlight, *createBatchPause)
 		if err != nil {
 			log.Fatalf("err: %v", err)
 		}
@@ -270,6 +321,35 @@ func main() {
 					ds.Timeout = *updateTimeout
 				}
 			}
+			if *updateMaxInFlight != "" {
+				maxInFlight, err := ds_fields.ParseMaxInFlight(*updateMaxInFlight)
+				if err != nil {
+					return ds, util.Errorf("Invalid value for max in flight: %v", err)
+				}
+				if ds.MaxInFlight != maxInFlight {
+					changed = true
+					ds.MaxInFlight = maxInFlight
+				}
+			}
+			if updateBatchPauseGiven {
+				if *updateBatchPause < time.Duration(0) {
+					return ds, util.Errorf("Batch pause must not be negative, got '%v'", *updateBatchPause)
+				}
+				if ds.BatchPause != *updateBatchPause {
+					changed = true
+					ds.BatchPause = *updateBatchPause
+				}
+			}
+			if updateFailureBudgetGiven {
+				failureBudget, err := ds_fields.ParseFailureBudget(*updateFailureBudget)
+				if err != nil {
+					return ds, util.Errorf("Invalid value for failure budget: %v", err)
+				}
+				if ds.FailureBudget != failureBudget {
+					changed = true
+					ds.FailureBudget = failureBudget
+				}
+			}
 			if *updateManifest != "" {
 				manifest, err := manifest.FromPath(*updateManifest)
 				if err != nil {
@@ -330,6 +410,137 @@ func main() {
 		fmt.Printf("The daemon set '%s' has been successfully updated in consul", id.String())
 		fmt.Println()
 
+	case CmdStatus:
+		statusStore := daemonsetstatus.NewConsul(statusstore.NewConsul(client), ds.DaemonSetStatusNamespace)
+		id := ds_fields.ID(*statusID)
+
+		status, queryMeta, err := statusStore.Get(id)
+		for {
+			switch {
+			case statusstore.IsNoStatus(err):
+				fmt.Printf("no status found for daemon set %s, it may not have been picked up by a farm yet\n", id)
+				return
+			case err != nil:
+				log.Fatalf("Could not fetch daemon set status: %v", err)
+			}
+
+			printStatus(status, *statusNodes)
+			if !*statusWatch {
+				return
+			}
+
+			status, queryMeta, err = statusStore.Watch(id, queryMeta.LastIndex)
+			fmt.Println()
+		}
+
+	case CmdHistory:
+		id := ds_fields.ID(*historyID)
+		ds, _, err := dsstore.Get(id)
+		if err != nil {
+			log.Fatalf("err: %v", err)
+		}
+		history, err := dsstore.History(id)
+		if err != nil {
+			log.Fatalf("err: %v", err)
+		}
+		currentSHA, err := ds.Manifest.SHA()
+		if err != nil {
+			log.Fatalf("Could not compute manifest SHA: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SHA\tREPLACED")
+		fmt.Fprintf(w, "%s\t(current)\n", currentSHA)
+		for i := len(history.Revisions) - 1; i >= 0; i-- {
+			revision := history.Revisions[i]
+			fmt.Fprintf(w, "%s\t%s\n", revision.SHA, revision.Timestamp.Format(time.RFC3339))
+		}
+		w.Flush()
+
+	case CmdRollback:
+		id := ds_fields.ID(*rollbackID)
+		auditingStore := newAuditingStore(client, dsstore)
+
+		ctx, cancelFunc := transaction.New(context.Background())
+		defer cancelFunc()
+		ds, err := auditingStore.Rollback(ctx, id, *rollbackTo, currentUsername())
+		if err != nil {
+			log.Fatalf("err: %v", err)
+		}
+		err = transaction.MustCommit(ctx, client.KV())
+		if err != nil {
+			log.Fatalf("Could not roll back daemon set: %v", err)
+		}
+
+		sha, err := ds.Manifest.SHA()
+		if err != nil {
+			log.Fatalf("Could not compute manifest SHA: %v", err)
+		}
+		fmt.Printf("The daemon set '%s' has been rolled back to manifest %s", id.String(), sha)
+		fmt.Println()
+
+	case CmdExclude:
+		id := ds_fields.ID(*excludeID)
+		nodes := make([]types.NodeName, len(*excludeNodes))
+		for i, node := range *excludeNodes {
+			nodes[i] = types.NodeName(node)
+		}
+		auditingStore := newAuditingStore(client, dsstore)
+
+		ctx, cancelFunc := transaction.New(context.Background())
+		defer cancelFunc()
+		ds, err := auditingStore.ExcludeNodes(ctx, id, nodes, *excludeInclude, currentUsername())
+		if err != nil {
+			log.Fatalf("err: %v", err)
+		}
+		err = transaction.MustCommit(ctx, client.KV())
+		if err != nil {
+			log.Fatalf("Could not update excluded nodes: %v", err)
+		}
+		fmt.Printf("The daemon set '%s' now excludes: %s", id.String(), strings.Join(nodeStrings(ds.ExcludedNodes), ","))
+		fmt.Println()
+
+	case CmdPin:
+		id := ds_fields.ID(*pinID)
+		node := types.NodeName(*pinNode)
+		var sha string
+		if !*pinRemove {
+			dsFields, _, err := dsstore.Get(id)
+			if err != nil {
+				log.Fatalf("err: %v", err)
+			}
+			history, err := dsstore.History(id)
+			if err != nil {
+				log.Fatalf("err: %v", err)
+			}
+			intent, _, err := consul.NewConsulStore(client).Pod(consul.INTENT_TREE, node, dsFields.PodID)
+			if err != nil && err != pods.NoCurrentManifest {
+				log.Fatalf("Could not read manifest of %s on %s: %v", dsFields.PodID, node, err)
+			}
+			sha, err = resolvePinSHA(dsFields, history, intent, *pinSHA)
+			if err != nil {
+				log.Fatalf("err: %v", err)
+			}
+		}
+		auditingStore := newAuditingStore(client, dsstore)
+
+		ctx, cancelFunc := transaction.New(context.Background())
+		defer cancelFunc()
+		_, err := auditingStore.PinNode(ctx, id, node, sha, currentUsername())
+		if err != nil {
+			log.Fatalf("err: %v", err)
+		}
+		err = transaction.MustCommit(ctx, client.KV())
+		if err != nil {
+			log.Fatalf("Could not update pinned nodes: %v", err)
+		}
+		if sha == "" {
+			fmt.Printf("%s has been unpinned from daemon set '%s'", node, id.String())
+		} else {
+			fmt.Printf("%s has been pinned to manifest %s in daemon set '%s'", node, sha, id.String())
+		}
+		fmt.Println()
+
 	case CmdTestSelector:
 		selectorString := *testSelectorString
 		if *testSelectorEverywhere {
@@ -353,6 +564,104 @@ func main() {
 	}
 }
 
+// resolvePinSHA returns the full SHA of the manifest a node should be pinned
+// to. An empty prefix means the node's own manifest, otherwise the prefix must
+// match exactly one of the node's manifest and the daemon set's current and
+// prior manifests
+func resolvePinSHA(dsFields ds_fields.DaemonSet, history ds_fields.History, intent manifest.Manifest, shaPrefix string) (string, error) {
+	var candidates []string
+	if intent != nil {
+		intentSHA, err := intent.SHA()
+		if err != nil {
+			return "", err
+		}
+		if shaPrefix == "" {
+			return intentSHA, nil
+		}
+		candidates = append(candidates, intentSHA)
+	} else if shaPrefix == "" {
+		return "", util.Errorf("the node has no manifest for %s, so the SHA to pin it to must be given", dsFields.PodID)
+	}
+
+	dsSHA, err := dsFields.Manifest.SHA()
+	if err != nil {
+		return "", err
+	}
+	candidates = append(candidates, dsSHA)
+	for _, revision := range history.Revisions {
+		candidates = append(candidates, revision.SHA)
+	}
+
+	matches := make(map[string]bool)
+	for _, sha := range candidates {
+		if strings.HasPrefix(sha, shaPrefix) {
+			matches[sha] = true
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", util.Errorf("no manifest of the node or the daemon set matches %q", shaPrefix)
+	case 1:
+		for sha := range matches {
+			return sha, nil
+		}
+	}
+	return "", util.Errorf("%q matches more than one manifest", shaPrefix)
+}
+
+func newAuditingStore(client consulutil.ConsulClient, store *dsstore.ConsulStore) dsstore.AuditingStore {
+	return dsstore.NewAuditingStore(store, auditlogstore.NewConsulStore(client.KV()))
+}
+
+func currentUsername() string {
+	currentUser, err := user.Current()
+	if err != nil {
+		return "unknown"
+	}
+	return currentUser.Username
+}
+
+func printStatus(status daemonsetstatus.Status, listNodes bool) {
+	fmt.Printf("Manifest SHA:          %s\n", status.ManifestSHA)
+	fmt.Printf("Replication running:   %t\n", status.ReplicationInProgress)
+	fmt.Printf("Nodes deployed:        %d\n", status.NodesDeployed)
+	if status.HaltReason != "" {
+		fmt.Printf("Halted:                %s\n", status.HaltReason)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if listNodes {
+		fmt.Fprintln(w, "STATE\tCOUNT\tNODES")
+	} else {
+		fmt.Fprintln(w, "STATE\tCOUNT")
+	}
+	for _, state := range []struct {
+		name  string
+		nodes []types.NodeName
+	}{
+		{"current", status.Nodes.Current},
+		{"outdated", status.Nodes.Outdated},
+		{"unhealthy", status.Nodes.Unhealthy},
+		{"timed out", status.Nodes.TimedOut},
+		{"unscheduled", status.Nodes.Unscheduled},
+	} {
+		if listNodes {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", state.name, len(state.nodes), strings.Join(nodeStrings(state.nodes), ","))
+		} else {
+			fmt.Fprintf(w, "%s\t%d\n", state.name, len(state.nodes))
+		}
+	}
+	w.Flush()
+}
+
+func nodeStrings(nodes []types.NodeName) []string {
+	ret := make([]string, len(nodes))
+	for i, node := range nodes {
+		ret[i] = node.String()
+	}
+	return ret
+}
+
 func parseNodeSelectorWithPrompt(
 	oldSelector klabels.Selector,
 	newSelectorString string,
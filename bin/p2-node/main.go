@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/cordon"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/rc"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/store/consul/rcstore"
+	"github.com/square/p2/pkg/types"
+)
+
+const (
+	CmdCordon   = "cordon"
+	CmdUncordon = "uncordon"
+	CmdDrain    = "drain"
+)
+
+var (
+	cmdCordon  = kingpin.Command(CmdCordon, "Make a node ineligible for new pods from every replication controller and daemon set. Pods already on the node are left alone.")
+	cordonNode = cmdCordon.Arg("node", "The node to cordon").Required().String()
+
+	cmdUncordon  = kingpin.Command(CmdUncordon, "Make a cordoned or draining node eligible for new pods again.")
+	uncordonNode = cmdUncordon.Arg("node", "The node to uncordon").Required().String()
+
+	cmdDrain = kingpin.Command(CmdDrain, `Cordon a node and move its replication controller pods off of it. Replication
+controllers with the dynamic allocation strategy move their pods to other
+nodes through node transfers, which respect min health and disruption
+budgets. Daemon set pods stay on the node, as for a cordoned node. Exits once
+the node holds no replication controller pods.`)
+	drainNode    = cmdDrain.Arg("node", "The node to drain").Required().String()
+	drainTimeout = cmdDrain.Flag("timeout", "How long to wait for the node to be drained. Zero waits forever").Default("0s").Duration()
+	drainPoll    = cmdDrain.Flag("poll-interval", "How often to check the pods remaining on the node").Default("10s").Duration()
+)
+
+func main() {
+	cmd, consulOpts, applicator := flags.ParseWithConsulOptions()
+	client := consul.NewConsulClient(consulOpts)
+	logger := log.New(os.Stderr, "", 0)
+
+	switch cmd {
+	case CmdCordon:
+		err := setState(applicator, types.NodeName(*cordonNode), cordon.Cordoned)
+		if err != nil {
+			logger.Fatalln(err)
+		}
+		fmt.Printf("%s cordoned\n", *cordonNode)
+	case CmdUncordon:
+		err := applicator.RemoveLabel(labels.NODE, *uncordonNode, cordon.StateLabel)
+		if err != nil {
+			logger.Fatalf("could not uncordon %s: %s", *uncordonNode, err)
+		}
+		fmt.Printf("%s uncordoned\n", *uncordonNode)
+	case CmdDrain:
+		node := types.NodeName(*drainNode)
+		err := setState(applicator, node, cordon.Draining)
+		if err != nil {
+			logger.Fatalln(err)
+		}
+		fmt.Printf("%s draining\n", node)
+
+		d := drainer{
+			node:      node,
+			labeler:   applicator,
+			pods:      consul.NewConsulStore(client),
+			rcs:       rcstore.NewConsul(client, applicator, 3),
+			staticRCs: make(map[rc_fields.ID]bool),
+		}
+		err = d.wait(*drainTimeout, *drainPoll)
+		if err != nil {
+			logger.Fatalln(err)
+		}
+		fmt.Printf("%s drained\n", node)
+	}
+}
+
+func setState(applicator labels.ApplicatorWithoutWatches, node types.NodeName, state cordon.State) error {
+	err := applicator.SetLabel(labels.NODE, node.String(), cordon.StateLabel, string(state))
+	if err != nil {
+		return fmt.Errorf("could not mark %s as %s: %s", node, state, err)
+	}
+	return nil
+}
+
+type podLister interface {
+	ListPods(podPrefix consul.PodPrefix, nodename types.NodeName) ([]consul.ManifestResult, time.Duration, error)
+}
+
+type rcGetter interface {
+	Get(id rc_fields.ID) (rc_fields.RC, error)
+}
+
+type drainer struct {
+	node    types.NodeName
+	labeler labels.ApplicatorWithoutWatches
+	pods    podLister
+	rcs     rcGetter
+
+	// staticRCs caches which RCs can't move their pods
+	staticRCs  map[rc_fields.ID]bool
+	lastReport string
+}
+
+// wait polls the node until it holds no replication controller pods, printing
+// the remaining pods whenever they change
+func (d *drainer) wait(timeout time.Duration, pollInterval time.Duration) error {
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		deadline = time.After(timeout)
+	}
+
+	for {
+		remaining, err := d.managedPods()
+		if err != nil {
+			// a transient consul error shouldn't end the drain
+			fmt.Fprintf(os.Stderr, "could not list pods on %s: %s\n", d.node, err)
+		} else if len(remaining) == 0 {
+			return nil
+		} else {
+			d.report(remaining)
+		}
+
+		select {
+		case <-deadline:
+			return fmt.Errorf("%s was not drained within %s", d.node, timeout)
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// managedPods describes each pod on the node that is owned by a replication
+// controller. Daemon set pods aren't moved by a drain, so they aren't waited on
+func (d *drainer) managedPods() ([]string, error) {
+	results, _, err := d.pods.ListPods(consul.INTENT_TREE, d.node)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []string
+	for _, result := range results {
+		podID := result.Manifest.ID()
+		podLabels, err := d.labeler.GetLabels(labels.POD, labels.MakePodLabelKey(d.node, podID))
+		if err != nil {
+			return nil, err
+		}
+
+		if podLabels.Labels.Has(rc.RCIDLabel) {
+			rcID := rc_fields.ID(podLabels.Labels.Get(rc.RCIDLabel))
+			static, err := d.isStatic(rcID)
+			if err != nil {
+				return nil, err
+			}
+			if static {
+				ret = append(ret, fmt.Sprintf("%s (replication controller %s, static strategy: must be moved by hand)", podID, rcID))
+			} else {
+				ret = append(ret, fmt.Sprintf("%s (replication controller %s)", podID, rcID))
+			}
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+func (d *drainer) isStatic(rcID rc_fields.ID) (bool, error) {
+	if static, ok := d.staticRCs[rcID]; ok {
+		return static, nil
+	}
+	rcFields, err := d.rcs.Get(rcID)
+	if err != nil {
+		return false, err
+	}
+	static := rcFields.AllocationStrategy != rc_fields.DynamicStrategy
+	d.staticRCs[rcID] = static
+	return static, nil
+}
+
+func (d *drainer) report(remaining []string) {
+	report := strings.Join(remaining, "\n  ")
+	if report == d.lastReport {
+		return
+	}
+	d.lastReport = report
+	fmt.Printf("%s: %d replication controller pods remaining:\n  %s\n", time.Now().Format(time.RFC3339), len(remaining), report)
+}
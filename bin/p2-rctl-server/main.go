@@ -4,6 +4,7 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 	"time"
 
@@ -16,20 +17,29 @@ import (
 
 	"github.com/square/p2/pkg/alerting"
 	"github.com/square/p2/pkg/artifact"
+	"github.com/square/p2/pkg/autoscale"
+	"github.com/square/p2/pkg/budget"
+	"github.com/square/p2/pkg/farmstatus"
 	"github.com/square/p2/pkg/health/checker"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/osversion"
 	"github.com/square/p2/pkg/rc"
 	"github.com/square/p2/pkg/roll"
 	"github.com/square/p2/pkg/scheduler"
+	"github.com/square/p2/pkg/shard"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/auditlogstore"
+	"github.com/square/p2/pkg/store/consul/autoscalestore"
+	"github.com/square/p2/pkg/store/consul/budgetstore"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/store/consul/freezestore"
 	"github.com/square/p2/pkg/store/consul/rcstore"
 	"github.com/square/p2/pkg/store/consul/rollstore"
+	"github.com/square/p2/pkg/store/consul/shardstore"
 	"github.com/square/p2/pkg/store/consul/statusstore"
 	"github.com/square/p2/pkg/store/consul/statusstore/rcstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/rollstatus"
 	"github.com/square/p2/pkg/uri"
 	"github.com/square/p2/pkg/util/stream"
 	"github.com/square/p2/pkg/version"
@@ -39,6 +49,10 @@ import (
 var (
 	logLevel            = kingpin.Flag("log", "Logging level to display").String()
 	pagerdutyServiceKey = kingpin.Flag("pagerduty-service-key", "Pagerduty Service Key to use for alerting if provided").String()
+	autoscaleInterval   = kingpin.Flag("autoscale-interval", "How often autoscalers read their metrics and scale their replication controllers").Default("1m").Duration()
+	farmStatusPort      = kingpin.Flag("farm-status-port", "If set, serve the RCs and rolling updates this server holds locks for on this port at /farms").Int()
+	binPacking          = kingpin.Flag("bin-packing", "Schedule pods on nodes according to their capacity labels, letting higher priority replication controllers preempt lower priority ones when nodes are full").Bool()
+	shardFarms          = kingpin.Flag("shard", "Split replication controllers and rolling updates with the other servers passing this flag instead of competing for all of them").Bool()
 )
 
 // RetryCount defines the number of retries to attempt when accessing some storage
@@ -84,7 +98,12 @@ func main() {
 	rollStore := rollstore.NewConsul(client, labeler, nil)
 	healthChecker := checker.NewHealthChecker(client)
 	shadowTrafficHealthChecker := checker.NewShadowTrafficHealthChecker(nil, nil, client, nil, nil, false, false)
-	sched := scheduler.NewApplicatorScheduler(labeler)
+	var sched rc.Scheduler = scheduler.NewApplicatorScheduler(labeler)
+	if *binPacking {
+		sched = scheduler.NewBinPackingScheduler(labeler, consulStore)
+	}
+	freezeStore := freezestore.NewConsul(client)
+	disruption := budget.NewChecker(budgetstore.NewConsul(client), labeler, healthChecker)
 
 	// Start acquiring sessions
 	sessions := make(chan string)
@@ -115,8 +134,17 @@ func main() {
 	// Only works for local files
 	artifactRegistry := artifact.NewRegistry(nil, fetcher, osversion.DefaultDetector)
 
+	// The interface must stay nil when not sharding, rather than holding a
+	// nil *shard.RingSharder
+	var sharder shard.Sharder
+	if *shardFarms {
+		s := shard.NewRingSharder(shardstore.NewConsul(client), "p2-rctl-server", SessionName(), pub.Subscribe().Chan(), logger)
+		go s.Start(nil)
+		sharder = s
+	}
+
 	// Run the farms!
-	go rc.NewFarm(
+	rcFarm := rc.NewFarm(
 		consulStore,
 		client,
 		rcStatusStore,
@@ -135,23 +163,64 @@ func main() {
 		1*time.Second,
 		artifactRegistry,
 		nil,
+		freezeStore,
+		disruption,
+		sharder,
+	)
+	go rcFarm.Start(nil)
+
+	// Metric endpoints shouldn't hold up the other autoscalers for long
+	metricClient := cleanhttp.DefaultClient()
+	metricClient.Timeout = 10 * time.Second
+	go autoscale.NewFarm(
+		autoscalestore.NewConsul(client),
+		rcStore,
+		rcStore,
+		consulStore,
+		labeler,
+		healthChecker,
+		metricClient,
+		auditLogStore,
+		client.KV(),
+		pub.Subscribe().Chan(),
+		*autoscaleInterval,
+		logger,
 	).Start(nil)
-	roll.NewFarm(
+	rollFarm := roll.NewFarm(
 		roll.UpdateFactory{
-			Store:         consulStore,
-			RCStore:       rcStore,
-			HealthChecker: shadowTrafficHealthChecker,
-			Labeler:       labeler,
+			Store:           consulStore,
+			RCStore:         rcStore,
+			RollStore:       rollStore,
+			RollStatusStore: rollstatus.NewConsul(statusStoreClient, consul.RollStatusNamespace),
+			HealthChecker:   shadowTrafficHealthChecker,
+			Labeler:         labeler,
+			NodeLabeler:     labeler,
+			Scheduler:       sched,
+			FreezeStore:     freezeStore,
 		},
 		consulStore,
 		rollStore,
 		rcStore,
+		freezeStore,
 		pub.Subscribe().Chan(),
 		logger,
 		labeler,
 		klabels.Everything(),
 		client.KV(),
-		roll.FarmConfig{},
+		roll.FarmConfig{Sharder: sharder},
 		alerter,
-	).Start(nil)
+	)
+
+	if *farmStatusPort != 0 {
+		handler := farmstatus.NewHandler(map[string]farmstatus.Farm{
+			"rc": rcFarm,
+			"ru": rollFarm,
+		})
+		go func() {
+			err := http.ListenAndServe(fmt.Sprintf(":%d", *farmStatusPort), handler)
+			logger.WithError(err).Errorln("Farm status server exited")
+		}()
+	}
+
+	rollFarm.Start(nil)
 }
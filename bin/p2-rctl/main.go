@@ -7,7 +7,11 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"os/user"
+	"strconv"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -17,7 +21,12 @@ import (
 	klabels "k8s.io/kubernetes/pkg/labels"
 
 	"github.com/square/p2/pkg/alerting"
+	"github.com/square/p2/pkg/audit"
+	autoscale_fields "github.com/square/p2/pkg/autoscale/fields"
+	"github.com/square/p2/pkg/budget"
+	budget_fields "github.com/square/p2/pkg/budget/fields"
 	"github.com/square/p2/pkg/cli"
+	freeze_fields "github.com/square/p2/pkg/freeze/fields"
 	"github.com/square/p2/pkg/health/checker"
 	hclient "github.com/square/p2/pkg/health/client"
 	"github.com/square/p2/pkg/labels"
@@ -29,32 +38,57 @@ import (
 	rc_fields "github.com/square/p2/pkg/rc/fields"
 	"github.com/square/p2/pkg/roll"
 	roll_fields "github.com/square/p2/pkg/roll/fields"
+	"github.com/square/p2/pkg/scheduler"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/auditlogstore"
+	"github.com/square/p2/pkg/store/consul/autoscalestore"
+	"github.com/square/p2/pkg/store/consul/budgetstore"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/store/consul/freezestore"
 	"github.com/square/p2/pkg/store/consul/rcstore"
 	"github.com/square/p2/pkg/store/consul/rollstore"
 	"github.com/square/p2/pkg/store/consul/statusstore"
 	"github.com/square/p2/pkg/store/consul/statusstore/rcstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/rollstatus"
 	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/version"
 )
 
 const (
-	cmdCreateText         = "create"
-	cmdDeleteText         = "delete"
-	cmdReplicasText       = "set-replicas"
-	cmdListText           = "list"
-	cmdGetText            = "get"
-	cmdGetStatusText      = "get-status"
-	cmdEnableText         = "enable"
-	cmdDisableText        = "disable"
-	cmdRollText           = "rolling-update"
-	cmdDeleteRollText     = "delete-rolling-update"
-	cmdSchedupText        = "schedule-update"
-	cmdUpdateManifestText = "update-manifest"
-	cmdUpdateStrategyText = "update-strategy"
+	cmdCreateText           = "create"
+	cmdDeleteText           = "delete"
+	cmdReplicasText         = "set-replicas"
+	cmdListText             = "list"
+	cmdGetText              = "get"
+	cmdGetStatusText        = "get-status"
+	cmdEnableText           = "enable"
+	cmdDisableText          = "disable"
+	cmdRollText             = "rolling-update"
+	cmdDeleteRollText       = "delete-rolling-update"
+	cmdSchedupText          = "schedule-update"
+	cmdUpdateManifestText   = "update-manifest"
+	cmdUpdateStrategyText   = "update-strategy"
+	cmdUpdateSpreadText     = "update-spread"
+	cmdUpdatePriorityText   = "update-priority"
+	cmdPromoteText          = "promote"
+	cmdPauseRollText        = "pause-roll"
+	cmdResumeRollText       = "resume-roll"
+	cmdRollStatusText       = "roll-status"
+	cmdCreateFreezeText     = "create-freeze"
+	cmdListFreezesText      = "list-freezes"
+	cmdDeleteFreezeText     = "delete-freeze"
+	cmdOverrideFreezeText   = "override-freeze"
+	cmdCreateBudgetText     = "create-budget"
+	cmdListBudgetsText      = "list-budgets"
+	cmdDeleteBudgetText     = "delete-budget"
+	cmdCreateAutoscalerText = "create-autoscaler"
+	cmdListAutoscalersText  = "list-autoscalers"
+	cmdDeleteAutoscalerText = "delete-autoscaler"
+	cmdHistoryText          = "history"
+	cmdRollbackText         = "rollback"
+	cmdPlanText             = "plan"
 )
 
 var (
@@ -104,11 +138,90 @@ var (
 	cmdDeleteRoll = kingpin.Command(cmdDeleteRollText, "Delete a rolling update.")
 	deleteRollID  = cmdDeleteRoll.Flag("id", "rolling update uuid").Required().Short('i').String()
 
-	cmdSchedup   = kingpin.Command(cmdSchedupText, "Schedule new rolling update (will be run by farm)")
-	schedupOldID = cmdSchedup.Flag("old", "old replication controller uuid").Required().Short('o').String()
-	schedupNewID = cmdSchedup.Flag("new", "new replication controller uuid").Required().Short('n').String()
-	schedupWant  = cmdSchedup.Flag("desired", "number of replicas desired").Required().Short('d').Int()
-	schedupNeed  = cmdSchedup.Flag("minimum", "minimum number of healthy replicas during update").Required().Short('m').Int()
+	cmdSchedup    = kingpin.Command(cmdSchedupText, "Schedule new rolling update (will be run by farm)")
+	schedupOldID  = cmdSchedup.Flag("old", "old replication controller uuid").Required().Short('o').String()
+	schedupNewID  = cmdSchedup.Flag("new", "new replication controller uuid").Required().Short('n').String()
+	schedupWant   = cmdSchedup.Flag("desired", "number of replicas desired").Required().Short('d').Int()
+	schedupNeed   = cmdSchedup.Flag("minimum", "minimum number of healthy replicas during update. Required unless --max-unavailable is given").Default("-1").Short('m').Int()
+	schedupStages = cmdSchedup.Flag("stages", "comma-separated list of canary stages, as replica counts or percentages of desired replicas (e.g. 1,10%,50%). The update pauses at each stage until promoted").String()
+
+	schedupMaxUnavailable = cmdSchedup.Flag("max-unavailable", "maximum number of desired replicas that may be unhealthy during the update, as a count or a percentage of desired replicas (e.g. 2 or 25%). Combined with --minimum, whichever keeps more replicas healthy wins").String()
+	schedupMaxSurge       = cmdSchedup.Flag("max-surge", "number of replicas the update may schedule beyond desired replicas while it runs, as a count or a percentage of desired replicas (e.g. 1 or 25%)").String()
+	schedupBlueGreen      = cmdSchedup.Flag("blue-green", "bring up all desired replicas of the new RC on nodes the old RC isn't using, and scale the old RC to zero only once every new node is healthy").Bool()
+	schedupTopologyKey    = cmdSchedup.Flag("topology-key", "node label key (e.g. availability_zone) whose values are failure domains. The new RC only schedules into one domain at a time and the update pauses between domains until resumed. Old RC removals are not confined to the domain").String()
+	schedupOverrideFreeze = cmdSchedup.Flag("override-freeze", "schedule the update even if a deploy freeze window covers the new RC. The given reason is recorded in the audit log").String()
+	schedupDryRun         = cmdSchedup.Flag("dry-run", "print the steps the update would take given the RCs' current health, and whether it would block on the minimum, without scheduling it").Bool()
+
+	schedupRollbackIfCritical  = cmdSchedup.Flag("rollback-if-critical", "roll the update back once more than this many new nodes have been critical for --rollback-critical-for. Negative disables automatic rollback").Default("-1").Int()
+	schedupRollbackCriticalFor = cmdSchedup.Flag("rollback-critical-for", "how long a new node must stay critical before it counts toward --rollback-if-critical").Default("5m").Duration()
+
+	cmdPromote = kingpin.Command(cmdPromoteText, "Promote a staged rolling update past the stage it is paused at")
+	promoteID  = cmdPromote.Arg("id", "rolling update uuid to promote").Required().String()
+
+	cmdPauseRoll = kingpin.Command(cmdPauseRollText, "Pause an in-flight rolling update without deleting it")
+	pauseRollID  = cmdPauseRoll.Arg("id", "rolling update uuid to pause").Required().String()
+
+	cmdResumeRoll = kingpin.Command(cmdResumeRollText, "Resume a paused rolling update")
+	resumeRollID  = cmdResumeRoll.Arg("id", "rolling update uuid to resume").Required().String()
+
+	cmdRollStatus   = kingpin.Command(cmdRollStatusText, "Show the progress of a rolling update")
+	rollStatusID    = cmdRollStatus.Arg("id", "rolling update uuid whose progress should be shown").Required().String()
+	rollStatusWatch = cmdRollStatus.Flag("watch", "keep printing the progress as it changes until the update finishes").Short('w').Bool()
+
+	cmdHistory = kingpin.Command(cmdHistoryText, "List the prior manifests of a replication controller")
+	historyID  = cmdHistory.Arg("id", "replication controller uuid whose history should be listed").Required().String()
+
+	cmdRollback      = kingpin.Command(cmdRollbackText, "Schedule a rolling update from a replication controller to a new one running a manifest from its history. Like any rolling update, it will not start during a deploy freeze")
+	rollbackID       = cmdRollback.Arg("id", "replication controller uuid to roll back").Required().String()
+	rollbackRevision = cmdRollback.Flag("revision", "number of the revision to roll back to, as listed by history").Required().Int()
+	rollbackNeed     = cmdRollback.Flag("minimum", "minimum number of healthy replicas during the rollback").Required().Short('m').Int()
+
+	cmdPlan        = kingpin.Command(cmdPlanText, "Show what a replication controller would do right now: the pods it would add and remove and the node transfers it would attempt. Nothing is changed")
+	planID         = cmdPlan.Arg("id", "replication controller uuid to plan").Required().String()
+	planBinPacking = cmdPlan.Flag("bin-packing", "plan with the bin-packing scheduler, as p2-rctl-server --bin-packing does, which preempts pods of lower priority replication controllers when nodes are full").Bool()
+
+	cmdCreateFreeze      = kingpin.Command(cmdCreateFreezeText, "Create a deploy freeze window. While it is active, matching RCs will not add pods or change manifests and rolling updates to them will not start")
+	createFreezeStart    = cmdCreateFreeze.Flag("start", "when the freeze starts, in RFC3339 format (e.g. 2006-01-02T15:04:05Z). Defaults to now").String()
+	createFreezeEnd      = cmdCreateFreeze.Flag("end", "when the freeze ends, in RFC3339 format (e.g. 2006-01-02T15:04:05Z)").Required().String()
+	createFreezePodID    = cmdCreateFreeze.Flag("pod", "only freeze RCs of this pod ID").String()
+	createFreezeSelector = cmdCreateFreeze.Flag("selector", "only freeze RCs whose labels match this selector").String()
+	createFreezeReason   = cmdCreateFreeze.Flag("reason", "why deploys are frozen").Required().String()
+
+	cmdListFreezes = kingpin.Command(cmdListFreezesText, "List deploy freeze windows that haven't ended")
+	listFreezesAll = cmdListFreezes.Flag("all", "include freeze windows that have ended").Bool()
+
+	cmdDeleteFreeze = kingpin.Command(cmdDeleteFreezeText, "Delete a deploy freeze window")
+	deleteFreezeID  = cmdDeleteFreeze.Arg("id", "freeze window id to delete").Required().String()
+
+	cmdOverrideFreeze    = kingpin.Command(cmdOverrideFreezeText, "Allow a replication controller to change during every active deploy freeze window that covers it, recording the override in the audit log")
+	overrideFreezeRCID   = cmdOverrideFreeze.Arg("id", "replication controller uuid to allow to change").Required().String()
+	overrideFreezeReason = cmdOverrideFreeze.Flag("reason", "why the freeze is being overridden").Required().String()
+
+	cmdCreateBudget            = kingpin.Command(cmdCreateBudgetText, "Create a disruption budget. Node transfers, replica decreases, p2-rm and p2-shutdown will not take down the pods it covers if doing so would break it")
+	createBudgetPodID          = cmdCreateBudget.Flag("pod", "only cover pods with this pod ID").String()
+	createBudgetSelector       = cmdCreateBudget.Flag("selector", "only cover pods whose pod labels match this selector").String()
+	createBudgetMinAvailable   = cmdCreateBudget.Flag("min-available", "the number of covered pods that must stay healthy").Int()
+	createBudgetMaxUnavailable = cmdCreateBudget.Flag("max-unavailable", "the number of covered pods that may be unhealthy or disrupted at once").Int()
+
+	cmdListBudgets = kingpin.Command(cmdListBudgetsText, "List disruption budgets")
+
+	cmdDeleteBudget = kingpin.Command(cmdDeleteBudgetText, "Delete a disruption budget")
+	deleteBudgetID  = cmdDeleteBudget.Arg("id", "disruption budget id to delete").Required().String()
+
+	cmdCreateAutoscaler               = kingpin.Command(cmdCreateAutoscalerText, "Create an autoscaler that sets the replicas desired of an RC to keep a metric close to a target. Autoscalers are run by p2-rctl-server")
+	createAutoscalerRCID              = cmdCreateAutoscaler.Arg("id", "replication controller uuid to scale").Required().String()
+	createAutoscalerMin               = cmdCreateAutoscaler.Flag("min", "the fewest replicas to scale to").Required().Int()
+	createAutoscalerMax               = cmdCreateAutoscaler.Flag("max", "the most replicas to scale to").Required().Int()
+	createAutoscalerMetric            = cmdCreateAutoscaler.Flag("metric", "the metric to scale on: \"health\" for the fraction of healthy pods, or \"http\" for a per-replica value read from --metric-url").Required().Enum(string(autoscale_fields.HealthMetric), string(autoscale_fields.HTTPMetric))
+	createAutoscalerMetricURL         = cmdCreateAutoscaler.Flag("metric-url", "for the http metric, an endpoint responding with JSON of the form {\"value\": 1.5}").String()
+	createAutoscalerTarget            = cmdCreateAutoscaler.Flag("target", "the value of the metric to keep the RC at").Required().Float64()
+	createAutoscalerScaleUpCooldown   = cmdCreateAutoscaler.Flag("scale-up-cooldown", "how long to wait after scaling before adding replicas").Default("3m").Duration()
+	createAutoscalerScaleDownCooldown = cmdCreateAutoscaler.Flag("scale-down-cooldown", "how long to wait after scaling before removing replicas").Default("5m").Duration()
+
+	cmdListAutoscalers = kingpin.Command(cmdListAutoscalersText, "List autoscalers")
+
+	cmdDeleteAutoscaler = kingpin.Command(cmdDeleteAutoscalerText, "Delete an autoscaler. The replicas desired of its RC are left as they are")
+	deleteAutoscalerID  = cmdDeleteAutoscaler.Arg("id", "autoscaler id to delete").Required().String()
 
 	cmdUpdateManifest  = kingpin.Command(cmdUpdateManifestText, "DANGEROUS. Forcefully update the manifest for the given RC. Consider disabling the RC before invoking this command.")
 	updateManifestRCID = cmdUpdateManifest.Arg("id", "replication controller uuid to update").Required().String()
@@ -117,6 +230,15 @@ var (
 	cmdUpdateStrategy  = kingpin.Command(cmdUpdateStrategyText, "Forcefully update the allocation strategy in the manifest.")
 	updateStrategyRCID = cmdUpdateStrategy.Flag("id", "replication controller uuid to update").Required().String()
 	updateStrategy     = cmdUpdateStrategy.Flag("strategy", "allocation strategy to use for the replication controller").Required().String()
+
+	cmdUpdateSpread         = kingpin.Command(cmdUpdateSpreadText, "Replace the spread constraints of a replication controller. Passing no constraints removes them.")
+	updateSpreadRCID        = cmdUpdateSpread.Flag("id", "replication controller uuid to update").Required().String()
+	updateSpreadMaxSkew     = cmdUpdateSpread.Flag("max-skew", "a node label and the largest allowed difference in pod counts between its values, in LABEL=N form. Can be specified multiple times.").StringMap()
+	updateSpreadOnePerValue = cmdUpdateSpread.Flag("one-per-value", "a node label that may have at most one pod per value. Can be specified multiple times.").Strings()
+
+	cmdUpdatePriority  = kingpin.Command(cmdUpdatePriorityText, "Set the priority of a replication controller. When it cannot find room for a pod, it may evict pods of replication controllers with a lower priority.")
+	updatePriorityRCID = cmdUpdatePriority.Flag("id", "replication controller uuid to update").Required().String()
+	updatePriority     = cmdUpdatePriority.Flag("priority", "the priority to set, replication controllers default to 0").Required().Int()
 )
 
 func main() {
@@ -148,6 +270,7 @@ func main() {
 
 	rcStore := rcstore.NewConsul(client, labeler, 3)
 	rcStatusStore := rcstatus.NewConsul(statusstore.NewConsul(client), consul.RCStatusNamespace)
+	rollStatusStore := rollstatus.NewConsul(statusstore.NewConsul(client), consul.RollStatusNamespace)
 
 	// The roll labeler CANT be an http applicator because it uses consul
 	// transactions, so this might be different from labeler returned by
@@ -165,9 +288,15 @@ func main() {
 		rollRCStatusStore: rcStatusStore,
 		rcLocker:          rcStore,
 		rls:               rollstore.NewConsul(client, rollLabeler, nil),
+		rollStatusStore:   rollStatusStore,
 		consuls:           consul.NewConsulStore(client),
 		labeler:           labeler,
 		hcheck:            checker.NewShadowTrafficHealthChecker(nil, nil, client, nil, nil, false, false),
+		healthChecker:     checker.NewHealthChecker(client),
+		freezeStore:       freezestore.NewConsul(client),
+		auditLogStore:     auditlogstore.NewConsulStore(client.KV()),
+		budgetStore:       budgetstore.NewConsul(client),
+		autoscalerStore:   autoscalestore.NewConsul(client),
 		hclient:           nil,
 		logger:            logger,
 	}
@@ -200,14 +329,84 @@ func main() {
 	case cmdRollText:
 		rctl.RollingUpdate(*rollOldID, *rollNewID, *rollWant, *rollNeed)
 	case cmdSchedupText:
-		rctl.ScheduleUpdate(*schedupOldID, *schedupNewID, *schedupWant, *schedupNeed, client.KV())
+		var rollbackPolicy *roll_fields.RollbackPolicy
+		if *schedupRollbackIfCritical >= 0 {
+			rollbackPolicy = &roll_fields.RollbackPolicy{
+				MaxCriticalNodes: *schedupRollbackIfCritical,
+				CriticalDuration: *schedupRollbackCriticalFor,
+			}
+		}
+		rctl.ScheduleUpdate(*schedupOldID, *schedupNewID, *schedupWant, *schedupNeed, scheduleUpdateOptions{
+			stages:         *schedupStages,
+			maxUnavailable: *schedupMaxUnavailable,
+			maxSurge:       *schedupMaxSurge,
+			topologyKey:    *schedupTopologyKey,
+			blueGreen:      *schedupBlueGreen,
+			rollbackPolicy: rollbackPolicy,
+			overrideFreeze: *schedupOverrideFreeze,
+			dryRun:         *schedupDryRun,
+		}, client.KV())
+	case cmdPromoteText:
+		rctl.Promote(*promoteID)
+	case cmdPauseRollText:
+		rctl.SetRollPaused(*pauseRollID, true)
+	case cmdResumeRollText:
+		rctl.SetRollPaused(*resumeRollID, false)
+	case cmdRollStatusText:
+		rctl.RollStatus(*rollStatusID, *rollStatusWatch)
 	case cmdDeleteRollText:
 		rctl.DeleteRollingUpdate(*deleteRollID, client.KV())
 	case cmdUpdateManifestText:
 		rctl.UpdateManifest(fields.ID(*updateManifestRCID), *updateManifestPath)
 	case cmdUpdateStrategyText:
 		rctl.UpdateStrategy(fields.ID(*updateStrategyRCID), fields.Strategy(*updateStrategy))
+	case cmdUpdateSpreadText:
+		rctl.UpdateSpread(fields.ID(*updateSpreadRCID), *updateSpreadMaxSkew, *updateSpreadOnePerValue)
+	case cmdUpdatePriorityText:
+		rctl.UpdatePriority(fields.ID(*updatePriorityRCID), *updatePriority)
+	case cmdCreateFreezeText:
+		rctl.CreateFreeze(*createFreezeStart, *createFreezeEnd, types.PodID(*createFreezePodID), *createFreezeSelector, *createFreezeReason)
+	case cmdListFreezesText:
+		rctl.ListFreezes(*listFreezesAll)
+	case cmdDeleteFreezeText:
+		rctl.DeleteFreeze(freeze_fields.ID(*deleteFreezeID))
+	case cmdOverrideFreezeText:
+		rctl.OverrideFreeze(fields.ID(*overrideFreezeRCID), *overrideFreezeReason, client.KV())
+	case cmdHistoryText:
+		rctl.History(fields.ID(*historyID))
+	case cmdRollbackText:
+		rctl.Rollback(fields.ID(*rollbackID), *rollbackRevision, *rollbackNeed, client.KV())
+	case cmdPlanText:
+		rctl.Plan(fields.ID(*planID), *planBinPacking)
+	case cmdCreateBudgetText:
+		rctl.CreateBudget(types.PodID(*createBudgetPodID), *createBudgetSelector, *createBudgetMinAvailable, *createBudgetMaxUnavailable)
+	case cmdListBudgetsText:
+		rctl.ListBudgets()
+	case cmdDeleteBudgetText:
+		rctl.DeleteBudget(budget_fields.ID(*deleteBudgetID))
+	case cmdCreateAutoscalerText:
+		rctl.CreateAutoscaler(autoscale_fields.Autoscaler{
+			RCID:              fields.ID(*createAutoscalerRCID),
+			MinReplicas:       *createAutoscalerMin,
+			MaxReplicas:       *createAutoscalerMax,
+			Metric:            autoscale_fields.Metric{Type: autoscale_fields.MetricType(*createAutoscalerMetric), URL: *createAutoscalerMetricURL},
+			TargetValue:       *createAutoscalerTarget,
+			ScaleUpCooldown:   *createAutoscalerScaleUpCooldown,
+			ScaleDownCooldown: *createAutoscalerScaleDownCooldown,
+		})
+	case cmdListAutoscalersText:
+		rctl.ListAutoscalers()
+	case cmdDeleteAutoscalerText:
+		rctl.DeleteAutoscaler(autoscale_fields.ID(*deleteAutoscalerID))
+	}
+}
+
+func currentUsername() string {
+	currentUser, err := user.Current()
+	if err != nil {
+		return "unknown"
 	}
+	return currentUser.Username
 }
 
 // SessionName returns a node identifier for use when creating Consul sessions.
@@ -242,13 +441,48 @@ type ReplicationControllerStore interface {
 	Disable(id fields.ID) error
 	Delete(id fields.ID, force bool) error
 	Get(id fields.ID) (fields.RC, error)
-	UpdateManifest(id fields.ID, man manifest.Manifest) error
+	UpdateManifest(id fields.ID, man manifest.Manifest, user string) error
+	History(id fields.ID) (fields.History, error)
 	UpdateStrategy(id fields.ID, strategy fields.Strategy) error
+	UpdateSpreadConstraints(id fields.ID, constraints []fields.SpreadConstraint) error
+	UpdatePriority(id fields.ID, priority int) error
 }
 
 type RollingUpdateStore interface {
+	Get(id roll_fields.ID) (roll_fields.Update, error)
+	Promote(id roll_fields.ID) (roll_fields.Update, error)
+	SetPaused(id roll_fields.ID, paused bool) (roll_fields.Update, error)
+	SetTopology(id roll_fields.ID, topology roll_fields.Topology, pause bool) (roll_fields.Update, error)
+	SetBlueGreen(id roll_fields.ID, blueGreen roll_fields.BlueGreen) (roll_fields.Update, error)
 	Delete(ctx context.Context, id roll_fields.ID) error
 	CreateRollingUpdateFromExistingRCs(ctx context.Context, u roll_fields.Update, newRCLabels klabels.Set, rollLabels klabels.Set) (roll_fields.Update, error)
+	CreateRollingUpdateFromOneExistingRCWithID(
+		ctx context.Context,
+		oldRCID rc_fields.ID,
+		desiredReplicas int,
+		minimumReplicas int,
+		leaveOld bool,
+		rollDelay time.Duration,
+		availabilityZone pc_fields.AvailabilityZone,
+		clusterName pc_fields.ClusterName,
+		newRCManifest manifest.Manifest,
+		newRCNodeSelector klabels.Selector,
+		newRCPodLabels klabels.Set,
+		newRCLabels klabels.Set,
+		rollLabels klabels.Set,
+		newAllocationStrategy rc_fields.Strategy,
+	) (roll_fields.Update, error)
+	CreateRollingUpdateFromRCTemplateWithID(
+		ctx context.Context,
+		oldRCID rc_fields.ID,
+		desiredReplicas int,
+		minimumReplicas int,
+		leaveOld bool,
+		rollDelay time.Duration,
+		newRCTemplate rc_fields.RC,
+		newRCLabels klabels.Set,
+		rollLabels klabels.Set,
+	) (roll_fields.Update, error)
 	Watch(quit <-chan struct{}, jitterWindow time.Duration) (<-chan []roll_fields.Update, <-chan error)
 }
 
@@ -256,6 +490,34 @@ type RCStatusStore interface {
 	Get(rcID rc_fields.ID) (rcstatus.Status, *api.QueryMeta, error)
 }
 
+type RollStatusStore interface {
+	roll.RollStatusStore
+	Watch(id roll_fields.ID, waitIndex uint64) (rollstatus.Status, *api.QueryMeta, error)
+}
+
+type FreezeStore interface {
+	roll.FreezeStore
+	Create(window freeze_fields.Window) (freeze_fields.Window, error)
+	Delete(id freeze_fields.ID) error
+	OverrideTxn(ctx context.Context, id freeze_fields.ID, rcID rc_fields.ID) error
+}
+
+type BudgetStore interface {
+	Create(budget budget_fields.Budget) (budget_fields.Budget, error)
+	List() ([]budget_fields.Budget, error)
+	Delete(id budget_fields.ID) error
+}
+
+type AutoscalerStore interface {
+	Create(autoscaler autoscale_fields.Autoscaler) (autoscale_fields.Autoscaler, error)
+	List() ([]autoscale_fields.Autoscaler, error)
+	Delete(id autoscale_fields.ID) error
+}
+
+type AuditLogStore interface {
+	Create(ctx context.Context, eventType audit.EventType, eventDetails json.RawMessage) error
+}
+
 // rctl is a struct for the data structures shared between commands
 // each member function represents a single command that takes over from main
 // and terminates the program on failure
@@ -269,9 +531,15 @@ type rctlParams struct {
 	rcLocker          roll.ReplicationControllerLocker
 	rcWatcher         rc.ReplicationControllerWatcher
 	rls               RollingUpdateStore
+	rollStatusStore   RollStatusStore
 	labeler           labels.ApplicatorWithoutWatches
 	consuls           Store
 	hcheck            checker.ShadowTrafficHealthChecker
+	healthChecker     checker.HealthChecker
+	freezeStore       FreezeStore
+	auditLogStore     AuditLogStore
+	budgetStore       BudgetStore
+	autoscalerStore   AutoscalerStore
 	hclient           hclient.HealthServiceClient
 	logger            logging.Logger
 }
@@ -404,6 +672,54 @@ func (r rctlParams) GetStatus(id string) {
 	fmt.Printf("%s\n", out)
 }
 
+func (r rctlParams) RollStatus(id string, watch bool) {
+	status, queryMeta, err := r.rollStatusStore.Get(roll_fields.ID(id))
+	for {
+		switch {
+		case statusstore.IsNoStatus(err):
+			fmt.Printf("no status found for rolling update %s, it may not have started or may have finished\n", id)
+			return
+		case err != nil:
+			r.logger.WithError(err).Fatalln("could not fetch rolling update status")
+		}
+
+		printRollStatus(status)
+		if !watch {
+			return
+		}
+
+		status, queryMeta, err = r.rollStatusStore.Watch(roll_fields.ID(id), queryMeta.LastIndex)
+		fmt.Println()
+	}
+}
+
+func printRollStatus(status rollstatus.Status) {
+	now := time.Now()
+	fmt.Printf("Phase:     %s\n", status.Phase)
+	fmt.Printf("Started:   %s (%s ago)\n", status.StartTime.Format(time.RFC3339), now.Sub(status.StartTime).Truncate(time.Second))
+	if status.BlockedReason != "" {
+		fmt.Printf("Blocked:   %s", status.BlockedReason)
+		if status.BlockedSince != nil {
+			fmt.Printf(" (for %s)", now.Sub(*status.BlockedSince).Truncate(time.Second))
+		}
+		fmt.Println()
+	}
+	fmt.Printf("Last step: adding %d new nodes, removing %d old nodes\n", status.LastStep.NodesToAdd, status.LastStep.NodesToRemove)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "RC\tDESIRED\tCURRENT\tREAL\tHEALTHY\tUNHEALTHY\tUNKNOWN")
+	for _, rc := range []struct {
+		name   string
+		counts rollstatus.NodeCounts
+	}{
+		{"old", status.OldRC},
+		{"new", status.NewRC},
+	} {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\n", rc.name, rc.counts.Desired, rc.counts.Current, rc.counts.Real, rc.counts.Healthy, rc.counts.Unhealthy, rc.counts.Unknown)
+	}
+	w.Flush()
+}
+
 func (r rctlParams) Enable(id string) {
 	err := r.rcs.Enable(rc_fields.ID(id))
 	if err != nil {
@@ -462,15 +778,19 @@ func (r rctlParams) RollingUpdate(oldID, newID string, want, need int) {
 			r.rollRCStore,
 			r.rollRCStatusStore,
 			r.rls,
+			r.rollStatusStore,
 			r.baseClient.KV(),
 			r.hcheck,
 			r.hclient,
 			r.labeler,
+			r.labeler,
+			nil, // blue/green updates aren't supported outside the farm
+			r.freezeStore,
 			r.logger,
 			session,
 			watchDelay,
 			alerting.NewNop(),
-			false, // no audit logging
+			false,                       // no audit logging
 			auditlogstore.ConsulStore{}, // no audit logging
 		).Run(ctx)
 		close(result)
@@ -502,17 +822,101 @@ LOOP:
 	}
 }
 
-func (r rctlParams) ScheduleUpdate(oldID, newID string, want, need int, txner transaction.Txner) {
+// scheduleUpdateOptions holds the optional settings of a scheduled rolling
+// update, as passed on the command line
+type scheduleUpdateOptions struct {
+	stages         string
+	maxUnavailable string
+	maxSurge       string
+	topologyKey    string
+	blueGreen      bool
+	rollbackPolicy *roll_fields.RollbackPolicy
+	overrideFreeze string
+	dryRun         bool
+}
+
+func (r rctlParams) ScheduleUpdate(oldID, newID string, want, need int, opts scheduleUpdateOptions, txner transaction.Txner) {
+	if need < 0 {
+		if opts.maxUnavailable == "" {
+			r.logger.NoFields().Fatalln("--minimum is required unless --max-unavailable is given")
+		}
+		need = 0
+	}
+
+	parsedStages, err := roll_fields.ParseStages(opts.stages)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not parse stages")
+	}
+
+	maxUnavailable, err := roll_fields.ParseIntOrPercent(opts.maxUnavailable)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not parse max unavailable")
+	}
+
+	maxSurge, err := roll_fields.ParseIntOrPercent(opts.maxSurge)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not parse max surge")
+	}
+
+	u := roll_fields.Update{
+		OldRC:           rc_fields.ID(oldID),
+		NewRC:           rc_fields.ID(newID),
+		DesiredReplicas: want,
+		MinimumReplicas: need,
+		MaxUnavailable:  maxUnavailable,
+		MaxSurge:        maxSurge,
+		Stages:          parsedStages,
+		RollbackPolicy:  opts.rollbackPolicy,
+	}
+	if opts.topologyKey != "" {
+		u.Topology = &roll_fields.Topology{Key: opts.topologyKey}
+	}
+	if opts.blueGreen {
+		if len(u.Stages) > 0 || u.Topology != nil || u.MaxSurge != "" || u.RollbackPolicy != nil {
+			r.logger.NoFields().Fatalln("--blue-green cannot be combined with --stages, --topology-key, --max-surge or --rollback-if-critical")
+		}
+		u.BlueGreen = &roll_fields.BlueGreen{}
+	}
+
+	if u.MaxUnavailable != "" {
+		minimum, _ := u.MinimumHealthy()
+		surge, _ := u.SurgeReplicas()
+		if minimum >= want && surge == 0 {
+			r.logger.WithFields(logrus.Fields{
+				"desired":         want,
+				"minimum":         minimum,
+				"max_surge":       surge,
+				"max_unavailable": opts.maxUnavailable,
+			}).Fatalln("The update would never make progress, --max-unavailable or --max-surge must allow at least one replica")
+		}
+	}
+
+	if opts.dryRun {
+		r.simulateUpdate(u)
+		return
+	}
+
 	ctx, cancelFunc := transaction.New(context.Background())
 	defer cancelFunc()
-	_, err := r.rls.CreateRollingUpdateFromExistingRCs(
-		ctx,
-		roll_fields.Update{
-			OldRC:           rc_fields.ID(oldID),
-			NewRC:           rc_fields.ID(newID),
-			DesiredReplicas: want,
-			MinimumReplicas: need,
-		}, nil, nil)
+	frozen, err := r.freezeWindows(u.NewRC)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not determine if deploys are frozen")
+	}
+	if len(frozen) > 0 {
+		if opts.overrideFreeze == "" {
+			r.logger.WithFields(logrus.Fields{
+				"freeze_window": frozen[0].ID,
+				"freeze_end":    frozen[0].End,
+				"reason":        frozen[0].Reason,
+			}).Fatalln("Deploys of the new RC are frozen, pass --override-freeze with a reason to schedule the update anyway")
+		}
+		err = r.overrideFreezesTxn(ctx, u.NewRC, frozen, opts.overrideFreeze)
+		if err != nil {
+			r.logger.WithError(err).Fatalln("Could not override deploy freeze")
+		}
+	}
+
+	_, err = r.rls.CreateRollingUpdateFromExistingRCs(ctx, u, nil, nil)
 	if err != nil {
 		r.logger.WithError(err).Fatalln("Could not create rolling update")
 	}
@@ -525,18 +929,557 @@ func (r rctlParams) ScheduleUpdate(oldID, newID string, want, need int, txner tr
 	r.logger.WithField("id", newID).Infoln("Created new rolling update")
 }
 
+// simulateUpdate prints the steps the given update would take if it were
+// scheduled now, assuming every pod it schedules becomes healthy
+func (r rctlParams) simulateUpdate(u roll_fields.Update) {
+	oldRC, oldHealthy := r.rcHealth(u.OldRC)
+	newRC, newHealthy := r.rcHealth(u.NewRC)
+
+	sim, err := roll.SimulateUpdate(u, oldRC.ReplicasDesired, oldHealthy, newRC.ReplicasDesired, newHealthy)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not simulate rolling update")
+	}
+
+	if u.BlueGreen != nil {
+		fmt.Println("Note: blue/green updates add every new node before removing any old ones, the steps below are for a regular update")
+	}
+	fmt.Printf("Old RC:  %d desired, %d healthy\n", oldRC.ReplicasDesired, oldHealthy)
+	fmt.Printf("New RC:  %d desired, %d healthy\n", newRC.ReplicasDesired, newHealthy)
+	fmt.Printf("Minimum: %d nodes must stay healthy\n", sim.MinimumHealthy)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STEP\tREMOVE\tADD\tOLD\tNEW\t")
+	for i, step := range sim.Steps {
+		note := ""
+		if step.AwaitsPromotion {
+			note = "(pauses for promotion)"
+		}
+		fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%d\t%s\n", i+1, step.NodesToRemove, step.NodesToAdd, step.OldDesired, step.NewDesired, note)
+	}
+	w.Flush()
+
+	if sim.Blocked {
+		fmt.Printf("The update would block after %d steps: %s\n", len(sim.Steps), sim.BlockedReason)
+	} else {
+		fmt.Printf("The update would complete in %d steps\n", len(sim.Steps))
+	}
+}
+
+// rcHealth returns an RC and the number of its nodes that run its manifest
+// and are healthy
+func (r rctlParams) rcHealth(id rc_fields.ID) (rc_fields.RC, int) {
+	ctl, err := r.rcs.Get(id)
+	if err != nil {
+		r.logger.WithErrorAndFields(err, logrus.Fields{"rc": id}).Fatalln("Could not get replication controller")
+	}
+	results, err := r.healthChecker.Service(string(ctl.Manifest.ID()))
+	if err != nil {
+		r.logger.WithErrorAndFields(err, logrus.Fields{"rc": id}).Fatalln("Could not get health of replication controller")
+	}
+	healthy, err := roll.CountHealthyNodes(ctl, r.labeler, r.consuls, results)
+	if err != nil {
+		r.logger.WithErrorAndFields(err, logrus.Fields{"rc": id}).Fatalln("Could not count healthy nodes of replication controller")
+	}
+	return ctl, healthy
+}
+
+func (r rctlParams) CreateFreeze(start, end string, podID types.PodID, selector, reason string) {
+	window := freeze_fields.Window{
+		Start:    time.Now(),
+		PodID:    podID,
+		Selector: selector,
+		Reason:   reason,
+	}
+	var err error
+	if start != "" {
+		window.Start, err = time.Parse(time.RFC3339, start)
+		if err != nil {
+			r.logger.WithError(err).Fatalln("Could not parse start time")
+		}
+	}
+	window.End, err = time.Parse(time.RFC3339, end)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not parse end time")
+	}
+
+	window, err = r.freezeStore.Create(window)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not create freeze window")
+	}
+	r.logger.WithFields(logrus.Fields{
+		"id":    window.ID,
+		"start": window.Start.Format(time.RFC3339),
+		"end":   window.End.Format(time.RFC3339),
+	}).Infoln("Created freeze window")
+}
+
+func (r rctlParams) ListFreezes(all bool) {
+	windows, err := r.freezeStore.List()
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not list freeze windows")
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTART\tEND\tACTIVE\tPOD\tSELECTOR\tOVERRIDES\tREASON")
+	for _, window := range windows {
+		if !all && !now.Before(window.End) {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\t%s\t%d\t%s\n",
+			window.ID,
+			window.Start.Format(time.RFC3339),
+			window.End.Format(time.RFC3339),
+			window.Active(now),
+			window.PodID,
+			window.Selector,
+			len(window.Overrides),
+			window.Reason,
+		)
+	}
+	w.Flush()
+}
+
+func (r rctlParams) DeleteFreeze(id freeze_fields.ID) {
+	err := r.freezeStore.Delete(id)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not delete freeze window")
+	}
+	r.logger.WithField("id", id).Infoln("Deleted freeze window")
+}
+
+func (r rctlParams) OverrideFreeze(id fields.ID, reason string, txner transaction.Txner) {
+	frozen, err := r.freezeWindows(id)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not determine if deploys are frozen")
+	}
+	if len(frozen) == 0 {
+		r.logger.WithField("id", id).Infoln("No active freeze window covers the replication controller")
+		return
+	}
+
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
+	err = r.overrideFreezesTxn(ctx, id, frozen, reason)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not override deploy freeze")
+	}
+	err = transaction.MustCommit(ctx, txner)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not override deploy freeze")
+	}
+
+	for _, window := range frozen {
+		r.logger.WithFields(logrus.Fields{
+			"id":            id,
+			"freeze_window": window.ID,
+		}).Infoln("Overrode freeze window")
+	}
+}
+
+// freezeWindows returns every active freeze window that prevents the given RC
+// from changing
+func (r rctlParams) freezeWindows(id fields.ID) ([]freeze_fields.Window, error) {
+	rcFields, err := r.rcs.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	rcLabels, err := r.labeler.GetLabels(labels.RC, id.String())
+	if err != nil {
+		return nil, err
+	}
+	windows, err := r.freezeStore.List()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var ret []freeze_fields.Window
+	for _, window := range windows {
+		if !window.Active(now) || window.Overridden(id) {
+			continue
+		}
+		matches, err := window.Matches(rcFields.Manifest.ID(), rcLabels.Labels)
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			ret = append(ret, window)
+		}
+	}
+	return ret, nil
+}
+
+// overrideFreezesTxn adds operations to the transaction in ctx that allow the
+// given RC to change during each of the given freeze windows, along with an
+// audit log record for each
+func (r rctlParams) overrideFreezesTxn(ctx context.Context, id fields.ID, windows []freeze_fields.Window, reason string) error {
+	rcFields, err := r.rcs.Get(id)
+	if err != nil {
+		return err
+	}
+	username := currentUsername()
+
+	for _, window := range windows {
+		err = r.freezeStore.OverrideTxn(ctx, window.ID, id)
+		if err != nil {
+			return err
+		}
+		details, err := audit.NewFreezeOverrideEventDetails(window, id, rcFields.Manifest.ID(), username, reason)
+		if err != nil {
+			return err
+		}
+		err = r.auditLogStore.Create(ctx, audit.FreezeOverrideEvent, details)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r rctlParams) CreateBudget(podID types.PodID, selector string, minAvailable, maxUnavailable int) {
+	budget, err := r.budgetStore.Create(budget_fields.Budget{
+		PodID:          podID,
+		Selector:       selector,
+		MinAvailable:   minAvailable,
+		MaxUnavailable: maxUnavailable,
+	})
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not create disruption budget")
+	}
+	r.logger.WithField("id", budget.ID).Infoln("Created disruption budget")
+}
+
+func (r rctlParams) ListBudgets() {
+	budgets, err := r.budgetStore.List()
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not list disruption budgets")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tPOD\tSELECTOR\tMIN AVAILABLE\tMAX UNAVAILABLE")
+	for _, budget := range budgets {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\n",
+			budget.ID,
+			budget.PodID,
+			budget.Selector,
+			budget.MinAvailable,
+			budget.MaxUnavailable,
+		)
+	}
+	w.Flush()
+}
+
+func (r rctlParams) DeleteBudget(id budget_fields.ID) {
+	err := r.budgetStore.Delete(id)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not delete disruption budget")
+	}
+	r.logger.WithField("id", id).Infoln("Deleted disruption budget")
+}
+
+func (r rctlParams) CreateAutoscaler(autoscaler autoscale_fields.Autoscaler) {
+	_, err := r.rcs.Get(autoscaler.RCID)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not read replication controller to autoscale")
+	}
+
+	autoscaler, err = r.autoscalerStore.Create(autoscaler)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not create autoscaler")
+	}
+	r.logger.WithField("id", autoscaler.ID).Infoln("Created autoscaler")
+}
+
+func (r rctlParams) ListAutoscalers() {
+	autoscalers, err := r.autoscalerStore.List()
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not list autoscalers")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tRC\tMIN\tMAX\tMETRIC\tTARGET\tSCALE UP COOLDOWN\tSCALE DOWN COOLDOWN")
+	for _, autoscaler := range autoscalers {
+		metric := string(autoscaler.Metric.Type)
+		if autoscaler.Metric.URL != "" {
+			metric = fmt.Sprintf("%s (%s)", metric, autoscaler.Metric.URL)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%g\t%s\t%s\n",
+			autoscaler.ID,
+			autoscaler.RCID,
+			autoscaler.MinReplicas,
+			autoscaler.MaxReplicas,
+			metric,
+			autoscaler.TargetValue,
+			autoscaler.ScaleUpCooldown,
+			autoscaler.ScaleDownCooldown,
+		)
+	}
+	w.Flush()
+}
+
+func (r rctlParams) DeleteAutoscaler(id autoscale_fields.ID) {
+	err := r.autoscalerStore.Delete(id)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not delete autoscaler")
+	}
+	r.logger.WithField("id", id).Infoln("Deleted autoscaler")
+}
+
+func (r rctlParams) Promote(id string) {
+	u, err := r.rls.Promote(roll_fields.ID(id))
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not promote rolling update")
+	}
+
+	target, err := u.StageTarget()
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Promoted rolling update but could not compute its next target")
+	}
+
+	r.logger.WithFields(logrus.Fields{
+		"id":     id,
+		"stage":  u.PromotedStages,
+		"target": target,
+	}).Infoln("Promoted rolling update")
+}
+
+func (r rctlParams) SetRollPaused(id string, paused bool) {
+	_, err := r.rls.SetPaused(roll_fields.ID(id), paused)
+	if paused {
+		if err != nil {
+			r.logger.WithError(err).Fatalln("Could not pause rolling update")
+		}
+		r.logger.WithField("id", id).Infoln("Paused rolling update")
+	} else {
+		if err != nil {
+			r.logger.WithError(err).Fatalln("Could not resume rolling update")
+		}
+		r.logger.WithField("id", id).Infoln("Resumed rolling update")
+	}
+}
+
 func (r rctlParams) UpdateManifest(id fields.ID, manifestPath string) {
 	man, err := manifest.FromPath(manifestPath)
 
-	err = r.rcs.UpdateManifest(id, man)
+	err = r.rcs.UpdateManifest(id, man, currentUsername())
 	if err != nil {
 		r.logger.WithError(err).Fatalln("Manifest update failed! Please retry after checking the database")
 	}
 }
 
+func (r rctlParams) History(id fields.ID) {
+	rcFields, err := r.rcs.Get(id)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not get replication controller")
+	}
+	history, err := r.rcs.History(id)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not get replication controller history")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "REVISION\tSHA\tREPLACED\tUSER")
+	for _, revision := range history.Revisions {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n",
+			revision.Number,
+			revision.SHA,
+			revision.Timestamp.Format(time.RFC3339),
+			revision.User,
+		)
+	}
+	if rcFields.Manifest != nil {
+		sha, err := rcFields.Manifest.SHA()
+		if err != nil {
+			r.logger.WithError(err).Fatalln("Could not compute current manifest SHA")
+		}
+		fmt.Fprintf(w, "current\t%s\t\t\n", sha)
+	}
+	w.Flush()
+}
+
+// Plan prints the decisions the given RC would make if it handled its
+// desired state now. No service discovery checker is available here, so
+// node transfers are always reported as blocked on it. Preemptions are only
+// planned with the bin-packing scheduler, since the default scheduler never
+// preempts.
+func (r rctlParams) Plan(id fields.ID, binPacking bool) {
+	rcFields, err := r.rcs.Get(id)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not get replication controller")
+	}
+
+	var sched rc.Scheduler = scheduler.NewApplicatorScheduler(r.labeler)
+	if binPacking {
+		sched = scheduler.NewBinPackingScheduler(r.labeler, consul.NewConsulStore(r.baseClient))
+	}
+	plan, err := rc.NewPlan(
+		rcFields,
+		sched,
+		r.labeler,
+		r.healthChecker,
+		nil,
+		r.freezeStore,
+		r.rcStatusStore,
+		budget.NewChecker(r.budgetStore, r.labeler, r.healthChecker),
+		r.rcs,
+		r.logger,
+	)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not plan replication controller")
+	}
+
+	fmt.Printf("Replicas: %d desired, %d current, %d eligible nodes\n", rcFields.ReplicasDesired, len(plan.Current), len(plan.Eligible))
+	if rcFields.Disabled {
+		fmt.Println("The RC is disabled, it will not add or remove pods")
+	}
+	if plan.Frozen != nil && rcFields.ReplicasDesired > len(plan.Current) {
+		fmt.Printf("Deploys are frozen by window %s until %s, the RC will only replace lost pods: %s\n", plan.Frozen.ID, plan.Frozen.End.Format(time.RFC3339), plan.Frozen.Reason)
+	}
+
+	if len(plan.Additions)+len(plan.Preemptions)+len(plan.Removals)+len(plan.DeferredRemovals)+len(plan.Ineligible) > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ACTION\tNODE")
+		for _, node := range plan.Additions {
+			fmt.Fprintf(w, "add\t%s\n", node)
+		}
+		for _, preemption := range plan.Preemptions {
+			var victims []string
+			for _, victim := range preemption.Victims {
+				victims = append(victims, fmt.Sprintf("%s of RC %s", victim.Manifest.ID(), victim.ID))
+			}
+			fmt.Fprintf(w, "add by preempting %s\t%s\n", strings.Join(victims, ", "), preemption.Node)
+		}
+		for _, node := range plan.Removals {
+			fmt.Fprintf(w, "remove\t%s\n", node)
+		}
+		for _, node := range plan.DeferredRemovals {
+			fmt.Fprintf(w, "remove later\t%s\n", node)
+		}
+		for _, node := range plan.Ineligible {
+			action := "ineligible"
+			if plan.NodeTransfer != nil && plan.NodeTransfer.From == node {
+				action = "transfer off"
+			}
+			fmt.Fprintf(w, "%s\t%s\n", action, node)
+		}
+		w.Flush()
+	} else {
+		fmt.Println("The RC would take no action")
+	}
+
+	if plan.Shortfall > 0 {
+		fmt.Printf("Not enough eligible nodes: %d more pods would not be scheduled\n", plan.Shortfall)
+		if !binPacking {
+			fmt.Println("Preemption was not considered, pass --bin-packing if p2-rctl-server runs with it")
+		}
+	}
+	if plan.RemovalsBlocked != nil {
+		fmt.Printf("%d removals would wait for disruption budgets: %s\n", len(plan.DeferredRemovals), plan.RemovalsBlocked)
+	}
+	switch transfer := plan.NodeTransfer; {
+	case transfer == nil && len(plan.Ineligible) > 0:
+		fmt.Printf("The RC uses the %s allocation strategy, pods on ineligible nodes must be moved manually\n", rcFields.AllocationStrategy)
+	case transfer == nil:
+	case transfer.Blocker != "":
+		fmt.Printf("The node transfer off %s would be skipped: %s\n", transfer.From, transfer.Blocker)
+	case transfer.NeedsLock:
+		fmt.Printf("The node transfer off %s would proceed once the RC's mutation lock is free, rolling updates hold it while they run\n", transfer.From)
+	default:
+		fmt.Printf("The node transfer off %s would proceed\n", transfer.From)
+	}
+}
+
+// Rollback schedules a rolling update from the given RC to a new RC that is
+// identical to it except for running the manifest from the given revision
+func (r rctlParams) Rollback(id fields.ID, revisionNumber int, need int, txner transaction.Txner) {
+	rcFields, err := r.rcs.Get(id)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not get replication controller")
+	}
+	history, err := r.rcs.History(id)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not get replication controller history")
+	}
+	revision, ok := history.Revision(revisionNumber)
+	if !ok {
+		r.logger.WithField("revision", revisionNumber).Fatalln("No such revision in the replication controller's history")
+	}
+	man, err := revision.GetManifest()
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not parse the revision's manifest")
+	}
+	rcLabels, err := r.labeler.GetLabels(labels.RC, id.String())
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not get replication controller labels")
+	}
+
+	// the new RC copies everything from the old one, including its spread
+	// constraints and priority, except for the manifest
+	newRC := rcFields
+	newRC.Manifest = man
+
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
+	u, err := r.rls.CreateRollingUpdateFromRCTemplateWithID(
+		ctx,
+		id,
+		rcFields.ReplicasDesired,
+		need,
+		false,
+		0,
+		newRC,
+		rcLabels.Labels,
+		nil,
+	)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not create rollback rolling update")
+	}
+
+	err = transaction.MustCommit(ctx, txner)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not create rollback rolling update")
+	}
+
+	r.logger.WithFields(logrus.Fields{
+		"id":       u.ID(),
+		"new_rc":   u.NewRC,
+		"revision": revision.Number,
+		"sha":      revision.SHA,
+	}).Infoln("Scheduled rolling update to roll back the replication controller")
+}
+
 func (r rctlParams) UpdateStrategy(id fields.ID, strategy fields.Strategy) {
 	err := r.rcs.UpdateStrategy(id, strategy)
 	if err != nil {
 		r.logger.WithError(err).Fatalln("Strategy update failed")
 	}
 }
+
+func (r rctlParams) UpdateSpread(id fields.ID, maxSkews map[string]string, onePerValue []string) {
+	var constraints []fields.SpreadConstraint
+	for key, skew := range maxSkews {
+		maxSkew, err := strconv.Atoi(skew)
+		if err != nil {
+			r.logger.WithError(err).Fatalf("Invalid max skew for %s", key)
+		}
+		constraints = append(constraints, fields.SpreadConstraint{TopologyKey: key, MaxSkew: maxSkew})
+	}
+	for _, key := range onePerValue {
+		constraints = append(constraints, fields.SpreadConstraint{TopologyKey: key, OnePerValue: true})
+	}
+
+	err := r.rcs.UpdateSpreadConstraints(id, constraints)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Spread update failed")
+	}
+	r.logger.WithField("id", id).Infof("Set %d spread constraints", len(constraints))
+}
+
+func (r rctlParams) UpdatePriority(id fields.ID, priority int) {
+	err := r.rcs.UpdatePriority(id, priority)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Priority update failed")
+	}
+	r.logger.WithField("id", id).Infof("Set priority to %d", priority)
+}
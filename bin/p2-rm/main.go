@@ -8,9 +8,12 @@ import (
 
 	"gopkg.in/alecthomas/kingpin.v2"
 
+	"github.com/square/p2/pkg/budget"
+	"github.com/square/p2/pkg/health/checker"
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/rc/fields"
 	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/budgetstore"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/flags"
 	"github.com/square/p2/pkg/types"
@@ -24,6 +27,7 @@ var (
 	podUniqueKey = kingpin.Flag("pod-unique-key", "The pod unique key to unschedule. Only applies to \"uuid\" pods. Cannot be used with --node").Short('k').String()
 	deallocation = kingpin.Flag("deallocate", "Specifies that we are deallocating this pod on this node. Using this switch will mutate the desired_replicas value on a managing RC, if one exists.").Bool()
 	removeOrphan = kingpin.Flag("remove-orphan", "Remove the pod even if it is labeled with a replication controller ID, but only if no RC with that ID exists").Bool()
+	force        = kingpin.Flag("force", "Remove the pod even if doing so breaks a disruption budget. The override is recorded in the audit log").Bool()
 )
 
 func main() {
@@ -37,14 +41,16 @@ func main() {
 	// transactions which that interface does not provide
 	labeler := labels.NewConsulApplicator(consulClient, 0, 0)
 
-	err := handlePodRemoval(consulClient, labeler)
+	disruption := budget.NewChecker(budgetstore.NewConsul(consulClient), labeler, checker.NewHealthChecker(consulClient))
+
+	err := handlePodRemoval(consulClient, labeler, disruption)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, err.Error())
 		os.Exit(1)
 	}
 }
 
-func handlePodRemoval(consulClient consulutil.ConsulClient, labeler Labeler) error {
+func handlePodRemoval(consulClient consulutil.ConsulClient, labeler Labeler, disruption budget.Checker) error {
 	var rm *P2RM
 	if *podUniqueKey != "" {
 		rm = NewUUIDP2RM(consulClient, types.PodUniqueKey(*podUniqueKey), types.PodID(*podName), labeler)
@@ -69,6 +75,13 @@ func handlePodRemoval(consulClient consulutil.ConsulClient, labeler Labeler) err
 		return err
 	}
 
+	if !podIsManagedByRC || *deallocation {
+		err = rm.checkDisruptionBudgets(disruption, *force)
+		if err != nil {
+			return err
+		}
+	}
+
 	if !podIsManagedByRC {
 		err = rm.deletePod()
 		if err != nil {
@@ -99,11 +112,13 @@ func handlePodRemoval(consulClient consulutil.ConsulClient, labeler Labeler) err
 }
 
 func sessionName(rcID fields.ID) string {
+	return fmt.Sprintf("p2-rm:user:%s:rcID:%s", currentUsername(), rcID)
+}
+
+func currentUsername() string {
 	currentUser, err := user.Current()
-	username := "unknown"
-	if err == nil {
-		username = currentUser.Username
+	if err != nil {
+		return "unknown"
 	}
-
-	return fmt.Sprintf("p2-rm:user:%s:rcID:%s", username, rcID)
+	return currentUser.Username
 }
@@ -6,11 +6,13 @@ import (
 	"path"
 	"time"
 
+	"github.com/square/p2/pkg/budget"
 	"github.com/square/p2/pkg/cli"
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/rc"
 	"github.com/square/p2/pkg/rc/fields"
 	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/auditlogstore"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/podstore"
 	"github.com/square/p2/pkg/store/consul/rcstore"
@@ -113,6 +115,22 @@ func (rm *P2RM) checkForManagingReplicationController(checkForOrphaned bool) (bo
 	return false, "", nil
 }
 
+// checkDisruptionBudgets returns an error if removing the pod would break a
+// disruption budget covering it, unless force is set. Only legacy pods are
+// covered by disruption budgets.
+func (rm *P2RM) checkDisruptionBudgets(disruption budget.Checker, force bool) error {
+	if rm.NodeName == "" {
+		return nil
+	}
+
+	disrupted := types.PodLocations{{Node: rm.NodeName, PodID: rm.PodID}}
+	err := disruption.Authorize(disrupted, force, "p2-rm", currentUsername(), auditlogstore.NewConsulStore(rm.Client.KV()), rm.Client.KV())
+	if err != nil {
+		return fmt.Errorf("refusing to remove %s from %s: %v", rm.PodID, rm.NodeName, err)
+	}
+	return nil
+}
+
 func (rm *P2RM) decrementDesiredCount(id fields.ID) error {
 	session, _, err := rm.Store.NewSession(sessionName(id), nil)
 	if err != nil {
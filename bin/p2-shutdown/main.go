@@ -3,14 +3,19 @@ package main
 import (
 	"log"
 	"os"
+	"os/user"
 
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 
 	"sync"
 
+	"github.com/square/p2/pkg/budget"
+	"github.com/square/p2/pkg/health/checker"
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/pods"
 	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/auditlogstore"
+	"github.com/square/p2/pkg/store/consul/budgetstore"
 	"github.com/square/p2/pkg/store/consul/flags"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/uri"
@@ -28,10 +33,11 @@ var (
 	shutdownPods = kingpin.Flag("pods", "The list of pods to shutdown. Leave empty for all").Short('p').Strings()
 	excludePods  = kingpin.Flag("exclude-pods", "The list of pods to exclude from shutdown.").Short('e').Strings()
 	podRoot      = kingpin.Flag("pod-root", "The base directory for pods").Default(pods.DefaultPath).String()
+	force        = kingpin.Flag("force", "Shut down pods even if doing so breaks a disruption budget. The override is recorded in the audit log").Bool()
 )
 
 func main() {
-	_, consulOpts, _ := flags.ParseWithConsulOptions()
+	_, consulOpts, labeler := flags.ParseWithConsulOptions()
 	client := consul.NewConsulClient(consulOpts)
 
 	hostname, err := os.Hostname()
@@ -56,6 +62,30 @@ func main() {
 		podsToShutdown = append(podsToShutdown, types.PodID(pod))
 	}
 
+	var toShutdown []consul.ManifestResult
+	var disrupted types.PodLocations
+	for _, realityEntry := range reality {
+		podID := realityEntry.Manifest.ID()
+		if !shouldShutdownPod(podID, podsToShutdown, podsToExclude) {
+			log.Printf("pod %s not in set of pods to shutdown, skipping", podID)
+			continue
+		}
+		toShutdown = append(toShutdown, realityEntry)
+		disrupted = append(disrupted, types.PodLocation{Node: node, PodID: podID})
+	}
+
+	if !*dryRun {
+		username := "unknown"
+		if currentUser, err := user.Current(); err == nil {
+			username = currentUser.Username
+		}
+		disruption := budget.NewChecker(budgetstore.NewConsul(client), labeler, checker.NewHealthChecker(client))
+		err = disruption.Authorize(disrupted, *force, "p2-shutdown", username, auditlogstore.NewConsulStore(client.KV()), client.KV())
+		if err != nil {
+			log.Fatalf("refusing to shut down pods: %v", err)
+		}
+	}
+
 	// An operator is taking the machine out of service, force all services
 	// to shut down regardless of manifest settings
 	forceHalt := true
@@ -63,12 +93,8 @@ func main() {
 	// TODO: configure a proper http client instead of using default fetcher
 	podFactory := pods.NewFactory(*podRoot, node, uri.DefaultFetcher, "", pods.NewReadOnlyPolicy(false, nil, nil))
 	var haltWG sync.WaitGroup
-	for _, realityEntry := range reality {
+	for _, realityEntry := range toShutdown {
 		pod := podFactory.NewLegacyPod(realityEntry.Manifest.ID())
-		if !shouldShutdownPod(pod.Id, podsToShutdown, podsToExclude) {
-			log.Printf("pod %s not in set of pods to shutdown, skipping", pod.Id)
-			continue
-		}
 		if *dryRun {
 			log.Printf("dry run, skipping this pod: %s", pod.Id)
 			continue
@@ -0,0 +1,49 @@
+package audit
+
+import (
+	"encoding/json"
+
+	autoscale_fields "github.com/square/p2/pkg/autoscale/fields"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	// AutoscaleEvent signifies that an autoscaler changed the desired
+	// replicas of a replication controller
+	AutoscaleEvent EventType = "REPLICATION_CONTROLLER_AUTOSCALE"
+)
+
+type AutoscaleDetails struct {
+	AutoscalerID     autoscale_fields.ID         `json:"autoscaler_id"`
+	RCID             rc_fields.ID                `json:"rc_id"`
+	Metric           autoscale_fields.MetricType `json:"metric"`
+	MetricValue      float64                     `json:"metric_value"`
+	TargetValue      float64                     `json:"target_value"`
+	PreviousReplicas int                         `json:"previous_replicas"`
+	Replicas         int                         `json:"replicas"`
+}
+
+func NewAutoscaleEventDetails(
+	autoscaler autoscale_fields.Autoscaler,
+	metricValue float64,
+	previousReplicas int,
+	replicas int,
+) (json.RawMessage, error) {
+	details := AutoscaleDetails{
+		AutoscalerID:     autoscaler.ID,
+		RCID:             autoscaler.RCID,
+		Metric:           autoscaler.Metric.Type,
+		MetricValue:      metricValue,
+		TargetValue:      autoscaler.TargetValue,
+		PreviousReplicas: previousReplicas,
+		Replicas:         replicas,
+	}
+
+	bytes, err := json.Marshal(details)
+	if err != nil {
+		return nil, util.Errorf("could not marshal autoscale details as json: %s", err)
+	}
+
+	return json.RawMessage(bytes), nil
+}
@@ -0,0 +1,48 @@
+package audit
+
+import (
+	"encoding/json"
+	"testing"
+
+	autoscale_fields "github.com/square/p2/pkg/autoscale/fields"
+)
+
+func TestAutoscaleEventDetails(t *testing.T) {
+	autoscaler := autoscale_fields.Autoscaler{
+		ID:          "some_autoscaler_id",
+		RCID:        "some_rc_id",
+		Metric:      autoscale_fields.Metric{Type: autoscale_fields.HealthMetric},
+		TargetValue: 0.9,
+	}
+
+	detailsJSON, err := NewAutoscaleEventDetails(autoscaler, 0.5, 4, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var details AutoscaleDetails
+	err = json.Unmarshal(detailsJSON, &details)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if details.AutoscalerID != autoscaler.ID {
+		t.Errorf("expected autoscaler id to be %s but was %s", autoscaler.ID, details.AutoscalerID)
+	}
+
+	if details.RCID != autoscaler.RCID {
+		t.Errorf("expected rc id to be %s but was %s", autoscaler.RCID, details.RCID)
+	}
+
+	if details.Metric != autoscale_fields.HealthMetric {
+		t.Errorf("expected metric to be %s but was %s", autoscale_fields.HealthMetric, details.Metric)
+	}
+
+	if details.MetricValue != 0.5 || details.TargetValue != 0.9 {
+		t.Errorf("expected metric value 0.5 and target 0.9 but got %f and %f", details.MetricValue, details.TargetValue)
+	}
+
+	if details.PreviousReplicas != 4 || details.Replicas != 8 {
+		t.Errorf("expected replicas to go from 4 to 8 but got %d to %d", details.PreviousReplicas, details.Replicas)
+	}
+}
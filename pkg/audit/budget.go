@@ -0,0 +1,43 @@
+package audit
+
+import (
+	"encoding/json"
+
+	budget_fields "github.com/square/p2/pkg/budget/fields"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	// DisruptionBudgetOverrideEvent signifies that an operator forced pods
+	// down even though doing so broke the disruption budgets covering them
+	DisruptionBudgetOverrideEvent EventType = "DISRUPTION_BUDGET_OVERRIDE"
+)
+
+type DisruptionBudgetOverrideDetails struct {
+	BudgetIDs []budget_fields.ID `json:"budget_ids"`
+	Pods      types.PodLocations `json:"pods"`
+	Command   string             `json:"command"`
+	User      string             `json:"user"`
+}
+
+func NewDisruptionBudgetOverrideEventDetails(
+	budgetIDs []budget_fields.ID,
+	pods types.PodLocations,
+	command string,
+	user string,
+) (json.RawMessage, error) {
+	details := DisruptionBudgetOverrideDetails{
+		BudgetIDs: budgetIDs,
+		Pods:      pods,
+		Command:   command,
+		User:      user,
+	}
+
+	bytes, err := json.Marshal(details)
+	if err != nil {
+		return nil, util.Errorf("could not marshal disruption budget override details as json: %s", err)
+	}
+
+	return json.RawMessage(bytes), nil
+}
@@ -0,0 +1,42 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	budget_fields "github.com/square/p2/pkg/budget/fields"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestDisruptionBudgetOverrideEventDetails(t *testing.T) {
+	budgetIDs := []budget_fields.ID{"some_budget_id"}
+	pods := types.PodLocations{{Node: "some_node", PodID: "some_pod_id"}}
+
+	detailsJSON, err := NewDisruptionBudgetOverrideEventDetails(budgetIDs, pods, "p2-rm", "some_user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var details DisruptionBudgetOverrideDetails
+	err = json.Unmarshal(detailsJSON, &details)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(details.BudgetIDs, budgetIDs) {
+		t.Errorf("expected budget ids to be %s but were %s", budgetIDs, details.BudgetIDs)
+	}
+
+	if !reflect.DeepEqual(details.Pods, pods) {
+		t.Errorf("expected pods to be %v but were %v", pods, details.Pods)
+	}
+
+	if details.Command != "p2-rm" {
+		t.Errorf("expected command to be p2-rm but was %s", details.Command)
+	}
+
+	if details.User != "some_user" {
+		t.Errorf("expected user to be some_user but was %s", details.User)
+	}
+}
@@ -41,6 +41,23 @@ const (
 	// timeout value will result in an event of this type (because it's
 	// neither a manifest or "disabled" update)
 	DSModifiedEvent EventType = "DAEMON_SET_MODIFIED"
+
+	// DSRolledBackEvent signifies that the daemon set's pod manifest was
+	// set back to one it had previously. Like a manifest update, this
+	// kicks off a replication to the nodes matched by the daemon set's
+	// node selector
+	DSRolledBackEvent EventType = "DAEMON_SET_ROLLED_BACK"
+
+	// DSExcludedNodesUpdatedEvent signifies that nodes were added to or
+	// removed from the daemon set's exclusion list. Nodes that are added
+	// have the daemon set's pod removed even if they match its node
+	// selector
+	DSExcludedNodesUpdatedEvent EventType = "DAEMON_SET_EXCLUDED_NODES_UPDATED"
+
+	// DSPinnedNodesUpdatedEvent signifies that a node was pinned to a
+	// manifest SHA or unpinned. The daemon set doesn't change the pod on a
+	// pinned node until its own manifest has the pinned SHA
+	DSPinnedNodesUpdatedEvent EventType = "DAEMON_SET_PINNED_NODES_UPDATED"
 )
 
 // DsEventDetails defines a JSON structure for the details related to a daemon
@@ -72,3 +89,33 @@ func NewDaemonSetDetails(ds fields.DaemonSet, user string) (json.RawMessage, err
 
 	return json.RawMessage(detailBytes), nil
 }
+
+// DSRollbackEventDetails defines a JSON structure for the details of a daemon
+// set rollback event
+type DSRollbackEventDetails struct {
+	DSEventDetails
+
+	// FromSHA is the SHA of the manifest that was replaced by the rollback
+	FromSHA string `json:"from_sha"`
+
+	// ToSHA is the SHA of the prior manifest that was restored
+	ToSHA string `json:"to_sha"`
+}
+
+func NewDaemonSetRollbackDetails(ds fields.DaemonSet, fromSHA string, toSHA string, user string) (json.RawMessage, error) {
+	event := DSRollbackEventDetails{
+		DSEventDetails: DSEventDetails{
+			DaemonSet: ds,
+			User:      user,
+		},
+		FromSHA: fromSHA,
+		ToSHA:   toSHA,
+	}
+
+	detailBytes, err := json.Marshal(event)
+	if err != nil {
+		return nil, util.Errorf("could not marshal DS rollback event as json: %s", err)
+	}
+
+	return json.RawMessage(detailBytes), nil
+}
@@ -0,0 +1,49 @@
+package audit
+
+import (
+	"encoding/json"
+
+	freeze_fields "github.com/square/p2/pkg/freeze/fields"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	// FreezeOverrideEvent signifies that an operator allowed an RC to change
+	// during a deploy freeze window that would otherwise have prevented it
+	FreezeOverrideEvent EventType = "FREEZE_OVERRIDE"
+)
+
+type FreezeOverrideDetails struct {
+	WindowID     freeze_fields.ID `json:"window_id"`
+	WindowReason string           `json:"window_reason"`
+	RCID         rc_fields.ID     `json:"rc_id"`
+	PodID        types.PodID      `json:"pod_id"`
+	User         string           `json:"user"`
+	Reason       string           `json:"reason"`
+}
+
+func NewFreezeOverrideEventDetails(
+	window freeze_fields.Window,
+	rcID rc_fields.ID,
+	podID types.PodID,
+	user string,
+	reason string,
+) (json.RawMessage, error) {
+	details := FreezeOverrideDetails{
+		WindowID:     window.ID,
+		WindowReason: window.Reason,
+		RCID:         rcID,
+		PodID:        podID,
+		User:         user,
+		Reason:       reason,
+	}
+
+	bytes, err := json.Marshal(details)
+	if err != nil {
+		return nil, util.Errorf("could not marshal freeze override details as json: %s", err)
+	}
+
+	return json.RawMessage(bytes), nil
+}
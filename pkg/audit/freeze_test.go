@@ -0,0 +1,54 @@
+package audit
+
+import (
+	"encoding/json"
+	"testing"
+
+	freeze_fields "github.com/square/p2/pkg/freeze/fields"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestFreezeOverrideEventDetails(t *testing.T) {
+	window := freeze_fields.Window{
+		ID:     "some_window_id",
+		Reason: "holiday",
+	}
+	rcID := rc_fields.ID("some_rc_id")
+	podID := types.PodID("some_pod_id")
+
+	detailsJSON, err := NewFreezeOverrideEventDetails(window, rcID, podID, "some_user", "security fix")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var details FreezeOverrideDetails
+	err = json.Unmarshal(detailsJSON, &details)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if details.WindowID != window.ID {
+		t.Errorf("expected window id to be %s but was %s", window.ID, details.WindowID)
+	}
+
+	if details.WindowReason != window.Reason {
+		t.Errorf("expected window reason to be %s but was %s", window.Reason, details.WindowReason)
+	}
+
+	if details.RCID != rcID {
+		t.Errorf("expected rc id to be %s but was %s", rcID, details.RCID)
+	}
+
+	if details.PodID != podID {
+		t.Errorf("expected pod id to be %s but was %s", podID, details.PodID)
+	}
+
+	if details.User != "some_user" {
+		t.Errorf("expected user to be some_user but was %s", details.User)
+	}
+
+	if details.Reason != "security fix" {
+		t.Errorf("expected reason to be %q but was %q", "security fix", details.Reason)
+	}
+}
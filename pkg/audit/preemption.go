@@ -0,0 +1,52 @@
+package audit
+
+import (
+	"encoding/json"
+
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	// PreemptionEvent signifies that a replication controller evicted a pod
+	// of a lower priority replication controller to make room for its own
+	PreemptionEvent EventType = "REPLICATION_CONTROLLER_PREEMPTION"
+)
+
+type PreemptionDetails struct {
+	// Node is where the pod was evicted
+	Node types.NodeName `json:"node"`
+
+	RCID     rc_fields.ID `json:"rc_id"`
+	PodID    types.PodID  `json:"pod_id"`
+	Priority int          `json:"priority"`
+
+	// The evicted pod and the replication controller it belonged to
+	VictimRCID     rc_fields.ID `json:"victim_rc_id"`
+	VictimPodID    types.PodID  `json:"victim_pod_id"`
+	VictimPriority int          `json:"victim_priority"`
+}
+
+func NewPreemptionEventDetails(
+	node types.NodeName,
+	rc rc_fields.RC,
+	victim rc_fields.RC,
+) (json.RawMessage, error) {
+	details := PreemptionDetails{
+		Node:           node,
+		RCID:           rc.ID,
+		PodID:          rc.Manifest.ID(),
+		Priority:       rc.Priority,
+		VictimRCID:     victim.ID,
+		VictimPodID:    victim.Manifest.ID(),
+		VictimPriority: victim.Priority,
+	}
+
+	bytes, err := json.Marshal(details)
+	if err != nil {
+		return nil, util.Errorf("could not marshal preemption details as json: %s", err)
+	}
+
+	return json.RawMessage(bytes), nil
+}
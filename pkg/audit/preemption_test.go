@@ -0,0 +1,41 @@
+package audit
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/square/p2/pkg/manifest"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+)
+
+func TestPreemptionEventDetails(t *testing.T) {
+	builder := manifest.NewBuilder()
+	builder.SetID("important_pod")
+	rc := rc_fields.RC{ID: "some_rc_id", Manifest: builder.GetManifest(), Priority: 10}
+	builder = manifest.NewBuilder()
+	builder.SetID("batch_pod")
+	victim := rc_fields.RC{ID: "victim_rc_id", Manifest: builder.GetManifest(), Priority: -1}
+
+	detailsJSON, err := NewPreemptionEventDetails("node1", rc, victim)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var details PreemptionDetails
+	err = json.Unmarshal(detailsJSON, &details)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if details.Node != "node1" {
+		t.Errorf("expected node to be node1 but was %s", details.Node)
+	}
+
+	if details.RCID != rc.ID || details.PodID != "important_pod" || details.Priority != 10 {
+		t.Errorf("expected preempting RC %s of important_pod with priority 10 but got %+v", rc.ID, details)
+	}
+
+	if details.VictimRCID != victim.ID || details.VictimPodID != "batch_pod" || details.VictimPriority != -1 {
+		t.Errorf("expected victim RC %s of batch_pod with priority -1 but got %+v", victim.ID, details)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/manifest"
 	pc_fields "github.com/square/p2/pkg/pc/fields"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
 	roll_fields "github.com/square/p2/pkg/roll/fields"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
@@ -14,6 +15,17 @@ import (
 const (
 	RUCreationEvent   EventType = "ROLLING_UPDATE_CREATION"
 	RUCompletionEvent EventType = "ROLLING_UPDATE_COMPLETION"
+
+	// RURollbackEvent signifies that a rolling update was automatically
+	// rolled back because the new RC's pods were unhealthy. The replicas
+	// of the new RC were transferred back to the old RC and the rolling
+	// update was deleted.
+	RURollbackEvent EventType = "ROLLING_UPDATE_ROLLBACK"
+
+	// RUCutOverEvent signifies that a blue/green rolling update switched
+	// from the old RC to the new one. Every new node was healthy and the
+	// old RC's replica count was set to zero.
+	RUCutOverEvent EventType = "ROLLING_UPDATE_CUT_OVER"
 )
 
 type RUCreationDetails struct {
@@ -34,6 +46,28 @@ type RUCompletionDetails struct {
 	Canceled         bool                       `json:"canceled"`
 }
 
+type RURollbackDetails struct {
+	PodID            types.PodID                `json:"pod_id"`
+	AvailabilityZone pc_fields.AvailabilityZone `json:"availability_zone"`
+	ClusterName      pc_fields.ClusterName      `json:"cluster_name"`
+	RollingUpdateID  roll_fields.ID             `json:"rolling_update_id"`
+	OldRCID          rc_fields.ID               `json:"old_rc_id"`
+	NewRCID          rc_fields.ID               `json:"new_rc_id"`
+	ReplicasReturned int                        `json:"replicas_returned"`
+	CriticalNodes    []types.NodeName           `json:"critical_nodes"`
+}
+
+type RUCutOverDetails struct {
+	PodID            types.PodID                `json:"pod_id"`
+	AvailabilityZone pc_fields.AvailabilityZone `json:"availability_zone"`
+	ClusterName      pc_fields.ClusterName      `json:"cluster_name"`
+	RollingUpdateID  roll_fields.ID             `json:"rolling_update_id"`
+	OldRCID          rc_fields.ID               `json:"old_rc_id"`
+	NewRCID          rc_fields.ID               `json:"new_rc_id"`
+	ReplicasRemoved  int                        `json:"replicas_removed"`
+	NewNodes         []types.NodeName           `json:"new_nodes"`
+}
+
 func NewRUCreationEventDetails(
 	podID types.PodID,
 	az pc_fields.AvailabilityZone,
@@ -96,3 +130,69 @@ func NewRUCompletionEventDetails(
 
 	return json.RawMessage(bytes), nil
 }
+
+func NewRURollbackEventDetails(
+	rollingUpdateID roll_fields.ID,
+	oldRCID rc_fields.ID,
+	newRCID rc_fields.ID,
+	replicasReturned int,
+	criticalNodes []types.NodeName,
+	labeler Labeler,
+) (json.RawMessage, error) {
+	details := RURollbackDetails{
+		RollingUpdateID:  rollingUpdateID,
+		OldRCID:          oldRCID,
+		NewRCID:          newRCID,
+		ReplicasReturned: replicasReturned,
+		CriticalNodes:    criticalNodes,
+	}
+
+	labels, err := labeler.GetLabels(labels.RU, rollingUpdateID.String())
+	if err != nil {
+		return nil, util.Errorf("could not determine pod cluster for RU %s: %s", rollingUpdateID, err)
+	}
+
+	details.PodID = types.PodID(labels.Labels[pc_fields.PodIDLabel])
+	details.AvailabilityZone = pc_fields.AvailabilityZone(labels.Labels[pc_fields.AvailabilityZoneLabel])
+	details.ClusterName = pc_fields.ClusterName(labels.Labels[pc_fields.ClusterNameLabel])
+
+	bytes, err := json.Marshal(details)
+	if err != nil {
+		return nil, util.Errorf("could not marshal ru rollback details as json: %s", err)
+	}
+
+	return json.RawMessage(bytes), nil
+}
+
+func NewRUCutOverEventDetails(
+	rollingUpdateID roll_fields.ID,
+	oldRCID rc_fields.ID,
+	newRCID rc_fields.ID,
+	replicasRemoved int,
+	newNodes []types.NodeName,
+	labeler Labeler,
+) (json.RawMessage, error) {
+	details := RUCutOverDetails{
+		RollingUpdateID: rollingUpdateID,
+		OldRCID:         oldRCID,
+		NewRCID:         newRCID,
+		ReplicasRemoved: replicasRemoved,
+		NewNodes:        newNodes,
+	}
+
+	labels, err := labeler.GetLabels(labels.RU, rollingUpdateID.String())
+	if err != nil {
+		return nil, util.Errorf("could not determine pod cluster for RU %s: %s", rollingUpdateID, err)
+	}
+
+	details.PodID = types.PodID(labels.Labels[pc_fields.PodIDLabel])
+	details.AvailabilityZone = pc_fields.AvailabilityZone(labels.Labels[pc_fields.AvailabilityZoneLabel])
+	details.ClusterName = pc_fields.ClusterName(labels.Labels[pc_fields.ClusterNameLabel])
+
+	bytes, err := json.Marshal(details)
+	if err != nil {
+		return nil, util.Errorf("could not marshal ru cut over details as json: %s", err)
+	}
+
+	return json.RawMessage(bytes), nil
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/square/p2/pkg/labels"
 	pc_fields "github.com/square/p2/pkg/pc/fields"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
 	roll_fields "github.com/square/p2/pkg/roll/fields"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
@@ -78,3 +79,115 @@ func TestRUCompletionEventDetails(t *testing.T) {
 		t.Errorf("expected ru ID to be %s but was %s", ruID, details.RollingUpdateID)
 	}
 }
+
+func TestRURollbackEventDetails(t *testing.T) {
+	podID := types.PodID("some_pod_id")
+	clusterName := pc_fields.ClusterName("some_cluster_name")
+	az := pc_fields.AvailabilityZone("some_availability_zone")
+	labeler := fakeLabeler{
+		labelMap: map[string]labels.Labeled{
+			"some_ru": labels.Labeled{
+				Labels: map[string]string{
+					pc_fields.ClusterNameLabel:      clusterName.String(),
+					pc_fields.AvailabilityZoneLabel: az.String(),
+					pc_fields.PodIDLabel:            podID.String(),
+				},
+			},
+		},
+	}
+
+	ruID := roll_fields.ID("some_ru")
+	oldRCID := rc_fields.ID("some_old_rc")
+	criticalNodes := []types.NodeName{"node1", "node2"}
+
+	detailsJSON, err := NewRURollbackEventDetails(ruID, oldRCID, rc_fields.ID(ruID), 3, criticalNodes, labeler)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var details RURollbackDetails
+	err = json.Unmarshal(detailsJSON, &details)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if details.PodID != podID {
+		t.Errorf("expected pod id to be %s but was %s", podID, details.PodID)
+	}
+
+	if details.AvailabilityZone != az {
+		t.Errorf("expected availability zone to be %s but was %s", az, details.AvailabilityZone)
+	}
+
+	if details.ClusterName != clusterName {
+		t.Errorf("expected cluster name to be %s but was %s", clusterName, details.ClusterName)
+	}
+
+	if details.RollingUpdateID != ruID {
+		t.Errorf("expected ru ID to be %s but was %s", ruID, details.RollingUpdateID)
+	}
+
+	if details.OldRCID != oldRCID {
+		t.Errorf("expected old rc ID to be %s but was %s", oldRCID, details.OldRCID)
+	}
+
+	if details.ReplicasReturned != 3 {
+		t.Errorf("expected 3 replicas returned but was %d", details.ReplicasReturned)
+	}
+
+	if len(details.CriticalNodes) != len(criticalNodes) {
+		t.Errorf("expected %d critical nodes but there were %d", len(criticalNodes), len(details.CriticalNodes))
+	}
+}
+
+func TestRUCutOverEventDetails(t *testing.T) {
+	podID := types.PodID("some_pod_id")
+	clusterName := pc_fields.ClusterName("some_cluster_name")
+	az := pc_fields.AvailabilityZone("some_availability_zone")
+	labeler := fakeLabeler{
+		labelMap: map[string]labels.Labeled{
+			"some_ru": labels.Labeled{
+				Labels: map[string]string{
+					pc_fields.ClusterNameLabel:      clusterName.String(),
+					pc_fields.AvailabilityZoneLabel: az.String(),
+					pc_fields.PodIDLabel:            podID.String(),
+				},
+			},
+		},
+	}
+
+	ruID := roll_fields.ID("some_ru")
+	oldRCID := rc_fields.ID("some_old_rc")
+	newNodes := []types.NodeName{"node3", "node4"}
+
+	detailsJSON, err := NewRUCutOverEventDetails(ruID, oldRCID, rc_fields.ID(ruID), 2, newNodes, labeler)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var details RUCutOverDetails
+	err = json.Unmarshal(detailsJSON, &details)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if details.PodID != podID {
+		t.Errorf("expected pod id to be %s but was %s", podID, details.PodID)
+	}
+
+	if details.ClusterName != clusterName {
+		t.Errorf("expected cluster name to be %s but was %s", clusterName, details.ClusterName)
+	}
+
+	if details.OldRCID != oldRCID {
+		t.Errorf("expected old rc ID to be %s but was %s", oldRCID, details.OldRCID)
+	}
+
+	if details.ReplicasRemoved != 2 {
+		t.Errorf("expected 2 replicas removed but was %d", details.ReplicasRemoved)
+	}
+
+	if len(details.NewNodes) != len(newNodes) {
+		t.Errorf("expected %d new nodes but there were %d", len(newNodes), len(details.NewNodes))
+	}
+}
@@ -0,0 +1,286 @@
+// Package autoscale runs autoscalers, which set the desired replicas of
+// replication controllers to keep a metric close to a target.
+package autoscale
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/autoscale/fields"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/rc"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/autoscalestore"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Store lists the autoscalers to run
+type Store interface {
+	List() ([]fields.Autoscaler, error)
+}
+
+type RCStore interface {
+	Get(id rc_fields.ID) (rc_fields.RC, error)
+	CASDesiredReplicasTxn(ctx context.Context, id rc_fields.ID, expected int, n int) error
+}
+
+type RCLocker interface {
+	LockForMutation(rc_fields.ID, consul.Session) (consul.Unlocker, error)
+}
+
+type AuditLogStore interface {
+	Create(ctx context.Context, eventType audit.EventType, eventDetails json.RawMessage) error
+}
+
+type sessionFactory interface {
+	NewUnmanagedSession(session, name string) consul.Session
+}
+
+// The Farm runs every autoscaler it can lock. Multiple farms can run at once,
+// each with its own Consul session, and each autoscaler is run by only one
+// of them.
+//
+// Every interval the farm reads each autoscaler's metric and changes the
+// desired replicas of its RC if needed. The time of each autoscaler's last
+// change is kept in memory, so cooldowns start over when an autoscaler moves
+// to another farm.
+type Farm struct {
+	store          Store
+	rcStore        RCStore
+	rcLocker       RCLocker
+	sessionFactory sessionFactory
+	labeler        rc.LabelMatcher
+	healthChecker  HealthChecker
+	httpClient     *http.Client
+	auditLogStore  AuditLogStore
+	txner          transaction.Txner
+	sessions       <-chan string
+	interval       time.Duration
+	logger         logging.Logger
+
+	session    consul.Session
+	children   map[fields.ID]consul.Unlocker
+	lastScaled map[fields.ID]time.Time
+}
+
+func NewFarm(
+	store Store,
+	rcStore RCStore,
+	rcLocker RCLocker,
+	sessionFactory sessionFactory,
+	labeler rc.LabelMatcher,
+	healthChecker HealthChecker,
+	httpClient *http.Client,
+	auditLogStore AuditLogStore,
+	txner transaction.Txner,
+	sessions <-chan string,
+	interval time.Duration,
+	logger logging.Logger,
+) *Farm {
+	return &Farm{
+		store:          store,
+		rcStore:        rcStore,
+		rcLocker:       rcLocker,
+		sessionFactory: sessionFactory,
+		labeler:        labeler,
+		healthChecker:  healthChecker,
+		httpClient:     httpClient,
+		auditLogStore:  auditLogStore,
+		txner:          txner,
+		sessions:       sessions,
+		interval:       interval,
+		logger:         logger,
+		children:       make(map[fields.ID]consul.Unlocker),
+		lastScaled:     make(map[fields.ID]time.Time),
+	}
+}
+
+// Start is a blocking function that runs autoscalers until the quit channel
+// is closed, releasing all locks it holds.
+//
+// Start is not safe for concurrent execution. Do not execute multiple
+// concurrent instances of Start.
+func (f *Farm) Start(quit <-chan struct{}) {
+	consulutil.WithSession(quit, f.sessions, func(sessionQuit <-chan struct{}, session string) {
+		f.logger.WithField("session", session).Infoln("Acquired new session")
+		f.session = f.sessionFactory.NewUnmanagedSession(session, "")
+		f.mainLoop(sessionQuit)
+	})
+}
+
+func (f *Farm) mainLoop(quit <-chan struct{}) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-quit:
+			f.logger.NoFields().Infoln("Session expired, releasing autoscalers")
+			f.releaseChildren()
+			f.session = nil
+			return
+		case <-timer.C:
+		}
+		timer.Reset(f.interval)
+
+		autoscalers, err := f.store.List()
+		if err != nil {
+			f.logger.WithError(err).Errorln("Could not list autoscalers")
+			continue
+		}
+
+		found := make(map[fields.ID]struct{})
+		for _, autoscaler := range autoscalers {
+			found[autoscaler.ID] = struct{}{}
+			logger := f.logger.SubLogger(logrus.Fields{
+				"autoscaler": autoscaler.ID,
+				"rc":         autoscaler.RCID,
+			})
+
+			ok, err := f.claim(autoscaler.ID)
+			if err != nil {
+				logger.WithError(err).Errorln("Got error while locking autoscaler - session may be expired")
+				break
+			} else if !ok {
+				continue
+			}
+
+			err = f.autoscale(autoscaler, time.Now(), logger)
+			if err != nil {
+				logger.WithError(err).Errorln("Could not autoscale")
+			}
+		}
+		f.releaseDeletedChildren(found)
+	}
+}
+
+// claim returns whether this farm holds the autoscaler's lock, acquiring it
+// if nobody else holds it
+func (f *Farm) claim(id fields.ID) (bool, error) {
+	if _, ok := f.children[id]; ok {
+		return true, nil
+	}
+
+	unlocker, err := f.session.Lock(autoscalestore.LockPath(id))
+	switch {
+	case consul.IsAlreadyLocked(err):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	f.logger.WithField("autoscaler", id).Infoln("Acquired lock on autoscaler")
+	f.children[id] = unlocker
+	return true, nil
+}
+
+// autoscale reads the autoscaler's metric and moves its RC to the desired
+// replicas, unless the RC is being mutated (e.g. by a rolling update) or
+// the autoscaler's cooldown hasn't passed. Every change is recorded in the
+// audit log.
+func (f *Farm) autoscale(autoscaler fields.Autoscaler, now time.Time, logger logging.Logger) error {
+	rcFields, err := f.rcStore.Get(autoscaler.RCID)
+	if err != nil {
+		return util.Errorf("could not read replication controller: %s", err)
+	}
+
+	value, err := f.metricValue(autoscaler, rcFields)
+	if err != nil {
+		return err
+	}
+
+	current := rcFields.ReplicasDesired
+	desired := autoscaler.DesiredReplicas(current, value)
+	logger = logger.SubLogger(logrus.Fields{
+		"metric_value":     value,
+		"target_value":     autoscaler.TargetValue,
+		"current_replicas": current,
+		"desired_replicas": desired,
+	})
+	if desired == current {
+		logger.NoFields().Debugln("Not scaling")
+		return nil
+	}
+
+	cooldown := autoscaler.Cooldown(current, desired)
+	if last, ok := f.lastScaled[autoscaler.ID]; ok && now.Sub(last) < cooldown {
+		logger.WithField("cooldown", cooldown).Infoln("Not scaling until cooldown has passed")
+		return nil
+	}
+
+	// Rolling updates hold the RC's mutation lock while they change its
+	// replicas, so the autoscaler waits for them to finish
+	unlocker, err := f.rcLocker.LockForMutation(autoscaler.RCID, f.session)
+	switch {
+	case consul.IsAlreadyLocked(err):
+		logger.NoFields().Infoln("Not scaling, rc mutation lock is already held")
+		return nil
+	case err != nil:
+		return util.Errorf("could not acquire rc mutation lock: %s", err)
+	}
+	defer func() {
+		err := unlocker.Unlock()
+		if err != nil {
+			logger.WithError(err).Errorln("Could not release rc mutation lock")
+		}
+	}()
+
+	// the replica change and its audit record are committed together so
+	// that no change goes unrecorded
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
+	err = f.rcStore.CASDesiredReplicasTxn(ctx, autoscaler.RCID, current, desired)
+	if err != nil {
+		return util.Errorf("could not set desired replicas: %s", err)
+	}
+
+	details, err := audit.NewAutoscaleEventDetails(autoscaler, value, current, desired)
+	if err != nil {
+		return err
+	}
+	err = f.auditLogStore.Create(ctx, audit.AutoscaleEvent, details)
+	if err != nil {
+		return err
+	}
+
+	err = transaction.MustCommit(ctx, f.txner)
+	if err != nil {
+		return util.Errorf("could not set desired replicas: %s", err)
+	}
+	f.lastScaled[autoscaler.ID] = now
+	logger.NoFields().Infoln("Scaled replication controller")
+	return nil
+}
+
+func (f *Farm) releaseDeletedChildren(found map[fields.ID]struct{}) {
+	for id := range f.children {
+		if _, ok := found[id]; !ok {
+			f.releaseChild(id)
+		}
+	}
+}
+
+func (f *Farm) releaseChildren() {
+	for id := range f.children {
+		// it's safe to delete this element during iteration,
+		// because we have already iterated over it
+		f.releaseChild(id)
+	}
+}
+
+func (f *Farm) releaseChild(id fields.ID) {
+	f.logger.WithField("autoscaler", id).Infoln("Releasing autoscaler")
+	err := f.children[id].Unlock()
+	if err != nil {
+		f.logger.WithField("autoscaler", id).Warnln("Could not release autoscaler lock")
+	}
+	delete(f.children, id)
+	delete(f.lastScaled, id)
+}
@@ -0,0 +1,226 @@
+// +build !race
+
+package autoscale
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/autoscale/fields"
+	"github.com/square/p2/pkg/health"
+	fake_checker "github.com/square/p2/pkg/health/checker/test"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/rc"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/auditlogstore"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/store/consul/rcstore"
+	"github.com/square/p2/pkg/types"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+type fakeUnlocker struct{}
+
+func (fakeUnlocker) Unlock() error { return nil }
+func (fakeUnlocker) Key() string   { return "" }
+
+type fakeRCLocker struct {
+	locked bool
+}
+
+func (l fakeRCLocker) LockForMutation(rc_fields.ID, consul.Session) (consul.Unlocker, error) {
+	if l.locked {
+		return nil, consul.AlreadyLockedError{Key: "some_key"}
+	}
+	return fakeUnlocker{}, nil
+}
+
+type farmFixture struct {
+	farm          *Farm
+	rcStore       *rcstore.ConsulStore
+	applicator    labels.Applicator
+	auditLogStore auditlogstore.ConsulStore
+	rcFields      rc_fields.RC
+}
+
+func setupFarm(t *testing.T, fixture consulutil.Fixture, replicas int) farmFixture {
+	applicator := labels.NewConsulApplicator(fixture.Client, 0, 0)
+	rcStore := rcstore.NewConsul(fixture.Client, applicator, 0)
+
+	builder := manifest.NewBuilder()
+	builder.SetID("web")
+	rcFields, err := rcStore.Create(builder.GetManifest(), klabels.Everything(), "some_az", "some_cn", nil, nil, rc_fields.StaticStrategy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rcStore.SetDesiredReplicas(rcFields.ID, replicas)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auditLogStore := auditlogstore.NewConsulStore(fixture.Client.KV())
+	farm := NewFarm(
+		nil,
+		rcStore,
+		fakeRCLocker{},
+		nil,
+		applicator,
+		fake_checker.NewSingleService("web", nil),
+		http.DefaultClient,
+		auditLogStore,
+		fixture.Client.KV(),
+		nil,
+		time.Second,
+		logging.DefaultLogger,
+	)
+	return farmFixture{
+		farm:          farm,
+		rcStore:       rcStore,
+		applicator:    applicator,
+		auditLogStore: auditLogStore,
+		rcFields:      rcFields,
+	}
+}
+
+func (f farmFixture) replicas(t *testing.T) int {
+	rcFields, err := f.rcStore.Get(f.rcFields.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rcFields.ReplicasDesired
+}
+
+func metricServer(value string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"value": %s}`, value)
+	}))
+}
+
+func TestAutoscaleHTTPMetric(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+	f := setupFarm(t, fixture, 4)
+
+	server := metricServer("150")
+	defer server.Close()
+
+	autoscaler := fields.Autoscaler{
+		ID:          "some_autoscaler",
+		RCID:        f.rcFields.ID,
+		MinReplicas: 1,
+		MaxReplicas: 10,
+		Metric:      fields.Metric{Type: fields.HTTPMetric, URL: server.URL},
+		TargetValue: 100,
+	}
+	err := f.farm.autoscale(autoscaler, time.Now(), logging.DefaultLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replicas := f.replicas(t); replicas != 6 {
+		t.Fatalf("expected the rc to be scaled to 6 replicas but it has %d", replicas)
+	}
+
+	records, err := f.auditLogStore.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected 1 audit log record but there were %d", len(records))
+	}
+	for _, record := range records {
+		if record.EventType != audit.AutoscaleEvent {
+			t.Errorf("expected audit log record of type %s but was %s", audit.AutoscaleEvent, record.EventType)
+		}
+	}
+}
+
+func TestAutoscaleRespectsCooldownAndMutationLock(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+	f := setupFarm(t, fixture, 4)
+
+	server := metricServer("50")
+	defer server.Close()
+
+	autoscaler := fields.Autoscaler{
+		ID:                "some_autoscaler",
+		RCID:              f.rcFields.ID,
+		MinReplicas:       1,
+		MaxReplicas:       10,
+		Metric:            fields.Metric{Type: fields.HTTPMetric, URL: server.URL},
+		TargetValue:       100,
+		ScaleDownCooldown: time.Hour,
+	}
+
+	now := time.Now()
+	f.farm.lastScaled[autoscaler.ID] = now.Add(-time.Minute)
+	err := f.farm.autoscale(autoscaler, now, logging.DefaultLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replicas := f.replicas(t); replicas != 4 {
+		t.Fatalf("expected the rc not to be scaled during the cooldown but it has %d replicas", replicas)
+	}
+
+	f.farm.lastScaled[autoscaler.ID] = now.Add(-2 * time.Hour)
+	f.farm.rcLocker = fakeRCLocker{locked: true}
+	err = f.farm.autoscale(autoscaler, now, logging.DefaultLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replicas := f.replicas(t); replicas != 4 {
+		t.Fatalf("expected the rc not to be scaled while it is locked but it has %d replicas", replicas)
+	}
+
+	f.farm.rcLocker = fakeRCLocker{}
+	err = f.farm.autoscale(autoscaler, now, logging.DefaultLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replicas := f.replicas(t); replicas != 2 {
+		t.Fatalf("expected the rc to be scaled to 2 replicas but it has %d", replicas)
+	}
+}
+
+func TestAutoscaleHealthMetric(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+	f := setupFarm(t, fixture, 4)
+
+	healths := make(map[types.NodeName]health.Result)
+	for i := 0; i < 4; i++ {
+		node := types.NodeName(fmt.Sprintf("node%d", i))
+		err := f.applicator.SetLabel(labels.POD, labels.MakePodLabelKey(node, "web"), rc.RCIDLabel, f.rcFields.ID.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i < 2 {
+			healths[node] = health.Result{Status: health.Passing}
+		}
+	}
+	f.farm.healthChecker = fake_checker.NewSingleService("web", healths)
+
+	autoscaler := fields.Autoscaler{
+		ID:          "some_autoscaler",
+		RCID:        f.rcFields.ID,
+		MinReplicas: 1,
+		MaxReplicas: 10,
+		Metric:      fields.Metric{Type: fields.HealthMetric},
+		TargetValue: 0.9,
+	}
+	err := f.farm.autoscale(autoscaler, time.Now(), logging.DefaultLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replicas := f.replicas(t); replicas != 8 {
+		t.Fatalf("expected the rc to be scaled to 8 replicas but it has %d", replicas)
+	}
+}
@@ -0,0 +1,136 @@
+package fields
+
+import (
+	"math"
+	"net/url"
+	"time"
+
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/util"
+)
+
+// ID is the unique identifier of an autoscaler
+type ID string
+
+func (id ID) String() string { return string(id) }
+
+type MetricType string
+
+const (
+	// HealthMetric is the fraction of the RC's pods that are healthy.
+	// Replicas are added while it is below the target, so that the healthy
+	// pods make up for the unhealthy ones.
+	HealthMetric MetricType = "health"
+
+	// HTTPMetric is a per-replica value, such as requests per second per
+	// pod, read from an HTTP endpoint that responds with JSON of the form
+	// {"value": 1.5}. Replicas are added while it is above the target and
+	// removed while it is below.
+	HTTPMetric MetricType = "http"
+)
+
+// Metric is the source of the value an autoscaler compares to its target
+type Metric struct {
+	Type MetricType `json:"type"`
+
+	// URL is the endpoint of an HTTPMetric
+	URL string `json:"url,omitempty"`
+}
+
+// Tolerance is how far the ratio of a metric to its target may be from 1
+// before replicas are changed. It keeps noisy metrics from causing scaling
+// back and forth.
+const Tolerance = 0.1
+
+// An Autoscaler sets the desired replicas of a replication controller,
+// between a minimum and a maximum, to keep a metric close to a target value.
+type Autoscaler struct {
+	ID   ID           `json:"id"`
+	RCID rc_fields.ID `json:"rc_id"`
+
+	MinReplicas int `json:"min_replicas"`
+	MaxReplicas int `json:"max_replicas"`
+
+	Metric      Metric  `json:"metric"`
+	TargetValue float64 `json:"target_value"`
+
+	// ScaleUpCooldown and ScaleDownCooldown are how long the autoscaler
+	// waits after changing the RC's replicas before adding or removing
+	// replicas, respectively
+	ScaleUpCooldown   time.Duration `json:"scale_up_cooldown"`
+	ScaleDownCooldown time.Duration `json:"scale_down_cooldown"`
+}
+
+// Validate checks that the autoscaler targets an RC, has a sensible replica
+// range and a metric it knows how to read
+func (a Autoscaler) Validate() error {
+	if a.RCID == "" {
+		return util.Errorf("autoscaler must target a replication controller")
+	}
+	if a.MinReplicas < 0 {
+		return util.Errorf("autoscaler min replicas cannot be negative")
+	}
+	if a.MaxReplicas < a.MinReplicas || a.MaxReplicas == 0 {
+		return util.Errorf("autoscaler max replicas must be positive and at least min replicas (%d)", a.MinReplicas)
+	}
+	if a.TargetValue <= 0 {
+		return util.Errorf("autoscaler target value must be positive")
+	}
+	if a.ScaleUpCooldown < 0 || a.ScaleDownCooldown < 0 {
+		return util.Errorf("autoscaler cooldowns cannot be negative")
+	}
+
+	switch a.Metric.Type {
+	case HealthMetric:
+		if a.TargetValue > 1 {
+			return util.Errorf("autoscaler target value for the %s metric is a fraction and cannot be more than 1", HealthMetric)
+		}
+	case HTTPMetric:
+		if _, err := url.ParseRequestURI(a.Metric.URL); err != nil {
+			return util.Errorf("could not parse autoscaler metric url %q: %s", a.Metric.URL, err)
+		}
+	default:
+		return util.Errorf("unknown autoscaler metric type %q", a.Metric.Type)
+	}
+	return nil
+}
+
+// DesiredReplicas returns the replicas that would bring the metric to the
+// target given the current replicas and the current value of the metric,
+// within the autoscaler's replica range. The current replicas are kept when
+// the metric is within Tolerance of the target.
+func (a Autoscaler) DesiredReplicas(current int, value float64) int {
+	var ratio float64
+	switch {
+	case a.Metric.Type == HealthMetric && value <= 0:
+		// There are no healthy pods to compare against, which more
+		// likely means a broken deploy than too little capacity
+		ratio = 1
+	case a.Metric.Type == HealthMetric:
+		ratio = a.TargetValue / value
+	default:
+		ratio = value / a.TargetValue
+	}
+
+	desired := current
+	if math.Abs(ratio-1) > Tolerance {
+		desired = int(math.Ceil(float64(current) * ratio))
+	}
+
+	if desired < a.MinReplicas {
+		return a.MinReplicas
+	}
+	if desired > a.MaxReplicas {
+		return a.MaxReplicas
+	}
+	return desired
+}
+
+// Cooldown returns how long the autoscaler must wait after its last change
+// before moving the RC from current to desired replicas
+func (a Autoscaler) Cooldown(current int, desired int) time.Duration {
+	if desired > current {
+		return a.ScaleUpCooldown
+	}
+	return a.ScaleDownCooldown
+}
@@ -0,0 +1,75 @@
+package fields
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	valid := Autoscaler{
+		RCID:        "some_rc",
+		MinReplicas: 2,
+		MaxReplicas: 10,
+		Metric:      Metric{Type: HTTPMetric, URL: "http://localhost:8080/load"},
+		TargetValue: 100,
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected autoscaler to be valid: %s", err)
+	}
+
+	invalid := []func(a *Autoscaler){
+		func(a *Autoscaler) { a.RCID = "" },
+		func(a *Autoscaler) { a.MaxReplicas = 1 },
+		func(a *Autoscaler) { a.TargetValue = 0 },
+		func(a *Autoscaler) { a.ScaleDownCooldown = -time.Minute },
+		func(a *Autoscaler) { a.Metric.URL = "" },
+		func(a *Autoscaler) { a.Metric = Metric{Type: HealthMetric} },
+		func(a *Autoscaler) { a.Metric = Metric{Type: "cpu"} },
+	}
+	for i, mutate := range invalid {
+		a := valid
+		mutate(&a)
+		if err := a.Validate(); err == nil {
+			t.Errorf("expected autoscaler %d to be invalid: %+v", i, a)
+		}
+	}
+}
+
+func TestDesiredReplicas(t *testing.T) {
+	http := Autoscaler{
+		MinReplicas: 2,
+		MaxReplicas: 10,
+		Metric:      Metric{Type: HTTPMetric},
+		TargetValue: 100,
+	}
+	health := Autoscaler{
+		MinReplicas: 2,
+		MaxReplicas: 10,
+		Metric:      Metric{Type: HealthMetric},
+		TargetValue: 0.9,
+	}
+
+	tests := []struct {
+		name       string
+		autoscaler Autoscaler
+		current    int
+		value      float64
+		expected   int
+	}{
+		{"http above target", http, 4, 150, 6},
+		{"http below target", http, 4, 50, 2},
+		{"http within tolerance", http, 4, 105, 4},
+		{"http clamped to max", http, 8, 300, 10},
+		{"http clamped to min", http, 4, 10, 2},
+		{"health below target", health, 4, 0.5, 8},
+		{"health at target", health, 4, 0.9, 4},
+		{"health all healthy", health, 4, 1, 4},
+		{"health none healthy", health, 4, 0, 4},
+	}
+	for _, test := range tests {
+		actual := test.autoscaler.DesiredReplicas(test.current, test.value)
+		if actual != test.expected {
+			t.Errorf("%s: expected %d replicas but got %d", test.name, test.expected, actual)
+		}
+	}
+}
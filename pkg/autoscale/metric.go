@@ -0,0 +1,88 @@
+package autoscale
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/square/p2/pkg/autoscale/fields"
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/rc"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+type HealthChecker interface {
+	Service(serviceID string) (map[types.NodeName]health.Result, error)
+}
+
+// httpMetricResponse is the JSON an HTTP metric endpoint responds with
+type httpMetricResponse struct {
+	Value *float64 `json:"value"`
+}
+
+// metricValue reads the current value of the autoscaler's metric
+func (f *Farm) metricValue(autoscaler fields.Autoscaler, rcFields rc_fields.RC) (float64, error) {
+	switch autoscaler.Metric.Type {
+	case fields.HealthMetric:
+		return f.healthyFraction(rcFields)
+	case fields.HTTPMetric:
+		return f.httpValue(autoscaler.Metric.URL)
+	default:
+		return 0, util.Errorf("unknown autoscaler metric type %q", autoscaler.Metric.Type)
+	}
+}
+
+// healthyFraction returns the fraction of the RC's current pods that are
+// passing their health checks
+func (f *Farm) healthyFraction(rcFields rc_fields.RC) (float64, error) {
+	current, err := rc.CurrentPods(rcFields.ID, f.labeler)
+	if err != nil {
+		return 0, util.Errorf("could not get current pods of %s: %s", rcFields.ID, err)
+	}
+	if len(current) == 0 {
+		return 0, util.Errorf("replication controller %s has no pods to check the health of", rcFields.ID)
+	}
+
+	service := rcFields.Manifest.ID().String()
+	healths, err := f.healthChecker.Service(service)
+	if err != nil {
+		return 0, util.Errorf("could not get %s health: %s", service, err)
+	}
+
+	healthy := 0
+	for _, pod := range current {
+		if result, ok := healths[pod.Node]; ok && result.Status == health.Passing {
+			healthy++
+		}
+	}
+	return float64(healthy) / float64(len(current)), nil
+}
+
+// httpValue reads the value from an HTTP metric endpoint
+func (f *Farm) httpValue(url string) (float64, error) {
+	resp, err := f.httpClient.Get(url)
+	if err != nil {
+		return 0, util.Errorf("could not read autoscaler metric from %s: %s", url, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, util.Errorf("could not read autoscaler metric from %s: %s", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, util.Errorf("autoscaler metric endpoint %s responded with %d: %s", url, resp.StatusCode, body)
+	}
+
+	var metric httpMetricResponse
+	err = json.Unmarshal(body, &metric)
+	if err != nil {
+		return 0, util.Errorf("could not unmarshal autoscaler metric from %s: %s", url, err)
+	}
+	if metric.Value == nil {
+		return 0, util.Errorf("autoscaler metric endpoint %s responded without a value", url)
+	}
+	return *metric.Value, nil
+}
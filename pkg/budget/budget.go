@@ -0,0 +1,182 @@
+// Package budget decides whether a voluntary disruption to pods is allowed by
+// the disruption budgets that cover them.
+package budget
+
+import (
+	"strings"
+
+	"github.com/square/p2/pkg/budget/fields"
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+// Store lists the disruption budgets to enforce
+type Store interface {
+	List() ([]fields.Budget, error)
+}
+
+type Labeler interface {
+	GetMatches(selector klabels.Selector, labelType labels.Type) ([]labels.Labeled, error)
+}
+
+type HealthChecker interface {
+	Service(serviceID string) (map[types.NodeName]health.Result, error)
+}
+
+// Checker evaluates disruptions against the disruption budgets in a store.
+// Budgets cover pods by their pod labels, so only pods labeled by node and pod
+// ID (such as those scheduled by replication controllers) are counted.
+type Checker struct {
+	store         Store
+	labeler       Labeler
+	healthChecker HealthChecker
+}
+
+func NewChecker(store Store, labeler Labeler, healthChecker HealthChecker) Checker {
+	return Checker{
+		store:         store,
+		labeler:       labeler,
+		healthChecker: healthChecker,
+	}
+}
+
+// Violation is a disruption budget that a disruption would break
+type Violation struct {
+	Budget fields.Budget
+	Err    error
+}
+
+// Result describes how the disruption budgets covering a disruption would be
+// affected by it
+type Result struct {
+	// Covering are the budgets that cover at least one of the disrupted pods
+	Covering []fields.Budget
+
+	// Violations are the covering budgets that the disruption would break
+	Violations []Violation
+}
+
+// Allowed returns true if no disruption budget would be broken
+func (r Result) Allowed() bool {
+	return len(r.Violations) == 0
+}
+
+// Err returns an error describing every violation, or nil if the disruption
+// is allowed
+func (r Result) Err() error {
+	if r.Allowed() {
+		return nil
+	}
+	msgs := make([]string, len(r.Violations))
+	for i, violation := range r.Violations {
+		msgs[i] = violation.Err.Error()
+	}
+	return util.Errorf("%s", strings.Join(msgs, "; "))
+}
+
+// ViolatedIDs returns the IDs of the budgets that would be broken
+func (r Result) ViolatedIDs() []fields.ID {
+	ids := make([]fields.ID, len(r.Violations))
+	for i, violation := range r.Violations {
+		ids[i] = violation.Budget.ID
+	}
+	return ids
+}
+
+// Check evaluates making the given pods unavailable against every disruption
+// budget that covers any of them
+func (c Checker) Check(disrupted types.PodLocations) (Result, error) {
+	var result Result
+	if len(disrupted) == 0 {
+		return result, nil
+	}
+
+	budgets, err := c.store.List()
+	if err != nil {
+		return result, util.Errorf("could not list disruption budgets: %s", err)
+	}
+
+	healths := make(map[types.PodID]map[types.NodeName]health.Result)
+	healthy := func(pod types.PodLocation) (bool, error) {
+		podHealths, ok := healths[pod.PodID]
+		if !ok {
+			var err error
+			podHealths, err = c.healthChecker.Service(pod.PodID.String())
+			if err != nil {
+				return false, util.Errorf("could not get %s health: %s", pod.PodID, err)
+			}
+			healths[pod.PodID] = podHealths
+		}
+		hlth, ok := podHealths[pod.Node]
+		return ok && hlth.Status == health.Passing, nil
+	}
+
+	disruptedSet := make(map[types.PodLocation]bool, len(disrupted))
+	for _, pod := range disrupted {
+		disruptedSet[pod] = true
+	}
+
+	for _, budget := range budgets {
+		covered, err := c.coveredPods(budget)
+		if err != nil {
+			return result, err
+		}
+
+		total, healthyCount, disruptedCount := 0, 0, 0
+		coversDisrupted := false
+		for _, pod := range covered {
+			total++
+			isHealthy, err := healthy(pod)
+			if err != nil {
+				return result, err
+			}
+			if disruptedSet[pod] {
+				coversDisrupted = true
+			}
+			if !isHealthy {
+				continue
+			}
+			healthyCount++
+			if disruptedSet[pod] {
+				disruptedCount++
+			}
+		}
+		if !coversDisrupted {
+			continue
+		}
+
+		result.Covering = append(result.Covering, budget)
+		err = budget.Check(total, healthyCount, disruptedCount)
+		if err != nil {
+			result.Violations = append(result.Violations, Violation{Budget: budget, Err: err})
+		}
+	}
+	return result, nil
+}
+
+func (c Checker) coveredPods(budget fields.Budget) (types.PodLocations, error) {
+	selector, err := budget.PodSelector()
+	if err != nil {
+		return nil, err
+	}
+	labeled, err := c.labeler.GetMatches(selector, labels.POD)
+	if err != nil {
+		return nil, util.Errorf("could not find pods covered by disruption budget %s: %s", budget.ID, err)
+	}
+
+	pods := make(types.PodLocations, 0, len(labeled))
+	for _, l := range labeled {
+		node, podID, err := labels.NodeAndPodIDFromPodLabel(l)
+		if err != nil {
+			// pods keyed by a unique key rather than by node can't be
+			// matched to health results
+			continue
+		}
+		pods = append(pods, types.PodLocation{Node: node, PodID: podID})
+	}
+	return pods, nil
+}
@@ -0,0 +1,149 @@
+package budget
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/budget/fields"
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/store/consul/auditlogstore"
+	"github.com/square/p2/pkg/types"
+
+	"github.com/hashicorp/consul/api"
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+type fakeStore []fields.Budget
+
+func (f fakeStore) List() ([]fields.Budget, error) {
+	return f, nil
+}
+
+type fakeLabeler []labels.Labeled
+
+func (f fakeLabeler) GetMatches(selector klabels.Selector, labelType labels.Type) ([]labels.Labeled, error) {
+	var matches []labels.Labeled
+	for _, l := range f {
+		if l.LabelType == labelType && selector.Matches(l.Labels) {
+			matches = append(matches, l)
+		}
+	}
+	return matches, nil
+}
+
+type fakeHealthChecker map[types.PodID]map[types.NodeName]health.Result
+
+func (f fakeHealthChecker) Service(serviceID string) (map[types.NodeName]health.Result, error) {
+	return f[types.PodID(serviceID)], nil
+}
+
+// fakeTxner just records the operations it gets
+type fakeTxner struct {
+	ops api.KVTxnOps
+}
+
+func (f *fakeTxner) Txn(txn api.KVTxnOps, q *api.QueryOptions) (bool, *api.KVTxnResponse, *api.QueryMeta, error) {
+	f.ops = txn
+	return true, new(api.KVTxnResponse), new(api.QueryMeta), nil
+}
+
+func podLabel(node types.NodeName, podID types.PodID) labels.Labeled {
+	return labels.Labeled{
+		LabelType: labels.POD,
+		ID:        labels.MakePodLabelKey(node, podID),
+		Labels:    klabels.Set{types.PodIDLabel: podID.String()},
+	}
+}
+
+func TestCheck(t *testing.T) {
+	labeler := fakeLabeler{
+		podLabel("node1", "web"),
+		podLabel("node2", "web"),
+		podLabel("node3", "web"),
+		podLabel("node1", "db"),
+	}
+	healthChecker := fakeHealthChecker{
+		"web": {
+			"node1": {Status: health.Passing},
+			"node2": {Status: health.Passing},
+			"node3": {Status: health.Critical},
+		},
+		"db": {
+			"node1": {Status: health.Passing},
+		},
+	}
+	store := fakeStore{{ID: "web-budget", PodID: "web", MinAvailable: 1}}
+	checker := NewChecker(store, labeler, healthChecker)
+
+	result, err := checker.Check(types.PodLocations{{Node: "node1", PodID: "web"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Allowed() || len(result.Covering) != 1 {
+		t.Errorf("expected disrupting one healthy web pod to be allowed by the covering budget but got %+v", result)
+	}
+
+	result, err = checker.Check(types.PodLocations{{Node: "node1", PodID: "web"}, {Node: "node2", PodID: "web"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Allowed() {
+		t.Error("expected disrupting both healthy web pods to break the budget")
+	}
+	if ids := result.ViolatedIDs(); len(ids) != 1 || ids[0] != "web-budget" {
+		t.Errorf("expected web-budget to be violated but got %s", ids)
+	}
+	if result.Err() == nil {
+		t.Error("expected a violated result to have an error")
+	}
+
+	result, err = checker.Check(types.PodLocations{{Node: "node1", PodID: "db"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Allowed() || len(result.Covering) != 0 {
+		t.Errorf("expected no budget to cover the db pod but got %+v", result)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	labeler := fakeLabeler{
+		podLabel("node1", "web"),
+		podLabel("node2", "web"),
+	}
+	healthChecker := fakeHealthChecker{
+		"web": {
+			"node1": {Status: health.Passing},
+			"node2": {Status: health.Passing},
+		},
+	}
+	store := fakeStore{{ID: "web-budget", PodID: "web", MaxUnavailable: 1}}
+	checker := NewChecker(store, labeler, healthChecker)
+	auditLogStore := auditlogstore.NewConsulStore(nil)
+
+	txner := &fakeTxner{}
+	err := checker.Authorize(types.PodLocations{{Node: "node1", PodID: "web"}}, false, "p2-rm", "some_user", auditLogStore, txner)
+	if err != nil {
+		t.Errorf("expected a disruption within the budget to be authorized but got %s", err)
+	}
+	if len(txner.ops) != 0 {
+		t.Errorf("expected no audit log record when the budget is honored but got %d operations", len(txner.ops))
+	}
+
+	both := types.PodLocations{{Node: "node1", PodID: "web"}, {Node: "node2", PodID: "web"}}
+	err = checker.Authorize(both, false, "p2-rm", "some_user", auditLogStore, txner)
+	if err == nil {
+		t.Error("expected a disruption breaking the budget to be refused")
+	}
+	if len(txner.ops) != 0 {
+		t.Errorf("expected no audit log record when the disruption is refused but got %d operations", len(txner.ops))
+	}
+
+	err = checker.Authorize(both, true, "p2-rm", "some_user", auditLogStore, txner)
+	if err != nil {
+		t.Errorf("expected a forced disruption to be authorized but got %s", err)
+	}
+	if len(txner.ops) != 1 {
+		t.Errorf("expected the forced disruption to be audited with a single operation but got %d", len(txner.ops))
+	}
+}
@@ -0,0 +1,89 @@
+package fields
+
+import (
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+// ID is the unique identifier of a disruption budget
+type ID string
+
+func (id ID) String() string { return string(id) }
+
+// A Budget limits how many pods of a set may be made unavailable at once by
+// voluntary disruptions such as node transfers, replica decreases, p2-rm and
+// p2-shutdown. The pods a budget covers are chosen by their pod labels.
+type Budget struct {
+	ID ID `json:"id"`
+
+	// PodID optionally limits the budget to pods with the given pod ID
+	PodID types.PodID `json:"pod_id,omitempty"`
+
+	// Selector optionally limits the budget to pods whose labels match it
+	Selector string `json:"selector,omitempty"`
+
+	// MinAvailable is the number of covered pods that must stay healthy
+	MinAvailable int `json:"min_available,omitempty"`
+
+	// MaxUnavailable is the number of covered pods that may be unhealthy or
+	// disrupted at the same time
+	MaxUnavailable int `json:"max_unavailable,omitempty"`
+}
+
+// Validate checks that the budget covers some pods and states exactly one
+// limit
+func (b Budget) Validate() error {
+	if b.PodID == "" && b.Selector == "" {
+		return util.Errorf("disruption budget must have a pod ID or a selector")
+	}
+	if _, err := klabels.Parse(b.Selector); err != nil {
+		return util.Errorf("could not parse disruption budget selector %q: %s", b.Selector, err)
+	}
+	if b.MinAvailable < 0 || b.MaxUnavailable < 0 {
+		return util.Errorf("disruption budget limits cannot be negative")
+	}
+	if (b.MinAvailable > 0) == (b.MaxUnavailable > 0) {
+		return util.Errorf("disruption budget must set exactly one of a positive min available or max unavailable")
+	}
+	return nil
+}
+
+// PodSelector returns a selector matching the pod labels of every pod the
+// budget covers
+func (b Budget) PodSelector() (klabels.Selector, error) {
+	selector, err := klabels.Parse(b.Selector)
+	if err != nil {
+		return nil, util.Errorf("could not parse selector of disruption budget %s: %s", b.ID, err)
+	}
+	if b.PodID != "" {
+		selector = selector.Add(types.PodIDLabel, klabels.EqualsOperator, []string{b.PodID.String()})
+	}
+	return selector, nil
+}
+
+// Check returns an error if disrupting the given number of healthy pods, out
+// of the total number of covered pods and how many of them are healthy, would
+// break the budget. Disrupting only unhealthy pods never breaks a budget
+// because it does not make anything less available.
+func (b Budget) Check(total int, healthy int, disrupted int) error {
+	if disrupted == 0 {
+		return nil
+	}
+
+	available := healthy - disrupted
+	if b.MinAvailable > 0 && available < b.MinAvailable {
+		return util.Errorf(
+			"disruption budget %s requires %d available pods but only %d of %d would be",
+			b.ID, b.MinAvailable, available, total,
+		)
+	}
+	if b.MaxUnavailable > 0 && total-available > b.MaxUnavailable {
+		return util.Errorf(
+			"disruption budget %s allows %d unavailable pods but %d of %d would be",
+			b.ID, b.MaxUnavailable, total-available, total,
+		)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package fields
+
+import (
+	"testing"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+func TestCheck(t *testing.T) {
+	minAvailable := Budget{ID: "min", PodID: "web", MinAvailable: 3}
+	if err := minAvailable.Check(5, 4, 1); err != nil {
+		t.Errorf("expected disrupting one of four healthy pods to leave three available but got %s", err)
+	}
+	if err := minAvailable.Check(5, 4, 2); err == nil {
+		t.Error("expected disrupting two of four healthy pods to break a min available of three")
+	}
+	if err := minAvailable.Check(5, 2, 0); err != nil {
+		t.Errorf("expected disrupting only unhealthy pods to be allowed but got %s", err)
+	}
+
+	maxUnavailable := Budget{ID: "max", PodID: "web", MaxUnavailable: 2}
+	if err := maxUnavailable.Check(5, 5, 2); err != nil {
+		t.Errorf("expected disrupting two of five healthy pods to be allowed but got %s", err)
+	}
+	if err := maxUnavailable.Check(5, 4, 2); err == nil {
+		t.Error("expected disrupting two healthy pods while one is unhealthy to break a max unavailable of two")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := []Budget{
+		{PodID: "web", MinAvailable: 2},
+		{Selector: "environment=production", MaxUnavailable: 1},
+	}
+	for _, b := range valid {
+		if err := b.Validate(); err != nil {
+			t.Errorf("expected %+v to be valid but got %s", b, err)
+		}
+	}
+
+	invalid := []Budget{
+		{MinAvailable: 2},
+		{PodID: "web"},
+		{PodID: "web", MinAvailable: 2, MaxUnavailable: 1},
+		{PodID: "web", Selector: "environment in (production", MinAvailable: 2},
+	}
+	for _, b := range invalid {
+		if err := b.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", b)
+		}
+	}
+}
+
+func TestPodSelector(t *testing.T) {
+	b := Budget{PodID: "web", Selector: "environment=production", MinAvailable: 1}
+	selector, err := b.PodSelector()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !selector.Matches(klabels.Set{"pod_id": "web", "environment": "production"}) {
+		t.Error("expected the budget to cover a production web pod")
+	}
+	if selector.Matches(klabels.Set{"pod_id": "db", "environment": "production"}) {
+		t.Error("expected the budget not to cover a pod with another pod ID")
+	}
+	if selector.Matches(klabels.Set{"pod_id": "web", "environment": "staging"}) {
+		t.Error("expected the budget not to cover a pod its selector doesn't match")
+	}
+}
@@ -0,0 +1,56 @@
+package budget
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+type AuditLogStore interface {
+	Create(ctx context.Context, eventType audit.EventType, eventDetails json.RawMessage) error
+}
+
+// Authorize is used by operator tools such as p2-rm and p2-shutdown before
+// they take pods down. A disruption that breaks a budget is refused unless
+// force is set, in which case the override is recorded in the audit log
+// before returning.
+func (c Checker) Authorize(
+	disrupted types.PodLocations,
+	force bool,
+	command string,
+	user string,
+	auditLogStore AuditLogStore,
+	txner transaction.Txner,
+) error {
+	result, err := c.Check(disrupted)
+	if err != nil {
+		return err
+	}
+	if result.Allowed() {
+		return nil
+	}
+	if !force {
+		return util.Errorf("%s. Pass --force to disrupt the pods anyway", result.Err())
+	}
+
+	details, err := audit.NewDisruptionBudgetOverrideEventDetails(result.ViolatedIDs(), disrupted, command, user)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
+	err = auditLogStore.Create(ctx, audit.DisruptionBudgetOverrideEvent, details)
+	if err != nil {
+		return err
+	}
+	err = transaction.MustCommit(ctx, txner)
+	if err != nil {
+		return util.Errorf("could not record disruption budget override in the audit log: %s", err)
+	}
+	return nil
+}
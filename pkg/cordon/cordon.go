@@ -0,0 +1,87 @@
+// Package cordon keeps nodes from receiving new pods. A cordoned node keeps
+// the pods it already has, while a draining node is additionally considered
+// ineligible by replication controllers, so that their pods are moved off of
+// it. Daemon sets run a pod on every node they select, so there is nowhere
+// to move theirs to and they treat draining nodes as cordoned.
+//
+// The state of a node is held in a node label so that it applies regardless
+// of the node selectors of the controllers.
+package cordon
+
+import (
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// StateLabel is the node label holding whether a node is cordoned or draining
+const StateLabel = "p2_cordon"
+
+type State string
+
+const (
+	// Cordoned nodes don't receive new pods but keep the ones they have
+	Cordoned State = "cordoned"
+
+	// Draining nodes don't receive new pods and have their pods moved off
+	Draining State = "draining"
+)
+
+type NodeLabeler interface {
+	GetMatches(klabels.Selector, labels.Type) ([]labels.Labeled, error)
+}
+
+// States maps the nodes that are cordoned or draining to their state. Nodes
+// missing from the map may be scheduled on normally.
+type States map[types.NodeName]State
+
+// GetStates returns the states of every cordoned or draining node
+func GetStates(labeler NodeLabeler) (States, error) {
+	selector := klabels.Everything().Add(StateLabel, klabels.ExistsOperator, nil)
+	nodes, err := labeler.GetMatches(selector, labels.NODE)
+	if err != nil {
+		return nil, util.Errorf("could not list cordoned nodes: %s", err)
+	}
+
+	ret := make(States, len(nodes))
+	for _, node := range nodes {
+		ret[types.NodeName(node.ID)] = State(node.Labels.Get(StateLabel))
+	}
+	return ret, nil
+}
+
+// Schedulable returns whether new pods may be scheduled on the node
+func (s States) Schedulable(node types.NodeName) bool {
+	_, ok := s[node]
+	return !ok
+}
+
+// Draining returns whether pods should be moved off of the node
+func (s States) Draining(node types.NodeName) bool {
+	return s[node] == Draining
+}
+
+// WithoutDrain returns the states with draining nodes treated as cordoned
+func (s States) WithoutDrain() States {
+	ret := make(States, len(s))
+	for node := range s {
+		ret[node] = Cordoned
+	}
+	return ret
+}
+
+// Eligible returns the nodes that a controller currently on the current nodes
+// should consider eligible: nodes it may schedule new pods on, plus cordoned
+// nodes it already has a pod on
+func (s States) Eligible(nodes []types.NodeName, current []types.NodeName) []types.NodeName {
+	currentSet := types.NewNodeSet(current...)
+	var ret []types.NodeName
+	for _, node := range nodes {
+		if s.Schedulable(node) || (!s.Draining(node) && currentSet.Has(node.String())) {
+			ret = append(ret, node)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,50 @@
+package cordon
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestEligible(t *testing.T) {
+	applicator := labels.NewFakeApplicator()
+	for node, state := range map[string]State{"cordoned": Cordoned, "draining": Draining} {
+		err := applicator.SetLabel(labels.NODE, node, StateLabel, string(state))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := applicator.SetLabel(labels.NODE, "normal", "pool", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	states, err := GetStates(applicator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 2 {
+		t.Fatalf("expected 2 cordoned or draining nodes, got %v", states)
+	}
+
+	all := []types.NodeName{"normal", "cordoned", "draining"}
+	eligible := states.Eligible(all, nil)
+	if !types.NewNodeSet(eligible...).Equal(types.NewNodeSet("normal")) {
+		t.Errorf("expected only the normal node to be eligible without current pods, got %v", eligible)
+	}
+
+	eligible = states.Eligible(all, all)
+	if !types.NewNodeSet(eligible...).Equal(types.NewNodeSet("normal", "cordoned")) {
+		t.Errorf("expected cordoned nodes with a pod to stay eligible, got %v", eligible)
+	}
+
+	eligible = states.WithoutDrain().Eligible(all, all)
+	if !types.NewNodeSet(eligible...).Equal(types.NewNodeSet("normal", "cordoned", "draining")) {
+		t.Errorf("expected draining nodes with a pod to stay eligible without drain, got %v", eligible)
+	}
+	eligible = states.WithoutDrain().Eligible(all, nil)
+	if !types.NewNodeSet(eligible...).Equal(types.NewNodeSet("normal")) {
+		t.Errorf("expected draining nodes to get no new pods without drain, got %v", eligible)
+	}
+}
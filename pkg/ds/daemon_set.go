@@ -9,6 +9,8 @@ import (
 	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/square/p2/pkg/alerting"
+	"github.com/square/p2/pkg/cordon"
 	"github.com/square/p2/pkg/ds/fields"
 	"github.com/square/p2/pkg/health"
 	"github.com/square/p2/pkg/health/checker"
@@ -76,7 +78,7 @@ type DaemonSet interface {
 	// CurrentPods() returns all nodes that are scheduled by this daemon set
 	CurrentPods() (types.PodLocations, error)
 
-	Replicate(context.Context, <-chan []types.NodeName, <-chan struct{}, <-chan struct{}, <-chan manifest.Manifest, <-chan time.Duration)
+	Replicate(context.Context, <-chan []types.NodeName, <-chan struct{}, <-chan struct{}, <-chan manifest.Manifest, <-chan time.Duration, <-chan int, <-chan time.Duration)
 }
 
 type Labeler interface {
@@ -104,6 +106,7 @@ type LabelWatcher interface {
 type store interface {
 	DeletePodTxn(ctx context.Context, podPrefix consul.PodPrefix, nodename types.NodeName, podID types.PodID) error
 	NewUnmanagedSession(session, name string) consul.Session
+	AllPods(podPrefix consul.PodPrefix) ([]consul.ManifestResult, time.Duration, error)
 
 	// For passing to the replication package:
 	replication.Store
@@ -142,6 +145,12 @@ type daemonSet struct {
 	healthChecker         *checker.HealthChecker
 	healthWatchDelay      time.Duration
 	statusWritingInterval time.Duration
+	alerter               alerting.Alerter
+
+	// haltReason is set when the daemon set disabled itself because it
+	// exceeded its failure budget, and is cleared when it is enabled
+	// again. Access to it is protected by mu
+	haltReason string
 
 	// unlocker is useful to ensure that certain operations only succeed if
 	// the farm that spawned this daemon set still holds the lock
@@ -188,12 +197,17 @@ func New(
 	unlocker consul.TxnUnlocker,
 	statusStore StatusStore,
 	statusWritingInterval time.Duration,
+	alerter alerting.Alerter,
 ) DaemonSet {
 
 	if retryInterval == 0 {
 		retryInterval = DefaultRetryInterval
 	}
 
+	if alerter == nil {
+		alerter = alerting.NewNop()
+	}
+
 	return &daemonSet{
 		DaemonSet: fields,
 
@@ -214,6 +228,7 @@ func New(
 		unlocker:              unlocker,
 		statusWritingInterval: statusWritingInterval,
 		statusStore:           statusStore,
+		alerter:               alerter,
 	}
 }
 
@@ -261,10 +276,37 @@ func (ds *daemonSet) MinHealth() int {
 
 func (ds *daemonSet) EligibleNodes() ([]types.NodeName, error) {
 	ds.mu.Lock()
-	m := ds.DaemonSet.Manifest
-	nodeSelector := ds.DaemonSet.NodeSelector
+	dsFields := ds.DaemonSet
 	ds.mu.Unlock()
-	return ds.scheduler.EligibleNodes(m, nodeSelector)
+	selected, err := ds.scheduler.EligibleNodes(dsFields.Manifest, dsFields.NodeSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	// Excluded nodes are never eligible, so they have the daemon set's pod
+	// removed
+	var eligible []types.NodeName
+	for _, node := range selected {
+		if !dsFields.Excluded(node) {
+			eligible = append(eligible, node)
+		}
+	}
+
+	// Cordoned and draining nodes keep the daemon set's pod if they already
+	// have it. There is no other node to move it to, so a drain leaves it
+	// alone
+	states, err := cordon.GetStates(ds.applicator)
+	if err != nil {
+		return nil, err
+	}
+	if len(states) == 0 {
+		return eligible, nil
+	}
+	current, err := ds.CurrentPods()
+	if err != nil {
+		return nil, err
+	}
+	return states.WithoutDrain().Eligible(eligible, current.Nodes()), nil
 }
 
 func (ds *daemonSet) MetricNames(suffix string) []string {
@@ -293,8 +335,11 @@ func (ds *daemonSet) WatchDesires(
 		close(watchMatchQuitCh)
 	}()
 
+	// publishStatus sends on haltCh when the replication exceeds the
+	// daemon set's failure budget
+	haltCh := make(chan string)
 	go func() {
-		ds.publishStatus(ctx)
+		ds.publishStatus(ctx, haltCh)
 	}()
 
 	// buffer this channel so we don't block the WatchDesires() loop on
@@ -311,7 +356,9 @@ func (ds *daemonSet) WatchDesires(
 	unpauseReplication := make(chan struct{})
 	manifestChange := make(chan manifest.Manifest)
 	timeoutChange := make(chan time.Duration)
-	go ds.Replicate(ctx, nodesToAdd, pauseReplication, unpauseReplication, manifestChange, timeoutChange)
+	maxInFlightChange := make(chan int)
+	batchPauseChange := make(chan time.Duration)
+	go ds.Replicate(ctx, nodesToAdd, pauseReplication, unpauseReplication, manifestChange, timeoutChange, maxInFlightChange, batchPauseChange)
 
 	nodesChangedCh := ds.watcher.WatchMatchDiff(ds.NodeSelector, labels.NODE, ds.labelsAggregationRate, watchMatchQuitCh)
 	// Do something whenever something is changed
@@ -405,13 +452,50 @@ func (ds *daemonSet) WatchDesires(
 					ds.logger.Infoln("manifest changed")
 				}
 
+				// Replicate takes ds.mu between nodes, so nothing may be
+				// sent to it while the lock is held
 				ds.mu.Lock()
-				if ds.Timeout != newDS.Timeout {
-					timeoutChange <- newDS.Timeout
-				}
+				timeoutChanged := ds.Timeout != newDS.Timeout
+				batchPauseChanged := ds.BatchPause != newDS.BatchPause
+				maxInFlightChanged := ds.MaxInFlight != newDS.MaxInFlight || ds.NodeSelector.String() != newDS.NodeSelector.String()
+				oldDS := ds.DaemonSet
 				ds.DaemonSet = newDS
+				if !newDS.Disabled {
+					ds.haltReason = ""
+				}
 				ds.mu.Unlock()
 
+				if timeoutChanged {
+					select {
+					case timeoutChange <- newDS.Timeout:
+					case <-ctx.Done():
+						return
+					}
+				}
+				if batchPauseChanged {
+					select {
+					case batchPauseChange <- newDS.BatchPause:
+					case <-ctx.Done():
+						return
+					}
+				}
+
+				if maxInFlightChanged {
+					// a percentage depends on the number of eligible
+					// nodes, so it is recomputed when the selector changes
+					var maxInFlight int
+					maxInFlight, err = ds.maxInFlight()
+					if err != nil {
+						err = util.Errorf("Unable to compute max in flight: %v", err)
+						continue
+					}
+					select {
+					case maxInFlightChange <- maxInFlight:
+					case <-ctx.Done():
+						return
+					}
+				}
+
 				if reportErr := ds.reportEligible(); reportErr != nil {
 					// An error in sending the metrics shouldn't stop us from doing updates.
 					// Report it, and move on.
@@ -445,6 +529,19 @@ func (ds *daemonSet) WatchDesires(
 					paused = false
 
 					nodesToAdd <- eligibleNodes
+				} else {
+					// nodes that are no longer pinned need the
+					// daemon set's manifest
+					var unpinnedNodes []types.NodeName
+					unpinnedNodes, err = ds.unpinnedNodes(oldDS, newManifestSHA)
+					if err != nil {
+						err = util.Errorf("Unable to compute unpinned nodes: %v", err)
+						continue
+					}
+					if len(unpinnedNodes) > 0 {
+						ds.logger.Infof("kicking off replication for unpinned nodes: %s", unpinnedNodes)
+						nodesToAdd <- unpinnedNodes
+					}
 				}
 
 				err = ds.removePods()
@@ -460,6 +557,21 @@ func (ds *daemonSet) WatchDesires(
 
 				nodesToAdd <- addedNodes
 
+			case reason := <-haltCh:
+				if ds.IsDisabled() {
+					continue
+				}
+
+				ds.logger.Errorf("halting replication: %s", reason)
+				pauseReplication <- struct{}{}
+				paused = true
+
+				err = ds.halt(reason)
+				if err != nil {
+					err = util.Errorf("Unable to disable daemon set after exceeding its failure budget: %v", err)
+					continue
+				}
+
 			case deleteDS, ok := <-deletedCh:
 				if !ok {
 					return
@@ -566,8 +678,18 @@ func (ds *daemonSet) computeNodesToAdd() ([]types.NodeName, error) {
 	// contention and then disable
 
 	// Get the difference in nodes that we need to schedule on and then sort them
-	// for deterministic ordering
-	toScheduleSorted := types.NewNodeSet(eligible...).Difference(types.NewNodeSet(currentNodes...)).ListNodes()
+	// for deterministic ordering. Pinned nodes are left alone because they
+	// can't be given the manifest they're pinned to
+	var toScheduleSorted []types.NodeName
+	for _, node := range types.NewNodeSet(eligible...).Difference(types.NewNodeSet(currentNodes...)).ListNodes() {
+		pinned, err := ds.pinned(node)
+		if err != nil {
+			return nil, err
+		}
+		if !pinned {
+			toScheduleSorted = append(toScheduleSorted, node)
+		}
+	}
 
 	if len(toScheduleSorted) > 0 {
 		ds.logger.Infof("Need to schedule %d nodes: %s", len(toScheduleSorted), toScheduleSorted)
@@ -645,6 +767,72 @@ func (ds *daemonSet) unschedule(node types.NodeName) error {
 	return nil
 }
 
+// excluded returns whether the daemon set's pod must not run on the node
+func (ds *daemonSet) excluded(node types.NodeName) bool {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	return ds.DaemonSet.Excluded(node)
+}
+
+// pinned returns whether the node is pinned to a manifest other than the
+// daemon set's, in which case the daemon set must not change its pod
+func (ds *daemonSet) pinned(node types.NodeName) (bool, error) {
+	ds.mu.Lock()
+	dsFields := ds.DaemonSet
+	ds.mu.Unlock()
+	if len(dsFields.PinnedNodes) == 0 {
+		return false, nil
+	}
+
+	manifestSHA, err := dsFields.Manifest.SHA()
+	if err != nil {
+		return false, util.Errorf("could not compute sha of manifest: %s", err)
+	}
+	return dsFields.Pinned(node, manifestSHA), nil
+}
+
+// unpinnedNodes returns the eligible nodes that the old daemon set had pinned
+// to a manifest other than the one with the given SHA, but that the daemon set
+// no longer pins
+func (ds *daemonSet) unpinnedNodes(oldFields fields.DaemonSet, manifestSHA string) ([]types.NodeName, error) {
+	ds.mu.Lock()
+	dsFields := ds.DaemonSet
+	ds.mu.Unlock()
+
+	var unpinned []types.NodeName
+	for node := range oldFields.PinnedNodes {
+		if oldFields.Pinned(node, manifestSHA) && !dsFields.Pinned(node, manifestSHA) {
+			unpinned = append(unpinned, node)
+		}
+	}
+	if len(unpinned) == 0 {
+		return nil, nil
+	}
+
+	eligible, err := ds.EligibleNodes()
+	if err != nil {
+		return nil, err
+	}
+	return types.NewNodeSet(unpinned...).Intersection(types.NewNodeSet(eligible...)).ListNodes(), nil
+}
+
+// maxInFlight returns the number of nodes the daemon set's replication should
+// update at once. A percentage is taken of the currently eligible nodes, and
+// an invalid MaxInFlight falls back to fields.DefaultMaxInFlight.
+func (ds *daemonSet) maxInFlight() (int, error) {
+	eligible, err := ds.EligibleNodes()
+	if err != nil {
+		return 0, err
+	}
+
+	maxInFlight, err := ds.MaxInFlight.Nodes(len(eligible))
+	if err != nil {
+		ds.logger.WithError(err).Errorf("Invalid max in flight, updating %d nodes at once", fields.DefaultMaxInFlight)
+		return fields.DefaultMaxInFlight, nil
+	}
+	return maxInFlight, nil
+}
+
 func (ds *daemonSet) Replicate(
 	ctx context.Context,
 	nodesToAdd <-chan []types.NodeName,
@@ -652,6 +840,8 @@ func (ds *daemonSet) Replicate(
 	unpauseReplication <-chan struct{},
 	manifestChange <-chan manifest.Manifest,
 	timeoutChange <-chan time.Duration,
+	maxInFlightChange <-chan int,
+	batchPauseChange <-chan time.Duration,
 ) {
 	nodeQueue := make(chan types.NodeName)
 
@@ -676,12 +866,18 @@ func (ds *daemonSet) Replicate(
 			thisUser = &user.User{}
 		}
 
+		maxInFlight, err := ds.maxInFlight()
+		if err != nil {
+			ds.logger.WithError(err).Errorln("error computing max in flight for daemon set")
+			continue
+		}
+
 		lockMessage := fmt.Sprintf("%q from %q at %q", thisUser.Username, thisHost, time.Now())
 		repl, err := replication.NewReplicator(
 			ds.Manifest(),
 			ds.logger,
 			nodes,
-			50, // always use max parallelism for daemon set deploys
+			maxInFlight,
 			ds.store,
 			ds.txner,
 			ds.applicator,
@@ -727,6 +923,8 @@ func (ds *daemonSet) Replicate(
 
 		ds.logger.Info("Replication initialized")
 
+		replication.SetBatchPause(ds.BatchPause)
+
 		// auto-drain this channel
 		go func() {
 			for err := range errCh {
@@ -771,15 +969,40 @@ func (ds *daemonSet) Replicate(
 			default:
 			}
 
-			select {
-			case nodeQueue <- node:
-			case <-ctx.Done():
-				return
-			case <-pauseReplication:
-				paused = true
-				return
-			case <-unpauseReplication:
-				paused = false
+			// checked for each node so that the node is skipped if it
+			// was excluded or pinned after the nodes were queued
+			if ds.excluded(node) {
+				continue
+			}
+			pinned, err := ds.pinned(node)
+			if err != nil {
+				ds.logger.WithError(err).Errorf("Could not determine whether %s is pinned, skipping it", node)
+				continue
+			}
+			if pinned {
+				continue
+			}
+
+		sendNode:
+			for {
+				select {
+				case nodeQueue <- node:
+					break sendNode
+				case <-ctx.Done():
+					return
+				case <-pauseReplication:
+					paused = true
+					return
+				case <-unpauseReplication:
+					paused = false
+					break sendNode
+				// the replication may be waiting on a change in
+				// pacing to take the node
+				case maxInFlight := <-maxInFlightChange:
+					ds.getDSReplication().replication.SetActive(maxInFlight)
+				case batchPause := <-batchPauseChange:
+					ds.getDSReplication().replication.SetBatchPause(batchPause)
+				}
 			}
 		}
 	}
@@ -799,6 +1022,10 @@ func (ds *daemonSet) Replicate(
 			}
 		case timeout := <-timeoutChange:
 			ds.getDSReplication().replication.SetTimeout(timeout)
+		case maxInFlight := <-maxInFlightChange:
+			ds.getDSReplication().replication.SetActive(maxInFlight)
+		case batchPause := <-batchPauseChange:
+			ds.getDSReplication().replication.SetBatchPause(batchPause)
 		case <-pauseReplication:
 			paused = true
 		case <-unpauseReplication:
@@ -853,7 +1080,79 @@ func (ds *daemonSet) CurrentPods() (types.PodLocations, error) {
 	return result, nil
 }
 
-func (ds *daemonSet) publishStatus(ctx context.Context) {
+// halt disables the daemon set after its replication exceeded its failure
+// budget and alerts about it. The daemon set is disabled locally first so that
+// replication stays paused even if it can't be disabled in the store
+func (ds *daemonSet) halt(reason string) error {
+	ds.mu.Lock()
+	ds.DaemonSet.Disabled = true
+	ds.haltReason = reason
+	dsFields := ds.DaemonSet
+	ds.mu.Unlock()
+
+	alertErr := ds.alerter.Alert(alerting.AlertInfo{
+		Description: fmt.Sprintf("Daemon set '%s' disabled itself: %s", dsFields.ID, reason),
+		IncidentKey: fmt.Sprintf("ds_failure_budget_%s", dsFields.ID),
+		Details: struct {
+			ID            fields.ID            `json:"id"`
+			Name          fields.ClusterName   `json:"cluster_name"`
+			PodID         types.PodID          `json:"pod_id"`
+			NodeSelector  string               `json:"node_selector"`
+			FailureBudget fields.FailureBudget `json:"failure_budget"`
+			Reason        string               `json:"reason"`
+		}{
+			ID:            dsFields.ID,
+			Name:          dsFields.Name,
+			PodID:         dsFields.PodID,
+			NodeSelector:  dsFields.NodeSelector.String(),
+			FailureBudget: dsFields.FailureBudget,
+			Reason:        reason,
+		},
+	}, alerting.HighUrgency)
+	if alertErr != nil {
+		ds.logger.WithError(alertErr).Errorln("Unable to deliver alert!")
+	}
+
+	_, err := ds.dsStore.Disable(dsFields.ID)
+	return err
+}
+
+// failureBudgetExceeded returns why the daemon set should halt if more of its
+// nodes failed than its failure budget allows. A node has failed if it timed
+// out in the replication of the current manifest, or if it runs the current
+// manifest but isn't healthy.
+func (ds *daemonSet) failureBudgetExceeded(nodes daemonsetstatus.NodeBreakdown) (string, bool, error) {
+	ds.mu.Lock()
+	failureBudget := ds.FailureBudget
+	ds.mu.Unlock()
+
+	// scheduled and unscheduled nodes together are the eligible nodes,
+	// which saves querying for them again
+	eligible := len(nodes.Current) + len(nodes.Outdated) + len(nodes.Unscheduled)
+	allowed, isSet, err := failureBudget.Nodes(eligible)
+	if err != nil || !isSet {
+		return "", false, err
+	}
+
+	unhealthy := types.NewNodeSet(nodes.Current...).Intersection(types.NewNodeSet(nodes.Unhealthy...))
+	failed := types.NewNodeSet(nodes.TimedOut...).Union(unhealthy)
+	if failed.Len() <= allowed {
+		return "", false, nil
+	}
+
+	return fmt.Sprintf(
+		"%d nodes failed, exceeding the failure budget of %s (%d nodes): %v",
+		failed.Len(), failureBudget, allowed, failed.ListNodes(),
+	), true, nil
+}
+
+func (ds *daemonSet) getHaltReason() string {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	return ds.haltReason
+}
+
+func (ds *daemonSet) publishStatus(ctx context.Context, haltCh chan<- string) {
 	var lastStatus daemonsetstatus.Status
 
 	for {
@@ -873,9 +1172,34 @@ func (ds *daemonSet) publishStatus(ctx context.Context) {
 				ds.logger.WithError(err).Errorln("could not write daemon set status")
 				continue
 			}
+
+			// a halted daemon set stays halted across farm restarts
+			ds.mu.Lock()
+			if ds.DaemonSet.Disabled && ds.haltReason == "" {
+				ds.haltReason = lastStatus.HaltReason
+			}
+			ds.mu.Unlock()
 		}
 
-		written, err := ds.writeNewestStatus(ctx, lastStatus)
+		nodes, err := ds.nodeBreakdown()
+		if err != nil {
+			// the rest of the status is still worth writing
+			ds.logger.WithError(err).Warnln("could not break down daemon set nodes for status")
+			nodes = lastStatus.Nodes
+		} else if !ds.IsDisabled() {
+			reason, exceeded, err := ds.failureBudgetExceeded(nodes)
+			if err != nil {
+				ds.logger.WithError(err).Errorln("could not check daemon set failure budget")
+			} else if exceeded {
+				select {
+				case haltCh <- reason:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+
+		written, err := ds.writeNewestStatus(ctx, lastStatus, nodes)
 		if err != nil {
 			ds.logger.WithError(err).Errorln("could not write daemon set status")
 			continue
@@ -889,7 +1213,7 @@ func (ds *daemonSet) publishStatus(ctx context.Context) {
 // it differs from the most recently written one. It handles the case where
 // lastStatus is the zero status which might be the case the first time the
 // daemon set's status is written
-func (ds *daemonSet) writeNewestStatus(ctx context.Context, lastStatus daemonsetstatus.Status) (daemonsetstatus.Status, error) {
+func (ds *daemonSet) writeNewestStatus(ctx context.Context, lastStatus daemonsetstatus.Status, nodes daemonsetstatus.NodeBreakdown) (daemonsetstatus.Status, error) {
 	var toWrite daemonsetstatus.Status
 	manifestSHA, err := ds.Manifest().SHA()
 	if err != nil {
@@ -897,6 +1221,8 @@ func (ds *daemonSet) writeNewestStatus(ctx context.Context, lastStatus daemonset
 	}
 
 	toWrite.ManifestSHA = manifestSHA
+	toWrite.Nodes = nodes
+	toWrite.HaltReason = ds.getHaltReason()
 	toWrite.NodesDeployed = lastStatus.NodesDeployed
 	if toWrite.ManifestSHA != lastStatus.ManifestSHA {
 		// reset the deployed count if the manifest has changed
@@ -916,7 +1242,7 @@ func (ds *daemonSet) writeNewestStatus(ctx context.Context, lastStatus daemonset
 		}
 	}
 
-	if toWrite == lastStatus {
+	if toWrite.Equal(lastStatus) {
 		// nothing to do
 		return lastStatus, nil
 	}
@@ -941,3 +1267,80 @@ func (ds *daemonSet) writeNewestStatus(ctx context.Context, lastStatus daemonset
 
 	return toWrite, nil
 }
+
+// nodeBreakdown sorts the daemon set's nodes by how far along the deployment
+// of its current manifest they are. It reads the reality of every node the
+// daemon set is scheduled on, so it should only be called as often as the
+// status is written
+func (ds *daemonSet) nodeBreakdown() (daemonsetstatus.NodeBreakdown, error) {
+	var breakdown daemonsetstatus.NodeBreakdown
+
+	man := ds.Manifest()
+	manifestSHA, err := man.SHA()
+	if err != nil {
+		return breakdown, err
+	}
+
+	eligible, err := ds.EligibleNodes()
+	if err != nil {
+		return breakdown, util.Errorf("could not compute eligible nodes: %s", err)
+	}
+	current, err := ds.CurrentPods()
+	if err != nil {
+		return breakdown, err
+	}
+	healthResults, err := (*ds.healthChecker).Service(man.ID().String())
+	if err != nil {
+		return breakdown, util.Errorf("could not fetch health of %s: %s", man.ID(), err)
+	}
+
+	scheduled := types.NewNodeSet(current.Nodes()...)
+	for _, node := range eligible {
+		if !scheduled.Has(node.String()) {
+			breakdown.Unscheduled = append(breakdown.Unscheduled, node)
+		}
+	}
+
+	// A single read of the reality tree is much cheaper than one read per
+	// node for daemon sets that run everywhere
+	realityResults, _, err := ds.store.AllPods(consul.REALITY_TREE)
+	if err != nil {
+		return breakdown, util.Errorf("could not read reality: %s", err)
+	}
+	realitySHAs := make(map[types.NodeName]string)
+	for _, result := range realityResults {
+		if result.PodUniqueKey != "" || result.PodLocation.PodID != man.ID() {
+			continue
+		}
+		realitySHA, err := result.Manifest.SHA()
+		if err != nil {
+			return breakdown, err
+		}
+		realitySHAs[result.PodLocation.Node] = realitySHA
+	}
+
+	for _, node := range current.Nodes() {
+		if realitySHAs[node] == manifestSHA {
+			breakdown.Current = append(breakdown.Current, node)
+		} else {
+			breakdown.Outdated = append(breakdown.Outdated, node)
+		}
+
+		if result, ok := healthResults[node]; !ok || result.Status != health.Passing {
+			breakdown.Unhealthy = append(breakdown.Unhealthy, node)
+		}
+	}
+
+	if dsReplication := ds.getDSReplication(); dsReplication != nil {
+		breakdown.TimedOut = dsReplication.replication.TimedOutNodes()
+	}
+
+	// ListNodes sorts the nodes so that the breakdown only changes when
+	// the nodes in it do
+	breakdown.Current = types.NewNodeSet(breakdown.Current...).ListNodes()
+	breakdown.Outdated = types.NewNodeSet(breakdown.Outdated...).ListNodes()
+	breakdown.Unhealthy = types.NewNodeSet(breakdown.Unhealthy...).ListNodes()
+	breakdown.TimedOut = types.NewNodeSet(breakdown.TimedOut...).ListNodes()
+	breakdown.Unscheduled = types.NewNodeSet(breakdown.Unscheduled...).ListNodes()
+	return breakdown, nil
+}
@@ -8,10 +8,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/square/p2/pkg/alerting/alertingtest"
+	"github.com/square/p2/pkg/health"
 	"github.com/square/p2/pkg/replication"
+	"github.com/square/p2/pkg/scheduler"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/util"
 
+	"github.com/square/p2/pkg/cordon"
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
@@ -179,7 +183,7 @@ func TestSchedule(t *testing.T) {
 
 	ctx, cancel := transaction.New(context.Background())
 	defer cancel()
-	dsData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, nodeSelector, podID, timeout)
+	dsData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, nodeSelector, podID, timeout, "", 0)
 	Assert(t).IsNil(err, "expected no error creating request")
 	err = transaction.MustCommit(ctx, fixture.Client.KV())
 	Assert(t).IsNil(err, "Expected no error committing transaction")
@@ -228,6 +232,7 @@ func TestSchedule(t *testing.T) {
 		nullUnlocker{},
 		statusStore,
 		DefaultStatusWritingInterval,
+		nil,
 	).(*daemonSet)
 
 	labeled := labeledPods(t, ds)
@@ -448,7 +453,7 @@ func TestPublishToReplication(t *testing.T) {
 
 	ctx, cancel := transaction.New(context.Background())
 	defer cancel()
-	dsData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, nodeSelector, podID, timeout)
+	dsData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, nodeSelector, podID, timeout, "", 0)
 	Assert(t).IsNil(err, "expected no error creating request")
 	err = transaction.MustCommit(ctx, fixture.Client.KV())
 	Assert(t).IsNil(err, "Expected no error committing transaction")
@@ -493,6 +498,7 @@ func TestPublishToReplication(t *testing.T) {
 		nullUnlocker{},
 		statusStore,
 		DefaultStatusWritingInterval,
+		nil,
 	).(*daemonSet)
 
 	labeled := labeledPods(t, ds)
@@ -595,6 +601,7 @@ func fakeReplication(completedCount int32, inProgress bool) nullReplication {
 type nullReplication struct {
 	completedCount int32
 	inProgress     bool
+	timedOut       []types.NodeName
 }
 
 func (nullReplication) Enact() {
@@ -623,6 +630,15 @@ func (n nullReplication) SetManifest(manifest.Manifest) {
 func (n nullReplication) SetTimeout(time.Duration) {
 	panic("SetTimeout() not implemented on nullReplication")
 }
+func (n nullReplication) SetActive(int) {
+	panic("SetActive() not implemented on nullReplication")
+}
+func (n nullReplication) SetBatchPause(time.Duration) {
+	panic("SetBatchPause() not implemented on nullReplication")
+}
+func (n nullReplication) TimedOutNodes() []types.NodeName {
+	return n.timedOut
+}
 
 func TestWriteNewestStatus(t *testing.T) {
 	type writeStatusTestCase struct {
@@ -762,19 +778,359 @@ func TestWriteNewestStatus(t *testing.T) {
 			}
 		}
 
-		ds.writeNewestStatus(context.Background(), testCase.lastStatus)
+		ds.writeNewestStatus(context.Background(), testCase.lastStatus, daemonsetstatus.NodeBreakdown{})
 
 		newStatus, _, err := ds.statusStore.Get(ds.ID())
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		if newStatus != testCase.expectedStatus {
+		if !newStatus.Equal(testCase.expectedStatus) {
 			t.Errorf("test case %d: expected %+v got %+v", i, testCase.expectedStatus, newStatus)
 		}
 	}
 }
 
+func TestNodeBreakdown(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+
+	consulStore := consul.NewConsulStore(fixture.Client)
+	applicator := labels.NewConsulApplicator(fixture.Client, 0, 0)
+
+	podID := types.PodID("some_pod")
+	currentManifest := testManifest(podID)
+	builder := currentManifest.GetBuilder()
+	builder.SetStatusPort(8080)
+	oldManifest := builder.GetManifest()
+
+	dsID := ds_fields.ID(uuid.New())
+	for _, node := range []types.NodeName{"current_node", "old_node", "new_node", "unscheduled_node"} {
+		err := applicator.SetLabel(labels.NODE, node.String(), "nodeQuality", "good")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if node == "unscheduled_node" {
+			continue
+		}
+		err = applicator.SetLabel(labels.POD, labels.MakePodLabelKey(node, podID), DSIDLabel, dsID.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := consulStore.SetPod(consul.REALITY_TREE, "current_node", currentManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = consulStore.SetPod(consul.REALITY_TREE, "old_node", oldManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// other pods running on a node must not affect its breakdown
+	otherBuilder := currentManifest.GetBuilder()
+	otherBuilder.SetID("zzz_other_pod")
+	_, err = consulStore.SetPod(consul.REALITY_TREE, "current_node", otherBuilder.GetManifest())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// new_node hasn't launched the pod yet so it has no health
+	healthChecker := fake_checker.NewSingleService(podID.String(), map[types.NodeName]health.Result{
+		"current_node": {ID: podID, Node: "current_node", Status: health.Passing},
+		"old_node":     {ID: podID, Node: "old_node", Status: health.Critical},
+	})
+
+	ds := &daemonSet{
+		DaemonSet: ds_fields.DaemonSet{
+			ID:           dsID,
+			Manifest:     currentManifest,
+			NodeSelector: klabels.Everything().Add("nodeQuality", klabels.EqualsOperator, []string{"good"}),
+			PodID:        podID,
+		},
+		store:         consulStore,
+		applicator:    applicator,
+		scheduler:     scheduler.NewApplicatorScheduler(applicator),
+		healthChecker: &healthChecker,
+		logger:        logging.TestLogger(),
+	}
+	ds.setDSReplication(&dsReplication{
+		replication: nullReplication{timedOut: []types.NodeName{"new_node"}},
+	})
+
+	breakdown, err := ds.nodeBreakdown()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		nodes    []types.NodeName
+		expected []types.NodeName
+	}{
+		{"current", breakdown.Current, []types.NodeName{"current_node"}},
+		{"outdated", breakdown.Outdated, []types.NodeName{"new_node", "old_node"}},
+		{"unhealthy", breakdown.Unhealthy, []types.NodeName{"new_node", "old_node"}},
+		{"timed out", breakdown.TimedOut, []types.NodeName{"new_node"}},
+		{"unscheduled", breakdown.Unscheduled, []types.NodeName{"unscheduled_node"}},
+	} {
+		if fmt.Sprint(tc.nodes) != fmt.Sprint(tc.expected) {
+			t.Errorf("expected %s nodes to be %s but were %s", tc.name, tc.expected, tc.nodes)
+		}
+	}
+}
+
+func TestExcludedAndPinnedNodes(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+
+	applicator := labels.NewConsulApplicator(fixture.Client, 0, 0)
+
+	podID := types.PodID("some_pod")
+	dsID := ds_fields.ID(uuid.New())
+	for _, node := range []types.NodeName{"scheduled_node", "excluded_node", "pinned_node", "new_node"} {
+		err := applicator.SetLabel(labels.NODE, node.String(), "nodeQuality", "good")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, node := range []types.NodeName{"scheduled_node", "excluded_node"} {
+		err := applicator.SetLabel(labels.POD, labels.MakePodLabelKey(node, podID), DSIDLabel, dsID.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ds := &daemonSet{
+		DaemonSet: ds_fields.DaemonSet{
+			ID:            dsID,
+			Manifest:      testManifest(podID),
+			NodeSelector:  klabels.Everything().Add("nodeQuality", klabels.EqualsOperator, []string{"good"}),
+			PodID:         podID,
+			ExcludedNodes: []types.NodeName{"excluded_node"},
+			PinnedNodes:   map[types.NodeName]string{"pinned_node": "old_sha"},
+		},
+		applicator: applicator,
+		scheduler:  scheduler.NewApplicatorScheduler(applicator),
+		logger:     logging.TestLogger(),
+	}
+
+	eligible, err := ds.EligibleNodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(eligible) != fmt.Sprint([]types.NodeName{"new_node", "pinned_node", "scheduled_node"}) {
+		t.Errorf("expected the excluded node not to be eligible but eligible nodes were %s", eligible)
+	}
+
+	toAdd, err := ds.computeNodesToAdd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(toAdd) != fmt.Sprint([]types.NodeName{"new_node"}) {
+		t.Errorf("expected only new_node to be scheduled but nodes to add were %s", toAdd)
+	}
+
+	oldDS := ds.DaemonSet
+	ds.DaemonSet.PinnedNodes = nil
+	manifestSHA, err := ds.Manifest().SHA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unpinned, err := ds.unpinnedNodes(oldDS, manifestSHA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(unpinned) != fmt.Sprint([]types.NodeName{"pinned_node"}) {
+		t.Errorf("expected pinned_node to need the daemon set's manifest after being unpinned but unpinned nodes were %s", unpinned)
+	}
+}
+
+func TestMaxInFlightUsesEligibleNodes(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+
+	applicator := labels.NewConsulApplicator(fixture.Client, 0, 0)
+	for _, node := range []types.NodeName{"node1", "node2", "node3", "node4", "excluded_node"} {
+		err := applicator.SetLabel(labels.NODE, node.String(), "nodeQuality", "good")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	podID := types.PodID("some_pod")
+	for _, tc := range []struct {
+		maxInFlight ds_fields.MaxInFlight
+		expected    int
+	}{
+		{"", ds_fields.DefaultMaxInFlight},
+		{"3", 3},
+		{"50%", 2},
+		{"not a number", ds_fields.DefaultMaxInFlight},
+	} {
+		ds := &daemonSet{
+			DaemonSet: ds_fields.DaemonSet{
+				ID:            ds_fields.ID(uuid.New()),
+				Manifest:      testManifest(podID),
+				NodeSelector:  klabels.Everything().Add("nodeQuality", klabels.EqualsOperator, []string{"good"}),
+				PodID:         podID,
+				ExcludedNodes: []types.NodeName{"excluded_node"},
+				MaxInFlight:   tc.maxInFlight,
+			},
+			applicator: applicator,
+			scheduler:  scheduler.NewApplicatorScheduler(applicator),
+			logger:     logging.TestLogger(),
+		}
+
+		maxInFlight, err := ds.maxInFlight()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if maxInFlight != tc.expected {
+			t.Errorf("expected max in flight %q to be %d nodes but was %d", tc.maxInFlight, tc.expected, maxInFlight)
+		}
+	}
+}
+
+func TestDrainingNodesKeepDaemonSetPods(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+
+	applicator := labels.NewConsulApplicator(fixture.Client, 0, 0)
+	for _, node := range []types.NodeName{"node1", "node2", "node3"} {
+		err := applicator.SetLabel(labels.NODE, node.String(), "nodeQuality", "good")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, node := range []types.NodeName{"node2", "node3"} {
+		err := applicator.SetLabel(labels.NODE, node.String(), cordon.StateLabel, string(cordon.Draining))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	podID := types.PodID("some_pod")
+	ds := &daemonSet{
+		DaemonSet: ds_fields.DaemonSet{
+			ID:           ds_fields.ID(uuid.New()),
+			Manifest:     testManifest(podID),
+			NodeSelector: klabels.Everything().Add("nodeQuality", klabels.EqualsOperator, []string{"good"}),
+			PodID:        podID,
+		},
+		applicator: applicator,
+		scheduler:  scheduler.NewApplicatorScheduler(applicator),
+		logger:     logging.TestLogger(),
+	}
+	err := applicator.SetLabel(labels.POD, labels.MakePodLabelKey("node2", podID), DSIDLabel, ds.ID().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eligible, err := ds.EligibleNodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !types.NewNodeSet(eligible...).Equal(types.NewNodeSet("node1", "node2")) {
+		t.Errorf("expected draining nodes to keep the daemon set's pod but get no new one, got %v", eligible)
+	}
+}
+
+func TestFailureBudgetExceeded(t *testing.T) {
+	// 10 eligible nodes, of which node1 timed out and node2 runs the
+	// current manifest but is unhealthy. node3 is unhealthy but hasn't
+	// been updated yet so it doesn't count against the budget
+	nodes := daemonsetstatus.NodeBreakdown{
+		Current:     []types.NodeName{"node1", "node2", "node4", "node5"},
+		Outdated:    []types.NodeName{"node3", "node6", "node7", "node8"},
+		Unhealthy:   []types.NodeName{"node2", "node3"},
+		TimedOut:    []types.NodeName{"node1"},
+		Unscheduled: []types.NodeName{"node9", "node10"},
+	}
+
+	for _, tc := range []struct {
+		failureBudget ds_fields.FailureBudget
+		exceeded      bool
+	}{
+		{"", false},
+		{"2", false},
+		{"20%", false},
+		{"1", true},
+		{"19%", true},
+	} {
+		ds := &daemonSet{
+			DaemonSet: ds_fields.DaemonSet{FailureBudget: tc.failureBudget},
+		}
+		_, exceeded, err := ds.failureBudgetExceeded(nodes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exceeded != tc.exceeded {
+			t.Errorf("expected failure budget %q to be exceeded: %t but was %t", tc.failureBudget, tc.exceeded, exceeded)
+		}
+	}
+}
+
+func TestHalt(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+
+	dsStore := dsstore.NewConsul(fixture.Client, 0, &logging.DefaultLogger)
+	statusStore := daemonsetstatus.NewConsul(statusstore.NewConsul(fixture.Client), "test_halt")
+
+	ctx, cancel := transaction.New(context.Background())
+	defer cancel()
+	dsData, err := dsStore.Create(ctx, testManifest("some_pod"), 0, "some_name", klabels.Everything(), "some_pod", replicationTimeout, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = transaction.MustCommit(ctx, fixture.Client.KV())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alerter := alertingtest.NewRecorder()
+	ds := &daemonSet{
+		DaemonSet:   dsData,
+		dsStore:     dsStore,
+		statusStore: statusStore,
+		unlocker:    nullUnlocker{},
+		txner:       fixture.Client.KV(),
+		alerter:     alerter,
+		logger:      logging.TestLogger(),
+	}
+
+	err = ds.halt("too many failures")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ds.IsDisabled() {
+		t.Error("expected the daemon set to be disabled locally")
+	}
+	stored, _, err := dsStore.Get(dsData.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.Disabled {
+		t.Error("expected the daemon set to be disabled in the store")
+	}
+	if len(alerter.Alerts) != 1 {
+		t.Errorf("expected 1 alert but there were %d", len(alerter.Alerts))
+	}
+
+	_, err = ds.writeNewestStatus(context.Background(), daemonsetstatus.Status{}, daemonsetstatus.NodeBreakdown{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, _, err := statusStore.Get(dsData.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.HaltReason != "too many failures" {
+		t.Errorf("expected the halt reason to be written to the status but it was %q", status.HaltReason)
+	}
+}
+
 type testStore interface {
 	AllPods(podPrefix consul.PodPrefix) ([]consul.ManifestResult, time.Duration, error)
 }
@@ -12,12 +12,14 @@ import (
 	"github.com/square/p2/pkg/alerting"
 	"github.com/square/p2/pkg/ds/fields"
 	ds_fields "github.com/square/p2/pkg/ds/fields"
+	"github.com/square/p2/pkg/farmstatus"
 	"github.com/square/p2/pkg/health/checker"
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/logging"
 	p2metrics "github.com/square/p2/pkg/metrics"
 	"github.com/square/p2/pkg/replication"
 	"github.com/square/p2/pkg/scheduler"
+	"github.com/square/p2/pkg/shard"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/dsstore"
@@ -67,9 +69,10 @@ type Farm struct {
 	dsRetryInterval       time.Duration
 	statusWritingInterval time.Duration
 
-	children map[fields.ID]*childDS
-	childMu  sync.Mutex
-	session  consul.Session
+	children  map[fields.ID]*childDS
+	childMu   sync.Mutex
+	session   consul.Session
+	sessionID string
 
 	logger  logging.Logger
 	alerter alerting.Alerter
@@ -81,7 +84,8 @@ type Farm struct {
 	cachedPodMatch        bool
 	labelsAggregationRate time.Duration
 
-	config DSFarmConfig
+	config       DSFarmConfig
+	shardChanges <-chan struct{}
 }
 
 type childDS struct {
@@ -91,6 +95,13 @@ type childDS struct {
 	deletedCh chan<- ds_fields.DaemonSet
 	errCh     <-chan error
 	unlocker  consul.TxnUnlocker
+
+	// the session that locked the daemon set and when, for introspection
+	session     string
+	lockedSince time.Time
+
+	outcomeMu   sync.Mutex
+	lastOutcome *farmstatus.Outcome
 }
 
 // TODO: move other config options in here to reduce the number of arguments to NewFarm()
@@ -107,6 +118,12 @@ type DSFarmConfig struct {
 	PodWhitelist []types.PodID `yaml:"pod_whitelist" json:"pod_whitelist"`
 
 	StatusWritingInterval time.Duration
+
+	// Sharder, if set, splits daemon sets between the farms sharing it. The
+	// farm only locks the daemon sets the sharder assigns to it and releases
+	// daemon sets it no longer owns when farms join or leave. It still
+	// watches every daemon set and skips the ones it doesn't own
+	Sharder shard.Sharder `yaml:"-" json:"-"`
 }
 
 func NewFarm(
@@ -137,6 +154,11 @@ func NewFarm(
 		statusWritingInterval = DefaultStatusWritingInterval
 	}
 
+	var shardChanges <-chan struct{}
+	if farmConfig.Sharder != nil {
+		shardChanges = farmConfig.Sharder.Subscribe()
+	}
+
 	return &Farm{
 		store:                 store,
 		txner:                 txner,
@@ -158,6 +180,7 @@ func NewFarm(
 		dsRetryInterval:       dsRetryInterval,
 		statusWritingInterval: statusWritingInterval,
 		config:                farmConfig,
+		shardChanges:          shardChanges,
 	}
 }
 
@@ -165,6 +188,7 @@ func (dsf *Farm) Start(quitCh <-chan struct{}) {
 	consulutil.WithSession(quitCh, dsf.sessions, func(sessionQuit <-chan struct{}, sessionID string) {
 		dsf.logger.WithField("session", sessionID).Infoln("Acquired new session for ds farm")
 		dsf.session = dsf.store.NewUnmanagedSession(sessionID, "")
+		dsf.sessionID = sessionID
 
 		// TODO: make consulutil.WithSession use a context instead of
 		// cancellation channel. Here we're just translating from that
@@ -284,6 +308,10 @@ func (dsf *Farm) mainLoop(ctx context.Context) {
 	var changes dsstore.WatchedDaemonSets
 	var ok bool
 
+	// the daemon sets that existed as of the last change, used to rebalance
+	// when the daemon sets this farm owns change
+	var existing []*ds_fields.DaemonSet
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -293,6 +321,15 @@ func (dsf *Farm) mainLoop(ctx context.Context) {
 				return
 			}
 			dsf.handleDSChanges(ctx, changes)
+			if changes.Err == nil {
+				existing = nil
+				existing = append(existing, changes.Created...)
+				existing = append(existing, changes.Updated...)
+				existing = append(existing, changes.Same...)
+			}
+		case <-dsf.shardChanges:
+			dsf.logger.NoFields().Infoln("Farm instances changed, rebalancing daemon sets")
+			dsf.handleDSChanges(ctx, dsstore.WatchedDaemonSets{Same: existing})
 		}
 	}
 }
@@ -558,6 +595,7 @@ func (dsf *Farm) spawnDaemonSet(
 		unlocker,
 		dsf.statusStore,
 		dsf.statusWritingInterval,
+		dsf.alerter,
 	)
 
 	updatedCh := make(chan ds_fields.DaemonSet)
@@ -565,6 +603,16 @@ func (dsf *Farm) spawnDaemonSet(
 	ctx, cancel := context.WithCancel(ctx)
 
 	desiresCh := ds.WatchDesires(ctx, updatedCh, deletedCh)
+	child := &childDS{
+		ds:          ds,
+		cancel:      cancel,
+		updatedCh:   updatedCh,
+		deletedCh:   deletedCh,
+		errCh:       desiresCh,
+		unlocker:    unlocker,
+		session:     dsf.sessionID,
+		lockedSince: time.Now(),
+	}
 
 	if dsf.monitorHealth {
 		go func() {
@@ -627,6 +675,9 @@ func (dsf *Farm) spawnDaemonSet(
 			case err, ok := <-desiresCh:
 				if err != nil {
 					dsf.logger.Errorf("An error has occurred in spawned ds '%v':, %v", ds.ID(), err)
+					child.outcomeMu.Lock()
+					child.lastOutcome = farmstatus.NewOutcome(err)
+					child.outcomeMu.Unlock()
 				}
 				if !ok {
 					// child error channel closed
@@ -639,14 +690,28 @@ func (dsf *Farm) spawnDaemonSet(
 			}
 		}
 	}()
-	return &childDS{
-		ds:        ds,
-		cancel:    cancel,
-		updatedCh: updatedCh,
-		deletedCh: deletedCh,
-		errCh:     desiresCh,
-		unlocker:  unlocker,
+	return child
+}
+
+// Children returns the daemon sets this farm holds locks for. Daemon sets
+// only report failed attempts to meet their desires, so the outcome is the
+// most recent error
+func (dsf *Farm) Children() []farmstatus.Child {
+	dsf.childMu.Lock()
+	defer dsf.childMu.Unlock()
+	children := make([]farmstatus.Child, 0, len(dsf.children))
+	for id, child := range dsf.children {
+		child.outcomeMu.Lock()
+		lastOutcome := child.lastOutcome
+		child.outcomeMu.Unlock()
+		children = append(children, farmstatus.Child{
+			ID:          id.String(),
+			Session:     child.session,
+			LockedSince: child.lockedSince,
+			LastOutcome: lastOutcome,
+		})
 	}
+	return children
 }
 
 type dsState string
@@ -674,6 +739,14 @@ func (dsf *Farm) lockAndSpawn(ctx context.Context, dsFields ds_fields.DaemonSet,
 		return false
 	}
 
+	if dsf.config.Sharder != nil && !dsf.config.Sharder.Owns(dsFields.ID.String()) {
+		if _, ok := dsf.children[dsFields.ID]; ok {
+			dsLogger.NoFields().Infoln("Daemon set is now owned by another farm")
+			dsf.closeChild(dsFields.ID)
+		}
+		return false
+	}
+
 	var unlocker consul.TxnUnlocker
 
 	// If it is not in our map, then try to acquire the lock
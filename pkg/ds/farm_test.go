@@ -102,7 +102,7 @@ func TestContendNodes(t *testing.T) {
 	nodeSelector := klabels.Everything().Add(pc_fields.AvailabilityZoneLabel, klabels.EqualsOperator, []string{"az1"})
 	ctx, cancel = transaction.New(ctx)
 	defer cancel()
-	dsData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, nodeSelector, podID, replicationTimeout)
+	dsData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, nodeSelector, podID, replicationTimeout, "", 0)
 	Assert(t).IsNil(err, "Expected no error creating request")
 	err = transaction.MustCommit(ctx, fixture.Client.KV())
 	Assert(t).IsNil(err, "Expected no error committing transaction")
@@ -124,7 +124,7 @@ func TestContendNodes(t *testing.T) {
 	// that it gets disabled and that the node label does not change
 	ctx, cancel = transaction.New(context.Background())
 	defer cancel()
-	anotherDSData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, nodeSelector, podID, replicationTimeout)
+	anotherDSData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, nodeSelector, podID, replicationTimeout, "", 0)
 	Assert(t).AreNotEqual(dsData.ID.String(), anotherDSData.ID.String(), "Precondition failed")
 	Assert(t).IsNil(err, "Expected no error creating request")
 	err = transaction.MustCommit(ctx, fixture.Client.KV())
@@ -148,7 +148,7 @@ func TestContendNodes(t *testing.T) {
 	anotherSelector := klabels.Everything().Add(pc_fields.AvailabilityZoneLabel, klabels.EqualsOperator, []string{"undefined"})
 	ctx, cancel = transaction.New(context.Background())
 	defer cancel()
-	badDS, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, anotherSelector, podID, replicationTimeout)
+	badDS, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, anotherSelector, podID, replicationTimeout, "", 0)
 	Assert(t).IsNil(err, "Expected no error creating request")
 	err = transaction.MustCommit(ctx, fixture.Client.KV())
 	Assert(t).IsNil(err, "Expected no error committing transaction")
@@ -239,7 +239,7 @@ func TestContendSelectors(t *testing.T) {
 	everythingSelector := klabels.Everything()
 	ctx, cancel = transaction.New(context.Background())
 	defer cancel()
-	firstDSData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, everythingSelector, podID, replicationTimeout)
+	firstDSData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, everythingSelector, podID, replicationTimeout, "", 0)
 	Assert(t).IsNil(err, "Expected no error creating request")
 	err = transaction.MustCommit(ctx, fixture.Client.KV())
 	Assert(t).IsNil(err, "Expected no error committing transaction")
@@ -248,7 +248,7 @@ func TestContendSelectors(t *testing.T) {
 
 	ctx, cancel = transaction.New(context.Background())
 	defer cancel()
-	secondDSData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, everythingSelector, podID, replicationTimeout)
+	secondDSData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, everythingSelector, podID, replicationTimeout, "", 0)
 	Assert(t).IsNil(err, "Expected no error creating request")
 	err = transaction.MustCommit(ctx, fixture.Client.KV())
 	Assert(t).IsNil(err, "Expected no error committing transaction")
@@ -267,7 +267,7 @@ func TestContendSelectors(t *testing.T) {
 		Add(pc_fields.AvailabilityZoneLabel, klabels.EqualsOperator, []string{"nowhere"})
 	ctx, cancel = transaction.New(context.Background())
 	defer cancel()
-	thirdDSData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, someSelector, podID, replicationTimeout)
+	thirdDSData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, someSelector, podID, replicationTimeout, "", 0)
 	Assert(t).IsNil(err, "Expected no error creating request")
 	err = transaction.MustCommit(ctx, fixture.Client.KV())
 	Assert(t).IsNil(err, "Expected no error committing transaction")
@@ -326,7 +326,7 @@ func TestContendSelectors(t *testing.T) {
 
 	ctx, cancel = transaction.New(context.Background())
 	defer cancel()
-	fourthDSData, err := dsStore.Create(ctx, anotherPodManifest, minHealth, clusterName, equalSelector, anotherPodID, replicationTimeout)
+	fourthDSData, err := dsStore.Create(ctx, anotherPodManifest, minHealth, clusterName, equalSelector, anotherPodID, replicationTimeout, "", 0)
 	Assert(t).IsNil(err, "Expected no error creating request")
 	err = transaction.MustCommit(ctx, fixture.Client.KV())
 	Assert(t).IsNil(err, "Expected no error committing transaction")
@@ -339,7 +339,7 @@ func TestContendSelectors(t *testing.T) {
 
 	ctx, cancel = transaction.New(context.Background())
 	defer cancel()
-	fifthDSData, err := dsStore.Create(ctx, anotherPodManifest, minHealth, clusterName, equalSelector, anotherPodID, replicationTimeout)
+	fifthDSData, err := dsStore.Create(ctx, anotherPodManifest, minHealth, clusterName, equalSelector, anotherPodID, replicationTimeout, "", 0)
 	Assert(t).IsNil(err, "Expected no error creating request")
 	err = transaction.MustCommit(ctx, fixture.Client.KV())
 	Assert(t).IsNil(err, "Expected no error committing transaction")
@@ -416,7 +416,7 @@ func TestFarmSchedule(t *testing.T) {
 	nodeSelector := klabels.Everything().Add(pc_fields.AvailabilityZoneLabel, klabels.EqualsOperator, []string{"az1"})
 	ctx, cancel = transaction.New(context.Background())
 	defer cancel()
-	dsData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, nodeSelector, podID, replicationTimeout)
+	dsData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, nodeSelector, podID, replicationTimeout, "", 0)
 	Assert(t).IsNil(err, "Expected no error creating request")
 	err = transaction.MustCommit(ctx, fixture.Client.KV())
 	Assert(t).IsNil(err, "Expected no error committing transaction")
@@ -427,7 +427,7 @@ func TestFarmSchedule(t *testing.T) {
 	anotherNodeSelector := klabels.Everything().Add(pc_fields.AvailabilityZoneLabel, klabels.EqualsOperator, []string{"az2"})
 	ctx, cancel = transaction.New(context.Background())
 	defer cancel()
-	anotherDSData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, anotherNodeSelector, podID, replicationTimeout)
+	anotherDSData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, anotherNodeSelector, podID, replicationTimeout, "", 0)
 	Assert(t).IsNil(err, "Expected no error creating request")
 	err = transaction.MustCommit(ctx, fixture.Client.KV())
 	Assert(t).IsNil(err, "Expected no error committing transaction")
@@ -816,7 +816,7 @@ func TestMultipleFarms(t *testing.T) {
 	nodeSelector := klabels.Everything().Add(pc_fields.AvailabilityZoneLabel, klabels.EqualsOperator, []string{"az1"})
 	ctx, cancel := transaction.New(context.Background())
 	defer cancel()
-	dsData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, nodeSelector, podID, replicationTimeout)
+	dsData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, nodeSelector, podID, replicationTimeout, "", 0)
 	Assert(t).IsNil(err, "Expected no error creating request")
 	err = transaction.MustCommit(ctx, fixture.Client.KV())
 	Assert(t).IsNil(err, "Expected no error committing transaction")
@@ -825,7 +825,7 @@ func TestMultipleFarms(t *testing.T) {
 	anotherNodeSelector := klabels.Everything().Add(pc_fields.AvailabilityZoneLabel, klabels.EqualsOperator, []string{"az2"})
 	ctx, cancel = transaction.New(context.Background())
 	defer cancel()
-	anotherDSData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, anotherNodeSelector, podID, replicationTimeout)
+	anotherDSData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, anotherNodeSelector, podID, replicationTimeout, "", 0)
 	Assert(t).IsNil(err, "Expected no error creating request")
 	err = transaction.MustCommit(ctx, fixture.Client.KV())
 	Assert(t).IsNil(err, "Expected no error committing transaction")
@@ -1129,7 +1129,7 @@ func TestRelock(t *testing.T) {
 		nodeSelector := klabels.Everything().Add(pc_fields.AvailabilityZoneLabel, klabels.EqualsOperator, []string{zone})
 		ctx, cancel := transaction.New(context.Background())
 		defer cancel()
-		dsData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, nodeSelector, podID, replicationTimeout)
+		dsData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, nodeSelector, podID, replicationTimeout, "", 0)
 		Assert(t).IsNil(err, "Expected no error creating request")
 		err = transaction.MustCommit(ctx, fixture.Client.KV())
 		Assert(t).IsNil(err, "Expected no error committing transaction")
@@ -1249,7 +1249,7 @@ func TestDieAndUpdate(t *testing.T) {
 		nodeSelector := klabels.Everything().Add(pc_fields.AvailabilityZoneLabel, klabels.EqualsOperator, []string{zone})
 		ctx, cancel := transaction.New(context.Background())
 		defer cancel()
-		dsData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, nodeSelector, podID, replicationTimeout)
+		dsData, err := dsStore.Create(ctx, podManifest, minHealth, clusterName, nodeSelector, podID, replicationTimeout, "", 0)
 		Assert(t).IsNil(err, "Expected no error creating request")
 		err = transaction.MustCommit(ctx, fixture.Client.KV())
 		Assert(t).IsNil(err, "Expected no error committing transaction")
@@ -2,6 +2,9 @@ package fields
 
 import (
 	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"k8s.io/kubernetes/pkg/labels"
@@ -58,18 +61,66 @@ type DaemonSet struct {
 	PodID types.PodID
 
 	Timeout time.Duration
+
+	// MaxInFlight bounds how many nodes a replication of the daemon set
+	// updates at once. When unset, DefaultMaxInFlight nodes are updated at
+	// once
+	MaxInFlight MaxInFlight
+
+	// BatchPause is how long a replication waits after each batch of
+	// MaxInFlight nodes finishes before starting on the next. When zero,
+	// a node is started as soon as another one finishes
+	BatchPause time.Duration
+
+	// FailureBudget bounds how many nodes a replication of the daemon
+	// set's manifest may leave unhealthy or timed out. Once more nodes
+	// than that fail, the daemon set disables itself. When unset, failures
+	// never halt replication
+	FailureBudget FailureBudget
+
+	// ExcludedNodes never have the daemon set's pod even if they match its
+	// node selector. The pod is removed from excluded nodes that have it
+	ExcludedNodes []types.NodeName
+
+	// PinnedNodes maps nodes to the SHA of the manifest they should keep.
+	// The daemon set leaves the pod on a pinned node alone while its own
+	// manifest has a different SHA
+	PinnedNodes map[types.NodeName]string
+}
+
+// Excluded returns whether the daemon set's pod must not run on the node
+func (ds DaemonSet) Excluded(node types.NodeName) bool {
+	for _, excluded := range ds.ExcludedNodes {
+		if excluded == node {
+			return true
+		}
+	}
+	return false
+}
+
+// Pinned returns whether the node is pinned to a manifest other than the one
+// with the given SHA, in which case the daemon set must not change its pod
+func (ds DaemonSet) Pinned(node types.NodeName, manifestSHA string) bool {
+	sha, ok := ds.PinnedNodes[node]
+	return ok && sha != manifestSHA
 }
 
 // RawDaemonSet defines the JSON format used to store data into Consul
 type RawDaemonSet struct {
-	ID           ID            `json:"id"`
-	Disabled     bool          `json:"disabled"`
-	Manifest     string        `json:"manifest"`
-	MinHealth    int           `json:"min_health"`
-	Name         ClusterName   `json:"cluster_name"`
-	NodeSelector string        `json:"node_selector"`
-	PodID        types.PodID   `json:"pod_id"`
-	Timeout      time.Duration `json:"timeout"`
+	ID            ID            `json:"id"`
+	Disabled      bool          `json:"disabled"`
+	Manifest      string        `json:"manifest"`
+	MinHealth     int           `json:"min_health"`
+	Name          ClusterName   `json:"cluster_name"`
+	NodeSelector  string        `json:"node_selector"`
+	PodID         types.PodID   `json:"pod_id"`
+	Timeout       time.Duration `json:"timeout"`
+	MaxInFlight   MaxInFlight   `json:"max_in_flight,omitempty"`
+	BatchPause    time.Duration `json:"batch_pause,omitempty"`
+	FailureBudget FailureBudget `json:"failure_budget,omitempty"`
+
+	ExcludedNodes []types.NodeName          `json:"excluded_nodes,omitempty"`
+	PinnedNodes   map[types.NodeName]string `json:"pinned_nodes,omitempty"`
 }
 
 // MarshalJSON implements the json.Marshaler interface for serializing the DS
@@ -100,14 +151,19 @@ func (ds *DaemonSet) ToRaw() (RawDaemonSet, error) {
 	}
 
 	return RawDaemonSet{
-		ID:           ds.ID,
-		Disabled:     ds.Disabled,
-		Manifest:     string(manifest),
-		MinHealth:    ds.MinHealth,
-		Name:         ds.Name,
-		NodeSelector: nodeSelector,
-		PodID:        ds.PodID,
-		Timeout:      ds.Timeout,
+		ID:            ds.ID,
+		Disabled:      ds.Disabled,
+		Manifest:      string(manifest),
+		MinHealth:     ds.MinHealth,
+		Name:          ds.Name,
+		NodeSelector:  nodeSelector,
+		PodID:         ds.PodID,
+		Timeout:       ds.Timeout,
+		MaxInFlight:   ds.MaxInFlight,
+		BatchPause:    ds.BatchPause,
+		FailureBudget: ds.FailureBudget,
+		ExcludedNodes: ds.ExcludedNodes,
+		PinnedNodes:   ds.PinnedNodes,
 	}, nil
 }
 
@@ -138,17 +194,194 @@ func (ds *DaemonSet) UnmarshalJSON(b []byte) error {
 	}
 
 	*ds = DaemonSet{
-		ID:           rawDS.ID,
-		Disabled:     rawDS.Disabled,
-		Manifest:     podManifest,
-		MinHealth:    rawDS.MinHealth,
-		Name:         rawDS.Name,
-		NodeSelector: nodeSelector,
-		PodID:        rawDS.PodID,
-		Timeout:      rawDS.Timeout,
+		ID:            rawDS.ID,
+		Disabled:      rawDS.Disabled,
+		Manifest:      podManifest,
+		MinHealth:     rawDS.MinHealth,
+		Name:          rawDS.Name,
+		NodeSelector:  nodeSelector,
+		PodID:         rawDS.PodID,
+		Timeout:       rawDS.Timeout,
+		MaxInFlight:   rawDS.MaxInFlight,
+		BatchPause:    rawDS.BatchPause,
+		FailureBudget: rawDS.FailureBudget,
+		ExcludedNodes: rawDS.ExcludedNodes,
+		PinnedNodes:   rawDS.PinnedNodes,
 	}
 	return nil
 }
 
 // Assert DaemonSet.UnmarshalJSON is implemented in json.Unmarshaler
 var _ json.Unmarshaler = &DaemonSet{}
+
+// DefaultMaxInFlight is the number of nodes a daemon set replication updates
+// at once when the daemon set doesn't set MaxInFlight
+const DefaultMaxInFlight = 50
+
+// A MaxInFlight is a number of nodes given either as an absolute count like
+// "5" or as a percentage of a daemon set's eligible nodes like "10%". The
+// empty MaxInFlight means the value is unset.
+type MaxInFlight string
+
+// ParseMaxInFlight validates a node count or percentage such as "5" or "10%"
+func ParseMaxInFlight(value string) (MaxInFlight, error) {
+	ret := MaxInFlight(strings.TrimSpace(value))
+	if _, err := ret.Nodes(1); err != nil {
+		return "", err
+	}
+	return ret, nil
+}
+
+// Nodes returns the number of nodes this value represents for a daemon set
+// with the given number of eligible nodes. Percentages are rounded up so that
+// a replication always makes progress. An unset value is DefaultMaxInFlight.
+func (m MaxInFlight) Nodes(eligible int) (int, error) {
+	str := string(m)
+	if str == "" {
+		return DefaultMaxInFlight, nil
+	}
+
+	if strings.HasSuffix(str, "%") {
+		percent, err := strconv.Atoi(strings.TrimSuffix(str, "%"))
+		if err != nil {
+			return 0, util.Errorf("could not parse %q as a percentage: %s", str, err)
+		}
+		if percent <= 0 || percent > 100 {
+			return 0, util.Errorf("%q must be a percentage between 1%% and 100%%", str)
+		}
+		nodes := int(math.Ceil(float64(eligible) * float64(percent) / 100))
+		if nodes < 1 {
+			nodes = 1
+		}
+		return nodes, nil
+	}
+
+	nodes, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, util.Errorf("could not parse %q as a node count: %s", str, err)
+	}
+	if nodes < 1 {
+		return 0, util.Errorf("%q must be a positive node count", str)
+	}
+	return nodes, nil
+}
+
+// A FailureBudget is a number of nodes given either as an absolute count like
+// "2" or as a percentage of a daemon set's eligible nodes like "5%". The empty
+// FailureBudget means there is no budget.
+type FailureBudget string
+
+// ParseFailureBudget validates a node count or percentage such as "2" or "5%"
+func ParseFailureBudget(value string) (FailureBudget, error) {
+	ret := FailureBudget(strings.TrimSpace(value))
+	if _, _, err := ret.Nodes(1); err != nil {
+		return "", err
+	}
+	return ret, nil
+}
+
+// Nodes returns how many nodes may fail for a daemon set with the given number
+// of eligible nodes, and false if there is no budget. Percentages are rounded
+// down so that the budget is never more generous than asked for.
+func (b FailureBudget) Nodes(eligible int) (int, bool, error) {
+	str := string(b)
+	if str == "" {
+		return 0, false, nil
+	}
+
+	if strings.HasSuffix(str, "%") {
+		percent, err := strconv.Atoi(strings.TrimSuffix(str, "%"))
+		if err != nil {
+			return 0, false, util.Errorf("could not parse %q as a percentage: %s", str, err)
+		}
+		if percent < 0 || percent > 100 {
+			return 0, false, util.Errorf("%q must be a percentage between 0%% and 100%%", str)
+		}
+		return eligible * percent / 100, true, nil
+	}
+
+	nodes, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, false, util.Errorf("could not parse %q as a node count: %s", str, err)
+	}
+	if nodes < 0 {
+		return 0, false, util.Errorf("%q must not be a negative node count", str)
+	}
+	return nodes, true, nil
+}
+
+// MaxRevisions is the number of prior manifests kept in a daemon set's
+// history. The oldest revisions are dropped first.
+const MaxRevisions = 10
+
+// Revision is a manifest a daemon set used to have. Timestamp is when it was
+// replaced.
+type Revision struct {
+	SHA       string    `json:"sha"`
+	Manifest  string    `json:"manifest"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// GetManifest parses the manifest stored in the revision
+func (r Revision) GetManifest() (manifest.Manifest, error) {
+	return manifest.FromBytes([]byte(r.Manifest))
+}
+
+// History holds the prior manifests of a daemon set, oldest first. It is
+// stored next to the daemon set.
+type History struct {
+	Revisions []Revision `json:"revisions"`
+}
+
+// Add returns the history with the given manifest appended as the newest
+// revision, dropping the oldest revisions beyond MaxRevisions
+func (h History) Add(man manifest.Manifest, timestamp time.Time) (History, error) {
+	manBytes, err := man.Marshal()
+	if err != nil {
+		return History{}, util.Errorf("could not marshal manifest for daemon set history: %s", err)
+	}
+	sha, err := man.SHA()
+	if err != nil {
+		return History{}, util.Errorf("could not compute manifest SHA for daemon set history: %s", err)
+	}
+
+	revisions := append([]Revision{}, h.Revisions...)
+	revisions = append(revisions, Revision{
+		SHA:       sha,
+		Manifest:  string(manBytes),
+		Timestamp: timestamp,
+	})
+	if len(revisions) > MaxRevisions {
+		revisions = revisions[len(revisions)-MaxRevisions:]
+	}
+	return History{Revisions: revisions}, nil
+}
+
+// Find returns the newest revision whose SHA starts with the given prefix. An
+// empty prefix matches the newest revision. It is an error for the prefix to
+// match revisions with different SHAs.
+func (h History) Find(shaPrefix string) (Revision, error) {
+	if len(h.Revisions) == 0 {
+		return Revision{}, util.Errorf("the daemon set has no prior manifests")
+	}
+	if shaPrefix == "" {
+		return h.Revisions[len(h.Revisions)-1], nil
+	}
+
+	var found *Revision
+	for i := len(h.Revisions) - 1; i >= 0; i-- {
+		revision := h.Revisions[i]
+		if !strings.HasPrefix(revision.SHA, shaPrefix) {
+			continue
+		}
+		if found == nil {
+			found = &revision
+		} else if found.SHA != revision.SHA {
+			return Revision{}, util.Errorf("%q matches more than one manifest in the daemon set's history", shaPrefix)
+		}
+	}
+	if found == nil {
+		return Revision{}, util.Errorf("no manifest matching %q in the daemon set's history", shaPrefix)
+	}
+	return *found, nil
+}
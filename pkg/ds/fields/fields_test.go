@@ -3,6 +3,10 @@ package fields
 import (
 	"encoding/json"
 	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
 )
 
 func TestZeroUnmarshal(t *testing.T) {
@@ -12,3 +16,155 @@ func TestZeroUnmarshal(t *testing.T) {
 		t.Fatal("error unmarshaling:", err)
 	}
 }
+
+func TestMaxInFlightNodes(t *testing.T) {
+	for _, tc := range []struct {
+		maxInFlight MaxInFlight
+		eligible    int
+		expected    int
+	}{
+		{"", 10, DefaultMaxInFlight},
+		{"3", 10, 3},
+		{"3", 1, 3},
+		{"25%", 10, 3},
+		{"10%", 1, 1},
+		{"100%", 7, 7},
+	} {
+		nodes, err := tc.maxInFlight.Nodes(tc.eligible)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", tc.maxInFlight, err)
+			continue
+		}
+		if nodes != tc.expected {
+			t.Errorf("expected %q of %d nodes to be %d but was %d", tc.maxInFlight, tc.eligible, tc.expected, nodes)
+		}
+	}
+
+	for _, invalid := range []string{"0", "-1", "0%", "150%", "some%", "lots"} {
+		_, err := ParseMaxInFlight(invalid)
+		if err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestFailureBudgetNodes(t *testing.T) {
+	for _, tc := range []struct {
+		failureBudget FailureBudget
+		eligible      int
+		expected      int
+		isSet         bool
+	}{
+		{"", 10, 0, false},
+		{"0", 10, 0, true},
+		{"2", 10, 2, true},
+		{"25%", 10, 2, true},
+		{"10%", 5, 0, true},
+		{"100%", 7, 7, true},
+	} {
+		nodes, isSet, err := tc.failureBudget.Nodes(tc.eligible)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", tc.failureBudget, err)
+			continue
+		}
+		if isSet != tc.isSet {
+			t.Errorf("expected %q to be set: %t but was %t", tc.failureBudget, tc.isSet, isSet)
+		}
+		if nodes != tc.expected {
+			t.Errorf("expected %q of %d nodes to be %d but was %d", tc.failureBudget, tc.eligible, tc.expected, nodes)
+		}
+	}
+
+	for _, invalid := range []string{"-1", "-5%", "150%", "some%", "lots"} {
+		_, err := ParseFailureBudget(invalid)
+		if err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestExcludedAndPinned(t *testing.T) {
+	ds := DaemonSet{
+		ExcludedNodes: []types.NodeName{"node1"},
+		PinnedNodes:   map[types.NodeName]string{"node2": "old_sha"},
+	}
+
+	dsJSON, err := json.Marshal(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var unmarshaled DaemonSet
+	err = json.Unmarshal(dsJSON, &unmarshaled)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !unmarshaled.Excluded("node1") || unmarshaled.Excluded("node2") {
+		t.Errorf("expected only node1 to be excluded but excluded nodes were %s", unmarshaled.ExcludedNodes)
+	}
+	if !unmarshaled.Pinned("node2", "new_sha") {
+		t.Error("expected node2 to be pinned while the daemon set has a different manifest")
+	}
+	if unmarshaled.Pinned("node2", "old_sha") {
+		t.Error("expected node2 not to be pinned once the daemon set has the pinned manifest")
+	}
+	if unmarshaled.Pinned("node1", "new_sha") {
+		t.Error("expected node1 not to be pinned")
+	}
+}
+
+func TestHistory(t *testing.T) {
+	var history History
+	var shas []string
+	for i := 0; i < MaxRevisions+2; i++ {
+		builder := manifest.NewBuilder()
+		builder.SetID("some_pod")
+		builder.SetStatusPort(i + 1)
+		man := builder.GetManifest()
+		sha, err := man.SHA()
+		if err != nil {
+			t.Fatal(err)
+		}
+		shas = append(shas, sha)
+
+		history, err = history.Add(man, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(history.Revisions) != MaxRevisions {
+		t.Fatalf("expected history to be trimmed to %d revisions but had %d", MaxRevisions, len(history.Revisions))
+	}
+	if history.Revisions[0].SHA != shas[2] {
+		t.Errorf("expected the oldest revisions to have been dropped")
+	}
+
+	latest, err := history.Find("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.SHA != shas[len(shas)-1] {
+		t.Errorf("expected an empty SHA to find the newest revision")
+	}
+
+	found, err := history.Find(shas[5][:12])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.SHA != shas[5] {
+		t.Errorf("expected to find %s by prefix but found %s", shas[5], found.SHA)
+	}
+	man, err := found.GetManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if man.GetStatusPort() != 6 {
+		t.Errorf("expected the revision's manifest to round trip")
+	}
+
+	_, err = history.Find(shas[0])
+	if err == nil {
+		t.Error("expected a dropped revision not to be found")
+	}
+}
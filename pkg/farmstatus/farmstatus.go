@@ -0,0 +1,116 @@
+// Package farmstatus reports which replication controllers, rolling updates
+// and daemon sets the farms in a process hold locks for. It is meant for
+// debugging work that is locked by a farm but not making progress.
+package farmstatus
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Child describes one unit of work that a farm holds the lock for
+type Child struct {
+	ID string `json:"id"`
+
+	// Session is the ID of the Consul session holding the lock
+	Session string `json:"session"`
+
+	LockedSince time.Time `json:"locked_since"`
+
+	// LockHeldFor is filled in when the child is served
+	LockHeldFor string `json:"lock_held_for,omitempty"`
+
+	// LastOutcome is the result of the child's most recent attempt to meet
+	// its desires. It is nil if the child hasn't made one yet or doesn't
+	// report them
+	LastOutcome *Outcome `json:"last_outcome,omitempty"`
+}
+
+// Outcome is the result of one attempt by a child to meet its desires
+type Outcome struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error,omitempty"`
+}
+
+// NewOutcome records an attempt made now that returned err
+func NewOutcome(err error) *Outcome {
+	outcome := &Outcome{Time: time.Now()}
+	if err != nil {
+		outcome.Error = err.Error()
+	}
+	return outcome
+}
+
+// Farm is implemented by the RC, roll and daemon set farms
+type Farm interface {
+	// Children returns the work the farm currently holds locks for. It is
+	// safe to call while the farm is running
+	Children() []Child
+}
+
+type server struct {
+	farms map[string]Farm
+}
+
+// NewHandler serves the children of the given farms, keyed by the name of the
+// kind of work they do, e.g. "rc". GET /farms returns every farm's children
+// and GET /farms/{name} returns one farm's.
+func NewHandler(farms map[string]Farm) http.Handler {
+	s := server{farms: farms}
+	r := mux.NewRouter()
+	r.Methods("GET").Path("/farms").HandlerFunc(s.listFarms)
+	r.Methods("GET").Path("/farms/{name}").HandlerFunc(s.getFarm)
+	return r
+}
+
+func (s server) listFarms(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	out := make(map[string][]Child)
+	for name, farm := range s.farms {
+		out[name] = sortedChildren(farm, now)
+	}
+	writeJSON(w, out)
+}
+
+func (s server) getFarm(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	farm, ok := s.farms[name]
+	if !ok {
+		http.Error(w, "no farm named "+name, http.StatusNotFound)
+		return
+	}
+	writeJSON(w, sortedChildren(farm, time.Now()))
+}
+
+func sortedChildren(farm Farm, now time.Time) []Child {
+	children := farm.Children()
+	for i := range children {
+		children[i].LockHeldFor = now.Sub(children[i].LockedSince).String()
+	}
+	sort.Sort(byID(children))
+	// an empty farm serves an empty list rather than null
+	if children == nil {
+		children = []Child{}
+	}
+	return children
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+type byID []Child
+
+func (b byID) Len() int           { return len(b) }
+func (b byID) Less(i, j int) bool { return b[i].ID < b[j].ID }
+func (b byID) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
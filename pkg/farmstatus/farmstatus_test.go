@@ -0,0 +1,73 @@
+package farmstatus
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type fakeFarm []Child
+
+func (f fakeFarm) Children() []Child {
+	return append([]Child(nil), f...)
+}
+
+func TestHandlerServesChildrenOfEachFarm(t *testing.T) {
+	lockedSince := time.Now().Add(-time.Hour)
+	handler := NewHandler(map[string]Farm{
+		"rc": fakeFarm{
+			{ID: "rc_b", Session: "some_session", LockedSince: lockedSince, LastOutcome: NewOutcome(errors.New("could not schedule"))},
+			{ID: "rc_a", Session: "some_session", LockedSince: lockedSince, LastOutcome: NewOutcome(nil)},
+		},
+		"ru": fakeFarm{},
+	})
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/farms", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	var farms map[string][]Child
+	err := json.Unmarshal(resp.Body.Bytes(), &farms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if farms["ru"] == nil || len(farms["ru"]) != 0 {
+		t.Errorf("expected an empty list of rolling updates, got %v", farms["ru"])
+	}
+
+	rcs := farms["rc"]
+	if len(rcs) != 2 || rcs[0].ID != "rc_a" || rcs[1].ID != "rc_b" {
+		t.Fatalf("expected rc_a and rc_b sorted by ID, got %v", rcs)
+	}
+	if rcs[0].LastOutcome == nil || rcs[0].LastOutcome.Error != "" {
+		t.Errorf("expected rc_a's last outcome to have succeeded, got %v", rcs[0].LastOutcome)
+	}
+	if rcs[1].LastOutcome == nil || rcs[1].LastOutcome.Error != "could not schedule" {
+		t.Errorf("expected rc_b's last outcome to have failed, got %v", rcs[1].LastOutcome)
+	}
+	heldFor, err := time.ParseDuration(rcs[0].LockHeldFor)
+	if err != nil || heldFor < time.Hour {
+		t.Errorf("expected the lock to have been held for at least an hour, got %q", rcs[0].LockHeldFor)
+	}
+}
+
+func TestHandlerRejectsUnknownFarm(t *testing.T) {
+	handler := NewHandler(map[string]Farm{"rc": fakeFarm{}})
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/farms/ds", nil))
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a farm that isn't running, got %d", resp.Code)
+	}
+
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/farms/rc", nil))
+	if resp.Code != http.StatusOK || resp.Body.String() != "[]" {
+		t.Fatalf("expected an empty list of RCs, got %d: %s", resp.Code, resp.Body.String())
+	}
+}
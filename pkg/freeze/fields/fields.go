@@ -0,0 +1,103 @@
+package fields
+
+import (
+	"time"
+
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+// ID is the unique identifier of a freeze window
+type ID string
+
+func (id ID) String() string { return string(id) }
+
+// A Window is a period of time during which deploys are frozen. While a window
+// is active, RCs that it matches will not increase their replica counts or
+// change the manifest their pods run, and rolling updates to them will not
+// start.
+type Window struct {
+	ID ID `json:"id"`
+
+	// Start and End bound the freeze. The window is active from Start up to
+	// but not including End
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	// PodID optionally limits the freeze to RCs of a single pod. When empty,
+	// RCs of every pod are frozen
+	PodID types.PodID `json:"pod_id,omitempty"`
+
+	// Selector optionally limits the freeze to RCs whose labels match it.
+	// When empty, RCs are frozen regardless of their labels
+	Selector string `json:"selector,omitempty"`
+
+	// Reason explains why deploys are frozen
+	Reason string `json:"reason"`
+
+	// Overrides lists the RCs that an operator has explicitly allowed to
+	// change during the window
+	Overrides []rc_fields.ID `json:"overrides,omitempty"`
+}
+
+// Validate checks that the window's time range and selector make sense
+func (w Window) Validate() error {
+	if !w.End.After(w.Start) {
+		return util.Errorf("freeze window must end after it starts, but it starts at %s and ends at %s", w.Start, w.End)
+	}
+	if _, err := klabels.Parse(w.Selector); err != nil {
+		return util.Errorf("could not parse freeze window selector %q: %s", w.Selector, err)
+	}
+	return nil
+}
+
+// Active returns true if the window covers the given time
+func (w Window) Active(now time.Time) bool {
+	return !now.Before(w.Start) && now.Before(w.End)
+}
+
+// Matches returns true if the window applies to an RC for the given pod ID
+// with the given labels
+func (w Window) Matches(podID types.PodID, rcLabels klabels.Labels) (bool, error) {
+	if w.PodID != "" && w.PodID != podID {
+		return false, nil
+	}
+	selector, err := klabels.Parse(w.Selector)
+	if err != nil {
+		return false, util.Errorf("could not parse selector of freeze window %s: %s", w.ID, err)
+	}
+	return selector.Matches(rcLabels), nil
+}
+
+// Overridden returns true if an operator has allowed the given RC to change
+// during the window
+func (w Window) Overridden(rcID rc_fields.ID) bool {
+	for _, id := range w.Overrides {
+		if id == rcID {
+			return true
+		}
+	}
+	return false
+}
+
+// Blocking returns the first of the given windows that freezes the given RC at
+// the given time, or nil if the RC is free to change. Windows that have been
+// overridden for the RC don't block it.
+func Blocking(windows []Window, now time.Time, rcID rc_fields.ID, podID types.PodID, rcLabels klabels.Labels) (*Window, error) {
+	for i := range windows {
+		if !windows[i].Active(now) || windows[i].Overridden(rcID) {
+			continue
+		}
+		matches, err := windows[i].Matches(podID, rcLabels)
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			return &windows[i], nil
+		}
+	}
+	return nil, nil
+}
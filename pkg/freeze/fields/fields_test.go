@@ -0,0 +1,87 @@
+package fields
+
+import (
+	"testing"
+	"time"
+
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+func TestBlocking(t *testing.T) {
+	now := time.Now()
+	rcLabels := klabels.Set{"pod_id": "web", "environment": "production"}
+	windows := []Window{
+		{
+			ID:     "past",
+			Start:  now.Add(-2 * time.Hour),
+			End:    now.Add(-time.Hour),
+			Reason: "already over",
+		},
+		{
+			ID:     "other-pod",
+			Start:  now.Add(-time.Hour),
+			End:    now.Add(time.Hour),
+			PodID:  "db",
+			Reason: "database migration",
+		},
+		{
+			ID:       "staging",
+			Start:    now.Add(-time.Hour),
+			End:      now.Add(time.Hour),
+			Selector: "environment=staging",
+			Reason:   "staging demo",
+		},
+		{
+			ID:        "holiday",
+			Start:     now.Add(-time.Hour),
+			End:       now.Add(time.Hour),
+			Selector:  "environment=production",
+			Reason:    "holiday",
+			Overrides: []rc_fields.ID{"overridden-rc"},
+		},
+	}
+
+	blocking, err := Blocking(windows, now, "some-rc", "web", rcLabels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocking == nil || blocking.ID != "holiday" {
+		t.Fatalf("expected the holiday window to block the RC but got %+v", blocking)
+	}
+
+	blocking, err = Blocking(windows, now, "overridden-rc", "web", rcLabels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocking != nil {
+		t.Errorf("expected an overridden RC not to be blocked but it was blocked by %s", blocking.ID)
+	}
+
+	blocking, err = Blocking(windows, now.Add(2*time.Hour), "some-rc", "web", rcLabels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocking != nil {
+		t.Errorf("expected no window to be active after they end but %s was", blocking.ID)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Now()
+	valid := Window{Start: now, End: now.Add(time.Hour), Selector: "environment=production"}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("expected window to be valid but got %s", err)
+	}
+
+	backwards := Window{Start: now, End: now.Add(-time.Hour)}
+	if err := backwards.Validate(); err == nil {
+		t.Error("expected a window that ends before it starts to be invalid")
+	}
+
+	badSelector := Window{Start: now, End: now.Add(time.Hour), Selector: "environment in (production"}
+	if err := badSelector.Validate(); err == nil {
+		t.Error("expected a window with an unparseable selector to be invalid")
+	}
+}
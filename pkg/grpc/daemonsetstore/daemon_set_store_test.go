@@ -348,6 +348,8 @@ func createADaemonSet(store *dsstore.ConsulStore, txner transaction.Txner) (fiel
 		nodeSelector,
 		podID,
 		timeout,
+		"",
+		0,
 	)
 	if err != nil {
 		return fields.DaemonSet{}, err
@@ -6,6 +6,7 @@ import (
 
 	scheduler_protos "github.com/square/p2/pkg/grpc/scheduler/protos"
 	"github.com/square/p2/pkg/manifest"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
 	"google.golang.org/grpc"
@@ -55,16 +56,30 @@ func (c *Client) EligibleNodes(man manifest.Manifest, sel klabels.Selector) ([]t
 	return ret, nil
 }
 
-func (c *Client) AllocateNodes(man manifest.Manifest, nodeSelector klabels.Selector, nodesRequested int, force bool) ([]types.NodeName, error) {
+func (c *Client) AllocateNodes(man manifest.Manifest, nodeSelector klabels.Selector, nodesRequested int, force bool, spread rc_fields.Spread) ([]types.NodeName, error) {
 	manifestStr, err := man.Marshal()
 	if err != nil {
 		return nil, util.Errorf("could not marshal manifest for AllocateNodes gRPC request: %s", err)
 	}
+	constraints := make([]*scheduler_protos.SpreadConstraint, len(spread.Constraints))
+	for i, constraint := range spread.Constraints {
+		constraints[i] = &scheduler_protos.SpreadConstraint{
+			TopologyKey: constraint.TopologyKey,
+			MaxSkew:     int64(constraint.MaxSkew),
+			OnePerValue: constraint.OnePerValue,
+		}
+	}
+	currentNodes := make([]string, len(spread.CurrentNodes))
+	for i, node := range spread.CurrentNodes {
+		currentNodes[i] = node.String()
+	}
 	req := &scheduler_protos.AllocateNodesRequest{
-		Manifest:       string(manifestStr),
-		NodeSelector:   nodeSelector.String(),
-		NodesRequested: int64(nodesRequested),
-		Force:          force,
+		Manifest:          string(manifestStr),
+		NodeSelector:      nodeSelector.String(),
+		NodesRequested:    int64(nodesRequested),
+		Force:             force,
+		SpreadConstraints: constraints,
+		CurrentNodes:      currentNodes,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
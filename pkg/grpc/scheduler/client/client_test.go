@@ -6,6 +6,7 @@ import (
 
 	scheduler_protos "github.com/square/p2/pkg/grpc/scheduler/protos"
 	"github.com/square/p2/pkg/manifest"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
 	"golang.org/x/net/context"
@@ -145,7 +146,14 @@ func TestAllocateNodesHappy(t *testing.T) {
 	}
 
 	selector := klabels.Everything().Add("foo", klabels.EqualsOperator, []string{"bar"})
-	nodes, err := client.AllocateNodes(testManifest(), selector, 2, false)
+	spread := rc_fields.Spread{
+		Constraints: []rc_fields.SpreadConstraint{
+			{TopologyKey: "rack", MaxSkew: 1},
+			{TopologyKey: "host_group", OnePerValue: true},
+		},
+		CurrentNodes: []types.NodeName{"node2"},
+	}
+	nodes, err := client.AllocateNodes(testManifest(), selector, 2, false, spread)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -184,6 +192,18 @@ func TestAllocateNodesHappy(t *testing.T) {
 	if call.NodesRequested != 2 {
 		t.Errorf("expected nodes requested count in call to be %d but was %d", 2, call.NodesRequested)
 	}
+
+	expectedConstraints := []*scheduler_protos.SpreadConstraint{
+		{TopologyKey: "rack", MaxSkew: 1},
+		{TopologyKey: "host_group", OnePerValue: true},
+	}
+	if !reflect.DeepEqual(call.SpreadConstraints, expectedConstraints) {
+		t.Errorf("expected spread constraints in call to be %s but was %s", expectedConstraints, call.SpreadConstraints)
+	}
+
+	if !reflect.DeepEqual(call.CurrentNodes, []string{"node2"}) {
+		t.Errorf("expected current nodes in call to be [node2] but was %s", call.CurrentNodes)
+	}
 }
 
 func TestAllocatedNodesServerError(t *testing.T) {
@@ -194,7 +214,7 @@ func TestAllocatedNodesServerError(t *testing.T) {
 		schedulerClient: inner,
 	}
 
-	_, err := client.AllocateNodes(testManifest(), klabels.Everything().Add("foo", klabels.EqualsOperator, []string{"bar"}), 3, false)
+	_, err := client.AllocateNodes(testManifest(), klabels.Everything().Add("foo", klabels.EqualsOperator, []string{"bar"}), 3, false, rc_fields.Spread{})
 	if err == nil {
 		t.Fatal("expected an error when the server fails")
 	}
@@ -246,7 +266,7 @@ func TestDeallocateNodesServerError(t *testing.T) {
 		schedulerClient: inner,
 	}
 
-	_, err := client.AllocateNodes(testManifest(), klabels.Everything().Add("foo", klabels.EqualsOperator, []string{"bar"}), 3, false)
+	_, err := client.AllocateNodes(testManifest(), klabels.Everything().Add("foo", klabels.EqualsOperator, []string{"bar"}), 3, false, rc_fields.Spread{})
 	if err == nil {
 		t.Fatal("expected an error when the server fails")
 	}
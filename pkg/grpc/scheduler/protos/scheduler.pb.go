@@ -14,6 +14,7 @@ It has these top-level messages:
 	DeallocateNodesResponse
 	EligibleNodesRequest
 	EligibleNodesResponse
+	SpreadConstraint
 */
 package scheduler_protos
 
@@ -38,10 +39,12 @@ var _ = math.Inf
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
 type AllocateNodesRequest struct {
-	Manifest       string `protobuf:"bytes,1,opt,name=manifest" json:"manifest,omitempty"`
-	NodeSelector   string `protobuf:"bytes,2,opt,name=node_selector,json=nodeSelector" json:"node_selector,omitempty"`
-	NodesRequested int64  `protobuf:"varint,3,opt,name=nodes_requested,json=nodesRequested" json:"nodes_requested,omitempty"`
-	Force          bool   `protobuf:"varint,4,opt,name=force" json:"force,omitempty"`
+	Manifest          string              `protobuf:"bytes,1,opt,name=manifest" json:"manifest,omitempty"`
+	NodeSelector      string              `protobuf:"bytes,2,opt,name=node_selector,json=nodeSelector" json:"node_selector,omitempty"`
+	NodesRequested    int64               `protobuf:"varint,3,opt,name=nodes_requested,json=nodesRequested" json:"nodes_requested,omitempty"`
+	Force             bool                `protobuf:"varint,4,opt,name=force" json:"force,omitempty"`
+	SpreadConstraints []*SpreadConstraint `protobuf:"bytes,5,rep,name=spread_constraints,json=spreadConstraints" json:"spread_constraints,omitempty"`
+	CurrentNodes      []string            `protobuf:"bytes,6,rep,name=current_nodes,json=currentNodes" json:"current_nodes,omitempty"`
 }
 
 func (m *AllocateNodesRequest) Reset()                    { *m = AllocateNodesRequest{} }
@@ -77,6 +80,20 @@ func (m *AllocateNodesRequest) GetForce() bool {
 	return false
 }
 
+func (m *AllocateNodesRequest) GetSpreadConstraints() []*SpreadConstraint {
+	if m != nil {
+		return m.SpreadConstraints
+	}
+	return nil
+}
+
+func (m *AllocateNodesRequest) GetCurrentNodes() []string {
+	if m != nil {
+		return m.CurrentNodes
+	}
+	return nil
+}
+
 type AllocateNodesResponse struct {
 	AllocatedNodes []string `protobuf:"bytes,1,rep,name=allocated_nodes,json=allocatedNodes" json:"allocated_nodes,omitempty"`
 }
@@ -165,6 +182,38 @@ func (m *EligibleNodesResponse) GetEligibleNodes() []string {
 	return nil
 }
 
+type SpreadConstraint struct {
+	TopologyKey string `protobuf:"bytes,1,opt,name=topology_key,json=topologyKey" json:"topology_key,omitempty"`
+	MaxSkew     int64  `protobuf:"varint,2,opt,name=max_skew,json=maxSkew" json:"max_skew,omitempty"`
+	OnePerValue bool   `protobuf:"varint,3,opt,name=one_per_value,json=onePerValue" json:"one_per_value,omitempty"`
+}
+
+func (m *SpreadConstraint) Reset()                    { *m = SpreadConstraint{} }
+func (m *SpreadConstraint) String() string            { return proto.CompactTextString(m) }
+func (*SpreadConstraint) ProtoMessage()               {}
+func (*SpreadConstraint) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *SpreadConstraint) GetTopologyKey() string {
+	if m != nil {
+		return m.TopologyKey
+	}
+	return ""
+}
+
+func (m *SpreadConstraint) GetMaxSkew() int64 {
+	if m != nil {
+		return m.MaxSkew
+	}
+	return 0
+}
+
+func (m *SpreadConstraint) GetOnePerValue() bool {
+	if m != nil {
+		return m.OnePerValue
+	}
+	return false
+}
+
 func init() {
 	proto.RegisterType((*AllocateNodesRequest)(nil), "scheduler_protos.AllocateNodesRequest")
 	proto.RegisterType((*AllocateNodesResponse)(nil), "scheduler_protos.AllocateNodesResponse")
@@ -172,6 +221,7 @@ func init() {
 	proto.RegisterType((*DeallocateNodesResponse)(nil), "scheduler_protos.DeallocateNodesResponse")
 	proto.RegisterType((*EligibleNodesRequest)(nil), "scheduler_protos.EligibleNodesRequest")
 	proto.RegisterType((*EligibleNodesResponse)(nil), "scheduler_protos.EligibleNodesResponse")
+	proto.RegisterType((*SpreadConstraint)(nil), "scheduler_protos.SpreadConstraint")
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -315,26 +365,34 @@ var _P2Scheduler_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("scheduler.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 336 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x92, 0xc1, 0x4e, 0xf2, 0x40,
-	0x10, 0xc7, 0x59, 0xf8, 0x3e, 0x03, 0xa3, 0x2d, 0x66, 0x03, 0x5a, 0x39, 0x35, 0x6b, 0x90, 0x7a,
-	0xe1, 0x80, 0x77, 0xa3, 0x89, 0x5e, 0x8d, 0x29, 0x07, 0x8f, 0x4d, 0xdb, 0x1d, 0xa4, 0xc9, 0xda,
-	0xc5, 0x6e, 0x79, 0x15, 0x5f, 0xc7, 0x57, 0x33, 0x6d, 0x97, 0x86, 0x96, 0x4d, 0xe4, 0xe0, 0x71,
-	0xfe, 0x33, 0xfb, 0x9f, 0x99, 0xdf, 0x0e, 0x0c, 0x55, 0xbc, 0x46, 0xbe, 0x15, 0x98, 0xcd, 0x37,
-	0x99, 0xcc, 0x25, 0x3d, 0xaf, 0x85, 0xa0, 0x14, 0x14, 0xfb, 0x22, 0x30, 0x7a, 0x14, 0x42, 0xc6,
-	0x61, 0x8e, 0x2f, 0x92, 0xa3, 0xf2, 0xf1, 0x73, 0x8b, 0x2a, 0xa7, 0x13, 0xe8, 0x7f, 0x84, 0x69,
-	0xb2, 0x42, 0x95, 0x3b, 0xc4, 0x25, 0xde, 0xc0, 0xaf, 0x63, 0x7a, 0x0d, 0x56, 0x2a, 0x39, 0x06,
-	0x0a, 0x05, 0xc6, 0xb9, 0xcc, 0x9c, 0x6e, 0x59, 0x70, 0x56, 0x88, 0x4b, 0xad, 0xd1, 0x19, 0x0c,
-	0x8b, 0x58, 0x05, 0x59, 0xe5, 0x88, 0xdc, 0xe9, 0xb9, 0xc4, 0xeb, 0xf9, 0x76, 0xba, 0xd7, 0x07,
-	0x39, 0x1d, 0xc1, 0xff, 0x95, 0xcc, 0x62, 0x74, 0xfe, 0xb9, 0xc4, 0xeb, 0xfb, 0x55, 0xc0, 0x1e,
-	0x60, 0xdc, 0x9a, 0x4b, 0x6d, 0x64, 0xaa, 0xb0, 0xf0, 0x0d, 0x75, 0x82, 0x07, 0xa5, 0x95, 0x43,
-	0xdc, 0x9e, 0x37, 0xf0, 0xed, 0x5a, 0x2e, 0x1f, 0x30, 0x0e, 0x17, 0x4f, 0x18, 0x9a, 0x76, 0x9b,
-	0x82, 0xbd, 0x1b, 0x4d, 0x60, 0xa8, 0x90, 0x6b, 0x07, 0x4b, 0x4f, 0x56, 0x89, 0x47, 0xad, 0xc9,
-	0xae, 0xe0, 0xf2, 0xa0, 0x4b, 0x35, 0x29, 0x7b, 0x83, 0xd1, 0xb3, 0x48, 0xde, 0x93, 0x48, 0xfc,
-	0x2d, 0x5a, 0x76, 0x0f, 0xe3, 0x96, 0xb1, 0x66, 0x33, 0x05, 0x1b, 0x75, 0xa2, 0x81, 0xc6, 0xc2,
-	0xfd, 0xf2, 0xc5, 0x77, 0x17, 0x4e, 0x5f, 0x17, 0xcb, 0xdd, 0x2d, 0xd0, 0x08, 0xac, 0x06, 0x6b,
-	0x7a, 0x33, 0x6f, 0x1f, 0xca, 0xdc, 0x74, 0x24, 0x93, 0xd9, 0xaf, 0x75, 0x1a, 0x45, 0x87, 0xae,
-	0x61, 0xd8, 0xe2, 0x44, 0xbd, 0xc3, 0xd7, 0xe6, 0x0f, 0x9b, 0xdc, 0x1e, 0x51, 0x59, 0x77, 0x8a,
-	0xc0, 0x6a, 0xd0, 0x31, 0x6d, 0x63, 0xfa, 0x17, 0xd3, 0x36, 0x46, 0xcc, 0xac, 0x13, 0x9d, 0x94,
-	0xf9, 0xbb, 0x9f, 0x00, 0x00, 0x00, 0xff, 0xff, 0x57, 0xa1, 0x16, 0xbc, 0x62, 0x03, 0x00, 0x00,
+	// 449 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xad, 0x53, 0x4d, 0x4f, 0xe3, 0x30,
+	0x10, 0xa5, 0x2d, 0x1f, 0xdd, 0x29, 0x69, 0xc1, 0x2a, 0x4b, 0xda, 0x13, 0x18, 0x41, 0xcb, 0xa5,
+	0x87, 0xee, 0x7d, 0x05, 0x62, 0x39, 0x21, 0x21, 0x48, 0x25, 0x38, 0x46, 0x69, 0x32, 0x40, 0x85,
+	0x89, 0x83, 0xed, 0x02, 0xfd, 0x13, 0xfb, 0x97, 0xf6, 0xaf, 0xe1, 0x38, 0x6e, 0x44, 0xd3, 0x48,
+	0xdb, 0x03, 0xb7, 0xcc, 0x9b, 0xe7, 0xf9, 0x78, 0x6f, 0x02, 0x2d, 0x19, 0x3e, 0x61, 0x34, 0x65,
+	0x28, 0x06, 0x89, 0xe0, 0x8a, 0x93, 0x9d, 0x1c, 0xf0, 0x0d, 0x20, 0xe9, 0xdf, 0x2a, 0xb4, 0xcf,
+	0x19, 0xe3, 0x61, 0xa0, 0xf0, 0x9a, 0x47, 0x28, 0x3d, 0x7c, 0x9d, 0xa2, 0x54, 0xa4, 0x0b, 0xf5,
+	0x97, 0x20, 0x9e, 0x3c, 0xe8, 0x6f, 0xb7, 0x72, 0x50, 0xe9, 0xff, 0xf0, 0xf2, 0x98, 0x1c, 0x81,
+	0x13, 0x6b, 0xae, 0x2f, 0x91, 0x61, 0xa8, 0xb8, 0x70, 0xab, 0x86, 0xb0, 0x9d, 0x82, 0x23, 0x8b,
+	0x91, 0x1e, 0xb4, 0xd2, 0x58, 0xfa, 0x22, 0xab, 0x88, 0x91, 0x5b, 0xd3, 0xb4, 0x9a, 0xd7, 0x8c,
+	0xbf, 0xf4, 0xc1, 0x88, 0xb4, 0x61, 0xe3, 0x81, 0x8b, 0x10, 0xdd, 0x75, 0x9d, 0xae, 0x7b, 0x59,
+	0x40, 0x6e, 0x81, 0xc8, 0x44, 0x60, 0x10, 0xf9, 0x21, 0x8f, 0xa5, 0x12, 0xc1, 0x24, 0x56, 0xd2,
+	0xdd, 0x38, 0xa8, 0xf5, 0x1b, 0x43, 0x3a, 0x28, 0xee, 0x31, 0x18, 0x19, 0xee, 0x45, 0x4e, 0xf5,
+	0x76, 0x65, 0x01, 0x91, 0xe9, 0xd8, 0xe1, 0x54, 0x08, 0x8c, 0x95, 0x6f, 0x46, 0x70, 0x37, 0x75,
+	0x35, 0x3d, 0xb6, 0x05, 0xcd, 0xfa, 0xf4, 0x0c, 0xf6, 0x0a, 0x7a, 0xc8, 0x44, 0xd7, 0xc0, 0x74,
+	0x9f, 0xc0, 0x26, 0x22, 0xfb, 0xbe, 0x62, 0xde, 0x37, 0x73, 0x38, 0xab, 0x10, 0xc1, 0xcf, 0x3f,
+	0x18, 0x94, 0x69, 0x7a, 0x0c, 0xcd, 0xb9, 0x24, 0x0c, 0x03, 0xa9, 0x15, 0xc9, 0x2a, 0x38, 0x56,
+	0x91, 0x0c, 0x5c, 0x49, 0x5e, 0xda, 0x81, 0xfd, 0xa5, 0x2e, 0xd9, 0xa4, 0xf4, 0x1e, 0xda, 0x97,
+	0x6c, 0xf2, 0x38, 0x19, 0xb3, 0xef, 0xb5, 0x94, 0xfe, 0x86, 0xbd, 0x42, 0x61, 0xab, 0x8d, 0x5e,
+	0x0c, 0x6d, 0x62, 0x41, 0x1a, 0x07, 0xbf, 0xd2, 0xa9, 0x82, 0x9d, 0xa2, 0x4f, 0xe4, 0x10, 0xb6,
+	0x15, 0x4f, 0x38, 0xe3, 0x8f, 0x33, 0xff, 0x19, 0x67, 0x76, 0xb0, 0xc6, 0x1c, 0xbb, 0xc2, 0x19,
+	0xe9, 0xa4, 0x73, 0x7f, 0xf8, 0xf2, 0x19, 0xdf, 0xcd, 0x58, 0x35, 0x6f, 0x4b, 0xc7, 0x23, 0x1d,
+	0x12, 0x0a, 0x0e, 0x8f, 0xd1, 0x4f, 0xf4, 0x21, 0xbc, 0x05, 0x6c, 0x8a, 0xe6, 0xc4, 0xea, 0x5e,
+	0x43, 0x83, 0x37, 0x28, 0xee, 0x52, 0x68, 0xf8, 0xaf, 0x0a, 0x8d, 0x9b, 0xe1, 0x68, 0x7e, 0x31,
+	0x64, 0x0c, 0xce, 0x82, 0xc3, 0xe4, 0x64, 0xf9, 0x9c, 0xca, 0x7e, 0x89, 0x6e, 0xef, 0xbf, 0x3c,
+	0x6b, 0xc0, 0x1a, 0x79, 0x82, 0x56, 0xc1, 0x1d, 0xd2, 0x5f, 0x7e, 0x5d, 0x7e, 0x26, 0xdd, 0xd3,
+	0x15, 0x98, 0x79, 0x27, 0xbd, 0xcd, 0x82, 0x27, 0x65, 0xdb, 0x94, 0x5d, 0x43, 0xd9, 0x36, 0xa5,
+	0xe6, 0xd2, 0xb5, 0xf1, 0xa6, 0xc9, 0xff, 0xfa, 0x04, 0xfc, 0x1a, 0x71, 0x72, 0x50, 0x04, 0x00,
+	0x00,
 }
@@ -0,0 +1,129 @@
+package scheduler
+
+import (
+	scheduler_protos "github.com/square/p2/pkg/grpc/scheduler/protos"
+	"github.com/square/p2/pkg/manifest"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/types"
+
+	context "golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+// Scheduler is the scheduling implementation the server exposes, such as
+// scheduler.BinPackingScheduler
+type Scheduler interface {
+	EligibleNodes(manifest.Manifest, klabels.Selector) ([]types.NodeName, error)
+	AllocateNodes(manifest manifest.Manifest, nodeSelector klabels.Selector, allocationCount int, force bool, spread rc_fields.Spread) ([]types.NodeName, error)
+	DeallocateNodes(nodeSelector klabels.Selector, nodes []types.NodeName) error
+}
+
+type server struct {
+	scheduler Scheduler
+}
+
+var _ scheduler_protos.P2SchedulerServer = server{}
+
+func NewServer(scheduler Scheduler) scheduler_protos.P2SchedulerServer {
+	return server{
+		scheduler: scheduler,
+	}
+}
+
+func (s server) EligibleNodes(_ context.Context, req *scheduler_protos.EligibleNodesRequest) (*scheduler_protos.EligibleNodesResponse, error) {
+	man, selector, err := parseRequest(req.Manifest, req.NodeSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := s.scheduler.EligibleNodes(man, selector)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "could not determine eligible nodes: %s", err)
+	}
+
+	return &scheduler_protos.EligibleNodesResponse{
+		EligibleNodes: nodeStrings(nodes),
+	}, nil
+}
+
+func (s server) AllocateNodes(_ context.Context, req *scheduler_protos.AllocateNodesRequest) (*scheduler_protos.AllocateNodesResponse, error) {
+	man, selector, err := parseRequest(req.Manifest, req.NodeSelector)
+	if err != nil {
+		return nil, err
+	}
+	if req.NodesRequested < 0 {
+		return nil, grpc.Errorf(codes.InvalidArgument, "nodes_requested cannot be negative")
+	}
+
+	spread := rc_fields.Spread{
+		CurrentNodes: make([]types.NodeName, len(req.CurrentNodes)),
+	}
+	for i, node := range req.CurrentNodes {
+		spread.CurrentNodes[i] = types.NodeName(node)
+	}
+	for _, constraint := range req.SpreadConstraints {
+		c := rc_fields.SpreadConstraint{
+			TopologyKey: constraint.TopologyKey,
+			MaxSkew:     int(constraint.MaxSkew),
+			OnePerValue: constraint.OnePerValue,
+		}
+		err = c.Validate()
+		if err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "invalid spread constraint: %s", err)
+		}
+		spread.Constraints = append(spread.Constraints, c)
+	}
+
+	nodes, err := s.scheduler.AllocateNodes(man, selector, int(req.NodesRequested), req.Force, spread)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "could not allocate nodes: %s", err)
+	}
+
+	return &scheduler_protos.AllocateNodesResponse{
+		AllocatedNodes: nodeStrings(nodes),
+	}, nil
+}
+
+func (s server) DeallocateNodes(_ context.Context, req *scheduler_protos.DeallocateNodesRequest) (*scheduler_protos.DeallocateNodesResponse, error) {
+	selector, err := klabels.Parse(req.NodeSelector)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "could not parse node selector: %s", err)
+	}
+
+	nodes := make([]types.NodeName, len(req.NodesReleased))
+	for i, node := range req.NodesReleased {
+		nodes[i] = types.NodeName(node)
+	}
+
+	err = s.scheduler.DeallocateNodes(selector, nodes)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "could not deallocate nodes: %s", err)
+	}
+	return &scheduler_protos.DeallocateNodesResponse{}, nil
+}
+
+func parseRequest(manifestStr string, nodeSelector string) (manifest.Manifest, klabels.Selector, error) {
+	if manifestStr == "" {
+		return nil, nil, grpc.Errorf(codes.InvalidArgument, "manifest must be provided")
+	}
+	man, err := manifest.FromBytes([]byte(manifestStr))
+	if err != nil {
+		return nil, nil, grpc.Errorf(codes.InvalidArgument, "could not parse passed manifest: %s", err)
+	}
+
+	selector, err := klabels.Parse(nodeSelector)
+	if err != nil {
+		return nil, nil, grpc.Errorf(codes.InvalidArgument, "could not parse node selector: %s", err)
+	}
+	return man, selector, nil
+}
+
+func nodeStrings(nodes []types.NodeName) []string {
+	ret := make([]string, len(nodes))
+	for i, node := range nodes {
+		ret[i] = node.String()
+	}
+	return ret
+}
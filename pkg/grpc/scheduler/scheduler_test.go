@@ -0,0 +1,94 @@
+package scheduler
+
+import (
+	"testing"
+
+	scheduler_protos "github.com/square/p2/pkg/grpc/scheduler/protos"
+	"github.com/square/p2/pkg/manifest"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/types"
+
+	context "golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+type fakeScheduler struct {
+	allocateCount int
+	spread        rc_fields.Spread
+	deallocated   []types.NodeName
+}
+
+func (f *fakeScheduler) EligibleNodes(manifest.Manifest, klabels.Selector) ([]types.NodeName, error) {
+	return []types.NodeName{"node1", "node2"}, nil
+}
+
+func (f *fakeScheduler) AllocateNodes(_ manifest.Manifest, _ klabels.Selector, allocationCount int, _ bool, spread rc_fields.Spread) ([]types.NodeName, error) {
+	f.allocateCount = allocationCount
+	f.spread = spread
+	return []types.NodeName{"node1"}, nil
+}
+
+func (f *fakeScheduler) DeallocateNodes(_ klabels.Selector, nodes []types.NodeName) error {
+	f.deallocated = nodes
+	return nil
+}
+
+func TestAllocateNodes(t *testing.T) {
+	fake := &fakeScheduler{}
+	server := NewServer(fake)
+
+	resp, err := server.AllocateNodes(context.Background(), &scheduler_protos.AllocateNodesRequest{
+		Manifest:       "id: test_app",
+		NodeSelector:   "pool=web",
+		NodesRequested: 1,
+		CurrentNodes:   []string{"node2"},
+		SpreadConstraints: []*scheduler_protos.SpreadConstraint{
+			{TopologyKey: "zone", MaxSkew: 1},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error from AllocateNodes: %s", err)
+	}
+	if len(resp.AllocatedNodes) != 1 || resp.AllocatedNodes[0] != "node1" {
+		t.Errorf("Expected [node1] to be allocated, got %s", resp.AllocatedNodes)
+	}
+	if fake.allocateCount != 1 {
+		t.Errorf("Expected 1 node to be requested, got %d", fake.allocateCount)
+	}
+	if len(fake.spread.CurrentNodes) != 1 || fake.spread.CurrentNodes[0] != "node2" {
+		t.Errorf("Expected current nodes to be passed through, got %s", fake.spread.CurrentNodes)
+	}
+	if len(fake.spread.Constraints) != 1 || fake.spread.Constraints[0].TopologyKey != "zone" {
+		t.Errorf("Expected spread constraints to be passed through, got %+v", fake.spread.Constraints)
+	}
+}
+
+func TestAllocateNodesInvalidManifest(t *testing.T) {
+	server := NewServer(&fakeScheduler{})
+
+	_, err := server.AllocateNodes(context.Background(), &scheduler_protos.AllocateNodesRequest{
+		Manifest:       "bad manifest",
+		NodesRequested: 1,
+	})
+	if grpc.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected error to be %s but was %s", codes.InvalidArgument.String(), grpc.ErrorDesc(err))
+	}
+}
+
+func TestDeallocateNodes(t *testing.T) {
+	fake := &fakeScheduler{}
+	server := NewServer(fake)
+
+	_, err := server.DeallocateNodes(context.Background(), &scheduler_protos.DeallocateNodesRequest{
+		NodeSelector:  "pool=web",
+		NodesReleased: []string{"node1"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error from DeallocateNodes: %s", err)
+	}
+	if len(fake.deallocated) != 1 || fake.deallocated[0] != "node1" {
+		t.Errorf("Expected [node1] to be deallocated, got %s", fake.deallocated)
+	}
+}
@@ -13,16 +13,21 @@ import (
 	"github.com/square/p2/pkg/alerting"
 	"github.com/square/p2/pkg/artifact"
 	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/budget"
+	"github.com/square/p2/pkg/farmstatus"
+	freeze_fields "github.com/square/p2/pkg/freeze/fields"
 	"github.com/square/p2/pkg/health/checker"
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/logging"
 	p2metrics "github.com/square/p2/pkg/metrics"
 	"github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/shard"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/rcstore"
 	"github.com/square/p2/pkg/store/consul/statusstore/rcstatus"
 	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
 
 	"github.com/rcrowley/go-metrics"
@@ -61,6 +66,17 @@ type AuditLogStore interface {
 	) error
 }
 
+// FreezeStore lists the deploy freeze windows that RCs must respect
+type FreezeStore interface {
+	List() ([]freeze_fields.Window, error)
+}
+
+// DisruptionChecker decides whether taking pods down would break the
+// disruption budgets that cover them
+type DisruptionChecker interface {
+	Check(disrupted types.PodLocations) (budget.Result, error)
+}
+
 // The Farm is responsible for spawning and reaping replication controllers
 // as they are added to and deleted from Consul. Multiple farms can exist
 // simultaneously, but each one must hold a different Consul session. This
@@ -71,6 +87,10 @@ type AuditLogStore interface {
 // pick up a particular RC. This can be used to assist in RC partitioning of
 // work or to create test environments. Note that this is _not_ required for RC
 // farms to cooperatively schedule work.
+//
+// With a sharder, the farm only locks the RCs the sharder assigns to it, and
+// releases RCs it no longer owns when farms join or leave. It still watches
+// every RC and skips the ones it doesn't own (see shard.Sharder).
 type Farm struct {
 	// constructor arguments for rcs created by this farm
 	store         consulStore
@@ -88,9 +108,10 @@ type Farm struct {
 	// session stream for the rcs locked by this farm
 	sessions <-chan string
 
-	children map[fields.ID]childRC
-	childMu  sync.Mutex
-	session  consul.Session
+	children  map[fields.ID]childRC
+	childMu   sync.Mutex
+	session   consul.Session
+	sessionID string
 
 	logger     logging.Logger
 	alerter    alerting.Alerter
@@ -104,12 +125,21 @@ type Farm struct {
 
 	artifactRegistry artifact.Registry
 	sdChecker        ServiceDiscoveryChecker
+	freezeStore      FreezeStore
+	disruption       DisruptionChecker
+
+	sharder      shard.Sharder
+	shardChanges <-chan struct{}
 }
 
 type childRC struct {
 	rc       ReplicationController
 	unlocker consul.Unlocker
 	quit     chan<- struct{}
+
+	// the session that locked the RC and when, for introspection
+	session     string
+	lockedSince time.Time
 }
 
 func NewFarm(
@@ -131,11 +161,19 @@ func NewFarm(
 	rcWatchPauseTime time.Duration,
 	artifactRegistry artifact.Registry,
 	sdChecker ServiceDiscoveryChecker,
+	freezeStore FreezeStore,
+	disruption DisruptionChecker,
+	sharder shard.Sharder,
 ) *Farm {
 	if alerter == nil {
 		alerter = alerting.NewNop()
 	}
 
+	var shardChanges <-chan struct{}
+	if sharder != nil {
+		shardChanges = sharder.Subscribe()
+	}
+
 	return &Farm{
 		store:            store,
 		client:           client,
@@ -156,6 +194,10 @@ func NewFarm(
 		rcWatchPauseTime: rcWatchPauseTime,
 		artifactRegistry: artifactRegistry,
 		sdChecker:        sdChecker,
+		freezeStore:      freezeStore,
+		disruption:       disruption,
+		sharder:          sharder,
+		shardChanges:     shardChanges,
 	}
 }
 
@@ -171,6 +213,7 @@ func (rcf *Farm) Start(quit <-chan struct{}) {
 	consulutil.WithSession(quit, rcf.sessions, func(sessionQuit <-chan struct{}, sessionID string) {
 		rcf.logger.WithField("session", sessionID).Infoln("Acquired new session")
 		rcf.session = rcf.store.NewUnmanagedSession(sessionID, "")
+		rcf.sessionID = sessionID
 		rcf.mainLoop(sessionQuit)
 	})
 }
@@ -182,6 +225,9 @@ func (rcf *Farm) mainLoop(quit <-chan struct{}) {
 	defer close(subQuit)
 
 	rcKeyWatch, rcErr := rcf.rcStore.WatchRCKeysWithLockInfo(subQuit, rcf.rcWatchPauseTime)
+	if rcf.sharder != nil {
+		rcKeyWatch = resendOnShardChange(subQuit, rcKeyWatch, rcf.shardChanges)
+	}
 
 	go func(errCh <-chan error) {
 		for {
@@ -214,17 +260,31 @@ START_LOOP:
 			rcf.session = nil
 			rcf.releaseChildren()
 			return
-		case rcKeys := <-rcKeyWatch:
+		case rcKeys, ok := <-rcKeyWatch:
+			if !ok {
+				rcf.logger.NoFields().Errorln("Replication controller watch closed, releasing replication controllers")
+				rcf.session = nil
+				rcf.releaseChildren()
+				return
+			}
 			startTime := time.Now()
 			rcf.logger.WithField("n", len(rcKeys)).Debugln("Received replication controller update")
 			countHistogram := metrics.GetOrRegisterHistogram("rc_count", p2metrics.Registry, metrics.NewExpDecaySample(1028, 0.015))
 			countHistogram.Update(int64(len(rcKeys)))
 
+			// the failsafe has to see every RC, not just the ones this
+			// farm owns
 			rcf.failsafe(rcKeys)
 
 			// track which children were found in the returned set
 			foundChildren := make(map[fields.ID]struct{})
 			for _, rcKey := range rcKeys {
+				// RCs this farm no longer owns are not found, so they are
+				// released below
+				if !rcf.owns(rcKey.ID) {
+					continue
+				}
+
 				rcLogger := rcf.logger.SubLogger(logrus.Fields{
 					"rc": rcKey.ID,
 				})
@@ -286,13 +346,20 @@ START_LOOP:
 					rcf.healthChecker,
 					rcf.artifactRegistry,
 					rcf.sdChecker,
+					rcf.freezeStore,
+					rcf.disruption,
+					rcf.rcStore,
 				)
 				childQuit := make(chan struct{})
+				rcf.childMu.Lock()
 				rcf.children[rcKey.ID] = childRC{
-					rc:       newChild,
-					quit:     childQuit,
-					unlocker: rcUnlocker,
+					rc:          newChild,
+					quit:        childQuit,
+					unlocker:    rcUnlocker,
+					session:     rcf.sessionID,
+					lockedSince: time.Now(),
 				}
+				rcf.childMu.Unlock()
 				foundChildren[rcKey.ID] = struct{}{}
 
 				go func(id fields.ID) {
@@ -335,6 +402,43 @@ START_LOOP:
 	}
 }
 
+// resendOnShardChange forwards results from the watch and sends the last one again
+// whenever the IDs this farm owns change, so that the farm picks up and
+// releases RCs without waiting for the watch to return. The returned
+// channel is closed when the watch is closed.
+func resendOnShardChange(quit <-chan struct{}, watch <-chan []rcstore.RCLockResult, changes <-chan struct{}) <-chan []rcstore.RCLockResult {
+	out := make(chan []rcstore.RCLockResult)
+	go func() {
+		defer close(out)
+
+		var last []rcstore.RCLockResult
+		received := false
+		for {
+			select {
+			case <-quit:
+				return
+			case v, ok := <-watch:
+				if !ok {
+					return
+				}
+				last = v
+				received = true
+			case <-changes:
+				if !received {
+					continue
+				}
+			}
+
+			select {
+			case <-quit:
+				return
+			case out <- last:
+			}
+		}
+	}()
+	return out
+}
+
 // This failsafe is only run at startup of the farm for performance reasons. It checks two conditions:
 // 1) there is at least one RC
 // 2) the sum of the replicas_desired fields for all RCs is greater than zero.
@@ -402,6 +506,27 @@ func (rcf *Farm) releaseDeletedChildren(foundChildren map[fields.ID]struct{}) {
 	}
 }
 
+// Children returns the RCs this farm holds locks for
+func (rcf *Farm) Children() []farmstatus.Child {
+	rcf.childMu.Lock()
+	defer rcf.childMu.Unlock()
+	children := make([]farmstatus.Child, 0, len(rcf.children))
+	for id, child := range rcf.children {
+		children = append(children, farmstatus.Child{
+			ID:          id.String(),
+			Session:     child.session,
+			LockedSince: child.lockedSince,
+			LastOutcome: child.rc.LastOutcome(),
+		})
+	}
+	return children
+}
+
+// owns returns whether the farm's sharder, if any, assigns the RC to this farm
+func (rcf *Farm) owns(rcID fields.ID) bool {
+	return rcf.sharder == nil || rcf.sharder.Owns(rcID.String())
+}
+
 // test if the farm should work on the given replication controller ID
 func (rcf *Farm) shouldWorkOn(rcID fields.ID) (bool, error) {
 	if rcf.rcSelector.Empty() {
@@ -4,10 +4,12 @@ import (
 	"net/http"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/square/p2/pkg/alerting"
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/rc/fields"
 	"github.com/square/p2/pkg/store/consul/rcstore"
 
 	. "github.com/anthonybishopric/gotcha"
@@ -88,6 +90,63 @@ func TestRCsWithZeroCountsWillTriggerIncident(t *testing.T) {
 	rcf.initialFailsafe()
 }
 
+type fakeSharder struct {
+	owned map[fields.ID]bool
+}
+
+func (f fakeSharder) Owns(id string) bool {
+	return f.owned[fields.ID(id)]
+}
+
+func (f fakeSharder) Subscribe() <-chan struct{} {
+	return nil
+}
+
+func TestFarmOnlyOwnsShardedRCs(t *testing.T) {
+	rcf := &Farm{}
+	Assert(t).IsTrue(rcf.owns("some_rc"), "a farm without a sharder should own every RC")
+
+	rcf.sharder = fakeSharder{owned: map[fields.ID]bool{"mine": true}}
+	Assert(t).IsTrue(rcf.owns("mine"), "should have owned the RC assigned by the sharder")
+	Assert(t).IsFalse(rcf.owns("theirs"), "should not have owned an RC assigned elsewhere")
+}
+
+func TestShardChangesResendLastRCKeys(t *testing.T) {
+	quit := make(chan struct{})
+	defer close(quit)
+	rcKeyWatch := make(chan []rcstore.RCLockResult)
+	shardChanges := make(chan struct{})
+	out := resendOnShardChange(quit, rcKeyWatch, shardChanges)
+
+	// nothing is resent before the watch has returned
+	shardChanges <- struct{}{}
+	select {
+	case <-out:
+		t.Fatal("should not have sent RC keys before the watch returned any")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	rcKeys := []rcstore.RCLockResult{{ID: "some_rc"}}
+	rcKeyWatch <- rcKeys
+	Assert(t).AreEqual((<-out)[0].ID, fields.ID("some_rc"), "should have forwarded the watched RC keys")
+
+	shardChanges <- struct{}{}
+	select {
+	case resent := <-out:
+		Assert(t).AreEqual(resent[0].ID, fields.ID("some_rc"), "should have resent the last RC keys")
+	case <-time.After(5 * time.Second):
+		t.Fatal("should have resent the last RC keys when the shard changed")
+	}
+
+	close(rcKeyWatch)
+	select {
+	case _, ok := <-out:
+		Assert(t).IsFalse(ok, "should have closed the output once the watch was closed")
+	case <-time.After(5 * time.Second):
+		t.Fatal("should have closed the output once the watch was closed")
+	}
+}
+
 func TestHTTPApplicatorImplementsFunctionality(t *testing.T) {
 	// assign an http applicator to Labeler to make sure http applicator implements the
 	// functionality it needs to
@@ -3,11 +3,13 @@ package fields
 import (
 	"encoding/json"
 	"sort"
+	"time"
 
 	"k8s.io/kubernetes/pkg/labels"
 
 	"github.com/pborman/uuid"
 	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
 )
 
@@ -42,6 +44,40 @@ const (
 	StaticStrategy  = Strategy("static_strategy")
 )
 
+// SpreadConstraint limits how unevenly an RC's pods may be spread across the
+// values of a node label, such as a rack or an availability zone. Nodes that
+// do not have the label are never used by an RC with the constraint.
+type SpreadConstraint struct {
+	// The node label whose values divide nodes into failure domains
+	TopologyKey string `json:"topology_key"`
+
+	// The largest allowed difference between the number of pods in the most
+	// and least populated domains
+	MaxSkew int `json:"max_skew,omitempty"`
+
+	// When set, at most one pod may be scheduled per value of the label
+	OnePerValue bool `json:"one_per_value,omitempty"`
+}
+
+func (c SpreadConstraint) Validate() error {
+	if c.TopologyKey == "" {
+		return util.Errorf("spread constraint has no topology key")
+	}
+	if c.OnePerValue == (c.MaxSkew > 0) {
+		return util.Errorf("spread constraint on %s must set exactly one of a positive max skew or one per value", c.TopologyKey)
+	}
+	return nil
+}
+
+// Spread is passed to schedulers allocating nodes for an RC so that the
+// allocated nodes respect the RC's spread constraints
+type Spread struct {
+	Constraints []SpreadConstraint
+
+	// The nodes the RC already has pods on
+	CurrentNodes []types.NodeName
+}
+
 // RC holds the runtime state of a Resource Controller as saved in Consul.
 type RC struct {
 	// GUID for this controller
@@ -66,6 +102,14 @@ type RC struct {
 	// Distinguishes between dynamic, static or other strategies for allocating
 	// nodes on which the rc can schedule the manifest.
 	AllocationStrategy Strategy
+
+	// Limits how the controller's pods are spread across node labels
+	SpreadConstraints []SpreadConstraint
+
+	// When the controller cannot find room for a pod, it may evict pods of
+	// controllers with a lower priority to make room. Controllers default
+	// to a priority of 0
+	Priority int
 }
 
 // RawRC defines the JSON format used to store data into Consul. It should only be used
@@ -80,9 +124,11 @@ type RawRC struct {
 	// zero-count indicating the RC handler should remove any and all pods
 	// from a case (for instance if the json key was changed) where golang
 	// is defaulting to the 0 value
-	ReplicasDesired    *int     `json:"replicas_desired"`
-	Disabled           bool     `json:"disabled"`
-	AllocationStrategy Strategy `json:"allocation_strategy"`
+	ReplicasDesired    *int               `json:"replicas_desired"`
+	Disabled           bool               `json:"disabled"`
+	AllocationStrategy Strategy           `json:"allocation_strategy"`
+	SpreadConstraints  []SpreadConstraint `json:"spread_constraints,omitempty"`
+	Priority           int                `json:"priority,omitempty"`
 }
 
 // MarshalJSON implements the json.Marshaler interface for serializing the RC to JSON
@@ -127,6 +173,8 @@ func (rc RC) ToRaw() (RawRC, error) {
 		ReplicasDesired:    &rc.ReplicasDesired,
 		Disabled:           rc.Disabled,
 		AllocationStrategy: rc.AllocationStrategy,
+		SpreadConstraints:  rc.SpreadConstraints,
+		Priority:           rc.Priority,
 	}, nil
 }
 
@@ -166,12 +214,81 @@ func (rc *RC) UnmarshalJSON(b []byte) error {
 		ReplicasDesired:    *rawRC.ReplicasDesired,
 		Disabled:           rawRC.Disabled,
 		AllocationStrategy: rawRC.AllocationStrategy,
+		SpreadConstraints:  rawRC.SpreadConstraints,
+		Priority:           rawRC.Priority,
 	}
 	return nil
 }
 
 var _ json.Unmarshaler = &RC{}
 
+// MaxRevisions is the number of prior manifests kept in an RC's history. The
+// oldest revisions are dropped first.
+const MaxRevisions = 10
+
+// Revision is a manifest an RC used to have. Timestamp and User describe the
+// change that replaced it.
+type Revision struct {
+	Number    int       `json:"number"`
+	SHA       string    `json:"sha"`
+	Manifest  string    `json:"manifest"`
+	Timestamp time.Time `json:"timestamp"`
+	User      string    `json:"user"`
+}
+
+// GetManifest parses the manifest stored in the revision
+func (r Revision) GetManifest() (manifest.Manifest, error) {
+	return manifest.FromBytes([]byte(r.Manifest))
+}
+
+// History holds the prior manifests of an RC, oldest first. It is stored next
+// to the RC and carried over to the new RC when a rolling update replaces it.
+type History struct {
+	Revisions []Revision `json:"revisions"`
+}
+
+// Add returns the history with the given manifest appended as the newest
+// revision, dropping the oldest revisions beyond MaxRevisions
+func (h History) Add(man manifest.Manifest, timestamp time.Time, user string) (History, error) {
+	manBytes, err := man.Marshal()
+	if err != nil {
+		return History{}, util.Errorf("could not marshal manifest for RC history: %s", err)
+	}
+	sha, err := man.SHA()
+	if err != nil {
+		return History{}, util.Errorf("could not compute manifest SHA for RC history: %s", err)
+	}
+
+	number := 1
+	if len(h.Revisions) > 0 {
+		number = h.Revisions[len(h.Revisions)-1].Number + 1
+	}
+
+	revisions := append([]Revision{}, h.Revisions...)
+	revisions = append(revisions, Revision{
+		Number:    number,
+		SHA:       sha,
+		Manifest:  string(manBytes),
+		Timestamp: timestamp,
+		User:      user,
+	})
+	if len(revisions) > MaxRevisions {
+		revisions = revisions[len(revisions)-MaxRevisions:]
+	}
+	return History{Revisions: revisions}, nil
+}
+
+// Revision returns the revision with the given number, or false if it isn't
+// in the history
+func (h History) Revision(number int) (Revision, bool) {
+	for _, revision := range h.Revisions {
+		if revision.Number == number {
+			return revision, true
+		}
+	}
+	return Revision{}, false
+}
+
 // Implements sort.Interface to make a list of ids sortable lexicographically
 type IDs []ID
 
@@ -2,7 +2,9 @@ package fields
 
 import (
 	"encoding/json"
+	"fmt"
 	"testing"
+	"time"
 
 	. "github.com/anthonybishopric/gotcha"
 	"github.com/square/p2/pkg/manifest"
@@ -14,9 +16,11 @@ func TestJSONMarshal(t *testing.T) {
 	m := mb.GetManifest()
 
 	rc1 := RC{
-		ID:              "hello",
-		Manifest:        m,
-		ReplicasDesired: 2,
+		ID:                "hello",
+		Manifest:          m,
+		ReplicasDesired:   2,
+		SpreadConstraints: []SpreadConstraint{{TopologyKey: "rack", MaxSkew: 1}},
+		Priority:          10,
 	}
 
 	b, err := json.Marshal(&rc1)
@@ -28,6 +32,9 @@ func TestJSONMarshal(t *testing.T) {
 	Assert(t).IsNil(err, "should have unmarshaled")
 	Assert(t).AreEqual(rc1.ID, rc2.ID, "RC ID changed when serialized")
 	Assert(t).AreEqual(rc1.Manifest.ID(), rc2.Manifest.ID(), "Manifest ID changed when serialized")
+	Assert(t).AreEqual(len(rc2.SpreadConstraints), 1, "spread constraints changed when serialized")
+	Assert(t).AreEqual(rc2.SpreadConstraints[0], rc1.SpreadConstraints[0], "spread constraint changed when serialized")
+	Assert(t).AreEqual(rc2.Priority, rc1.Priority, "priority changed when serialized")
 }
 
 func TestZeroUnmarshal(t *testing.T) {
@@ -42,3 +49,69 @@ func TestZeroUnmarshal(t *testing.T) {
 		t.Errorf("got an error unmarshaling an otherwise-empty RC with a replicas_desired count of 0: %s", err)
 	}
 }
+
+func TestSpreadConstraintValidate(t *testing.T) {
+	valid := []SpreadConstraint{
+		{TopologyKey: "rack", MaxSkew: 1},
+		{TopologyKey: "rack", OnePerValue: true},
+	}
+	for _, c := range valid {
+		if err := c.Validate(); err != nil {
+			t.Errorf("expected %+v to be valid but got %s", c, err)
+		}
+	}
+
+	invalid := []SpreadConstraint{
+		{MaxSkew: 1},
+		{TopologyKey: "rack"},
+		{TopologyKey: "rack", MaxSkew: 1, OnePerValue: true},
+		{TopologyKey: "rack", MaxSkew: -1},
+	}
+	for _, c := range invalid {
+		if err := c.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", c)
+		}
+	}
+}
+
+func TestHistoryAdd(t *testing.T) {
+	var history History
+	for i := 0; i < MaxRevisions+2; i++ {
+		mb := manifest.NewBuilder()
+		mb.SetID("hello")
+		mb.SetConfig(map[interface{}]interface{}{"version": i})
+
+		var err error
+		history, err = history.Add(mb.GetManifest(), time.Now(), fmt.Sprintf("user%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(history.Revisions) != MaxRevisions {
+		t.Fatalf("expected history to be bounded to %d revisions but had %d", MaxRevisions, len(history.Revisions))
+	}
+	if history.Revisions[0].Number != 3 {
+		t.Errorf("expected the oldest revisions to be dropped, leaving revision 3 first but got %d", history.Revisions[0].Number)
+	}
+
+	newest, ok := history.Revision(MaxRevisions + 2)
+	if !ok {
+		t.Fatal("expected to find the newest revision")
+	}
+	if newest.User != fmt.Sprintf("user%d", MaxRevisions+1) {
+		t.Errorf("unexpected user %s on the newest revision", newest.User)
+	}
+	man, err := newest.GetManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha, _ := man.SHA()
+	if sha != newest.SHA {
+		t.Errorf("expected the revision's manifest to have SHA %s but had %s", newest.SHA, sha)
+	}
+
+	if _, ok := history.Revision(1); ok {
+		t.Error("expected revision 1 to have been dropped")
+	}
+}
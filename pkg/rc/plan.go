@@ -0,0 +1,201 @@
+package rc
+
+import (
+	freeze_fields "github.com/square/p2/pkg/freeze/fields"
+	"github.com/square/p2/pkg/health/checker"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/rcstatus"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// A Plan describes what a replication controller would do if it handled its
+// desired state right now
+type Plan struct {
+	Current  types.PodLocations
+	Eligible []types.NodeName
+
+	// The deploy freeze window keeping the RC from adding pods beyond the
+	// ones it lost during the freeze, if any
+	Frozen *freeze_fields.Window
+
+	// The nodes the RC would schedule its pod on, the nodes it would
+	// schedule on by preempting pods of lower priority RCs when there aren't
+	// enough eligible nodes with room, and the number of pods it would still
+	// fail to schedule
+	Additions   []types.NodeName
+	Preemptions []Preemption
+	Shortfall   int
+
+	// The nodes the RC would unschedule its pod from, and the ones it would
+	// only unschedule from on a later pass because the disruption budgets
+	// covering the pods don't allow it yet. RemovalsBlocked says why
+	Removals         []types.NodeName
+	DeferredRemovals []types.NodeName
+	RemovalsBlocked  error
+
+	// The nodes the RC has pods on that are no longer eligible, once the
+	// additions and removals are made. NodeTransfer is set when the RC would
+	// try to move a pod off one of them
+	Ineligible   []types.NodeName
+	NodeTransfer *NodeTransferPlan
+}
+
+// A NodeTransferPlan describes whether a replication controller would move
+// its pod off an ineligible node
+type NodeTransferPlan struct {
+	From types.NodeName
+
+	// Why the transfer can't happen right now, if it can't
+	Blocker string
+
+	// Whether the transfer must acquire the RC's mutation lock, which
+	// rolling updates hold while they run
+	NeedsLock bool
+}
+
+// RCStatusGetter reads the status recorded for an RC
+type RCStatusGetter interface {
+	Get(rcID fields.ID) (rcstatus.Status, *api.QueryMeta, error)
+}
+
+// NewPlan computes the decisions a replication controller would make for the
+// given RC, such as which nodes it would schedule on, without changing
+// anything. The service discovery checker may be nil, in which case node
+// transfers are reported as blocked. Preemptions are only planned if the
+// scheduler is a Preemptor and rcGetter is not nil. If a deploy freeze window
+// covers the RC, the replica count and manifest recorded in its status before
+// the freeze are used, or its current ones if rcStatusGetter is nil or
+// nothing was recorded.
+func NewPlan(
+	rcFields fields.RC,
+	scheduler Scheduler,
+	labeler Labeler,
+	healthChecker checker.HealthChecker,
+	sdChecker ServiceDiscoveryChecker,
+	freezeStore FreezeStore,
+	rcStatusGetter RCStatusGetter,
+	disruption DisruptionChecker,
+	rcGetter RCGetter,
+	logger logging.Logger,
+) (Plan, error) {
+	rc := &replicationController{
+		rcID:          rcFields.ID,
+		logger:        logger,
+		scheduler:     scheduler,
+		podApplicator: labeler,
+		healthChecker: healthChecker,
+		sdChecker:     sdChecker,
+		freezeStore:   freezeStore,
+		disruption:    disruption,
+		rcGetter:      rcGetter,
+	}
+	if rcStatusGetter != nil {
+		status, _, err := rcStatusGetter.Get(rcFields.ID)
+		switch {
+		case statusstore.IsNoStatus(err):
+		case err != nil:
+			return Plan{}, util.Errorf("could not read RC status: %s", err)
+		default:
+			rc.unfrozen = status.Unfrozen
+		}
+	}
+	return rc.plan(rcFields)
+}
+
+// plan mirrors meetDesires, addPods, removePods and checkForIneligible
+func (rc *replicationController) plan(rcFields fields.RC) (Plan, error) {
+	current, err := rc.CurrentPods()
+	if err != nil {
+		return Plan{}, err
+	}
+	eligible, err := rc.eligibleNodes(rcFields, current)
+	if err != nil {
+		return Plan{}, err
+	}
+	frozen, err := rc.freezeWindow(rcFields)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	plan := Plan{
+		Current:  current,
+		Eligible: eligible,
+		Frozen:   frozen,
+	}
+
+	toAdd, err := rc.unfrozenFields(rcFields, frozen)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	currentNodes := current.Nodes()
+	after := types.NewNodeSet(currentNodes...)
+	switch {
+	case rcFields.Disabled:
+	case rcFields.ReplicasDesired > len(current) && toAdd.ReplicasDesired <= len(current):
+	case rcFields.ReplicasDesired > len(current):
+		toSchedule := toAdd.ReplicasDesired - len(currentNodes)
+		additions, err := rc.additions(toAdd, currentNodes, eligible)
+		if err != nil {
+			return Plan{}, err
+		}
+		if len(additions) > toSchedule {
+			additions = additions[:toSchedule]
+		}
+		plan.Additions = additions
+		after = after.Union(types.NewNodeSet(additions...))
+
+		if len(additions) < toSchedule {
+			preemptions, err := rc.preemptions(toAdd, currentNodes, eligible, additions, toSchedule-len(additions))
+			if err != nil {
+				return Plan{}, err
+			}
+			plan.Preemptions = preemptions
+			plan.Shortfall = toSchedule - len(additions) - len(preemptions)
+			for _, preemption := range preemptions {
+				after.InsertNode(preemption.Node)
+			}
+		}
+	case len(current) > rcFields.ReplicasDesired:
+		removals, err := rc.removals(rcFields, currentNodes, eligible)
+		if err != nil {
+			return Plan{}, err
+		}
+		allowed, refused, err := rc.budgetedRemovals(rcFields, removals)
+		if err != nil {
+			return Plan{}, err
+		}
+		plan.Removals = allowed
+		plan.DeferredRemovals = removals[len(allowed):]
+		plan.RemovalsBlocked = refused.Err()
+		after = after.Difference(types.NewNodeSet(allowed...))
+	}
+
+	var afterPods types.PodLocations
+	for _, node := range after.ListNodes() {
+		afterPods = append(afterPods, types.PodLocation{Node: node, PodID: rcFields.Manifest.ID()})
+	}
+	plan.Ineligible = rc.checkForIneligible(afterPods, eligible)
+	if len(plan.Ineligible) == 0 || rcFields.AllocationStrategy != fields.DynamicStrategy {
+		return plan, nil
+	}
+
+	transfer := &NodeTransferPlan{From: plan.Ineligible[0]}
+	if rc.sdChecker == nil {
+		transfer.Blocker = "service discovery system can't be checked"
+	} else {
+		blocker, needsLock, err := rc.nodeTransferBlocker(rcFields, afterPods, plan.Ineligible)
+		if err != nil {
+			blocker = blocker + ": " + err.Error()
+		}
+		transfer.Blocker = blocker
+		transfer.NeedsLock = needsLock
+	}
+	plan.NodeTransfer = transfer
+	return plan, nil
+}
@@ -0,0 +1,231 @@
+// +build !race
+
+package rc
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/health"
+	fake_checker "github.com/square/p2/pkg/health/checker/test"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/scheduler"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestPlanMatchesScheduling(t *testing.T) {
+	_, _, applicator, rc, _, _, _, closeFn := setup(t)
+	defer closeFn()
+
+	for i := 0; i < 4; i++ {
+		err := applicator.SetLabel(labels.NODE, fmt.Sprintf("node%d", i), "nodeQuality", "good")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	rcFields := fields.RC{
+		ID:              rc.rcID,
+		ReplicasDesired: 3,
+		Manifest:        testManifest(),
+		NodeSelector:    klabels.Everything().Add("nodeQuality", klabels.EqualsOperator, []string{"good"}),
+	}
+
+	plan, err := NewPlan(rcFields, rc.scheduler, applicator, rc.healthChecker, rc.sdChecker, nil, nil, nil, nil, logging.DefaultLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []types.NodeName{"node0", "node1", "node2"}
+	if !reflect.DeepEqual(plan.Additions, expected) {
+		t.Fatalf("expected plan to add %s but it adds %s", expected, plan.Additions)
+	}
+	if plan.Shortfall != 0 || len(plan.Removals) != 0 || len(plan.Ineligible) != 0 {
+		t.Fatalf("expected plan to only add pods, was %+v", plan)
+	}
+
+	current, err := rc.CurrentPods()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(current) != 0 {
+		t.Fatalf("planning should not have scheduled anything, found %s", current)
+	}
+
+	err = rc.meetDesires(rcFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err = rc.CurrentPods()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !types.NewNodeSet(current.Nodes()...).Equal(types.NewNodeSet(expected...)) {
+		t.Fatalf("expected the RC to schedule on the planned nodes %s, was %s", expected, current.Nodes())
+	}
+
+	rcFields.ReplicasDesired = 6
+	plan, err = rc.plan(rcFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(plan.Additions, []types.NodeName{"node3"}) || plan.Shortfall != 2 {
+		t.Fatalf("expected plan to add node3 and fall 2 nodes short, was %+v", plan)
+	}
+}
+
+func TestPlanPreemptions(t *testing.T) {
+	rcStore, consulStore, applicator, rc, _, _, _, closeFn := setup(t)
+	defer closeFn()
+
+	builder := manifest.NewBuilder()
+	builder.SetID("batch_pod")
+	victim, err := rcStore.Create(builder.GetManifest(), klabels.Everything(), "some_az", "some_cn", nil, nil, "some_strategy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = consulStore.SetPod(consul.INTENT_TREE, "node1", victim.Manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = applicator.SetLabel(labels.POD, labels.MakePodLabelKey("node1", "batch_pod"), RCIDLabel, victim.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc.scheduler = preemptingScheduler{
+		testScheduler: testScheduler{applicator: applicator},
+		candidates: []scheduler.Preemption{
+			{Node: "node1", Victims: []types.PodID{"batch_pod"}},
+		},
+	}
+	rcFields := fields.RC{
+		ID:              rc.rcID,
+		ReplicasDesired: 2,
+		Manifest:        testManifest(),
+		NodeSelector:    klabels.Everything().Add("nodeQuality", klabels.EqualsOperator, []string{"good"}),
+		Priority:        10,
+	}
+
+	plan, err := rc.plan(rcFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Preemptions) != 1 || plan.Preemptions[0].Node != "node1" || len(plan.Preemptions[0].Victims) != 1 || plan.Preemptions[0].Victims[0].ID != victim.ID {
+		t.Fatalf("expected plan to preempt the lower priority pod on node1, was %+v", plan.Preemptions)
+	}
+	if plan.Shortfall != 1 {
+		t.Fatalf("expected plan to fall 1 node short after preempting, was %d", plan.Shortfall)
+	}
+
+	_, _, err = consulStore.Pod(consul.INTENT_TREE, "node1", "batch_pod")
+	if err != nil {
+		t.Fatalf("planning should not have preempted anything, got %v", err)
+	}
+}
+
+func TestPlanRemovalsBlockedByDisruptionBudget(t *testing.T) {
+	_, _, _, rc, _, _, _, closeFn := setup(t)
+	defer closeFn()
+
+	rcFields := fields.RC{
+		ID:              rc.rcID,
+		ReplicasDesired: 3,
+		Manifest:        testManifest(),
+		NodeSelector:    klabels.Everything(),
+	}
+	eligible := []types.NodeName{"node1", "node2", "node3"}
+	err := rc.addPods(rcFields, types.PodLocations{}, eligible)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rcFields.ReplicasDesired = 1
+	rc.disruption = &fakeDisruptionChecker{violated: true}
+	plan, err := rc.plan(rcFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Removals) != 0 || len(plan.DeferredRemovals) != 2 {
+		t.Fatalf("expected plan to defer removing 2 pods, was %s and %s", plan.Removals, plan.DeferredRemovals)
+	}
+	if plan.RemovalsBlocked == nil {
+		t.Fatal("expected the disruption budget to block the removals")
+	}
+
+	current, err := rc.CurrentPods()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(current) != 3 {
+		t.Fatalf("planning should not have unscheduled anything, found %s", current)
+	}
+}
+
+func TestPlanNodeTransfer(t *testing.T) {
+	_, _, applicator, rc, _, _, _, closeFn := setup(t)
+	defer closeFn()
+
+	rcFields := fields.RC{
+		ID:                 rc.rcID,
+		ReplicasDesired:    3,
+		Manifest:           testManifest(),
+		NodeSelector:       klabels.Everything().Add("nodeQuality", klabels.EqualsOperator, []string{"good"}),
+		AllocationStrategy: fields.StaticStrategy,
+	}
+	err := nodeTransferSetup(applicator, rc, rcFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := rc.plan(rcFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(plan.Ineligible, []types.NodeName{"node2"}) {
+		t.Fatalf("expected node2 to be ineligible, was %s", plan.Ineligible)
+	}
+	if plan.NodeTransfer != nil {
+		t.Fatalf("expected no node transfer for a static RC, was %+v", plan.NodeTransfer)
+	}
+
+	healthMap := make(map[types.NodeName]health.Result)
+	for _, node := range plan.Current.Nodes() {
+		healthMap[node] = health.Result{Status: health.Passing}
+	}
+	rc.healthChecker = fake_checker.NewSingleService("some_pod", healthMap)
+
+	rcFields.AllocationStrategy = fields.DynamicStrategy
+	plan, err = rc.plan(rcFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.NodeTransfer == nil || plan.NodeTransfer.From != "node2" {
+		t.Fatalf("expected a node transfer off node2, was %+v", plan.NodeTransfer)
+	}
+	if plan.NodeTransfer.Blocker != "" || !plan.NodeTransfer.NeedsLock {
+		t.Fatalf("expected the node transfer to only need the mutation lock, was %+v", plan.NodeTransfer)
+	}
+
+	rc.sdChecker = fakeServiceDiscoveryChecker{false}
+	plan, err = rc.plan(rcFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.NodeTransfer == nil || plan.NodeTransfer.Blocker != "service discovery system not synced" {
+		t.Fatalf("expected the node transfer to be blocked by service discovery, was %+v", plan.NodeTransfer)
+	}
+
+	current, err := rc.CurrentPods()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !types.NewNodeSet(current.Nodes()...).Has("node2") {
+		t.Fatalf("planning should not have transferred off node2, current is %s", current.Nodes())
+	}
+}
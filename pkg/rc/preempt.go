@@ -0,0 +1,244 @@
+package rc
+
+import (
+	"context"
+	"fmt"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/alerting"
+	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/scheduler"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// A Preemptor is a Scheduler that can find room for a pod on nodes that are
+// full by evicting other pods. Only schedulers that track node capacity
+// implement it.
+type Preemptor interface {
+	PreemptionCandidates(man manifest.Manifest, selector klabels.Selector, evictable func(types.PodLocation) bool) ([]scheduler.Preemption, error)
+}
+
+var _ Preemptor = &scheduler.BinPackingScheduler{}
+
+// RCGetter reads the RCs that own the pods an RC may preempt
+type RCGetter interface {
+	Get(id fields.ID) (fields.RC, error)
+}
+
+// A Preemption is a node a replication controller would schedule its pod on
+// by evicting the pods of lower priority RCs from it
+type Preemption struct {
+	Node    types.NodeName
+	Victims []fields.RC
+}
+
+// preempt schedules up to count pods on nodes that are full, by evicting
+// pods of RCs with a lower priority from them. It returns the nodes it
+// scheduled on.
+//
+// Evicted pods are not rescheduled elsewhere by this RC; their RCs run fewer
+// replicas until they find room of their own.
+func (rc *replicationController) preempt(rcFields fields.RC, currentNodes []types.NodeName, eligible []types.NodeName, planned []types.NodeName, count int) ([]types.NodeName, error) {
+	preemptions, err := rc.preemptions(rcFields, currentNodes, eligible, planned, count)
+	if err != nil {
+		return nil, err
+	}
+
+	var scheduled []types.NodeName
+	for _, preemption := range preemptions {
+		node := preemption.Node
+		err = rc.preemptNode(rcFields, append(currentNodes, scheduled...), node, preemption.Victims)
+		if err != nil {
+			return scheduled, err
+		}
+		scheduled = append(scheduled, node)
+
+		for _, victim := range preemption.Victims {
+			msg := fmt.Sprintf(
+				"Pod %s was evicted from %s to make room for higher priority replication controller %s (priority %d > %d)",
+				victim.Manifest.ID(), node, rcFields.ID, rcFields.Priority, victim.Priority,
+			)
+			err := rc.alerter.Alert(rc.alertInfo(victim, msg), alerting.LowUrgency)
+			if err != nil {
+				rc.logger.WithError(err).Errorln("Unable to send alert")
+			}
+		}
+	}
+	return scheduled, nil
+}
+
+// preemptions picks up to count nodes that are full on which the RC could
+// schedule its pod by evicting pods of RCs with a lower priority, without
+// changing anything. Nodes the RC already has pods on or is about to
+// schedule on are skipped, as are nodes whose pods can't be evicted without
+// breaking a disruption budget.
+func (rc *replicationController) preemptions(rcFields fields.RC, currentNodes []types.NodeName, eligible []types.NodeName, planned []types.NodeName, count int) ([]Preemption, error) {
+	preemptor, ok := rc.scheduler.(Preemptor)
+	if !ok || rc.rcGetter == nil || count <= 0 {
+		return nil, nil
+	}
+
+	victimRCs := make(map[types.PodLocation]fields.RC)
+	evictable := func(pod types.PodLocation) bool {
+		victim, ok, err := rc.podRC(pod)
+		if err != nil {
+			rc.logger.WithErrorAndFields(err, logrus.Fields{
+				"node":   pod.Node,
+				"pod_id": pod.PodID,
+			}).Warnln("Could not determine whether pod may be preempted")
+			return false
+		}
+		if !ok || victim.ID == rcFields.ID || victim.Priority >= rcFields.Priority {
+			return false
+		}
+		victimRCs[pod] = victim
+		return true
+	}
+
+	candidates, err := preemptor.PreemptionCandidates(rcFields.Manifest, rcFields.NodeSelector, evictable)
+	if err != nil {
+		return nil, util.Errorf("could not find pods to preempt: %s", err)
+	}
+
+	skip := types.NewNodeSet(append(currentNodes, planned...)...)
+	victimsByNode := make(map[types.NodeName][]fields.RC)
+	var candidateNodes []types.NodeName
+	for _, candidate := range candidates {
+		if skip.Has(candidate.Node.String()) {
+			continue
+		}
+
+		var victims []fields.RC
+		var evicted types.PodLocations
+		for _, podID := range candidate.Victims {
+			pod := types.PodLocation{Node: candidate.Node, PodID: podID}
+			victims = append(victims, victimRCs[pod])
+			evicted = append(evicted, pod)
+		}
+		allowed, err := rc.evictionAllowed(evicted)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			continue
+		}
+
+		victimsByNode[candidate.Node] = victims
+		candidateNodes = append(candidateNodes, candidate.Node)
+	}
+
+	picked := candidateNodes
+	if len(rcFields.SpreadConstraints) > 0 {
+		// count the planned nodes as the RC's so that they are spread too
+		spread, err := rc.newSpreadState(rcFields, append(currentNodes, planned...), append(eligible, candidateNodes...))
+		if err != nil {
+			return nil, err
+		}
+		picked = spread.pickAdditions(candidateNodes, count)
+	}
+	if len(picked) > count {
+		picked = picked[:count]
+	}
+
+	preemptions := make([]Preemption, len(picked))
+	for i, node := range picked {
+		preemptions[i] = Preemption{Node: node, Victims: victimsByNode[node]}
+	}
+	return preemptions, nil
+}
+
+// evictionAllowed returns whether evicting the pods, which are all on one
+// node, keeps every disruption budget covering them
+func (rc *replicationController) evictionAllowed(evicted types.PodLocations) (bool, error) {
+	if rc.disruption == nil || len(evicted) == 0 {
+		return true, nil
+	}
+
+	result, err := rc.disruption.Check(evicted)
+	if err != nil {
+		return false, util.Errorf("could not check disruption budgets: %s", err)
+	}
+	if !result.Allowed() {
+		rc.logger.WithError(result.Err()).Infof("not preempting pods on %s because it would break a disruption budget", evicted[0].Node)
+	}
+	return result.Allowed(), nil
+}
+
+// preemptNode evicts the victims' pods from the node and schedules the RC's
+// pod in their place in a single transaction, with an audit record for each
+// eviction
+func (rc *replicationController) preemptNode(rcFields fields.RC, currentNodes []types.NodeName, node types.NodeName, victims []fields.RC) error {
+	txn, cancelFunc := rc.newAuditingTransaction(context.Background(), rcFields, currentNodes)
+	defer cancelFunc()
+
+	for _, victim := range victims {
+		rc.logger.WithFields(logrus.Fields{
+			"node":      node,
+			"victim_rc": victim.ID,
+			"victim":    victim.Manifest.ID(),
+		}).Infoln("Preempting pod of lower priority replication controller")
+
+		err := rc.consulStore.DeletePodTxn(txn.Context(), consul.INTENT_TREE, node, victim.Manifest.ID())
+		if err != nil {
+			return err
+		}
+
+		var keysToRemove []string
+		for k := range rc.computePodLabels(victim) {
+			keysToRemove = append(keysToRemove, k)
+		}
+		err = rc.podApplicator.RemoveLabelsTxn(txn.Context(), labels.POD, labels.MakePodLabelKey(node, victim.Manifest.ID()), keysToRemove)
+		if err != nil {
+			return err
+		}
+
+		details, err := audit.NewPreemptionEventDetails(node, rcFields, victim)
+		if err != nil {
+			return err
+		}
+		err = rc.auditLogStore.Create(txn.Context(), audit.PreemptionEvent, details)
+		if err != nil {
+			return util.Errorf("could not add preemption audit log to context: %s", err)
+		}
+	}
+
+	err := rc.schedule(txn, rcFields, node)
+	if err != nil {
+		return err
+	}
+
+	ok, resp, err := txn.Commit(rc.txner)
+	switch {
+	case err != nil:
+		return err
+	case !ok:
+		return util.Errorf("could not preempt pods on %s due to transaction violation: %s", node, transaction.TxnErrorsToString(resp.Errors))
+	}
+	return nil
+}
+
+// podRC returns the RC that owns the pod, or false if no RC does
+func (rc *replicationController) podRC(pod types.PodLocation) (fields.RC, bool, error) {
+	podLabels, err := rc.podApplicator.GetLabels(labels.POD, labels.MakePodLabelKey(pod.Node, pod.PodID))
+	if err != nil {
+		return fields.RC{}, false, err
+	}
+	if !podLabels.Labels.Has(RCIDLabel) {
+		return fields.RC{}, false, nil
+	}
+
+	rcFields, err := rc.rcGetter.Get(fields.ID(podLabels.Labels.Get(RCIDLabel)))
+	if err != nil {
+		return fields.RC{}, false, err
+	}
+	return rcFields, true, nil
+}
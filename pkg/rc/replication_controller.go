@@ -6,12 +6,17 @@ import (
 	"math"
 	"math/rand"
 	"os"
+	"sync"
 	"time"
 
 	klabels "k8s.io/kubernetes/pkg/labels"
 
 	"github.com/square/p2/pkg/alerting"
 	"github.com/square/p2/pkg/artifact"
+	"github.com/square/p2/pkg/budget"
+	"github.com/square/p2/pkg/cordon"
+	"github.com/square/p2/pkg/farmstatus"
+	freeze_fields "github.com/square/p2/pkg/freeze/fields"
 	grpc_scheduler "github.com/square/p2/pkg/grpc/scheduler/client"
 	"github.com/square/p2/pkg/health"
 	"github.com/square/p2/pkg/health/checker"
@@ -24,6 +29,7 @@ import (
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/rcstore"
+	"github.com/square/p2/pkg/store/consul/statusstore"
 	"github.com/square/p2/pkg/store/consul/statusstore/rcstatus"
 	"github.com/square/p2/pkg/store/consul/transaction"
 	"github.com/square/p2/pkg/types"
@@ -53,6 +59,10 @@ type ReplicationController interface {
 
 	// CurrentPods() returns all pods managed by this replication controller.
 	CurrentPods() (types.PodLocations, error)
+
+	// LastOutcome returns the result of the most recent attempt to meet
+	// desires, or nil if none has been made yet
+	LastOutcome() *farmstatus.Outcome
 }
 
 type RCMutationLocker interface {
@@ -69,8 +79,9 @@ type Scheduler interface {
 	// AllocateNodes() can be called by the RC when it needs more nodes to
 	// schedule on than EligibleNodes() returns. It will return the newly
 	// allocated nodes which will also appear in subsequent EligibleNodes()
-	// calls
-	AllocateNodes(manifest manifest.Manifest, nodeSelector klabels.Selector, allocationCount int, force bool) ([]types.NodeName, error)
+	// calls. The allocated nodes should respect the spread constraints given
+	// the nodes the RC already has pods on
+	AllocateNodes(manifest manifest.Manifest, nodeSelector klabels.Selector, allocationCount int, force bool, spread fields.Spread) ([]types.NodeName, error)
 
 	// DeallocateNodes() indicates to the scheduler that the RC has unscheduled
 	// the pod from these nodes, meaning the scheduler can free the
@@ -79,6 +90,7 @@ type Scheduler interface {
 }
 
 var _ Scheduler = &scheduler.ApplicatorScheduler{}
+var _ Scheduler = &scheduler.BinPackingScheduler{}
 var _ Scheduler = &grpc_scheduler.Client{}
 
 type ServiceDiscoveryChecker interface {
@@ -132,6 +144,18 @@ type replicationController struct {
 	healthChecker    checker.HealthChecker
 	artifactRegistry artifact.Registry
 	sdChecker        ServiceDiscoveryChecker
+	freezeStore      FreezeStore
+	disruption       DisruptionChecker
+	rcGetter         RCGetter
+
+	// The RC as it was the last time no deploy freeze window covered it,
+	// or as first seen if it was frozen from the start, as recorded in its
+	// status. While frozen, the RC replaces lost pods up to this replica
+	// count, with this manifest. It is nil until the status has been read.
+	unfrozen *rcstatus.Unfrozen
+
+	outcomeMu   sync.Mutex
+	lastOutcome *farmstatus.Outcome
 }
 
 type ReplicationControllerWatcher interface {
@@ -154,6 +178,9 @@ func New(
 	healthChecker checker.HealthChecker,
 	artifactRegistry artifact.Registry,
 	sdChecker ServiceDiscoveryChecker,
+	freezeStore FreezeStore,
+	disruption DisruptionChecker,
+	rcGetter RCGetter,
 ) ReplicationController {
 	if alerter == nil {
 		alerter = alerting.NewNop()
@@ -176,6 +203,9 @@ func New(
 		healthChecker:    healthChecker,
 		artifactRegistry: artifactRegistry,
 		sdChecker:        sdChecker,
+		freezeStore:      freezeStore,
+		disruption:       disruption,
+		rcGetter:         rcGetter,
 	}
 }
 
@@ -201,6 +231,7 @@ func (rc *replicationController) WatchDesires(quit <-chan struct{}) <-chan error
 			default:
 			}
 			err := rc.meetDesires(rcFields)
+			rc.setLastOutcome(farmstatus.NewOutcome(err))
 			if err != nil {
 				errOutChannel <- err
 			}
@@ -231,6 +262,18 @@ func (rc *replicationController) WatchDesires(quit <-chan struct{}) <-chan error
 	return errOutChannel
 }
 
+func (rc *replicationController) LastOutcome() *farmstatus.Outcome {
+	rc.outcomeMu.Lock()
+	defer rc.outcomeMu.Unlock()
+	return rc.lastOutcome
+}
+
+func (rc *replicationController) setLastOutcome(outcome *farmstatus.Outcome) {
+	rc.outcomeMu.Lock()
+	defer rc.outcomeMu.Unlock()
+	rc.lastOutcome = outcome
+}
+
 func (rc *replicationController) meetDesires(rcFields fields.RC) error {
 	rc.logger.NoFields().Infof("Handling RC update: desired replicas %d, disabled %v", rcFields.ReplicasDesired, rcFields.Disabled)
 
@@ -238,17 +281,39 @@ func (rc *replicationController) meetDesires(rcFields fields.RC) error {
 	if err != nil {
 		return err
 	}
-	eligible, err := rc.eligibleNodes(rcFields)
+	eligible, err := rc.eligibleNodes(rcFields, current)
 	if err != nil {
 		return err
 	}
 
 	rc.logger.NoFields().Infof("Currently on nodes %s", current)
 
+	frozen, err := rc.freezeWindow(rcFields)
+	if err != nil {
+		return err
+	}
+
+	err = rc.updateUnfrozen(rcFields, frozen)
+	if err != nil {
+		return err
+	}
+	toAdd, err := rc.unfrozenFields(rcFields, frozen)
+	if err != nil {
+		return err
+	}
+
 	nodesChanged := false
 	switch {
+	case rcFields.ReplicasDesired > len(current) && toAdd.ReplicasDesired <= len(current):
+		rc.logger.WithFields(logrus.Fields{
+			"freeze_window": frozen.ID,
+			"freeze_end":    frozen.End,
+		}).Warnf("Not adding pods while deploys are frozen: %s", frozen.Reason)
 	case rcFields.ReplicasDesired > len(current):
-		err := rc.addPods(rcFields, current, eligible)
+		if toAdd.ReplicasDesired < rcFields.ReplicasDesired {
+			rc.logger.WithField("freeze_window", frozen.ID).Infof("Only replacing pods lost during the freeze, up to %d replicas", toAdd.ReplicasDesired)
+		}
+		err := rc.addPods(toAdd, current, eligible)
 		if err != nil {
 			return err
 		}
@@ -268,7 +333,7 @@ func (rc *replicationController) meetDesires(rcFields fields.RC) error {
 		if err != nil {
 			return err
 		}
-		eligible, err = rc.eligibleNodes(rcFields)
+		eligible, err = rc.eligibleNodes(rcFields, current)
 		if err != nil {
 			return err
 		}
@@ -285,7 +350,101 @@ func (rc *replicationController) meetDesires(rcFields fields.RC) error {
 		}
 	}
 
-	return rc.ensureConsistency(rcFields)
+	return rc.ensureConsistency(rcFields, frozen)
+}
+
+// unfrozenFields returns the RC as it may be acted on while the given deploy
+// freeze window, if any, covers it. Increases to the replica count and
+// manifest changes made during the freeze are held back, but pods lost
+// during it can still be replaced.
+func (rc *replicationController) unfrozenFields(rcFields fields.RC, frozen *freeze_fields.Window) (fields.RC, error) {
+	if frozen == nil || rc.unfrozen == nil {
+		return rcFields, nil
+	}
+
+	unfrozenManifest, err := manifest.FromBytes([]byte(rc.unfrozen.Manifest))
+	if err != nil {
+		return fields.RC{}, util.Errorf("could not parse the manifest from before the freeze: %s", err)
+	}
+
+	allowed := rcFields
+	allowed.Manifest = unfrozenManifest
+	if rc.unfrozen.ReplicasDesired < allowed.ReplicasDesired {
+		allowed.ReplicasDesired = rc.unfrozen.ReplicasDesired
+	}
+	return allowed, nil
+}
+
+// updateUnfrozen reads the RC as it was before the deploy freeze window, if
+// any, from its status, and records the given RC there if no window covers it
+// or nothing was recorded yet
+func (rc *replicationController) updateUnfrozen(rcFields fields.RC, frozen *freeze_fields.Window) error {
+	if rc.unfrozen == nil {
+		status, _, err := rc.rcStatusStore.Get(rc.rcID)
+		switch {
+		case statusstore.IsNoStatus(err):
+		case err != nil:
+			return util.Errorf("could not read RC status: %s", err)
+		default:
+			rc.unfrozen = status.Unfrozen
+		}
+	}
+
+	if frozen != nil && rc.unfrozen != nil {
+		return nil
+	}
+	return rc.recordUnfrozen(rcFields)
+}
+
+// recordUnfrozen writes the RC's replica count and manifest to its status if
+// they differ from the ones recorded there
+func (rc *replicationController) recordUnfrozen(rcFields fields.RC) error {
+	manifestSHA, err := rcFields.Manifest.SHA()
+	if err != nil {
+		return err
+	}
+	if rc.unfrozen != nil && rc.unfrozen.ReplicasDesired == rcFields.ReplicasDesired && rc.unfrozen.ManifestSHA == manifestSHA {
+		return nil
+	}
+
+	manifestBytes, err := rcFields.Manifest.Marshal()
+	if err != nil {
+		return err
+	}
+
+	status, _, err := rc.rcStatusStore.Get(rc.rcID)
+	if err != nil && !statusstore.IsNoStatus(err) {
+		return util.Errorf("could not read RC status: %s", err)
+	}
+	status.Unfrozen = &rcstatus.Unfrozen{
+		ReplicasDesired: rcFields.ReplicasDesired,
+		ManifestSHA:     manifestSHA,
+		Manifest:        string(manifestBytes),
+	}
+	err = rc.rcStatusStore.Set(rc.rcID, status)
+	if err != nil {
+		return util.Errorf("could not record RC status: %s", err)
+	}
+	rc.unfrozen = status.Unfrozen
+	return nil
+}
+
+// freezeWindow returns the deploy freeze window that prevents this RC from
+// adding pods or changing its manifest, or nil if there isn't one
+func (rc *replicationController) freezeWindow(rcFields fields.RC) (*freeze_fields.Window, error) {
+	if rc.freezeStore == nil {
+		return nil, nil
+	}
+
+	windows, err := rc.freezeStore.List()
+	if err != nil {
+		return nil, util.Errorf("could not list deploy freeze windows: %s", err)
+	}
+	rcLabels, err := rc.podApplicator.GetLabels(labels.RC, rc.rcID.String())
+	if err != nil {
+		return nil, err
+	}
+	return freeze_fields.Blocking(windows, time.Now(), rc.rcID, rcFields.Manifest.ID(), rcLabels.Labels)
 }
 
 func (rc *replicationController) addPods(rcFields fields.RC, current types.PodLocations, eligible []types.NodeName) error {
@@ -294,17 +453,31 @@ func (rc *replicationController) addPods(rcFields fields.RC, current types.PodLo
 	}
 
 	currentNodes := current.Nodes()
+	toSchedule := rcFields.ReplicasDesired - len(currentNodes)
 
-	// TODO: With Docker or runc we would not be constrained to running only once per node.
-	// So it may be the case that we need to make the Scheduler interface smarter and use it here.
-	possible := types.NewNodeSet(eligible...).Difference(types.NewNodeSet(currentNodes...))
+	possibleSorted, err := rc.additions(rcFields, currentNodes, eligible)
+	if err != nil {
+		return err
+	}
+	constrained := ""
+	if len(rcFields.SpreadConstraints) > 0 {
+		constrained = " within spread constraints"
+	}
 
-	// Users want deterministic ordering of nodes being populated to a new
-	// RC. Move nodes in sorted order by hostname to achieve this
-	possibleSorted := possible.ListNodes()
-	toSchedule := rcFields.ReplicasDesired - len(currentNodes)
+	rc.logger.NoFields().Infof("Need to schedule %d nodes out of %s", toSchedule, possibleSorted)
 
-	rc.logger.NoFields().Infof("Need to schedule %d nodes out of %s", toSchedule, possible)
+	// make up any shortfall by evicting pods of lower priority RCs
+	if len(possibleSorted) < toSchedule {
+		preempted, err := rc.preempt(rcFields, currentNodes, eligible, possibleSorted, toSchedule-len(possibleSorted))
+		if len(preempted) > 0 {
+			rc.logger.NoFields().Infof("Scheduled on %s by preempting lower priority pods", preempted)
+			currentNodes = append(currentNodes, preempted...)
+			toSchedule -= len(preempted)
+		}
+		if err != nil {
+			rc.logger.WithError(err).Errorln("Could not preempt lower priority pods")
+		}
+	}
 
 	txn, cancelFunc := rc.newAuditingTransaction(context.Background(), rcFields, currentNodes)
 	defer func() {
@@ -332,8 +505,8 @@ func (rc *replicationController) addPods(rcFields fields.RC, current types.PodLo
 		}
 		if len(possibleSorted) < i+1 {
 			errMsg := fmt.Sprintf(
-				"Not enough nodes to meet desire: %d replicas desired, %d currentNodes, %d eligible. Scheduled on %d nodes instead.",
-				rcFields.ReplicasDesired, len(currentNodes), len(eligible), i,
+				"Not enough nodes to meet desire%s: %d replicas desired, %d currentNodes, %d eligible. Scheduled on %d nodes instead.",
+				constrained, rcFields.ReplicasDesired, len(currentNodes), len(eligible), i,
 			)
 			err := rc.alerter.Alert(rc.alertInfo(rcFields, errMsg), alerting.LowUrgency)
 			if err != nil {
@@ -399,14 +572,36 @@ func (rc *replicationController) removePods(rcFields fields.RC, current types.Po
 	}
 
 	currentNodes := current.Nodes()
-
-	// If we need to downsize the number of nodes, prefer any in current that are not eligible anymore.
-	// TODO: evaluate changes to 'eligible' more frequently
-	ineligible := types.NewNodeSet(currentNodes...).Difference(types.NewNodeSet(eligible...))
-	rest := types.NewNodeSet(currentNodes...).Difference(ineligible)
 	toUnschedule := len(current) - rcFields.ReplicasDesired
+
+	removals, err := rc.removals(rcFields, currentNodes, eligible)
+	if err != nil {
+		return err
+	}
 	rc.logger.NoFields().Infof("Need to unschedule %d nodes out of %s", toUnschedule, current)
 
+	allowed, refused, err := rc.budgetedRemovals(rcFields, removals)
+	if err != nil {
+		return err
+	}
+	if blocked := refused.Err(); blocked != nil {
+		if len(allowed) == 0 {
+			errMsg := fmt.Sprintf(
+				"Not unscheduling %d pods to meet %d replicas desired: %s",
+				len(removals), rcFields.ReplicasDesired, blocked,
+			)
+			err = rc.alerter.Alert(rc.alertInfo(rcFields, errMsg), alerting.LowUrgency)
+			if err != nil {
+				rc.logger.WithError(err).Errorln("Unable to send alert")
+			}
+			return util.Errorf(errMsg)
+		}
+
+		rc.logger.NoFields().Infof("Only unscheduling %d of %d pods now, the rest will be unscheduled once disruption budgets allow it: %s", len(allowed), len(removals), blocked)
+		removals = allowed
+		toUnschedule = len(allowed)
+	}
+
 	txn, cancelFunc := rc.newAuditingTransaction(context.Background(), rcFields, currentNodes)
 	defer func() {
 		cancelFunc()
@@ -429,29 +624,24 @@ func (rc *replicationController) removePods(rcFields fields.RC, current types.Po
 			txn, cancelFunc = rc.newAuditingTransaction(context.Background(), rcFields, txn.Nodes())
 		}
 
-		unscheduleFrom, ok := ineligible.PopAny()
-		if !ok {
-			var ok bool
-			unscheduleFrom, ok = rest.PopAny()
-			if !ok {
-				// This should be mathematically impossible unless replicasDesired was negative
-				// commit any queued operations
-				ok, resp, txnErr := txn.Commit(rc.txner)
-				switch {
-				case txnErr != nil:
-					return txnErr
-				case !ok:
-					return util.Errorf("could not schedule pods due to transaction violation: %s", transaction.TxnErrorsToString(resp.Errors))
-				}
-
-				return util.Errorf(
-					"Unable to unschedule enough nodes to meet replicas desired: %d replicas desired, %d current.",
-					rcFields.ReplicasDesired, len(current),
-				)
+		if i >= len(removals) {
+			// This should be mathematically impossible unless replicasDesired was negative
+			// commit any queued operations
+			ok, resp, txnErr := txn.Commit(rc.txner)
+			switch {
+			case txnErr != nil:
+				return txnErr
+			case !ok:
+				return util.Errorf("could not schedule pods due to transaction violation: %s", transaction.TxnErrorsToString(resp.Errors))
 			}
+
+			return util.Errorf(
+				"Unable to unschedule enough nodes to meet replicas desired: %d replicas desired, %d current.",
+				rcFields.ReplicasDesired, len(current),
+			)
 		}
 
-		err := rc.unschedule(txn, rcFields, unscheduleFrom)
+		err := rc.unschedule(txn, rcFields, removals[i])
 		if err != nil {
 			return err
 		}
@@ -468,7 +658,94 @@ func (rc *replicationController) removePods(rcFields fields.RC, current types.Po
 	return nil
 }
 
-func (rc *replicationController) ensureConsistency(rcFields fields.RC) error {
+// additions returns the nodes addPods may schedule on, in the order it uses
+// them. Fewer nodes than the RC needs are returned when not enough are
+// eligible.
+func (rc *replicationController) additions(rcFields fields.RC, currentNodes []types.NodeName, eligible []types.NodeName) ([]types.NodeName, error) {
+	// TODO: With Docker or runc we would not be constrained to running only once per node.
+	// So it may be the case that we need to make the Scheduler interface smarter and use it here.
+	possible := types.NewNodeSet(eligible...).Difference(types.NewNodeSet(currentNodes...))
+
+	// Users want deterministic ordering of nodes being populated to a new
+	// RC. Move nodes in sorted order by hostname to achieve this
+	possibleSorted := possible.ListNodes()
+	if len(rcFields.SpreadConstraints) == 0 {
+		return possibleSorted, nil
+	}
+
+	// With spread constraints, only the nodes that keep the pods spread are
+	// candidates, in the order they should be scheduled on
+	spread, err := rc.newSpreadState(rcFields, currentNodes, eligible)
+	if err != nil {
+		return nil, err
+	}
+	return spread.pickAdditions(possibleSorted, rcFields.ReplicasDesired-len(currentNodes)), nil
+}
+
+// removals returns the nodes removePods unschedules from to get down to the
+// RC's desired replicas
+func (rc *replicationController) removals(rcFields fields.RC, currentNodes []types.NodeName, eligible []types.NodeName) ([]types.NodeName, error) {
+	// If we need to downsize the number of nodes, prefer any in current that are not eligible anymore.
+	// TODO: evaluate changes to 'eligible' more frequently
+	ineligible := types.NewNodeSet(currentNodes...).Difference(types.NewNodeSet(eligible...))
+	rest := types.NewNodeSet(currentNodes...).Difference(ineligible).ListNodes()
+	toUnschedule := len(currentNodes) - rcFields.ReplicasDesired
+
+	// With spread constraints, unschedule from the most populated domains
+	// first so the remaining pods stay spread
+	if len(rcFields.SpreadConstraints) > 0 {
+		spread, err := rc.newSpreadState(rcFields, currentNodes, eligible)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range ineligible.ListNodes() {
+			spread.remove(node)
+		}
+		rest = spread.pickRemovals(rest)
+	}
+	removals := append(ineligible.ListNodes(), rest...)
+	switch {
+	case toUnschedule <= 0:
+		removals = nil
+	case toUnschedule < len(removals):
+		removals = removals[:toUnschedule]
+	}
+	return removals, nil
+}
+
+// budgetedRemovals returns the longest prefix of removals the RC's pods can
+// be unscheduled from without breaking a disruption budget. If that isn't
+// all of them, it also returns the check that refused unscheduling all of
+// them, the rest having to wait for a later pass.
+func (rc *replicationController) budgetedRemovals(rcFields fields.RC, removals []types.NodeName) ([]types.NodeName, budget.Result, error) {
+	if rc.disruption == nil {
+		return removals, budget.Result{}, nil
+	}
+
+	var refused budget.Result
+	for n := len(removals); n > 0; n-- {
+		disrupted := make(types.PodLocations, n)
+		for i, node := range removals[:n] {
+			disrupted[i] = types.PodLocation{Node: node, PodID: rcFields.Manifest.ID()}
+		}
+		result, err := rc.disruption.Check(disrupted)
+		if err != nil {
+			return nil, budget.Result{}, util.Errorf("could not check disruption budgets: %s", err)
+		}
+		if result.Allowed() {
+			return removals[:n], refused, nil
+		}
+		if refused.Allowed() {
+			refused = result
+		}
+	}
+	return nil, refused, nil
+}
+
+// ensureConsistency writes the RC's manifest to every eligible node it has a
+// pod on. While the RC is frozen, nodes running a different manifest are left
+// alone.
+func (rc *replicationController) ensureConsistency(rcFields fields.RC, frozen *freeze_fields.Window) error {
 	if rcFields.Disabled {
 		return nil
 	}
@@ -478,7 +755,7 @@ func (rc *replicationController) ensureConsistency(rcFields fields.RC) error {
 		return err
 	}
 	current := currentPods.Nodes()
-	eligible, err := rc.eligibleNodes(rcFields)
+	eligible, err := rc.eligibleNodes(rcFields, currentPods)
 	if err != nil {
 		return err
 	}
@@ -526,6 +803,13 @@ func (rc *replicationController) ensureConsistency(rcFields fields.RC) error {
 			if intentSHA == manifestSHA {
 				continue
 			}
+			if frozen != nil {
+				rc.logger.WithFields(logrus.Fields{
+					"node":          node,
+					"freeze_window": frozen.ID,
+				}).Warnf("Not changing manifest while deploys are frozen: %s", frozen.Reason)
+				continue
+			}
 		}
 
 		rc.logger.WithField("node", node).WithField("intentManifestSHA", intentSHA).Info("Found inconsistency in scheduled manifest")
@@ -567,8 +851,20 @@ func (rc *replicationController) checkForIneligible(current types.PodLocations,
 	return ineligibleCurrent
 }
 
-func (rc *replicationController) eligibleNodes(rcFields fields.RC) ([]types.NodeName, error) {
-	return rc.scheduler.EligibleNodes(rcFields.Manifest, rcFields.NodeSelector)
+// eligibleNodes returns the nodes the scheduler considers eligible for the
+// RC, except for cordoned nodes the RC doesn't have a pod on and draining
+// nodes. Pods on draining nodes are then moved off by node transfers.
+func (rc *replicationController) eligibleNodes(rcFields fields.RC, current types.PodLocations) ([]types.NodeName, error) {
+	eligible, err := rc.scheduler.EligibleNodes(rcFields.Manifest, rcFields.NodeSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	states, err := cordon.GetStates(rc.podApplicator)
+	if err != nil {
+		return nil, err
+	}
+	return states.Eligible(eligible, current.Nodes()), nil
 }
 
 // CurrentPods returns all pods managed by an RC with the given ID.
@@ -662,7 +958,8 @@ func (rc *replicationController) unschedule(txn *auditingTransaction, rcFields f
 
 // attemptNodeTransfer will transactionally remove a pod on an ineligible node
 // and add a pod on a new node if the following conditions are met:
-//   1) The ineligible pod is unhealthy OR all of the RC's pods are healthy
+//   1) The ineligible pod is unhealthy OR the disruption budgets covering it
+//      allow it to go down (all of the RC's pods must be healthy if none do)
 //   2) The service discovery system is synced with the pod cluster
 //   3) The RC can acquire a mutation lock on its ID
 //   4) OR the RC is disabled, only on ineligible nodes, and has fewer desired
@@ -699,38 +996,16 @@ func (rc *replicationController) attemptNodeTransfer(rcFields fields.RC, current
 }
 
 func (rc *replicationController) canNodeTransfer(rcFields fields.RC, current types.PodLocations, ineligibles []types.NodeName) (bool, consul.Unlocker, error) {
-	ok, err := rc.sdChecker.IsSyncedWithCluster(rcFields.ID)
+	blocker, needsLock, err := rc.nodeTransferBlocker(rcFields, current, ineligibles)
 	if err != nil {
-		rc.logger.WithError(err).Errorln("skipping node transfer; error checking service discovery system")
+		rc.logger.WithError(err).Errorf("skipping node transfer; %s", blocker)
 		return false, nil, err
-	} else if !ok {
-		rc.logger.Infoln("skipping node transfer; service discovery system not synced")
+	} else if blocker != "" {
+		rc.logger.Infof("skipping node transfer; %s", blocker)
 		return false, nil, nil
-	}
-
-	currentSet := types.NewNodeSet(current.Nodes()...)
-	ineligibleSet := types.NewNodeSet(ineligibles...)
-	if rcFields.Disabled &&
-		currentSet.Equal(ineligibleSet) &&
-		rcFields.ReplicasDesired < len(current) {
-		// If the RC is disabled, all of its nodes are inelgible, and its
-		// desired replica count is less than its current replica count,
-		// then it is likely the old RC in an RU. In that case, the new RC
-		// will not be able to schedule on the ineligible nodes, so we should
-		// perform a node transfer. The RU would not have decremented this RC's
-		// replicas desired unless its min health was met, so we can safely
-		// perform the swap.
+	} else if !needsLock {
 		return true, nil, nil
 	}
-	ineligible := ineligibles[0]
-	ok, err = rc.isTransferMinHealthMet(rcFields, current, ineligible)
-	if err != nil {
-		rc.logger.WithError(err).Errorln("skipping node transfer; error checking health")
-		return false, nil, err
-	} else if !ok {
-		rc.logger.Infoln("skipping node transfer; node transfer health requirement not met")
-		return false, nil, nil
-	}
 
 	_, session, err := consul.SessionContext(context.Background(), rc.consulClient, fmt.Sprintf("rc-node-transfer-%s", rc.rcID))
 	if err != nil {
@@ -753,10 +1028,46 @@ func (rc *replicationController) canNodeTransfer(rcFields fields.RC, current typ
 	return true, unlocker, nil
 }
 
+// nodeTransferBlocker returns why a node transfer off the first ineligible
+// node can't happen right now, or an empty string if it can. Unless needsLock
+// is false, the transfer must still acquire the RC's mutation lock.
+func (rc *replicationController) nodeTransferBlocker(rcFields fields.RC, current types.PodLocations, ineligibles []types.NodeName) (blocker string, needsLock bool, err error) {
+	ok, err := rc.sdChecker.IsSyncedWithCluster(rcFields.ID)
+	if err != nil {
+		return "error checking service discovery system", false, err
+	} else if !ok {
+		return "service discovery system not synced", false, nil
+	}
+
+	currentSet := types.NewNodeSet(current.Nodes()...)
+	ineligibleSet := types.NewNodeSet(ineligibles...)
+	if rcFields.Disabled &&
+		currentSet.Equal(ineligibleSet) &&
+		rcFields.ReplicasDesired < len(current) {
+		// If the RC is disabled, all of its nodes are inelgible, and its
+		// desired replica count is less than its current replica count,
+		// then it is likely the old RC in an RU. In that case, the new RC
+		// will not be able to schedule on the ineligible nodes, so we should
+		// perform a node transfer. The RU would not have decremented this RC's
+		// replicas desired unless its min health was met, so we can safely
+		// perform the swap.
+		return "", false, nil
+	}
+	ineligible := ineligibles[0]
+	ok, err = rc.isTransferMinHealthMet(rcFields, current, ineligible)
+	if err != nil {
+		return "error checking health", false, err
+	} else if !ok {
+		return "node transfer health requirement not met", false, nil
+	}
+	return "", true, nil
+}
+
 // isTransferMinHealthMet returns true if either the ineligible node is unhealthy
 // (in which case a node transfer would not reduce the cluster's health) or if
-// all of the RC's current pods are healthy (in which case the cluster can
-// tolerate one pod down)
+// the disruption budgets covering the pod allow it to go down. When no budget
+// covers the pod, all of the RC's current pods must be healthy (in which case
+// the cluster can tolerate one pod down)
 func (rc *replicationController) isTransferMinHealthMet(rcFields fields.RC, current types.PodLocations, ineligible types.NodeName) (bool, error) {
 	service := rcFields.Manifest.ID().String()
 	healths, err := rc.healthChecker.Service(service)
@@ -770,6 +1081,20 @@ func (rc *replicationController) isTransferMinHealthMet(rcFields fields.RC, curr
 		// will not reduce the health of a cluster
 		return true, nil
 	}
+
+	if rc.disruption != nil {
+		result, err := rc.disruption.Check(types.PodLocations{{Node: ineligible, PodID: rcFields.Manifest.ID()}})
+		if err != nil {
+			return false, util.Errorf("could not check disruption budgets: %s", err)
+		}
+		if len(result.Covering) > 0 {
+			if !result.Allowed() {
+				rc.logger.WithError(result.Err()).Infof("node transfer off %s would break a disruption budget", ineligible)
+			}
+			return result.Allowed(), nil
+		}
+	}
+
 	for _, pod := range current {
 		hlth, ok := healths[pod.Node]
 		if !ok {
@@ -804,7 +1129,11 @@ func (e *incorrectAllocationError) Error() string {
 // swapNodes allocates a node, deallocates the inelgible node, and
 // transactionally schedules on the new node and unschedules from the old
 func (rc *replicationController) swapNodes(rcFields fields.RC, current types.PodLocations, ineligible types.NodeName, allocAttempts int) error {
-	newNode, err := rc.retryAllocate(rcFields, allocAttempts)
+	spread := fields.Spread{
+		Constraints:  rcFields.SpreadConstraints,
+		CurrentNodes: types.NewNodeSet(current.Nodes()...).Difference(types.NewNodeSet(ineligible)).ListNodes(),
+	}
+	newNode, err := rc.retryAllocate(rcFields, spread, allocAttempts)
 	if err != nil {
 		return err
 	}
@@ -854,14 +1183,14 @@ func (rc *replicationController) swapNodes(rcFields fields.RC, current types.Pod
 	return nil
 }
 
-func (rc *replicationController) retryAllocate(rcFields fields.RC, attempts int) (types.NodeName, error) {
+func (rc *replicationController) retryAllocate(rcFields fields.RC, spread fields.Spread, attempts int) (types.NodeName, error) {
 	for i := 0; i < attempts; i++ {
 		backoff := time.Duration(math.Pow(float64(i), 2)) * time.Second
 		if backoff > 1*time.Minute {
 			backoff = 1 * time.Minute
 		}
 		time.Sleep(backoff)
-		nodes, err := rc.scheduler.AllocateNodes(rcFields.Manifest, rcFields.NodeSelector, 1, true)
+		nodes, err := rc.scheduler.AllocateNodes(rcFields.Manifest, rcFields.NodeSelector, 1, true, spread)
 		if err != nil {
 			rc.logger.WithError(err).Errorf("node transfer allocate attempt %d failed", i+1)
 			continue
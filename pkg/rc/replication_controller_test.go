@@ -5,6 +5,7 @@ package rc
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"testing"
@@ -13,6 +14,10 @@ import (
 	"github.com/square/p2/pkg/alerting/alertingtest"
 	"github.com/square/p2/pkg/artifact"
 	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/budget"
+	budget_fields "github.com/square/p2/pkg/budget/fields"
+	"github.com/square/p2/pkg/cordon"
+	freeze_fields "github.com/square/p2/pkg/freeze/fields"
 	"github.com/square/p2/pkg/health"
 	fake_checker "github.com/square/p2/pkg/health/checker/test"
 	"github.com/square/p2/pkg/labels"
@@ -52,6 +57,7 @@ type testRCStore interface {
 		allocationStrategy fields.Strategy,
 	) (fields.RC, error)
 	SetDesiredReplicas(id fields.ID, n int) error
+	UpdatePriority(id fields.ID, priority int) error
 	LockForMutation(fields.ID, consul.Session) (consul.Unlocker, error)
 }
 
@@ -80,7 +86,7 @@ func (s testScheduler) EligibleNodes(manifest manifest.Manifest, nodeSelector kl
 	return as.EligibleNodes(manifest, nodeSelector)
 }
 
-func (s testScheduler) AllocateNodes(manifest manifest.Manifest, nodeSelector klabels.Selector, allocationCount int, force bool) ([]types.NodeName, error) {
+func (s testScheduler) AllocateNodes(manifest manifest.Manifest, nodeSelector klabels.Selector, allocationCount int, force bool, spread fields.Spread) ([]types.NodeName, error) {
 	if s.allocateShouldErr {
 		return nil, util.Errorf("Intentional error allocating nodes.")
 	}
@@ -105,6 +111,54 @@ type testScheduler struct {
 	deallocateShouldErr bool
 }
 
+// preemptingScheduler offers preemption candidates as long as every one of
+// their victims is evictable
+type preemptingScheduler struct {
+	testScheduler
+	candidates []scheduler.Preemption
+}
+
+func (s preemptingScheduler) PreemptionCandidates(_ manifest.Manifest, _ klabels.Selector, evictable func(types.PodLocation) bool) ([]scheduler.Preemption, error) {
+	var ret []scheduler.Preemption
+	for _, candidate := range s.candidates {
+		ok := true
+		for _, victim := range candidate.Victims {
+			if !evictable(types.PodLocation{Node: candidate.Node, PodID: victim}) {
+				ok = false
+			}
+		}
+		if ok {
+			ret = append(ret, candidate)
+		}
+	}
+	return ret, nil
+}
+
+type fakeFreezeStore []freeze_fields.Window
+
+func (f fakeFreezeStore) List() ([]freeze_fields.Window, error) {
+	return f, nil
+}
+
+// fakeDisruptionChecker refuses every disruption when violated is set, or
+// disruptions of more than maxDisrupted pods when that is positive, and
+// records the pods it was asked about
+type fakeDisruptionChecker struct {
+	violated     bool
+	maxDisrupted int
+	checked      []types.PodLocations
+}
+
+func (f *fakeDisruptionChecker) Check(disrupted types.PodLocations) (budget.Result, error) {
+	f.checked = append(f.checked, disrupted)
+	b := budget_fields.Budget{ID: "some_budget", PodID: "testPod", MinAvailable: 2}
+	result := budget.Result{Covering: []budget_fields.Budget{b}}
+	if f.violated || (f.maxDisrupted > 0 && len(disrupted) > f.maxDisrupted) {
+		result.Violations = []budget.Violation{{Budget: b, Err: errors.New("budget violated")}}
+	}
+	return result, nil
+}
+
 type fakeServiceDiscoveryChecker struct {
 	isSynced bool
 }
@@ -177,6 +231,9 @@ func setup(t *testing.T) (
 		healthChecker,
 		artifactRegistry,
 		sdChecker,
+		nil,
+		nil,
+		rcStore,
 	).(*replicationController)
 
 	return
@@ -659,6 +716,173 @@ func TestConsistencyModify(t *testing.T) {
 	Assert(t).AreEqual(len(alerter.Alerts), 0, "expected no alerts to fire")
 }
 
+func TestFreezePreventsIncreasesAndManifestChanges(t *testing.T) {
+	rcStore, kvStore, applicator, rc, _, _, _, closeFn := setup(t)
+	defer closeFn()
+
+	rcFields, err := rcStore.Get(rc.rcID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range []types.NodeName{"node1", "node2"} {
+		err = applicator.SetLabel(labels.NODE, node.String(), "nodeQuality", "good")
+		Assert(t).IsNil(err, "expected no error assigning label")
+	}
+
+	rcFields.ReplicasDesired = 1
+	err = rc.meetDesires(rcFields)
+	Assert(t).IsNil(err, "unexpected error scheduling nodes")
+	current, err := rc.CurrentPods()
+	Assert(t).IsNil(err, "unexpected error getting current pods")
+	Assert(t).AreEqual(len(current), 1, "expected a pod to be scheduled before the freeze")
+
+	now := time.Now()
+	freeze := freeze_fields.Window{
+		ID:     "holiday",
+		Start:  now.Add(-time.Hour),
+		End:    now.Add(time.Hour),
+		PodID:  "testPod",
+		Reason: "holiday",
+	}
+	rc.freezeStore = fakeFreezeStore{freeze}
+
+	b := rcFields.Manifest.GetBuilder()
+	b.SetConfig(map[interface{}]interface{}{"test": true})
+	rcFields.Manifest = b.GetManifest()
+	rcFields.ReplicasDesired = 2
+	err = rc.meetDesires(rcFields)
+	Assert(t).IsNil(err, "unexpected error meeting desires during freeze")
+
+	current, err = rc.CurrentPods()
+	Assert(t).IsNil(err, "unexpected error getting current pods")
+	Assert(t).AreEqual(len(current), 1, "expected no pods to be added during the freeze")
+	frozenSHA, _ := rcFields.Manifest.SHA()
+	intent, _, err := kvStore.Pod(consul.INTENT_TREE, current[0].Node, "testPod")
+	Assert(t).IsNil(err, "could not fetch intent")
+	intentSHA, _ := intent.SHA()
+	Assert(t).AreNotEqual(intentSHA, frozenSHA, "expected manifest not to change during the freeze")
+
+	// lose the pod, it should be replaced with the manifest from before the
+	// freeze but the increase should still be held back
+	_, err = kvStore.DeletePod(consul.INTENT_TREE, current[0].Node, "testPod")
+	Assert(t).IsNil(err, "unexpected error deleting pod")
+	err = applicator.RemoveAllLabels(labels.POD, labels.MakePodLabelKey(current[0].Node, "testPod"))
+	Assert(t).IsNil(err, "unexpected error removing pod labels")
+	err = rc.meetDesires(rcFields)
+	Assert(t).IsNil(err, "unexpected error meeting desires during freeze")
+
+	current, err = rc.CurrentPods()
+	Assert(t).IsNil(err, "unexpected error getting current pods")
+	Assert(t).AreEqual(len(current), 1, "expected the lost pod to be replaced during the freeze")
+	intent, _, err = kvStore.Pod(consul.INTENT_TREE, current[0].Node, "testPod")
+	Assert(t).IsNil(err, "could not fetch intent")
+	replacedSHA, _ := intent.SHA()
+	Assert(t).AreEqual(replacedSHA, intentSHA, "expected the lost pod to be replaced with the manifest from before the freeze")
+
+	// a farm picking the RC up after a restart or lock handoff starts
+	// without the in-memory state but should still hold the changes back
+	rc.unfrozen = nil
+	err = rc.meetDesires(rcFields)
+	Assert(t).IsNil(err, "unexpected error meeting desires during freeze")
+
+	current, err = rc.CurrentPods()
+	Assert(t).IsNil(err, "unexpected error getting current pods")
+	Assert(t).AreEqual(len(current), 1, "expected no pods to be added during the freeze after a restart")
+	intent, _, err = kvStore.Pod(consul.INTENT_TREE, current[0].Node, "testPod")
+	Assert(t).IsNil(err, "could not fetch intent")
+	restartedSHA, _ := intent.SHA()
+	Assert(t).AreEqual(restartedSHA, intentSHA, "expected manifest not to change during the freeze after a restart")
+
+	freeze.Overrides = []fields.ID{rc.rcID}
+	rc.freezeStore = fakeFreezeStore{freeze}
+	err = rc.meetDesires(rcFields)
+	Assert(t).IsNil(err, "unexpected error meeting desires with an override")
+
+	current, err = rc.CurrentPods()
+	Assert(t).IsNil(err, "unexpected error getting current pods")
+	Assert(t).AreEqual(len(current), 2, "expected pods to be added once the freeze was overridden")
+	for _, pod := range current {
+		intent, _, err := kvStore.Pod(consul.INTENT_TREE, pod.Node, "testPod")
+		Assert(t).IsNil(err, "could not fetch intent")
+		intentSHA, _ := intent.SHA()
+		Assert(t).AreEqual(intentSHA, frozenSHA, "expected manifest to change once the freeze was overridden")
+	}
+}
+
+func TestDisruptionBudgetPreventsDecreases(t *testing.T) {
+	rcStore, _, applicator, rc, alerter, _, _, closeFn := setup(t)
+	defer closeFn()
+
+	rcFields, err := rcStore.Get(rc.rcID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range []types.NodeName{"node1", "node2"} {
+		err = applicator.SetLabel(labels.NODE, node.String(), "nodeQuality", "good")
+		Assert(t).IsNil(err, "expected no error assigning label")
+	}
+
+	rcFields.ReplicasDesired = 2
+	err = rc.meetDesires(rcFields)
+	Assert(t).IsNil(err, "unexpected error scheduling nodes")
+
+	disruption := &fakeDisruptionChecker{violated: true}
+	rc.disruption = disruption
+	rcFields.ReplicasDesired = 1
+	err = rc.meetDesires(rcFields)
+	Assert(t).IsNotNil(err, "expected an error when a decrease breaks a disruption budget")
+
+	current, err := rc.CurrentPods()
+	Assert(t).IsNil(err, "unexpected error getting current pods")
+	Assert(t).AreEqual(len(current), 2, "expected no pods to be removed while the budget is violated")
+	Assert(t).AreEqual(len(alerter.Alerts), 1, "expected an alert for the refused decrease")
+	Assert(t).AreEqual(len(disruption.checked), 1, "expected the disruption budget to be checked once")
+	Assert(t).AreEqual(len(disruption.checked[0]), 1, "expected only the removed pod to be checked")
+
+	disruption.violated = false
+	err = rc.meetDesires(rcFields)
+	Assert(t).IsNil(err, "unexpected error unscheduling nodes")
+
+	current, err = rc.CurrentPods()
+	Assert(t).IsNil(err, "unexpected error getting current pods")
+	Assert(t).AreEqual(len(current), 1, "expected a pod to be removed once the budget allowed it")
+}
+
+func TestDisruptionBudgetLimitsDecreases(t *testing.T) {
+	rcStore, _, applicator, rc, alerter, _, _, closeFn := setup(t)
+	defer closeFn()
+
+	rcFields, err := rcStore.Get(rc.rcID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range []types.NodeName{"node1", "node2", "node3"} {
+		err = applicator.SetLabel(labels.NODE, node.String(), "nodeQuality", "good")
+		Assert(t).IsNil(err, "expected no error assigning label")
+	}
+
+	rcFields.ReplicasDesired = 3
+	err = rc.meetDesires(rcFields)
+	Assert(t).IsNil(err, "unexpected error scheduling nodes")
+
+	rc.disruption = &fakeDisruptionChecker{maxDisrupted: 1}
+	rcFields.ReplicasDesired = 1
+	err = rc.meetDesires(rcFields)
+	Assert(t).IsNil(err, "unexpected error unscheduling nodes")
+
+	current, err := rc.CurrentPods()
+	Assert(t).IsNil(err, "unexpected error getting current pods")
+	Assert(t).AreEqual(len(current), 2, "expected only as many pods to be removed as the budget allows")
+	Assert(t).AreEqual(len(alerter.Alerts), 0, "expected no alert when some pods could be removed")
+
+	err = rc.meetDesires(rcFields)
+	Assert(t).IsNil(err, "unexpected error unscheduling nodes")
+
+	current, err = rc.CurrentPods()
+	Assert(t).IsNil(err, "unexpected error getting current pods")
+	Assert(t).AreEqual(len(current), 1, "expected the rest of the pods to be removed on a later pass")
+}
+
 func TestConsistencyDelete(t *testing.T) {
 	rcStore, kvStore, applicator, rc, alerter, _, _, closeFn := setup(t)
 	defer closeFn()
@@ -890,6 +1114,154 @@ func TestAddPods(t *testing.T) {
 	}
 }
 
+func TestAddPodsPreemptsLowerPriorityPods(t *testing.T) {
+	rcStore, consulStore, applicator, rc, alerter, auditLogStore, _, closeFn := setup(t)
+	defer closeFn()
+
+	// schedule a pod of an RC with the given priority on the node
+	scheduleOther := func(podID types.PodID, node types.NodeName, priority int) fields.RC {
+		builder := manifest.NewBuilder()
+		builder.SetID(podID)
+		other, err := rcStore.Create(builder.GetManifest(), klabels.Everything(), "some_az", "some_cn", nil, nil, "some_strategy")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = rcStore.UpdatePriority(other.ID, priority)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = consulStore.SetPod(consul.INTENT_TREE, node, other.Manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = applicator.SetLabel(labels.POD, labels.MakePodLabelKey(node, podID), RCIDLabel, other.ID.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return other
+	}
+	victim := scheduleOther("batch_pod", "node1", -1)
+	scheduleOther("critical_pod", "node2", 20)
+
+	rc.scheduler = preemptingScheduler{
+		testScheduler: testScheduler{applicator: applicator},
+		candidates: []scheduler.Preemption{
+			{Node: "node2", Victims: []types.PodID{"critical_pod"}},
+			{Node: "node1", Victims: []types.PodID{"batch_pod"}},
+		},
+	}
+	rcFields := fields.RC{
+		ID:              rc.rcID,
+		ReplicasDesired: 1,
+		Manifest:        testManifest(),
+		Priority:        10,
+	}
+
+	// no nodes have room, so the pod can only be placed by preempting
+	err := rc.addPods(rcFields, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := rc.CurrentPods()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(current) != 1 || current[0].Node != "node1" {
+		t.Fatalf("expected the pod to have been scheduled on node1 in place of the lower priority pod, got %s", current)
+	}
+
+	victimPods, err := CurrentPods(victim.ID, applicator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(victimPods) != 0 {
+		t.Errorf("expected the lower priority RC to have lost its pod, got %s", victimPods)
+	}
+	_, _, err = consulStore.Pod(consul.INTENT_TREE, "node1", "batch_pod")
+	if err != pods.NoCurrentManifest {
+		t.Errorf("expected the lower priority pod to have been removed from the intent tree, got %v", err)
+	}
+	_, _, err = consulStore.Pod(consul.INTENT_TREE, "node2", "critical_pod")
+	if err != nil {
+		t.Errorf("expected the higher priority pod to have been left alone, got %v", err)
+	}
+
+	records, err := auditLogStore.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	preemptions := 0
+	for _, record := range records {
+		if record.EventType == audit.PreemptionEvent {
+			preemptions++
+		}
+	}
+	if preemptions != 1 {
+		t.Errorf("expected one preemption audit record, got %d", preemptions)
+	}
+
+	if len(alerter.Alerts) != 1 {
+		t.Errorf("expected the owner of the preempted pod to have been alerted once, got %d alerts", len(alerter.Alerts))
+	}
+}
+
+func TestAddPodsDoesNotPreemptPastDisruptionBudgets(t *testing.T) {
+	rcStore, consulStore, applicator, rc, _, _, _, closeFn := setup(t)
+	defer closeFn()
+
+	builder := manifest.NewBuilder()
+	builder.SetID("batch_pod")
+	other, err := rcStore.Create(builder.GetManifest(), klabels.Everything(), "some_az", "some_cn", nil, nil, "some_strategy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = consulStore.SetPod(consul.INTENT_TREE, "node1", other.Manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = applicator.SetLabel(labels.POD, labels.MakePodLabelKey("node1", "batch_pod"), RCIDLabel, other.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc.scheduler = preemptingScheduler{
+		testScheduler: testScheduler{applicator: applicator},
+		candidates: []scheduler.Preemption{
+			{Node: "node1", Victims: []types.PodID{"batch_pod"}},
+		},
+	}
+	disruption := &fakeDisruptionChecker{violated: true}
+	rc.disruption = disruption
+	rcFields := fields.RC{
+		ID:              rc.rcID,
+		ReplicasDesired: 1,
+		Manifest:        testManifest(),
+		NodeSelector:    klabels.Everything(),
+		Priority:        10,
+	}
+
+	err = rc.addPods(rcFields, nil, nil)
+	if err == nil {
+		t.Fatal("expected an error when the pod could not be placed")
+	}
+
+	if len(disruption.checked) != 1 || len(disruption.checked[0]) != 1 || disruption.checked[0][0].PodID != "batch_pod" {
+		t.Errorf("expected the lower priority pod's disruption budgets to be checked, checked %v", disruption.checked)
+	}
+	current, err := rc.CurrentPods()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(current) != 0 {
+		t.Errorf("expected nothing to be scheduled, got %s", current)
+	}
+	_, _, err = consulStore.Pod(consul.INTENT_TREE, "node1", "batch_pod")
+	if err != nil {
+		t.Errorf("expected the lower priority pod to have been left alone, got %v", err)
+	}
+}
+
 func TestAddPodsDisabled(t *testing.T) {
 	_, _, _, rc, _, _, _, closeFn := setup(t)
 	defer closeFn()
@@ -1020,6 +1392,87 @@ func TestRemovePodsDisabled(t *testing.T) {
 
 }
 
+func TestSpreadConstraints(t *testing.T) {
+	_, _, applicator, rc, alerter, _, _, closeFn := setup(t)
+	defer closeFn()
+
+	racks := map[types.NodeName]string{
+		"node1": "a",
+		"node2": "a",
+		"node3": "a",
+		"node4": "b",
+		"node5": "b",
+		"node6": "c",
+	}
+	for node, rack := range racks {
+		err := applicator.SetLabel(labels.NODE, node.String(), "rack", rack)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rcFields := fields.RC{
+		ID:                rc.rcID,
+		ReplicasDesired:   4,
+		Manifest:          testManifest(),
+		NodeSelector:      klabels.Everything(),
+		SpreadConstraints: []fields.SpreadConstraint{{TopologyKey: "rack", MaxSkew: 1}},
+	}
+
+	// node7 has no rack label so it must never be used
+	eligible := []types.NodeName{"node1", "node2", "node3", "node4", "node5", "node6", "node7"}
+
+	err := rc.addPods(rcFields, types.PodLocations{}, eligible)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	currentPods, err := rc.CurrentPods()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := types.NewNodeSet("node1", "node2", "node4", "node6")
+	if !types.NewNodeSet(currentPods.Nodes()...).Equal(expected) {
+		t.Fatalf("expected pods to be spread across racks on %s but were on %s", expected, currentPods.Nodes())
+	}
+
+	rcFields.ReplicasDesired = 2
+	err = rc.removePods(rcFields, currentPods, eligible)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	currentPods, err = rc.CurrentPods()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = types.NewNodeSet("node1", "node4")
+	if !types.NewNodeSet(currentPods.Nodes()...).Equal(expected) {
+		t.Fatalf("expected pods to be removed from the most populated racks leaving %s but were on %s", expected, currentPods.Nodes())
+	}
+
+	// with one pod per rack there is only room for three pods
+	rcFields.ReplicasDesired = 4
+	rcFields.SpreadConstraints = []fields.SpreadConstraint{{TopologyKey: "rack", OnePerValue: true}}
+	err = rc.addPods(rcFields, currentPods, eligible)
+	if err == nil {
+		t.Fatal("expected an error scheduling more pods than there are racks")
+	}
+
+	currentPods, err = rc.CurrentPods()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = types.NewNodeSet("node1", "node4", "node6")
+	if !types.NewNodeSet(currentPods.Nodes()...).Equal(expected) {
+		t.Fatalf("expected one pod per rack on %s but pods were on %s", expected, currentPods.Nodes())
+	}
+
+	if len(alerter.Alerts) != 1 {
+		t.Fatalf("expected an alert about not meeting desire within spread constraints but got %d alerts", len(alerter.Alerts))
+	}
+}
+
 func nodeTransferSetup(applicator testApplicator, rc *replicationController, rcFields fields.RC) error {
 	for i := 0; i < 3; i++ {
 		err := applicator.SetLabel(labels.NODE, fmt.Sprintf("node%d", i), "nodeQuality", "good")
@@ -1282,6 +1735,114 @@ func TestNodeTransferWhenAllPodsHealthy(t *testing.T) {
 	}
 }
 
+func TestCordonedNodesKeepPodsButGetNoNewOnes(t *testing.T) {
+	_, _, applicator, rc, _, _, _, closeFn := setup(t)
+	defer closeFn()
+
+	for i := 0; i < 3; i++ {
+		err := applicator.SetLabel(labels.NODE, fmt.Sprintf("node%d", i), "nodeQuality", "good")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := applicator.SetLabel(labels.NODE, "node0", cordon.StateLabel, string(cordon.Cordoned))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rcFields := fields.RC{
+		ID:                 rc.rcID,
+		ReplicasDesired:    2,
+		Manifest:           testManifest(),
+		NodeSelector:       klabels.Everything().Add("nodeQuality", klabels.EqualsOperator, []string{"good"}),
+		AllocationStrategy: fields.DynamicStrategy,
+	}
+	err = rc.meetDesires(rcFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := rc.CurrentPods()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := types.NewNodeSet("node1", "node2")
+	if !types.NewNodeSet(current.Nodes()...).Equal(expected) {
+		t.Fatalf("expected the cordoned node to get no pod, current nodes were %v", current.Nodes())
+	}
+
+	// cordoning a node the RC is already on leaves its pod alone
+	err = applicator.SetLabel(labels.NODE, "node1", cordon.StateLabel, string(cordon.Cordoned))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rc.meetDesires(rcFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err = rc.CurrentPods()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !types.NewNodeSet(current.Nodes()...).Equal(expected) {
+		t.Fatalf("expected pods on cordoned nodes to be kept, current nodes were %v", current.Nodes())
+	}
+}
+
+func TestNodeTransferOffDrainingNode(t *testing.T) {
+	_, _, applicator, rc, _, _, _, closeFn := setup(t)
+	defer closeFn()
+
+	for i := 0; i < 3; i++ {
+		err := applicator.SetLabel(labels.NODE, fmt.Sprintf("node%d", i), "nodeQuality", "good")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rcFields := fields.RC{
+		ID:                 rc.rcID,
+		ReplicasDesired:    3,
+		Manifest:           testManifest(),
+		NodeSelector:       klabels.Everything().Add("nodeQuality", klabels.EqualsOperator, []string{"good"}),
+		AllocationStrategy: fields.DynamicStrategy,
+	}
+	err := rc.meetDesires(rcFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := rc.CurrentPods()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	healthMap := make(map[types.NodeName]health.Result, len(current))
+	for _, node := range current.Nodes() {
+		healthMap[node] = health.Result{Status: health.Passing}
+	}
+	rc.healthChecker = fake_checker.NewSingleService("some_pod", healthMap)
+
+	// the node still matches the RC's selector, but draining it makes it
+	// ineligible
+	err = applicator.SetLabel(labels.NODE, "node2", cordon.StateLabel, string(cordon.Draining))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rc.meetDesires(rcFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current, err = rc.CurrentPods()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := types.NewNodeSet("node0", "node1", newTransferNode)
+	if !types.NewNodeSet(current.Nodes()...).Equal(expected) {
+		t.Fatalf("expected the pod to be transferred off the draining node, current nodes were %v", current.Nodes())
+	}
+}
+
 func TestNodeTransferWhenIneligibleNodeUnhealthy(t *testing.T) {
 	_, _, applicator, rc, _, _, _, closeFn := setup(t)
 	defer closeFn()
@@ -0,0 +1,190 @@
+package rc
+
+import (
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// spreadDomains tracks how an RC's pods are spread across the values of one
+// spread constraint's topology key
+type spreadDomains struct {
+	constraint fields.SpreadConstraint
+
+	// the topology key value of every relevant node that has the label
+	domains map[types.NodeName]string
+
+	// the number of the RC's pods in each topology key value
+	counts map[string]int
+}
+
+// spreadState tracks the placement of an RC's pods against each of its
+// spread constraints
+type spreadState []spreadDomains
+
+// newSpreadState looks up the topology labels of the current and eligible
+// nodes for each of the RC's spread constraints
+func (rc *replicationController) newSpreadState(rcFields fields.RC, current []types.NodeName, eligible []types.NodeName) (spreadState, error) {
+	relevant := types.NewNodeSet(current...).Union(types.NewNodeSet(eligible...))
+
+	state := make(spreadState, 0, len(rcFields.SpreadConstraints))
+	for _, constraint := range rcFields.SpreadConstraints {
+		selector := klabels.Everything().Add(constraint.TopologyKey, klabels.ExistsOperator, []string{})
+		labeled, err := rc.podApplicator.GetMatches(selector, labels.NODE)
+		if err != nil {
+			return nil, util.Errorf("could not get %s labels of nodes: %s", constraint.TopologyKey, err)
+		}
+
+		domains := spreadDomains{
+			constraint: constraint,
+			domains:    make(map[types.NodeName]string),
+			counts:     make(map[string]int),
+		}
+		for _, node := range labeled {
+			nodeName := types.NodeName(node.ID)
+			if !relevant.Has(nodeName.String()) {
+				continue
+			}
+			domain := node.Labels.Get(constraint.TopologyKey)
+			domains.domains[nodeName] = domain
+			if _, ok := domains.counts[domain]; !ok {
+				domains.counts[domain] = 0
+			}
+		}
+		for _, node := range current {
+			if domain, ok := domains.domains[node]; ok {
+				domains.counts[domain]++
+			}
+		}
+		state = append(state, domains)
+	}
+	return state, nil
+}
+
+// labeled returns whether the node has every topology key label
+func (s spreadState) labeled(node types.NodeName) bool {
+	for _, d := range s {
+		if _, ok := d.domains[node]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// allows returns whether scheduling a pod on the node keeps every spread
+// constraint satisfied
+func (s spreadState) allows(node types.NodeName) bool {
+	for _, d := range s {
+		domain, ok := d.domains[node]
+		if !ok {
+			return false
+		}
+
+		count := d.counts[domain] + 1
+		if d.constraint.OnePerValue {
+			if count > 1 {
+				return false
+			}
+			continue
+		}
+
+		min := count
+		for other, otherCount := range d.counts {
+			if other != domain && otherCount < min {
+				min = otherCount
+			}
+		}
+		if count-min > d.constraint.MaxSkew {
+			return false
+		}
+	}
+	return true
+}
+
+// score sums the number of pods in each of the node's domains
+func (s spreadState) score(node types.NodeName) int {
+	score := 0
+	for _, d := range s {
+		if domain, ok := d.domains[node]; ok {
+			score += d.counts[domain]
+		}
+	}
+	return score
+}
+
+func (s spreadState) add(node types.NodeName) {
+	for _, d := range s {
+		if domain, ok := d.domains[node]; ok {
+			d.counts[domain]++
+		}
+	}
+}
+
+func (s spreadState) remove(node types.NodeName) {
+	for _, d := range s {
+		if domain, ok := d.domains[node]; ok && d.counts[domain] > 0 {
+			d.counts[domain]--
+		}
+	}
+}
+
+// pickAdditions chooses up to count of the candidates to schedule on, one at
+// a time, always taking an allowed candidate in the least populated domains.
+// Ties go to the earliest candidate so ordering stays deterministic. Fewer
+// than count nodes are returned if the constraints cannot otherwise be met.
+func (s spreadState) pickAdditions(candidates []types.NodeName, count int) []types.NodeName {
+	remaining := append([]types.NodeName(nil), candidates...)
+	var picked []types.NodeName
+	for len(picked) < count {
+		best := -1
+		for i, node := range remaining {
+			if !s.allows(node) {
+				continue
+			}
+			if best < 0 || s.score(node) < s.score(remaining[best]) {
+				best = i
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		node := remaining[best]
+		s.add(node)
+		picked = append(picked, node)
+		remaining = append(remaining[:best], remaining[best+1:]...)
+	}
+	return picked
+}
+
+// pickRemovals orders all of the candidates for unscheduling. Nodes missing
+// a topology label come first, then the rest are taken one at a time from
+// the most populated domains, with ties going to the latest candidate.
+func (s spreadState) pickRemovals(candidates []types.NodeName) []types.NodeName {
+	var ordered, remaining []types.NodeName
+	for _, node := range candidates {
+		if s.labeled(node) {
+			remaining = append(remaining, node)
+		} else {
+			ordered = append(ordered, node)
+		}
+	}
+
+	for len(remaining) > 0 {
+		best := 0
+		for i, node := range remaining {
+			if s.score(node) >= s.score(remaining[best]) {
+				best = i
+			}
+		}
+
+		node := remaining[best]
+		s.remove(node)
+		ordered = append(ordered, node)
+		remaining = append(remaining[:best], remaining[best+1:]...)
+	}
+	return ordered
+}
@@ -80,6 +80,19 @@ type Replication interface {
 
 	// SetTimeout() is used to change the timeout used for the replication while it is in progress
 	SetTimeout(timeout time.Duration)
+
+	// SetActive() changes the number of nodes updated concurrently while
+	// the replication is in progress
+	SetActive(active int)
+
+	// SetBatchPause() changes how long the replication waits between
+	// batches of nodes while it is in progress. Zero disables batching,
+	// starting a node as soon as another finishes
+	SetBatchPause(batchPause time.Duration)
+
+	// TimedOutNodes() returns the nodes that timed out while being updated
+	// to the current manifest and haven't been updated successfully since
+	TimedOutNodes() []types.NodeName
 }
 
 type Store interface {
@@ -97,7 +110,6 @@ type Store interface {
 
 // A replication contains the information required to do a single replication (deploy).
 type replication struct {
-	active         int
 	nodes          []types.NodeName
 	completedCount int32
 	store          Store
@@ -117,6 +129,10 @@ type replication struct {
 	// until a value can be read off of the channel.
 	rateLimiter *time.Ticker
 
+	// Limits the number of nodes updated concurrently and paces batches
+	// of them
+	throttle *throttle
+
 	// communicates errors back to the caller, such as an error renewing
 	// the deploy lock
 	errCh chan<- error
@@ -183,7 +199,6 @@ func newReplication(
 	nodeQueue chan types.NodeName,
 ) *replication {
 	return &replication{
-		active:                 active,
 		nodes:                  nodes,
 		store:                  store,
 		txner:                  txner,
@@ -194,6 +209,7 @@ func newReplication(
 		threshold:              threshold,
 		logger:                 logger,
 		rateLimiter:            rateLimiter,
+		throttle:               newThrottle(active),
 		errCh:                  errCh,
 		healthWatchDelay:       healthWatchDelay,
 		replicationCancelledCh: replicationCancelledCh,
@@ -351,13 +367,25 @@ func (r *replication) Enact() {
 	defer aggregateHealth.Stop()
 	// this loop multiplexes the node queue across some goroutines
 
+	// start enough goroutines for the largest number of concurrent
+	// updates, since that can be changed while the replication is in
+	// progress. The throttle limits how many of them are busy at once
 	var updatePool sync.WaitGroup
-	for i := 0; i < r.active; i++ {
+	for i := 0; i < maxActive; i++ {
 		updatePool.Add(1)
 		go func() {
 			// nodeQueue is managed below to throttle these goroutines
 			defer updatePool.Done()
-			for node := range nodeQueue {
+			for {
+				if !r.throttle.acquire(r.quitCh) {
+					return
+				}
+				node, ok := <-nodeQueue
+				if !ok {
+					r.throttle.release()
+					return
+				}
+
 				exitCh := make(chan struct{})
 				ctx, cancel := context.WithCancel(context.Background())
 				r.mu.Lock()
@@ -372,15 +400,14 @@ func (r *replication) Enact() {
 					defer close(exitCh)
 					err := r.updateOne(ctx, node, aggregateHealth)
 					if err == nil {
+						r.clearTimedOut(node)
 						r.logger.Infof("The host '%v' successfully replicated the pod '%v'", node, r.GetManifest().ID())
 						return
 					}
 
 					switch err {
 					case errTimeout:
-						r.timedOutReplicationsMutex.Lock()
-						r.timedOutReplications = append(r.timedOutReplications, node)
-						r.timedOutReplicationsMutex.Unlock()
+						r.markTimedOut(node)
 						r.logger.Errorf("The host '%v' timed out during replication for pod '%v'", node, r.GetManifest().ID())
 					case errCancelled:
 						r.logger.Errorf("The host '%v' was cancelled (probably due to an update) during replication for pod '%v'", node, r.GetManifest().ID())
@@ -391,6 +418,7 @@ func (r *replication) Enact() {
 
 				select {
 				case <-ctx.Done():
+					r.throttle.release()
 				case <-r.quitCh:
 					return
 				}
@@ -426,6 +454,11 @@ func (r *replication) SetManifest(man manifest.Manifest) {
 	if oldSHA != newSHA {
 		// reset the completed count to 0 because we changed the manifest
 		atomic.StoreInt32(&r.completedCount, 0)
+
+		// timeouts deploying the old manifest are no longer relevant
+		r.timedOutReplicationsMutex.Lock()
+		r.timedOutReplications = nil
+		r.timedOutReplicationsMutex.Unlock()
 	}
 	r.manifest = man
 }
@@ -436,6 +469,50 @@ func (r *replication) SetTimeout(timeout time.Duration) {
 	r.mu.Unlock()
 }
 
+func (r *replication) TimedOutNodes() []types.NodeName {
+	r.timedOutReplicationsMutex.Lock()
+	defer r.timedOutReplicationsMutex.Unlock()
+	return append([]types.NodeName(nil), r.timedOutReplications...)
+}
+
+func (r *replication) markTimedOut(node types.NodeName) {
+	r.timedOutReplicationsMutex.Lock()
+	defer r.timedOutReplicationsMutex.Unlock()
+	for _, n := range r.timedOutReplications {
+		if n == node {
+			return
+		}
+	}
+	r.timedOutReplications = append(r.timedOutReplications, node)
+}
+
+func (r *replication) clearTimedOut(node types.NodeName) {
+	r.timedOutReplicationsMutex.Lock()
+	defer r.timedOutReplicationsMutex.Unlock()
+	var timedOut []types.NodeName
+	for _, n := range r.timedOutReplications {
+		if n != node {
+			timedOut = append(timedOut, n)
+		}
+	}
+	r.timedOutReplications = timedOut
+}
+
+func (r *replication) SetActive(active int) {
+	if active < 1 {
+		active = 1
+	}
+	if active > maxActive {
+		r.logger.Infof("Number of concurrent updates (%v) is greater than %d, reducing to %d", active, maxActive, maxActive)
+		active = maxActive
+	}
+	r.throttle.setActive(active)
+}
+
+func (r *replication) SetBatchPause(batchPause time.Duration) {
+	r.throttle.setBatchPause(batchPause)
+}
+
 func (r *replication) GetManifest() manifest.Manifest {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -70,7 +70,7 @@ func TestEnactCancellation(t *testing.T) {
 	defer fixture.Stop()
 
 	podStore := consul.NewConsulStore(fixture.Client)
-	r.active = 1
+	r.throttle = newThrottle(1)
 	r.rateLimiter = time.NewTicker(2 * time.Second) // we need time to cancel
 
 	enactHaltCh := make(chan bool)
@@ -128,7 +128,7 @@ func newTestReplication(t *testing.T, errCh chan error) (*replication, consuluti
 	concurrentRealityRequests := make(chan struct{}, 100)
 	timeout := 10 * time.Second
 	return &replication{
-		active:      2,
+		throttle:    newThrottle(2),
 		podLabels:   map[string]string{"foo": "bar"},
 		nodes:       nodes,
 		store:       podStore,
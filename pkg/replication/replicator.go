@@ -21,6 +21,10 @@ const (
 	// Normal replications will have no timeout, but daemon sets will
 	// because it is unlikely that all hosts are healthy at all times
 	NoTimeout = time.Duration(-1)
+
+	// maxActive is the largest number of nodes a replication will update
+	// concurrently
+	maxActive = 50
 )
 
 var (
@@ -87,9 +91,9 @@ func NewReplicator(
 	if active < 1 {
 		return replicator{}, util.Errorf("Active must be >= 1, was %d", active)
 	}
-	if active > 50 {
-		logger.Infof("Number of concurrent updates (%v) is greater than 50, reducing to 50", active)
-		active = 50
+	if active > maxActive {
+		logger.Infof("Number of concurrent updates (%v) is greater than %d, reducing to %d", active, maxActive, maxActive)
+		active = maxActive
 	}
 	return replicator{
 		manifest:         manifest,
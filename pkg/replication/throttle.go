@@ -0,0 +1,110 @@
+package replication
+
+import (
+	"sync"
+	"time"
+)
+
+// throttle limits how many nodes a replication updates at once. Nodes are
+// started in batches of at most active nodes, and when batchPause is nonzero
+// the next batch isn't started until the previous one has finished and
+// batchPause has elapsed. Both values may be changed while the replication is
+// in progress.
+type throttle struct {
+	mu         sync.Mutex
+	active     int
+	batchPause time.Duration
+
+	// inFlight is the number of slots currently held by updates
+	inFlight int
+	// started is the number of slots handed out in the current batch
+	started int
+	// pauseUntil is when the next batch may start
+	pauseUntil time.Time
+
+	// changed is closed and replaced whenever a slot may have become
+	// available
+	changed chan struct{}
+}
+
+func newThrottle(active int) *throttle {
+	return &throttle{
+		active:  active,
+		changed: make(chan struct{}),
+	}
+}
+
+// acquire blocks until a node may be updated, returning false if quitCh is
+// closed first. Every successful acquire must be followed by a release.
+func (t *throttle) acquire(quitCh <-chan struct{}) bool {
+	for {
+		t.mu.Lock()
+		var wait time.Duration
+		ok := false
+		if t.batchPause <= 0 {
+			ok = t.inFlight < t.active
+		} else if t.started < t.active {
+			wait = t.pauseUntil.Sub(time.Now())
+			ok = wait <= 0
+		}
+		if ok {
+			t.inFlight++
+			t.started++
+			t.mu.Unlock()
+			return true
+		}
+		changed := t.changed
+		t.mu.Unlock()
+
+		var pauseOver <-chan time.Time
+		if wait > 0 {
+			pauseOver = time.After(wait)
+		}
+		select {
+		case <-changed:
+		case <-pauseOver:
+		case <-quitCh:
+			return false
+		}
+	}
+}
+
+func (t *throttle) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.inFlight--
+	t.endBatchIfDone()
+	t.notify()
+}
+
+func (t *throttle) setActive(active int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active = active
+	t.endBatchIfDone()
+	t.notify()
+}
+
+func (t *throttle) setBatchPause(batchPause time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.batchPause = batchPause
+	t.notify()
+}
+
+// endBatchIfDone starts a new batch once the current one is full and all of
+// its updates have finished. The caller must hold t.mu
+func (t *throttle) endBatchIfDone() {
+	if t.inFlight > 0 || t.started < t.active {
+		return
+	}
+	t.started = 0
+	t.pauseUntil = time.Now().Add(t.batchPause)
+}
+
+// notify wakes up any acquire calls so they check for a slot again. The
+// caller must hold t.mu
+func (t *throttle) notify() {
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
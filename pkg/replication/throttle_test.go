@@ -0,0 +1,74 @@
+package replication
+
+import (
+	"testing"
+	"time"
+)
+
+// acquireWithin returns whether the throttle hands out a slot within the
+// given duration
+func acquireWithin(t *throttle, d time.Duration) bool {
+	quitCh := make(chan struct{})
+	acquired := make(chan bool)
+	go func() {
+		acquired <- t.acquire(quitCh)
+	}()
+
+	select {
+	case ok := <-acquired:
+		return ok
+	case <-time.After(d):
+		close(quitCh)
+		<-acquired
+		return false
+	}
+}
+
+func TestThrottleLimitsConcurrentUpdates(t *testing.T) {
+	throttle := newThrottle(2)
+	if !acquireWithin(throttle, time.Second) || !acquireWithin(throttle, time.Second) {
+		t.Fatal("expected two slots to be available")
+	}
+	if acquireWithin(throttle, 50*time.Millisecond) {
+		t.Fatal("expected no more than two slots to be handed out")
+	}
+
+	throttle.release()
+	if !acquireWithin(throttle, time.Second) {
+		t.Fatal("expected a slot to be available as soon as one was released")
+	}
+
+	throttle.setActive(3)
+	if !acquireWithin(throttle, time.Second) {
+		t.Fatal("expected a slot to be available after raising active")
+	}
+}
+
+func TestThrottlePausesBetweenBatches(t *testing.T) {
+	batchPause := 200 * time.Millisecond
+	throttle := newThrottle(2)
+	throttle.setBatchPause(batchPause)
+
+	if !acquireWithin(throttle, time.Second) || !acquireWithin(throttle, time.Second) {
+		t.Fatal("expected the first batch to start immediately")
+	}
+
+	throttle.release()
+	if acquireWithin(throttle, 50*time.Millisecond) {
+		t.Fatal("expected the next batch to wait until the current one finished")
+	}
+
+	throttle.release()
+	start := time.Now()
+	if !acquireWithin(throttle, time.Second) {
+		t.Fatal("expected the next batch to start after the pause")
+	}
+	if waited := time.Since(start); waited < batchPause/2 {
+		t.Fatalf("expected the next batch to wait about %s but it waited %s", batchPause, waited)
+	}
+
+	throttle.setBatchPause(0)
+	if !acquireWithin(throttle, time.Second) {
+		t.Fatal("expected a slot to be available after disabling batching")
+	}
+}
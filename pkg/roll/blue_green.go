@@ -0,0 +1,268 @@
+package roll
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/rc"
+	rcf "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/store/consul/rcstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/rollstatus"
+	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/Sirupsen/logrus"
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+// BlueGreenLabel is set on the nodes a blue/green update has chosen for its
+// new RC, with the new RC's ID as the value. Until the update cuts over, the
+// new RC's node selector requires it so that the new RC can't schedule onto
+// the old RC's nodes.
+const BlueGreenLabel = "blue_green_replication_controller_id"
+
+// blueGreenStep moves a blue/green update one step closer to completion. The
+// new RC is scaled to DesiredReplicas on nodes that the old RC isn't using,
+// and once all of them are healthy the old RC is scaled to zero in a single
+// cut over. It returns true once the update has cut over and the new RC's
+// node selector has been restored. If the update has to wait, a reason is
+// returned.
+func (u *update) blueGreenStep(ctx context.Context, oldNodes, newNodes rcNodeCounts) (bool, string, error) {
+	if u.scheduler == nil || u.nodeLabeler == nil {
+		return false, "", util.Errorf("blue/green updates require a scheduler and a node labeler")
+	}
+
+	if oldNodes.Desired == 0 && newNodes.Desired >= u.DesiredReplicas {
+		// the update has already cut over, clean up after it
+		err := u.finishBlueGreen(ctx)
+		if err != nil {
+			return false, "", err
+		}
+		return true, "", nil
+	}
+
+	if len(u.BlueGreen.Nodes) == 0 {
+		blockedReason, err := u.allocateBlueGreenNodes()
+		if err != nil || blockedReason != "" {
+			return false, blockedReason, err
+		}
+	}
+
+	err := u.labelBlueGreenNodes()
+	if err != nil {
+		return false, "", err
+	}
+	err = u.syncBlueGreenSelector(ctx)
+	if err != nil {
+		return false, "", err
+	}
+
+	if newNodes.Desired < u.DesiredReplicas {
+		nextAdd := u.DesiredReplicas - newNodes.Desired
+		nextRemove := 0
+		u.logger.WithFields(logrus.Fields{
+			"old": oldNodes.ToString(),
+			"new": newNodes.ToString(),
+		}).Infof("Adding %d new nodes before cutting over", nextAdd)
+		transferReq := rcstore.TransferReplicaCountsRequest{
+			ToRCID:               u.NewRC,
+			FromRCID:             u.OldRC,
+			ReplicasToAdd:        &nextAdd,
+			ReplicasToRemove:     &nextRemove,
+			StartingToReplicas:   &newNodes.Desired,
+			StartingFromReplicas: &oldNodes.Desired,
+		}
+
+		// branch off of the passed ctx which implicitly ensures that RC locks are held
+		transferCtx, cancel := transaction.New(ctx)
+		defer cancel()
+		err = u.rcStore.TransferReplicaCounts(transferCtx, transferReq)
+		if err != nil {
+			return false, "", err
+		}
+		err = transaction.MustCommit(transferCtx, u.txner)
+		if err != nil {
+			return false, "", err
+		}
+		u.status.LastStep = rollstatus.Step{
+			NodesToAdd:    nextAdd,
+			NodesToRemove: nextRemove,
+		}
+		return false, "", nil
+	}
+
+	if newNodes.Healthy < u.DesiredReplicas {
+		return false, fmt.Sprintf("waiting for all %d new nodes to become healthy before cutting over", u.DesiredReplicas), nil
+	}
+
+	return false, "", u.cutOver(ctx, oldNodes, newNodes)
+}
+
+// allocateBlueGreenNodes chooses DesiredReplicas nodes for the new RC that
+// the old RC isn't running on. Nodes are taken from the scheduler's eligible
+// nodes first, and if there aren't enough of those the scheduler is asked to
+// allocate the rest.
+func (u *update) allocateBlueGreenNodes() (string, error) {
+	newRC, err := u.rcStore.Get(u.NewRC)
+	if err != nil {
+		return "", err
+	}
+	oldPods, err := rc.CurrentPods(u.OldRC, u.labeler)
+	if err != nil {
+		return "", err
+	}
+	oldNodeSet := types.NewNodeSet(oldPods.Nodes()...)
+
+	eligible, err := u.scheduler.EligibleNodes(newRC.Manifest, newRC.NodeSelector)
+	if err != nil {
+		return "", util.Errorf("could not determine eligible nodes for new RC: %s", err)
+	}
+	available := types.NewNodeSet(eligible...).Difference(oldNodeSet)
+
+	if available.Len() < u.DesiredReplicas {
+		spread := rcf.Spread{
+			Constraints:  newRC.SpreadConstraints,
+			CurrentNodes: available.ListNodes(),
+		}
+		allocated, err := u.scheduler.AllocateNodes(newRC.Manifest, newRC.NodeSelector, u.DesiredReplicas-available.Len(), false, spread)
+		if err != nil {
+			return "", util.Errorf("could not allocate nodes for new RC: %s", err)
+		}
+		for _, node := range allocated {
+			if !oldNodeSet.Has(node.String()) {
+				available.InsertNode(node)
+			}
+		}
+	}
+
+	if available.Len() < u.DesiredReplicas {
+		return fmt.Sprintf("only %d nodes not used by the old RC are eligible for the new RC, %d are needed", available.Len(), u.DesiredReplicas), nil
+	}
+
+	next := *u.BlueGreen
+	next.Nodes = available.ListNodes()[:u.DesiredReplicas]
+	next.NodeSelector = newRC.NodeSelector.String()
+	stored, err := u.rollStore.SetBlueGreen(u.ID(), next)
+	if err != nil {
+		return "", err
+	}
+	u.logger.WithField("nodes", next.Nodes).Infoln("Allocated nodes for new RC")
+	u.BlueGreen = stored.BlueGreen
+
+	if u.nodeIDsCh != nil {
+		nodeIDs, err := u.currentNodeIDs()
+		if err == nil {
+			select {
+			case u.nodeIDsCh <- nodeIDs:
+			default:
+			}
+		}
+	}
+	return "", nil
+}
+
+// labelBlueGreenNodes marks every node chosen for the new RC so that the new
+// RC's node selector matches them
+func (u *update) labelBlueGreenNodes() error {
+	for _, node := range u.BlueGreen.Nodes {
+		nodeLabels, err := u.labeler.GetLabels(labels.NODE, node.String())
+		if err != nil {
+			return err
+		}
+		if nodeLabels.Labels.Get(BlueGreenLabel) == u.NewRC.String() {
+			continue
+		}
+
+		err = u.nodeLabeler.SetLabel(labels.NODE, node.String(), BlueGreenLabel, u.NewRC.String())
+		if err != nil {
+			return util.Errorf("could not label node %s for new RC: %s", node, err)
+		}
+	}
+	return nil
+}
+
+// syncBlueGreenSelector restricts the new RC to the nodes chosen for it
+func (u *update) syncBlueGreenSelector(ctx context.Context) error {
+	selector, err := klabels.Parse(u.BlueGreen.NodeSelector)
+	if err != nil {
+		return util.Errorf("could not parse original node selector of RC %s: %s", u.NewRC, err)
+	}
+	return u.setNewRCSelector(ctx, selector.Add(BlueGreenLabel, klabels.EqualsOperator, []string{u.NewRC.String()}))
+}
+
+// cutOver scales the old RC to zero and records the switch in the audit log
+func (u *update) cutOver(ctx context.Context, oldNodes, newNodes rcNodeCounts) error {
+	nextAdd := 0
+	nextRemove := oldNodes.Desired
+	transferReq := rcstore.TransferReplicaCountsRequest{
+		ToRCID:               u.NewRC,
+		FromRCID:             u.OldRC,
+		ReplicasToAdd:        &nextAdd,
+		ReplicasToRemove:     &nextRemove,
+		StartingToReplicas:   &newNodes.Desired,
+		StartingFromReplicas: &oldNodes.Desired,
+	}
+
+	// branch off of the passed ctx which implicitly ensures that RC locks are held
+	cutOverCtx, cancel := transaction.New(ctx)
+	defer cancel()
+	err := u.rcStore.TransferReplicaCounts(cutOverCtx, transferReq)
+	if err != nil {
+		return util.Errorf("could not build cut over transaction: %s", err)
+	}
+
+	if u.shouldCreateAuditLogRecords {
+		details, err := audit.NewRUCutOverEventDetails(u.ID(), u.OldRC, u.NewRC, nextRemove, u.BlueGreen.Nodes, u.labeler)
+		if err != nil {
+			return err
+		}
+
+		err = u.auditLogStore.Create(cutOverCtx, audit.RUCutOverEvent, details)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = transaction.MustCommit(cutOverCtx, u.txner)
+	if err != nil {
+		return util.Errorf("could not cut over to new RC: %s", err)
+	}
+
+	u.logger.WithFields(logrus.Fields{
+		"old": oldNodes.ToString(),
+		"new": newNodes.ToString(),
+	}).Infof("Cut over to new RC, removed %d old nodes", nextRemove)
+	u.status.LastStep = rollstatus.Step{
+		NodesToAdd:    nextAdd,
+		NodesToRemove: nextRemove,
+	}
+	return nil
+}
+
+// finishBlueGreen restores the new RC's original node selector and removes
+// the label from the nodes chosen for it
+func (u *update) finishBlueGreen(ctx context.Context) error {
+	if len(u.BlueGreen.Nodes) == 0 {
+		return nil
+	}
+
+	selector, err := klabels.Parse(u.BlueGreen.NodeSelector)
+	if err != nil {
+		return util.Errorf("could not parse original node selector of RC %s: %s", u.NewRC, err)
+	}
+	err = u.setNewRCSelector(ctx, selector)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range u.BlueGreen.Nodes {
+		err = u.nodeLabeler.RemoveLabel(labels.NODE, node.String(), BlueGreenLabel)
+		if err != nil {
+			return util.Errorf("could not remove label from node %s: %s", node, err)
+		}
+	}
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/square/p2/pkg/alerting"
 	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/farmstatus"
 	"github.com/square/p2/pkg/health/checker"
 	hclient "github.com/square/p2/pkg/health/client"
 	"github.com/square/p2/pkg/labels"
@@ -16,6 +17,7 @@ import (
 	"github.com/square/p2/pkg/rc"
 	"github.com/square/p2/pkg/rc/fields"
 	roll_fields "github.com/square/p2/pkg/roll/fields"
+	"github.com/square/p2/pkg/shard"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/auditlogstore"
 	"github.com/square/p2/pkg/store/consul/consulutil"
@@ -42,9 +44,13 @@ type UpdateFactory struct {
 	RCStore             ReplicationControllerStore
 	RCStatusStore       RCStatusStore
 	RollStore           RollingUpdateStore
+	RollStatusStore     RollStatusStore
 	HealthServiceClient hclient.HealthServiceClient
 	HealthChecker       checker.ShadowTrafficHealthChecker
 	Labeler             labeler
+	NodeLabeler         NodeLabeler
+	Scheduler           rc.Scheduler
+	FreezeStore         FreezeStore
 	WatchDelay          time.Duration
 	Alerter             alerting.Alerter
 
@@ -65,9 +71,13 @@ func NewUpdateFactory(
 	rcStore ReplicationControllerStore,
 	rcStatusStore RCStatusStore,
 	rollStore RollingUpdateStore,
+	rollStatusStore RollStatusStore,
 	healthChecker checker.ShadowTrafficHealthChecker,
 	healthServiceClient hclient.HealthServiceClient,
 	labeler labeler,
+	nodeLabeler NodeLabeler,
+	scheduler rc.Scheduler,
+	freezeStore FreezeStore,
 	watchDelay time.Duration,
 	alerter alerting.Alerter,
 	auditLogStore auditlogstore.ConsulStore,
@@ -81,9 +91,13 @@ func NewUpdateFactory(
 		RCStore:                     rcStore,
 		RCStatusStore:               rcStatusStore,
 		RollStore:                   rollStore,
+		RollStatusStore:             rollStatusStore,
 		HealthChecker:               healthChecker,
 		HealthServiceClient:         healthServiceClient,
 		Labeler:                     labeler,
+		NodeLabeler:                 nodeLabeler,
+		Scheduler:                   scheduler,
+		FreezeStore:                 freezeStore,
 		WatchDelay:                  watchDelay,
 		Alerter:                     alerter,
 		AuditLogStore:               auditLogStore,
@@ -100,10 +114,14 @@ func (f UpdateFactory) New(u roll_fields.Update, l logging.Logger, session consu
 		f.RCStore,
 		f.RCStatusStore,
 		f.RollStore,
+		f.RollStatusStore,
 		f.Txner,
 		f.HealthChecker,
 		f.HealthServiceClient,
 		f.Labeler,
+		f.NodeLabeler,
+		f.Scheduler,
+		f.FreezeStore,
 		l,
 		session,
 		f.WatchDelay,
@@ -118,8 +136,11 @@ type RCGetter interface {
 }
 
 type RollingUpdateStore interface {
+	Get(id roll_fields.ID) (roll_fields.Update, error)
 	Watch(quit <-chan struct{}, jitterWindow time.Duration) (<-chan []roll_fields.Update, <-chan error)
 	Delete(ctx context.Context, id roll_fields.ID) error
+	SetTopology(id roll_fields.ID, topology roll_fields.Topology, pause bool) (roll_fields.Update, error)
+	SetBlueGreen(id roll_fields.ID, blueGreen roll_fields.BlueGreen) (roll_fields.Update, error)
 }
 
 // The Farm is responsible for spawning and reaping rolling updates as they are
@@ -132,15 +153,17 @@ type RollingUpdateStore interface {
 // of work or to create test environments. Note that this is _not_ required for RU farms
 // to cooperatively schedule work.
 type Farm struct {
-	factory  Factory
-	store    Store
-	rls      RollingUpdateStore
-	rcs      RCGetter
-	sessions <-chan string
-
-	children map[roll_fields.ID]childRU
-	childMu  sync.Mutex
-	session  consul.Session
+	factory     Factory
+	store       Store
+	rls         RollingUpdateStore
+	rcs         RCGetter
+	freezeStore FreezeStore
+	sessions    <-chan string
+
+	children  map[roll_fields.ID]childRU
+	childMu   sync.Mutex
+	session   consul.Session
+	sessionID string
 
 	logger logging.Logger
 
@@ -150,12 +173,17 @@ type Farm struct {
 	auditLogStore auditlogstore.ConsulStore
 	config        FarmConfig
 	alerter       alerting.Alerter
+	shardChanges  <-chan struct{}
 }
 
 type childRU struct {
 	ru       Update
 	unlocker consul.Unlocker
 	cancel   context.CancelFunc
+
+	// the session that locked the update and when, for introspection
+	session     string
+	lockedSince time.Time
 }
 
 func (c childRU) Cancel() {
@@ -169,6 +197,12 @@ type FarmConfig struct {
 	// log records when deleting a rolling update, which occurs after completing
 	// the RU
 	ShouldCreateAuditLogRecords bool
+
+	// Sharder, if set, splits rolling updates between the farms sharing it.
+	// The farm only locks the updates the sharder assigns to it and releases
+	// updates it no longer owns when farms join or leave. It still watches
+	// every update and skips the ones it doesn't own
+	Sharder shard.Sharder
 }
 
 func NewFarm(
@@ -176,6 +210,7 @@ func NewFarm(
 	store Store,
 	rls RollingUpdateStore,
 	rcs RCGetter,
+	freezeStore FreezeStore,
 	sessions <-chan string,
 	logger logging.Logger,
 	labeler rc.Labeler,
@@ -184,19 +219,26 @@ func NewFarm(
 	config FarmConfig,
 	alerter alerting.Alerter,
 ) *Farm {
+	var shardChanges <-chan struct{}
+	if config.Sharder != nil {
+		shardChanges = config.Sharder.Subscribe()
+	}
+
 	return &Farm{
-		factory:    factory,
-		store:      store,
-		rls:        rls,
-		rcs:        rcs,
-		sessions:   sessions,
-		logger:     logger,
-		children:   make(map[roll_fields.ID]childRU),
-		labeler:    labeler,
-		rcSelector: rcSelector,
-		txner:      txner,
-		config:     config,
-		alerter:    alerter,
+		factory:      factory,
+		store:        store,
+		rls:          rls,
+		rcs:          rcs,
+		freezeStore:  freezeStore,
+		sessions:     sessions,
+		logger:       logger,
+		children:     make(map[roll_fields.ID]childRU),
+		labeler:      labeler,
+		rcSelector:   rcSelector,
+		txner:        txner,
+		config:       config,
+		alerter:      alerter,
+		shardChanges: shardChanges,
 	}
 }
 
@@ -211,6 +253,7 @@ func (rlf *Farm) Start(quit <-chan struct{}) {
 	consulutil.WithSession(quit, rlf.sessions, func(sessionQuit <-chan struct{}, session string) {
 		rlf.logger.WithField("session", session).Infoln("Acquired new session")
 		rlf.session = rlf.store.NewUnmanagedSession(session, "")
+		rlf.sessionID = session
 		rlf.mainLoop(sessionQuit)
 	})
 }
@@ -219,6 +262,9 @@ func (rlf *Farm) mainLoop(quit <-chan struct{}) {
 	subQuit := make(chan struct{})
 	defer close(subQuit)
 	rlWatch, rlErr := rlf.rls.Watch(subQuit, 1*time.Minute)
+	if rlf.config.Sharder != nil {
+		rlWatch = resendOnShardChange(subQuit, rlWatch, rlf.shardChanges)
+	}
 
 START_LOOP:
 	for {
@@ -230,7 +276,13 @@ START_LOOP:
 			return
 		case err := <-rlErr:
 			rlf.logger.WithError(err).Errorln("Could not read consul updates")
-		case rlFields := <-rlWatch:
+		case rlFields, ok := <-rlWatch:
+			if !ok {
+				rlf.logger.NoFields().Errorln("Update watch closed, releasing updates")
+				rlf.session = nil
+				rlf.releaseChildren()
+				return
+			}
 			rlf.logger.WithField("n", len(rlFields)).Debugln("Received update update")
 			countHistogram := metrics.GetOrRegisterHistogram("ru_count", p2metrics.Registry, metrics.NewExpDecaySample(1028, 0.015))
 			countHistogram.Update(int64(len(rlFields)))
@@ -238,6 +290,11 @@ START_LOOP:
 			// track which children were found in the returned set
 			foundChildren := make(map[roll_fields.ID]struct{})
 			for _, rlField := range rlFields {
+				// Updates this farm no longer owns are not found, so they
+				// are released below
+				if !rlf.owns(rlField.ID()) {
+					continue
+				}
 
 				rlLogger := rlf.logger.SubLogger(logrus.Fields{
 					"ru": rlField.ID(),
@@ -255,9 +312,11 @@ START_LOOP:
 				rlLogger = rlLogger.SubLogger(logrus.Fields{
 					"pod": rcField.Manifest.ID(),
 				})
-				if _, ok := rlf.children[rlField.ID()]; ok {
-					// this one is already ours, skip
+				if child, ok := rlf.children[rlField.ID()]; ok {
+					// this one is already ours, pass along any change an
+					// operator made to it
 					rlLogger.NoFields().Debugln("Got update already owned by self")
+					child.ru.Watched(rlField)
 					foundChildren[rlField.ID()] = struct{}{}
 					continue
 				}
@@ -282,6 +341,16 @@ START_LOOP:
 					continue
 				}
 
+				frozen, err := freezeWindow(rlf.freezeStore, rlf.labeler, rlField.NewRC, rcField.Manifest.ID())
+				if err != nil {
+					rlLogger.WithError(err).Errorln("Could not determine if deploys are frozen, skipping")
+					continue
+				}
+				if frozen != nil {
+					rlLogger.WithField("freeze_window", frozen.ID).Infof("Not starting update, %s", frozenReason(frozen))
+					continue
+				}
+
 				lockPath, err := rollstore.RollLockPath(rlField.ID())
 				if err != nil {
 					rlLogger.WithError(err).Errorln("Unable to compute roll lock path")
@@ -308,11 +377,15 @@ START_LOOP:
 
 				newChild := rlf.factory.New(rlField, rlLogger, rlf.session)
 				childCtx, cancel := context.WithCancel(context.Background())
+				rlf.childMu.Lock()
 				rlf.children[rlField.ID()] = childRU{
-					ru:       newChild,
-					unlocker: unlocker,
-					cancel:   cancel,
+					ru:          newChild,
+					unlocker:    unlocker,
+					cancel:      cancel,
+					session:     rlf.sessionID,
+					lockedSince: startTime,
 				}
+				rlf.childMu.Unlock()
 				foundChildren[rlField.ID()] = struct{}{}
 
 				err = rlf.validateRoll(rlField, rlLogger)
@@ -385,6 +458,43 @@ START_LOOP:
 	}
 }
 
+// resendOnShardChange forwards results from the watch and sends the last one
+// again whenever the IDs this farm owns change, so that the farm picks up and
+// releases updates without waiting for the watch to return. The returned
+// channel is closed when the watch is closed.
+func resendOnShardChange(quit <-chan struct{}, watch <-chan []roll_fields.Update, changes <-chan struct{}) <-chan []roll_fields.Update {
+	out := make(chan []roll_fields.Update)
+	go func() {
+		defer close(out)
+
+		var last []roll_fields.Update
+		received := false
+		for {
+			select {
+			case <-quit:
+				return
+			case v, ok := <-watch:
+				if !ok {
+					return
+				}
+				last = v
+				received = true
+			case <-changes:
+				if !received {
+					continue
+				}
+			}
+
+			select {
+			case <-quit:
+				return
+			case out <- last:
+			}
+		}
+	}()
+	return out
+}
+
 func (rlf *Farm) releaseDeletedChildren(foundChildren map[roll_fields.ID]struct{}) {
 	rlf.childMu.Lock()
 	defer rlf.childMu.Unlock()
@@ -396,6 +506,28 @@ func (rlf *Farm) releaseDeletedChildren(foundChildren map[roll_fields.ID]struct{
 	}
 }
 
+// Children returns the updates this farm holds locks for. Updates don't
+// report outcomes; their progress is in the roll status store instead
+func (rlf *Farm) Children() []farmstatus.Child {
+	rlf.childMu.Lock()
+	defer rlf.childMu.Unlock()
+	children := make([]farmstatus.Child, 0, len(rlf.children))
+	for id, child := range rlf.children {
+		children = append(children, farmstatus.Child{
+			ID:          id.String(),
+			Session:     child.session,
+			LockedSince: child.lockedSince,
+		})
+	}
+	return children
+}
+
+// owns returns whether the farm's sharder, if any, assigns the update to this
+// farm
+func (rlf *Farm) owns(id roll_fields.ID) bool {
+	return rlf.config.Sharder == nil || rlf.config.Sharder.Owns(id.String())
+}
+
 // test if the farm should work on the given replication controller ID
 func (rlf *Farm) shouldWorkOn(rcID fields.ID) (bool, error) {
 	if rlf.rcSelector.Empty() {
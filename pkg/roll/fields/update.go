@@ -1,9 +1,14 @@
 package fields
 
 import (
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
 )
 
 type ID string
@@ -52,6 +57,247 @@ type Update struct {
 	// unhealthy after being healthy for a short duration. Naive implementations like
 	// p2-replicate do not handle such after-the-fact unhealthiness. Default is 0.
 	RollDelay time.Duration
+
+	// Stages optionally splits the update into a series of canary stages.
+	// Each stage names a number of new RC replicas, either absolute (e.g.
+	// "1") or as a percentage of DesiredReplicas (e.g. "10%"). The update
+	// will roll until the new RC reaches the current stage and then pause
+	// until an operator promotes it to the next one. An empty list means
+	// the update rolls straight to DesiredReplicas.
+	Stages []Stage
+
+	// PromotedStages is the number of stages that have been promoted by an
+	// operator. It is stored alongside the rest of the update so that a
+	// paused update stays paused if it is handed to a different farm.
+	PromotedStages int
+
+	// RollbackPolicy optionally causes the update to be reversed if the new
+	// RC's pods go unhealthy. When nil, the update never rolls back on its
+	// own and will keep blocking on minimum health instead.
+	RollbackPolicy *RollbackPolicy
+
+	// MaxUnavailable optionally bounds how many of DesiredReplicas may be
+	// unhealthy at once during the update, either as an absolute count or a
+	// percentage of DesiredReplicas (rounded down). When set, the update
+	// keeps at least DesiredReplicas-MaxUnavailable nodes healthy, or
+	// MinimumReplicas if that is larger.
+	MaxUnavailable IntOrPercent
+
+	// MaxSurge optionally allows the old and new RCs to temporarily desire
+	// more than DesiredReplicas nodes between them, either as an absolute
+	// count or a percentage of DesiredReplicas (rounded up). Surge nodes
+	// are scheduled without removing an old node first, and the extra old
+	// nodes are removed once the new ones are healthy.
+	MaxSurge IntOrPercent
+
+	// Topology optionally makes the update roll one failure domain at a
+	// time. When nil, the new RC may schedule nodes anywhere its node
+	// selector allows.
+	Topology *Topology
+
+	// BlueGreen optionally makes the update bring up all DesiredReplicas of
+	// the new RC on nodes the old RC isn't using before cutting over to it
+	// in a single step. When nil, old nodes are replaced a few at a time.
+	BlueGreen *BlueGreen
+
+	// Paused freezes an in-flight update. While set, the farm running the
+	// update will keep its locks but will not change either RC's replica
+	// count, so the update can be resumed later without being recreated.
+	Paused bool
+}
+
+// A RollbackPolicy describes when a rolling update should give up and move
+// all of its replicas back to the old RC.
+type RollbackPolicy struct {
+	// MaxCriticalNodes is the number of nodes running the new RC's pod that
+	// may be critical at once. The update is rolled back as soon as more
+	// than this many new nodes have been critical for CriticalDuration.
+	MaxCriticalNodes int
+
+	// CriticalDuration is how long a new node must continuously report
+	// critical health before it counts against MaxCriticalNodes.
+	CriticalDuration time.Duration
+}
+
+// Topology describes a rolling update that finishes every node sharing one
+// value of a node label (a failure domain, such as an availability zone or
+// rack) before starting on the next. The update pauses between domains until
+// an operator resumes it.
+//
+// Domains are tracked by the nodes the old RC runs on and the new RC is
+// restricted to the domains rolled so far, so this is intended for updates
+// that replace the old pod in place on the same nodes.
+type Topology struct {
+	// Key is the node label key whose values define the failure domains
+	Key string
+
+	// Domain is the value of Key currently being rolled. It is empty until
+	// the update has picked its first domain
+	Domain string
+
+	// Completed lists the domains that have been fully rolled, in order
+	Completed []string
+
+	// NodeSelector is the new RC's node selector from before the update
+	// restricted it to the rolled domains. It is restored once the update
+	// completes
+	NodeSelector string
+}
+
+// BlueGreen describes a rolling update for services that can't run old and new
+// versions side by side. The new RC is scaled to DesiredReplicas on a set of
+// nodes disjoint from the old RC's, and only once every one of them is healthy
+// is the old RC scaled down to zero.
+type BlueGreen struct {
+	// Nodes are the nodes chosen for the new RC. It is empty until the
+	// update has allocated them
+	Nodes []types.NodeName
+
+	// NodeSelector is the new RC's node selector from before the update
+	// restricted it to Nodes. It is restored after the cut over
+	NodeSelector string
+}
+
+// An IntOrPercent is a number of replicas given either as an absolute count
+// like "2" or as a percentage of an update's DesiredReplicas like "25%". The
+// empty IntOrPercent means the value is unset.
+type IntOrPercent string
+
+// ParseIntOrPercent validates a replica count or percentage such as "2" or
+// "25%"
+func ParseIntOrPercent(value string) (IntOrPercent, error) {
+	ret := IntOrPercent(strings.TrimSpace(value))
+	if _, err := ret.Replicas(1, false); err != nil {
+		return "", err
+	}
+	return ret, nil
+}
+
+// Replicas returns the number of replicas this value represents for an update
+// with the given number of desired replicas. Percentages are rounded up if
+// roundUp is true and down otherwise. An unset value is 0.
+func (v IntOrPercent) Replicas(desired int, roundUp bool) (int, error) {
+	str := string(v)
+	if str == "" {
+		return 0, nil
+	}
+
+	if strings.HasSuffix(str, "%") {
+		percent, err := strconv.Atoi(strings.TrimSuffix(str, "%"))
+		if err != nil {
+			return 0, util.Errorf("could not parse %q as a percentage: %s", str, err)
+		}
+		if percent < 0 {
+			return 0, util.Errorf("%q must not be a negative percentage", str)
+		}
+		replicas := float64(desired) * float64(percent) / 100
+		if roundUp {
+			return int(math.Ceil(replicas)), nil
+		}
+		return int(math.Floor(replicas)), nil
+	}
+
+	replicas, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, util.Errorf("could not parse %q as a replica count: %s", str, err)
+	}
+	if replicas < 0 {
+		return 0, util.Errorf("%q must not be a negative replica count", str)
+	}
+	return replicas, nil
+}
+
+// MinimumHealthy returns the number of nodes that must stay healthy for the
+// duration of the update, taking both MinimumReplicas and MaxUnavailable
+// into account.
+func (u Update) MinimumHealthy() (int, error) {
+	if u.MaxUnavailable == "" {
+		return u.MinimumReplicas, nil
+	}
+
+	maxUnavailable, err := u.MaxUnavailable.Replicas(u.DesiredReplicas, false)
+	if err != nil {
+		return 0, err
+	}
+
+	minimum := u.DesiredReplicas - maxUnavailable
+	if minimum < u.MinimumReplicas {
+		minimum = u.MinimumReplicas
+	}
+	return minimum, nil
+}
+
+// SurgeReplicas returns the number of nodes the update may schedule beyond
+// DesiredReplicas
+func (u Update) SurgeReplicas() (int, error) {
+	return u.MaxSurge.Replicas(u.DesiredReplicas, true)
+}
+
+// A Stage is a boundary at which a staged rolling update will pause until it
+// is promoted. It is either an absolute replica count like "3" or a percentage
+// of the update's DesiredReplicas like "50%".
+type Stage string
+
+// ParseStages parses a comma-separated list of stages such as "1,10%,50%,100%"
+func ParseStages(stages string) ([]Stage, error) {
+	if stages == "" {
+		return nil, nil
+	}
+
+	var ret []Stage
+	for _, s := range strings.Split(stages, ",") {
+		stage := Stage(strings.TrimSpace(s))
+		// validate the stage against an arbitrary positive total
+		if _, err := stage.Replicas(1); err != nil {
+			return nil, err
+		}
+		ret = append(ret, stage)
+	}
+	return ret, nil
+}
+
+// Replicas returns the number of new RC replicas this stage represents for
+// an update with the given number of desired replicas. Percentages are
+// rounded up so that a non-zero stage always schedules at least one node.
+func (s Stage) Replicas(desired int) (int, error) {
+	str := string(s)
+	if strings.HasSuffix(str, "%") {
+		percent, err := strconv.Atoi(strings.TrimSuffix(str, "%"))
+		if err != nil {
+			return 0, util.Errorf("could not parse stage %q as a percentage: %s", str, err)
+		}
+		if percent <= 0 || percent > 100 {
+			return 0, util.Errorf("stage %q must be a percentage between 1%% and 100%%", str)
+		}
+		return int(math.Ceil(float64(desired) * float64(percent) / 100)), nil
+	}
+
+	replicas, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, util.Errorf("could not parse stage %q as a replica count: %s", str, err)
+	}
+	if replicas <= 0 {
+		return 0, util.Errorf("stage %q must be a positive replica count", str)
+	}
+	return replicas, nil
+}
+
+// StageTarget returns the number of replicas the new RC should be rolled to
+// before the update pauses for promotion. If every stage has been promoted
+// (or the update has no stages) this is DesiredReplicas.
+func (u Update) StageTarget() (int, error) {
+	if u.PromotedStages >= len(u.Stages) {
+		return u.DesiredReplicas, nil
+	}
+
+	target, err := u.Stages[u.PromotedStages].Replicas(u.DesiredReplicas)
+	if err != nil {
+		return 0, err
+	}
+	if target > u.DesiredReplicas {
+		target = u.DesiredReplicas
+	}
+	return target, nil
 }
 
 // Implementation detail: a rolling updates ID matches that of it's NewRC. We may
@@ -0,0 +1,145 @@
+package fields
+
+import (
+	"testing"
+)
+
+func TestParseStages(t *testing.T) {
+	stages, err := ParseStages("1, 10%,50%,100%")
+	if err != nil {
+		t.Fatalf("unexpected error parsing stages: %s", err)
+	}
+
+	expected := []Stage{"1", "10%", "50%", "100%"}
+	if len(stages) != len(expected) {
+		t.Fatalf("expected %d stages but got %d", len(expected), len(stages))
+	}
+	for i := range expected {
+		if stages[i] != expected[i] {
+			t.Errorf("expected stage %d to be %q but was %q", i, expected[i], stages[i])
+		}
+	}
+
+	stages, err = ParseStages("")
+	if err != nil {
+		t.Fatalf("unexpected error parsing empty stages: %s", err)
+	}
+	if len(stages) != 0 {
+		t.Errorf("expected no stages but got %d", len(stages))
+	}
+}
+
+func TestParseStagesInvalid(t *testing.T) {
+	for _, stages := range []string{"0", "-1", "0%", "101%", "abc", "1,,2", "10%%"} {
+		_, err := ParseStages(stages)
+		if err == nil {
+			t.Errorf("expected an error parsing stages %q", stages)
+		}
+	}
+}
+
+func TestStageReplicas(t *testing.T) {
+	testCases := []struct {
+		stage    Stage
+		desired  int
+		expected int
+	}{
+		{"1", 10, 1},
+		{"3", 10, 3},
+		{"10%", 10, 1},
+		{"10%", 15, 2},
+		{"50%", 9, 5},
+		{"100%", 9, 9},
+	}
+
+	for _, testCase := range testCases {
+		replicas, err := testCase.stage.Replicas(testCase.desired)
+		if err != nil {
+			t.Fatalf("unexpected error computing replicas for stage %q: %s", testCase.stage, err)
+		}
+		if replicas != testCase.expected {
+			t.Errorf("expected stage %q of %d to be %d replicas but was %d", testCase.stage, testCase.desired, testCase.expected, replicas)
+		}
+	}
+}
+
+func TestStageTarget(t *testing.T) {
+	u := Update{
+		DesiredReplicas: 4,
+		Stages:          []Stage{"1", "50%", "10"},
+	}
+
+	for promoted, expected := range []int{1, 2, 4, 4} {
+		u.PromotedStages = promoted
+		target, err := u.StageTarget()
+		if err != nil {
+			t.Fatalf("unexpected error computing stage target: %s", err)
+		}
+		if target != expected {
+			t.Errorf("expected target after %d promotions to be %d but was %d", promoted, expected, target)
+		}
+	}
+}
+
+func TestIntOrPercentReplicas(t *testing.T) {
+	testCases := []struct {
+		value    IntOrPercent
+		desired  int
+		roundUp  bool
+		expected int
+	}{
+		{"", 10, false, 0},
+		{"0", 10, false, 0},
+		{"2", 10, false, 2},
+		{"25%", 10, false, 2},
+		{"25%", 10, true, 3},
+		{"0%", 10, true, 0},
+		{"150%", 10, true, 15},
+	}
+
+	for _, testCase := range testCases {
+		replicas, err := testCase.value.Replicas(testCase.desired, testCase.roundUp)
+		if err != nil {
+			t.Fatalf("unexpected error computing replicas for %q: %s", testCase.value, err)
+		}
+		if replicas != testCase.expected {
+			t.Errorf("expected %q of %d (round up %t) to be %d but was %d", testCase.value, testCase.desired, testCase.roundUp, testCase.expected, replicas)
+		}
+	}
+
+	for _, value := range []string{"-1", "-5%", "abc", "1.5", "%"} {
+		_, err := ParseIntOrPercent(value)
+		if err == nil {
+			t.Errorf("expected an error parsing %q", value)
+		}
+	}
+}
+
+func TestMinimumHealthy(t *testing.T) {
+	u := Update{DesiredReplicas: 10, MinimumReplicas: 3}
+	minimum, err := u.MinimumHealthy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if minimum != 3 {
+		t.Errorf("expected minimum replicas to be used without max unavailable, got %d", minimum)
+	}
+
+	u.MaxUnavailable = "30%"
+	minimum, err = u.MinimumHealthy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if minimum != 7 {
+		t.Errorf("expected 7 nodes to stay healthy with 30%% unavailable, got %d", minimum)
+	}
+
+	u.MaxUnavailable = "9"
+	minimum, err = u.MinimumHealthy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if minimum != 3 {
+		t.Errorf("expected minimum replicas to win over a larger max unavailable, got %d", minimum)
+	}
+}
@@ -0,0 +1,42 @@
+package roll
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/square/p2/pkg/audit"
+	freeze_fields "github.com/square/p2/pkg/freeze/fields"
+	"github.com/square/p2/pkg/labels"
+	rcf "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// FreezeStore lists the deploy freeze windows that rolling updates must
+// respect
+type FreezeStore interface {
+	List() ([]freeze_fields.Window, error)
+}
+
+// freezeWindow returns the deploy freeze window that prevents the given RC
+// from growing, or nil if there isn't one. A nil store never freezes anything.
+func freezeWindow(freezeStore FreezeStore, labeler audit.Labeler, rcID rcf.ID, podID types.PodID) (*freeze_fields.Window, error) {
+	if freezeStore == nil {
+		return nil, nil
+	}
+
+	windows, err := freezeStore.List()
+	if err != nil {
+		return nil, util.Errorf("could not list deploy freeze windows: %s", err)
+	}
+	rcLabels, err := labeler.GetLabels(labels.RC, rcID.String())
+	if err != nil {
+		return nil, err
+	}
+	return freeze_fields.Blocking(windows, time.Now(), rcID, podID, rcLabels.Labels)
+}
+
+// frozenReason describes why a freeze window is holding up an update
+func frozenReason(window *freeze_fields.Window) string {
+	return fmt.Sprintf("deploys are frozen until %s by window %s: %s", window.End.Format(time.RFC3339), window.ID, window.Reason)
+}
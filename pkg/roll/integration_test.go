@@ -296,10 +296,14 @@ func TestLockRCs(t *testing.T) {
 		nil,
 		nil,
 		nil,
+		nil,
 		fixture.Client.KV(),
 		nil,
 		nil,
 		nil,
+		nil,
+		nil,
+		nil,
 		logging.DefaultLogger,
 		session,
 		0,
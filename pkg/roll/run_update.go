@@ -4,12 +4,14 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"reflect"
 	"time"
 
 	"github.com/square/p2/pkg/alerting"
 	"github.com/square/p2/pkg/audit"
 	"github.com/square/p2/pkg/health"
 	hclient "github.com/square/p2/pkg/health/client"
+	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/pods"
@@ -20,13 +22,16 @@ import (
 	"github.com/square/p2/pkg/store/consul/auditlogstore"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/rcstore"
+	"github.com/square/p2/pkg/store/consul/statusstore"
 	"github.com/square/p2/pkg/store/consul/statusstore/rcstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/rollstatus"
 	"github.com/square/p2/pkg/store/consul/transaction"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/hashicorp/consul/api"
+	klabels "k8s.io/kubernetes/pkg/labels"
 )
 
 type Store interface {
@@ -49,9 +54,11 @@ type ReplicationControllerStore interface {
 	SetDesiredReplicas(id rcf.ID, n int) error
 	Delete(id rcf.ID, force bool) error
 	DeleteTxn(ctx context.Context, id rcf.ID, force bool) error
+	InheritHistoryTxn(ctx context.Context, from rcf.ID, to rcf.ID, user string) error
 	TransferReplicaCounts(ctx context.Context, req rcstore.TransferReplicaCountsRequest) error
 	DisableTxn(ctx context.Context, id rcf.ID) error
 	EnableTxn(ctx context.Context, id rcf.ID) error
+	UpdateNodeSelectorTxn(ctx context.Context, id rcf.ID, nodeSelector klabels.Selector) error
 }
 
 type Labeler interface {
@@ -59,6 +66,12 @@ type Labeler interface {
 	audit.Labeler
 }
 
+// A NodeLabeler marks the nodes a blue/green update has chosen for the new RC
+type NodeLabeler interface {
+	SetLabel(labelType labels.Type, id, name, value string) error
+	RemoveLabel(labelType labels.Type, id, name string) error
+}
+
 type ServiceWatcher interface {
 	WatchService(
 		ctx context.Context,
@@ -83,16 +96,20 @@ type ServiceWatcher interface {
 type update struct {
 	fields.Update
 
-	consuls       Store
-	consulClient  consulutil.ConsulClient
-	rcStore       ReplicationControllerStore
-	rcStatusStore RCStatusStore
-	rollStore     RollingUpdateStore
-	rcLocker      ReplicationControllerLocker
-	hcheck        ServiceWatcher
-	hclient       hclient.HealthServiceClient
-	labeler       Labeler
-	txner         transaction.Txner
+	consuls         Store
+	consulClient    consulutil.ConsulClient
+	rcStore         ReplicationControllerStore
+	rcStatusStore   RCStatusStore
+	rollStore       RollingUpdateStore
+	rollStatusStore RollStatusStore
+	rcLocker        ReplicationControllerLocker
+	hcheck          ServiceWatcher
+	hclient         hclient.HealthServiceClient
+	labeler         Labeler
+	nodeLabeler     NodeLabeler
+	scheduler       rc.Scheduler
+	freezeStore     FreezeStore
+	txner           transaction.Txner
 
 	logger logging.Logger
 
@@ -110,12 +127,45 @@ type update struct {
 	// to signify that the rolling update was successful
 	shouldCreateAuditLogRecords bool
 	auditLogStore               auditlogstore.ConsulStore
+
+	// criticalSince tracks when each node running the new RC's pod was
+	// first seen to be critical. It is only used if the update has a
+	// RollbackPolicy
+	criticalSince map[types.NodeName]time.Time
+
+	// status is the progress record most recently written to the
+	// rollStatusStore
+	status rollstatus.Status
+
+	// nodeIDsCh tells the health watch about nodes a blue/green update
+	// has allocated for the new RC so they are checked right away
+	nodeIDsCh chan<- []types.NodeName
+
+	// watched receives the stored update each time the farm's watch
+	// returns it, and stored is the last one Run has taken from it
+	watched chan fields.Update
+	stored  fields.Update
+
+	// leftoverSince is when the update first saw the new RC desire every
+	// node while the old RC still desired some
+	leftoverSince time.Time
+
+	// domainTarget is the number of replicas the new RC may be rolled to
+	// before the current failure domain is finished. It is only used if
+	// the update has a Topology
+	domainTarget int
 }
 
 type RCStatusStore interface {
 	Get(rcID rcf.ID) (rcstatus.Status, *api.QueryMeta, error)
 }
 
+type RollStatusStore interface {
+	Get(id fields.ID) (rollstatus.Status, *api.QueryMeta, error)
+	Set(id fields.ID, status rollstatus.Status) error
+	DeleteTxn(ctx context.Context, id fields.ID) error
+}
+
 // Create a new Update. The consul.Store, rcstore.Store, and labels.Applicator
 // arguments should be the same as those of the RCs themselves. The
 // session must be valid for the lifetime of the Update; maintaining this is the
@@ -128,10 +178,14 @@ func NewUpdate(
 	rcStore ReplicationControllerStore,
 	rcStatusStore RCStatusStore,
 	rollStore RollingUpdateStore,
+	rollStatusStore RollStatusStore,
 	txner transaction.Txner,
 	hcheck ServiceWatcher,
 	hclient hclient.HealthServiceClient,
 	labeler Labeler,
+	nodeLabeler NodeLabeler,
+	scheduler rc.Scheduler,
+	freezeStore FreezeStore,
 	logger logging.Logger,
 	session consul.Session,
 	watchDelay time.Duration,
@@ -145,15 +199,21 @@ func NewUpdate(
 	})
 	return &update{
 		Update:                      f,
+		watched:                     make(chan fields.Update, 1),
+		stored:                      f,
 		consuls:                     consuls,
 		rcLocker:                    rcLocker,
 		rcStore:                     rcStore,
 		rcStatusStore:               rcStatusStore,
 		rollStore:                   rollStore,
+		rollStatusStore:             rollStatusStore,
 		txner:                       txner,
 		hcheck:                      hcheck,
 		hclient:                     hclient,
 		labeler:                     labeler,
+		nodeLabeler:                 nodeLabeler,
+		scheduler:                   scheduler,
+		freezeStore:                 freezeStore,
 		logger:                      logger,
 		watchDelay:                  watchDelay,
 		alerter:                     alerter,
@@ -175,6 +235,10 @@ type Update interface {
 	// if the update completed (true) or if it was terminated early
 	// (false).
 	Run(ctx context.Context) bool
+
+	// Watched is called with the stored update each time the farm's watch
+	// returns it, so that Run picks up an operator pausing or resuming it
+	Watched(stored fields.Update)
 }
 
 // returned by shouldStop
@@ -184,6 +248,7 @@ const (
 	ruShouldTerminate ruStep = iota
 	ruShouldBlock
 	ruShouldContinue
+	ruShouldAwaitPromotion
 )
 
 // retries a given function until it returns a nil error or the quit channel is
@@ -373,6 +438,9 @@ func (u *update) Run(ctx context.Context) (ret bool) {
 		}
 	}()
 
+	u.initStatus()
+	u.nodeIDsCh = nodeIDsCh
+
 	if updateSucceeded := u.rollLoop(checkRCLocksCtx, newFields.Manifest.ID(), hChecks, hErrs, useHealthService, statusStanza); !updateSucceeded {
 		// We were asked to quit. Do so without cleaning old RC.
 		return false
@@ -400,6 +468,20 @@ func (u *update) Run(ctx context.Context) (ret bool) {
 		return false
 	}
 
+	if u.rollStatusStore != nil {
+		err = u.rollStatusStore.DeleteTxn(cleanupCtx, u.ID())
+		if err != nil {
+			u.logger.WithError(err).Errorln("could not construct transaction to delete RU status")
+			u.mustAlert(
+				context.Background(),
+				"could not build RU status deletion transaction",
+				"ru-deletion-txn"+u.ID().String(),
+				err,
+			)
+			return false
+		}
+	}
+
 	if u.shouldCreateAuditLogRecords {
 		succeeded := true
 		canceled := false
@@ -500,7 +582,12 @@ func (u *update) cleanupOldRC(ctx context.Context) bool {
 		return false
 	}
 
-	err := u.rcStore.DeleteTxn(ctx, u.OldRC, false)
+	// carry the old RC's manifest history over to the new RC so the update
+	// can be rolled back after the old RC is gone
+	err := u.rcStore.InheritHistoryTxn(ctx, u.OldRC, u.NewRC, "rolling-update:"+u.ID().String())
+	if err == nil {
+		err = u.rcStore.DeleteTxn(ctx, u.OldRC, false)
+	}
 	if err != nil {
 		alertContext, cancel := context.WithCancel(context.Background())
 		defer cancel()
@@ -549,6 +636,13 @@ func (u *update) rollLoop(ctx context.Context, podID types.PodID, hChecks <-chan
 		case err := <-hErrs:
 			u.logger.WithError(err).Errorln("Could not read health checks")
 		case checks := <-hChecks:
+			u.refreshPaused()
+			if u.Paused {
+				u.logger.NoFields().Debugln("Update is paused, waiting for it to be resumed")
+				u.publishStatus(rollstatus.PhasePaused, u.pausedReason())
+				break
+			}
+
 			newNodes, err := u.countHealthy(u.NewRC, checks)
 			if err != nil {
 				u.logger.WithErrorAndFields(err, logrus.Fields{
@@ -564,7 +658,67 @@ func (u *update) rollLoop(ctx context.Context, podID types.PodID, hChecks <-chan
 				break
 			}
 
-			if nextAction := u.shouldStop(oldNodes, newNodes); nextAction == ruShouldTerminate {
+			u.status.OldRC = oldNodes.toStatus()
+			u.status.NewRC = newNodes.toStatus()
+
+			if newNodes.Desired < u.DesiredReplicas {
+				// the new RC won't add pods while it's frozen, so don't
+				// remove any old ones either
+				frozen, err := freezeWindow(u.freezeStore, u.labeler, u.NewRC, podID)
+				if err != nil {
+					u.logger.WithError(err).Errorln("Could not determine if deploys are frozen")
+					u.publishStatus(rollstatus.PhaseBlocked, err.Error())
+					break
+				}
+				if frozen != nil {
+					u.logger.WithField("freeze_window", frozen.ID).Debugln("Update is frozen")
+					u.publishStatus(rollstatus.PhaseBlocked, frozenReason(frozen))
+					break
+				}
+			}
+
+			if u.BlueGreen != nil {
+				done, blockedReason, err := u.blueGreenStep(ctx, oldNodes, newNodes)
+				switch {
+				case err != nil:
+					u.logger.WithError(err).Errorln("Could not perform blue/green update step")
+					u.publishStatus(rollstatus.PhaseBlocked, err.Error())
+				case done:
+					u.logger.WithFields(logrus.Fields{
+						"old": oldNodes.ToString(),
+						"new": newNodes.ToString(),
+					}).Debugln("Upgrade complete")
+					return true
+				case blockedReason != "":
+					u.publishStatus(rollstatus.PhaseBlocked, blockedReason)
+				default:
+					u.publishStatus(rollstatus.PhaseRolling, "")
+				}
+				break
+			}
+
+			nextAction := u.shouldStop(oldNodes, newNodes)
+			if nextAction != ruShouldTerminate && u.RollbackPolicy != nil {
+				rolledBack, err := u.checkRollback(ctx, checks, oldNodes, newNodes)
+				if err != nil {
+					u.logger.WithError(err).Errorln("Could not determine whether to roll back update")
+					break
+				}
+				if rolledBack {
+					// The RU has been deleted, so there's nothing
+					// left to do
+					return false
+				}
+			}
+
+			if nextAction == ruShouldTerminate {
+				if u.Topology != nil {
+					err = u.restoreNodeSelector(ctx)
+					if err != nil {
+						u.logger.WithError(err).Errorln("Could not restore node selector of new RC")
+						break
+					}
+				}
 				u.logger.WithFields(logrus.Fields{
 					"old": oldNodes.ToString(),
 					"new": newNodes.ToString(),
@@ -575,9 +729,39 @@ func (u *update) rollLoop(ctx context.Context, podID types.PodID, hChecks <-chan
 					"old": oldNodes.ToString(),
 					"new": newNodes.ToString(),
 				}).Debugln("Upgrade almost complete, blocking for more healthy new nodes")
+				u.publishStatus(rollstatus.PhaseBlocked, "waiting for new nodes to become healthy")
+				break
+			} else if nextAction == ruShouldAwaitPromotion {
+				u.logger.WithFields(logrus.Fields{
+					"old":   oldNodes.ToString(),
+					"new":   newNodes.ToString(),
+					"stage": u.PromotedStages,
+				}).Debugln("Stage complete, waiting for the update to be promoted")
+				u.publishStatus(rollstatus.PhaseAwaitingPromotion, fmt.Sprintf("waiting for stage %d to be promoted", u.PromotedStages+1))
+				err = u.refreshPromotion()
+				if err != nil {
+					u.logger.WithError(err).Errorln("Could not check whether the update has been promoted")
+				}
 				break
 			}
 
+			if u.Topology != nil {
+				blockedReason, err := u.advanceTopology(ctx, checks, newNodes)
+				if err != nil {
+					u.logger.WithError(err).Errorln("Could not determine progress through failure domains")
+					u.publishStatus(rollstatus.PhaseBlocked, err.Error())
+					break
+				}
+				if u.Paused {
+					u.publishStatus(rollstatus.PhasePaused, u.pausedReason())
+					break
+				}
+				if blockedReason != "" {
+					u.publishStatus(rollstatus.PhaseBlocked, blockedReason)
+					break
+				}
+			}
+
 			nextRemove, nextAdd := rollAlgorithm(u.rollAlgorithmParams(oldNodes, newNodes))
 			if nextRemove > 0 || nextAdd > 0 {
 				// apply the delay only if we've already added to the new RC, since there's
@@ -591,6 +775,13 @@ func (u *update) rollLoop(ctx context.Context, podID types.PodID, hChecks <-chan
 						return false
 					}
 
+					// an operator may have paused the update during the delay
+					u.refreshPaused()
+					if u.Paused {
+						u.publishStatus(rollstatus.PhasePaused, u.pausedReason())
+						break
+					}
+
 					// determine the new value of `next`, which may have changed
 					// following the delay.
 					nextRemove, nextAdd, err = u.shouldRollAfterDelay(podID, useHealthService, manifestStatus)
@@ -646,11 +837,18 @@ func (u *update) rollLoop(ctx context.Context, podID types.PodID, hChecks <-chan
 					break
 				}
 				cancel()
+
+				u.status.LastStep = rollstatus.Step{
+					NodesToAdd:    nextAdd,
+					NodesToRemove: nextRemove,
+				}
+				u.publishStatus(rollstatus.PhaseRolling, "")
 			} else {
 				u.logger.WithFields(logrus.Fields{
 					"old": oldNodes.ToString(),
 					"new": newNodes.ToString(),
 				}).Debugln("Blocking for more healthy nodes")
+				u.publishStatus(rollstatus.PhaseBlocked, "minimum health not satisfied")
 			}
 		}
 	}
@@ -658,12 +856,35 @@ func (u *update) rollLoop(ctx context.Context, podID types.PodID, hChecks <-chan
 
 func (u *update) shouldStop(oldNodes, newNodes rcNodeCounts) ruStep {
 	if newNodes.Desired < u.DesiredReplicas {
+		if newNodes.Desired >= u.stageTarget() {
+			// The current stage of a staged update has been scheduled.
+			// An operator has to promote the update before it can
+			// continue.
+			return ruShouldAwaitPromotion
+		}
 		// Not enough nodes scheduled on the new side, so deploy should continue.
 		return ruShouldContinue
 	}
 
 	// Enough nodes are scheduled on the new side.
 
+	if !u.LeaveOld && oldNodes.Desired > 0 {
+		// The old RC still desires nodes, for example ones that were
+		// kept around during a surge. rollAlgorithm removes them, and
+		// the old RC can't be deleted until it has none left. If that
+		// takes too long, terminate anyway so that cleanupOldRC alerts
+		// about the old RC's replica count.
+		if u.leftoverSince.IsZero() {
+			u.leftoverSince = time.Now()
+		}
+		if time.Since(u.leftoverSince) < leftoverOldNodesTimeout {
+			return ruShouldContinue
+		}
+		u.logger.Warnf("Old RC still desires %d nodes after %s, not waiting any longer", oldNodes.Desired, leftoverOldNodesTimeout)
+	} else {
+		u.leftoverSince = time.Time{}
+	}
+
 	if newNodes.Current >= u.DesiredReplicas {
 		// We only ask for the new RC to have labeled the desired number of nodes
 		// (number of nodes labeled is reflected in newNodes.Current)
@@ -683,6 +904,366 @@ func (u *update) shouldStop(oldNodes, newNodes rcNodeCounts) ruStep {
 	return ruShouldBlock
 }
 
+// checkRollback decides whether the update's RollbackPolicy has been
+// violated and if so rolls the update back. It returns true if the rollback
+// was performed, in which case the RU no longer exists.
+func (u *update) checkRollback(ctx context.Context, checks map[types.NodeName]health.Result, oldNodes, newNodes rcNodeCounts) (bool, error) {
+	critical, err := u.criticalNewNodes(checks)
+	if err != nil {
+		return false, err
+	}
+
+	criticalTooLong := u.nodesCriticalTooLong(critical, time.Now())
+	if len(criticalTooLong) <= u.RollbackPolicy.MaxCriticalNodes {
+		return false, nil
+	}
+
+	u.logger.WithFields(logrus.Fields{
+		"old":            oldNodes.ToString(),
+		"new":            newNodes.ToString(),
+		"critical_nodes": criticalTooLong,
+	}).Warnf("%d new nodes have been critical for at least %s, rolling back", len(criticalTooLong), u.RollbackPolicy.CriticalDuration)
+
+	err = u.rollback(ctx, oldNodes, newNodes, criticalTooLong)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// criticalNewNodes returns the nodes on which the new RC's pod has been
+// installed and is reporting critical health.
+func (u *update) criticalNewNodes(checks map[types.NodeName]health.Result) ([]types.NodeName, error) {
+	rcFields, err := u.rcStore.Get(u.NewRC)
+	if err != nil {
+		return nil, err
+	}
+	targetSHA, _ := rcFields.Manifest.SHA()
+
+	currentPods, err := rc.CurrentPods(u.NewRC, u.labeler)
+	if err != nil {
+		return nil, err
+	}
+
+	var critical []types.NodeName
+	for _, pod := range currentPods {
+		if hres, ok := checks[pod.Node]; !ok || hres.Status != health.Critical {
+			continue
+		}
+
+		realManifest, _, err := u.consuls.Pod(consul.REALITY_TREE, pod.Node, rcFields.Manifest.ID())
+		if err != nil && err != pods.NoCurrentManifest {
+			return nil, err
+		}
+		if realManifest == nil {
+			// the new pod hasn't been installed yet, so the
+			// critical health must belong to something else
+			continue
+		}
+		if realSHA, _ := realManifest.SHA(); realSHA != targetSHA {
+			continue
+		}
+		critical = append(critical, pod.Node)
+	}
+	return critical, nil
+}
+
+// nodesCriticalTooLong records when each of the passed critical nodes first
+// became critical, forgets nodes that have recovered, and returns the nodes
+// that have been critical for at least the RollbackPolicy's CriticalDuration.
+func (u *update) nodesCriticalTooLong(critical []types.NodeName, now time.Time) []types.NodeName {
+	if u.criticalSince == nil {
+		u.criticalSince = make(map[types.NodeName]time.Time)
+	}
+
+	stillCritical := make(map[types.NodeName]struct{})
+	for _, node := range critical {
+		stillCritical[node] = struct{}{}
+		if _, ok := u.criticalSince[node]; !ok {
+			u.criticalSince[node] = now
+		}
+	}
+
+	for node := range u.criticalSince {
+		if _, ok := stillCritical[node]; !ok {
+			delete(u.criticalSince, node)
+		}
+	}
+
+	var ret []types.NodeName
+	for _, node := range critical {
+		if now.Sub(u.criticalSince[node]) >= u.RollbackPolicy.CriticalDuration {
+			ret = append(ret, node)
+		}
+	}
+	return ret
+}
+
+// originalNewRCSelector returns the node selector the new RC had before a
+// topology-aware or blue/green update restricted it, or nil if the update
+// hasn't restricted the new RC.
+func (u *update) originalNewRCSelector() (klabels.Selector, error) {
+	var original string
+	switch {
+	case u.Topology != nil && (u.Topology.Domain != "" || len(u.Topology.Completed) > 0):
+		original = u.Topology.NodeSelector
+	case u.BlueGreen != nil && len(u.BlueGreen.Nodes) > 0:
+		original = u.BlueGreen.NodeSelector
+	default:
+		return nil, nil
+	}
+
+	selector, err := klabels.Parse(original)
+	if err != nil {
+		return nil, util.Errorf("could not parse original node selector of RC %s: %s", u.NewRC, err)
+	}
+	return selector, nil
+}
+
+// leftoverOldNodesTimeout bounds how long an update that has scheduled every
+// new node waits for the old RC to stop desiring nodes
+const leftoverOldNodesTimeout = 10 * time.Minute
+
+// rollbackAlertTimeout bounds how long a rollback keeps retrying its alert
+// after the RU has already been deleted.
+const rollbackAlertTimeout = 5 * time.Minute
+
+// rollback moves every replica of the new RC back to the old RC, re-enables
+// the old RC, gives the new RC back any node selector the update restricted
+// and deletes the RU. It is performed in two transactions because
+// both the replica transfer and enabling the old RC need to check-and-set the
+// old RC. If only the first succeeds, the RU still exists and will be resumed
+// by whichever farm picks it up next.
+func (u *update) rollback(ctx context.Context, oldNodes, newNodes rcNodeCounts, criticalNodes []types.NodeName) error {
+	replicasToReturn := newNodes.Desired
+	if replicasToReturn > 0 {
+		transferReq := rcstore.TransferReplicaCountsRequest{
+			ToRCID:               u.OldRC,
+			FromRCID:             u.NewRC,
+			ReplicasToAdd:        &replicasToReturn,
+			ReplicasToRemove:     &replicasToReturn,
+			StartingToReplicas:   &oldNodes.Desired,
+			StartingFromReplicas: &newNodes.Desired,
+		}
+
+		transferCtx, cancel := transaction.New(ctx)
+		defer cancel()
+		err := u.rcStore.TransferReplicaCounts(transferCtx, transferReq)
+		if err != nil {
+			return util.Errorf("could not build replica transfer for rollback: %s", err)
+		}
+
+		err = transaction.MustCommit(transferCtx, u.txner)
+		if err != nil {
+			return util.Errorf("could not transfer replicas back to old RC: %s", err)
+		}
+	}
+
+	finishCtx, cancel := transaction.New(ctx)
+	defer cancel()
+	err := u.rcStore.EnableTxn(finishCtx, u.OldRC)
+	if err != nil {
+		return err
+	}
+
+	originalSelector, err := u.originalNewRCSelector()
+	if err != nil {
+		return err
+	}
+	if originalSelector != nil {
+		err = u.rcStore.UpdateNodeSelectorTxn(finishCtx, u.NewRC, originalSelector)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = u.rollStore.Delete(finishCtx, u.ID())
+	if err != nil {
+		return err
+	}
+
+	if u.rollStatusStore != nil {
+		err = u.rollStatusStore.DeleteTxn(finishCtx, u.ID())
+		if err != nil {
+			return err
+		}
+	}
+
+	if u.shouldCreateAuditLogRecords {
+		details, err := audit.NewRURollbackEventDetails(u.ID(), u.OldRC, u.NewRC, replicasToReturn, criticalNodes, u.labeler)
+		if err != nil {
+			return err
+		}
+
+		err = u.auditLogStore.Create(finishCtx, audit.RURollbackEvent, details)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = transaction.MustCommit(finishCtx, u.txner)
+	if err != nil {
+		return util.Errorf("could not enable old RC and delete RU after rollback: %s", err)
+	}
+
+	if u.BlueGreen != nil && u.nodeLabeler != nil {
+		for _, node := range u.BlueGreen.Nodes {
+			err = u.nodeLabeler.RemoveLabel(labels.NODE, node.String(), BlueGreenLabel)
+			if err != nil {
+				// the RU is already gone so nothing would retry this. a
+				// stale label is harmless once the selector is restored
+				u.logger.WithError(err).Errorf("could not remove blue/green label from node %s after rollback", node)
+			}
+		}
+	}
+
+	f := func() error {
+		return u.alerter.Alert(alerting.AlertInfo{
+			Description: fmt.Sprintf("rolling update %s was rolled back because %d new nodes were critical", u.ID(), len(criticalNodes)),
+			IncidentKey: "roll-rollback-" + u.ID().String(),
+			Details: struct {
+				RUID          string           `json:"ru_id"`
+				OldRCID       string           `json:"old_rc_id"`
+				NewRCID       string           `json:"new_rc_id"`
+				CriticalNodes []types.NodeName `json:"critical_nodes"`
+			}{
+				RUID:          u.ID().String(),
+				OldRCID:       u.OldRC.String(),
+				NewRCID:       u.NewRC.String(),
+				CriticalNodes: criticalNodes,
+			},
+		}, alerting.HighUrgency)
+	}
+	// use a fresh context because the farm will cancel ours as soon as it
+	// notices the RU is gone, and the rollback must not go unnoticed. it is
+	// bounded so that an unreachable alerter can't wedge the farm forever.
+	alertCtx, alertCancel := context.WithTimeout(context.Background(), rollbackAlertTimeout)
+	defer alertCancel()
+	if !RetryOrQuit(alertCtx, f, u.logger, "could not send rollback alert") {
+		u.logger.Errorf("gave up sending rollback alert after %s", rollbackAlertTimeout)
+	}
+	return nil
+}
+
+// stageTarget returns the number of replicas the new RC may be rolled to
+// before the update must pause for promotion. If the current stage cannot be
+// parsed, 0 is returned so that the update doesn't roll any further than it
+// already has.
+func (u *update) stageTarget() int {
+	target, err := u.StageTarget()
+	if err != nil {
+		u.logger.WithError(err).Errorln("Could not compute target for current stage")
+		return 0
+	}
+	return target
+}
+
+// refreshPromotion re-reads the stored update to see if an operator has
+// promoted it past the stage it is currently paused at.
+func (u *update) refreshPromotion() error {
+	stored, err := u.rollStore.Get(u.ID())
+	if err != nil {
+		return err
+	}
+
+	if stored.PromotedStages > u.PromotedStages {
+		u.logger.WithFields(logrus.Fields{
+			"old_stage": u.PromotedStages,
+			"new_stage": stored.PromotedStages,
+		}).Infoln("Update was promoted, continuing to next stage")
+		u.PromotedStages = stored.PromotedStages
+	}
+	return nil
+}
+
+// initStatus seeds the progress record for the update. If another farm
+// already ran part of this update its start time is carried over.
+func (u *update) initStatus() {
+	if u.rollStatusStore == nil {
+		return
+	}
+
+	existing, _, err := u.rollStatusStore.Get(u.ID())
+	switch {
+	case err == nil:
+		u.status = existing
+	case statusstore.IsNoStatus(err):
+	default:
+		u.logger.WithError(err).Errorln("could not read existing RU status")
+	}
+
+	if u.status.StartTime.IsZero() {
+		u.status.StartTime = time.Now()
+	}
+}
+
+// publishStatus records the update's progress in the roll status store so
+// that it can be inspected from outside the farm. The write is skipped if
+// nothing has changed since the last one.
+func (u *update) publishStatus(phase rollstatus.Phase, blockedReason string) {
+	if u.rollStatusStore == nil {
+		return
+	}
+
+	next := u.status
+	next.Phase = phase
+	next.BlockedReason = blockedReason
+	if phase == rollstatus.PhaseRolling {
+		next.BlockedSince = nil
+	} else if phase != u.status.Phase || blockedReason != u.status.BlockedReason || u.status.BlockedSince == nil {
+		now := time.Now()
+		next.BlockedSince = &now
+	}
+
+	if reflect.DeepEqual(next, u.status) {
+		return
+	}
+
+	err := u.rollStatusStore.Set(u.ID(), next)
+	if err != nil {
+		// not fatal, the next health check will try again
+		u.logger.WithError(err).Errorln("could not write RU status")
+		return
+	}
+	u.status = next
+}
+
+// Watched hands the stored update to refreshPaused. Only the farm's watch
+// calls it, so once an update Run hasn't taken yet is dropped there is room
+// for the new one.
+func (u *update) Watched(stored fields.Update) {
+	select {
+	case <-u.watched:
+	default:
+	}
+	u.watched <- stored
+}
+
+// refreshPaused checks the stored update the farm's watch last returned to
+// see if an operator has paused or resumed it.
+func (u *update) refreshPaused() {
+	select {
+	case u.stored = <-u.watched:
+	default:
+	}
+	stored := u.stored
+
+	// The watch may still return the update from before it paused itself
+	// to move to the next failure domain, which must not resume it
+	if u.Topology != nil && !reflect.DeepEqual(stored.Topology, u.Topology) {
+		return
+	}
+
+	if stored.Paused != u.Paused {
+		if stored.Paused {
+			u.logger.NoFields().Infoln("Update was paused")
+		} else {
+			u.logger.NoFields().Infoln("Update was resumed, continuing")
+		}
+		u.Paused = stored.Paused
+	}
+}
+
 func (u *update) lockRCs(
 	lockCtx context.Context,
 	unlockCtx context.Context,
@@ -816,19 +1397,49 @@ func (r rcNodeCounts) ToString() string {
 	return fmt.Sprintf("%+v", r)
 }
 
+func (r rcNodeCounts) toStatus() rollstatus.NodeCounts {
+	return rollstatus.NodeCounts{
+		Desired:   r.Desired,
+		Current:   r.Current,
+		Real:      r.Real,
+		Healthy:   r.Healthy,
+		Unhealthy: r.Unhealthy,
+		Unknown:   r.Unknown,
+	}
+}
+
 func (u *update) countHealthy(id rcf.ID, checks map[types.NodeName]health.Result) (rcNodeCounts, error) {
-	ret := rcNodeCounts{}
 	rcFields, err := u.rcStore.Get(id)
 	if rcstore.IsNotExist(err) {
 		err := util.Errorf("RC %s did not exist", id)
-		return ret, err
+		return rcNodeCounts{}, err
 	} else if err != nil {
-		return ret, err
+		return rcNodeCounts{}, err
 	}
+	return countNodes(rcFields, u.labeler, u.consuls, checks)
+}
 
+// A RealityGetter reads the manifest a node is running for a pod
+type RealityGetter interface {
+	Pod(podPrefix consul.PodPrefix, nodename types.NodeName, podId types.PodID) (manifest.Manifest, time.Duration, error)
+}
+
+// CountHealthyNodes returns the number of nodes the given RC has scheduled
+// itself on that run its manifest and pass their health checks, counted the
+// same way rolling updates count them
+func CountHealthyNodes(rcFields rcf.RC, labeler rc.LabelMatcher, reality RealityGetter, checks map[types.NodeName]health.Result) (int, error) {
+	counts, err := countNodes(rcFields, labeler, reality, checks)
+	if err != nil {
+		return 0, err
+	}
+	return counts.Healthy, nil
+}
+
+func countNodes(rcFields rcf.RC, labeler rc.LabelMatcher, reality RealityGetter, checks map[types.NodeName]health.Result) (rcNodeCounts, error) {
+	ret := rcNodeCounts{}
 	ret.Desired = rcFields.ReplicasDesired
 
-	currentPods, err := rc.CurrentPods(id, u.labeler)
+	currentPods, err := rc.CurrentPods(rcFields.ID, labeler)
 	if err != nil {
 		return ret, err
 	}
@@ -844,7 +1455,7 @@ func (u *update) countHealthy(id rcf.ID, checks map[types.NodeName]health.Result
 	for _, pod := range currentPods {
 		node := pod.Node
 		// TODO: is reality checking an rc-layer concern?
-		realManifest, _, err := u.consuls.Pod(consul.REALITY_TREE, node, rcFields.Manifest.ID())
+		realManifest, _, err := reality.Pod(consul.REALITY_TREE, node, rcFields.Manifest.ID())
 		if err != nil && err != pods.NoCurrentManifest {
 			return ret, err
 		}
@@ -893,6 +1504,14 @@ func (u *update) currentNodeIDs() ([]types.NodeName, error) {
 	for i, _ := range currentPods {
 		nodeIDs[i] = currentPods[i].Node
 	}
+	if u.BlueGreen != nil {
+		// the new RC may not have scheduled onto all of its nodes yet
+		nodeSet := types.NewNodeSet(nodeIDs...)
+		for _, node := range u.BlueGreen.Nodes {
+			nodeSet.InsertNode(node)
+		}
+		nodeIDs = nodeSet.ListNodes()
+	}
 	return nodeIDs, nil
 }
 
@@ -927,7 +1546,7 @@ func (u *update) shouldRollAfterDelay(podID types.PodID, useHealthService bool,
 	return afterDelayRemove, afterDelayAdd, nil
 }
 
-func (u *update) rollAlgorithmParams(oldHealth, newHealth rcNodeCounts) (oldHealthy, newHealthy, oldDesired, newDesired, targetDesired, minHealthy int) {
+func (u *update) rollAlgorithmParams(oldHealth, newHealth rcNodeCounts) (oldHealthy, newHealthy, oldDesired, newDesired, targetDesired, minHealthy, maxSurge int) {
 	oldHealthy = oldHealth.Healthy
 	if oldHealth.Desired < oldHealthy {
 		// Because of the non-atomicity of our KV stores,
@@ -943,8 +1562,23 @@ func (u *update) rollAlgorithmParams(oldHealth, newHealth rcNodeCounts) (oldHeal
 	newHealthy = newHealth.Healthy
 	oldDesired = oldHealth.Desired
 	newDesired = newHealth.Desired
-	targetDesired = u.DesiredReplicas
-	minHealthy = u.MinimumReplicas
+	targetDesired = u.topologyTarget(u.stageTarget())
+	// Replicas that later stages (or failure domains) will move stay on the old RC, so leave them
+	// out of its desire. That way any capacity change is measured against
+	// DesiredReplicas rather than the current stage.
+	oldDesired -= u.DesiredReplicas - targetDesired
+	minHealthy, err := u.MinimumHealthy()
+	if err != nil {
+		// MaxUnavailable is validated when the update is scheduled so this
+		// shouldn't happen. Be conservative and allow no unavailability
+		u.logger.WithError(err).Errorln("could not compute minimum healthy nodes")
+		minHealthy = u.DesiredReplicas
+	}
+	maxSurge, err = u.SurgeReplicas()
+	if err != nil {
+		u.logger.WithError(err).Errorln("could not compute surge nodes")
+		maxSurge = 0
+	}
 	return
 }
 
@@ -972,14 +1606,15 @@ func (u *update) mustAlert(ctx context.Context, description string, incidentKey
 	}
 }
 
-// the roll algorithm defines how to mutate RCs over time. it takes six args:
+// the roll algorithm defines how to mutate RCs over time. it takes seven args:
 // - old: the number of healthy nodes on the old RC
 // - new: the number of healthy nodes on the new RC
 // - oldDesired: the number of nodes currently desired by the old RC
 // - newDesired: the number of nodes currently desired by the new RC
 // - targetDesired: the number of nodes desired on the new RC (ie the target) in the final state
 // - minHealthy: the number of nodes that must always be up (ie the minimum)
-// given these five arguments, rollAlgorithm returns the number of nodes to add
+// - maxSurge: the number of nodes the two RCs may desire beyond targetDesired
+// given these seven arguments, rollAlgorithm returns the number of nodes to add
 // to the new RC and to delete from the old
 //
 // Returns two values, both of which are a positive number or zero:
@@ -987,16 +1622,72 @@ func (u *update) mustAlert(ctx context.Context, description string, incidentKey
 // The second value indicates how many nodes to add to the old RC.
 //
 // Under the following circumstances, both return values will be zero:
-// - new >= desired (the update is done)
+// - new >= desired and the old RC desires no nodes (the update is done)
 // - old+new <= minHealthy (at or below the minimum, update has to block)
-func rollAlgorithm(old, new, oldDesired, newDesired, targetDesired, minHealthy int) (nodesToRemove, nodesToAdd int) {
+//
+// Once new >= desired, any nodes the old RC still desires are removed without
+// adding new ones, as long as doing so doesn't go below the minimum.
+//
+// If the two RCs together desire more nodes than targetDesired (a capacity
+// decrease, or nodes added during a surge), the extra old nodes are removed
+// first, without adding any new ones. Extra old nodes are only removed while
+// doing so leaves enough headroom to keep replacing nodes; any that can't be
+// removed yet are kept around as a buffer and the update proceeds one-for-one.
+func rollAlgorithm(old, new, oldDesired, newDesired, targetDesired, minHealthy, maxSurge int) (nodesToRemove, nodesToAdd int) {
 	// how much "headroom" do we have between the number of nodes that are
 	// currently healthy, and the number that must be healthy?
 	// if we schedule more than this, we'll go below the minimum
 	// Note that this can go negative (if old + new don't satisfy minHealthy).
 	headroom := old + new - minHealthy
 
-	capacityIncrease := targetDesired - (oldDesired + newDesired)
+	// how many nodes do we have left to go? we can't schedule more than this
+	// or we'll go over the target
+	// note that remaining < headroom is possible depending on how many
+	// old nodes are still alive
+	remaining := targetDesired - newDesired
+
+	// heuristic time:
+	if remaining <= 0 {
+		// Every node has been scheduled on the new RC. Whatever the old RC
+		// still desires (such as nodes kept around during a surge) is
+		// left over and can be removed as health allows.
+		leftover := clampToZero(oldDesired)
+		if leftover == 0 || new >= minHealthy {
+			return leftover, 0
+		}
+		if headroom < leftover {
+			return clampToZero(headroom), 0
+		}
+		return leftover, 0
+	}
+	if extra := oldDesired + newDesired - targetDesired; extra > 0 {
+		// The old RC has more nodes than we will need in the final state.
+		// Because remaining > 0, there are fewer extra nodes than the old
+		// RC desires, so all of them can come out of the old RC.
+		if new >= minHealthy {
+			// minimum is satisfied by new nodes, remove every extra
+			// old node at once
+			return extra, 0
+		}
+		// Removing an old node may take down a healthy one, so it
+		// consumes headroom. Leave at least one node of headroom so
+		// the update can still replace nodes afterwards.
+		removable := extra
+		if headroom-1 < removable {
+			removable = headroom - 1
+		}
+		if removable > 0 {
+			return removable, 0
+		}
+		// None of the extra old nodes can be removed without blocking
+		// the update. Keep them as a buffer and carry on, the old RC
+		// will be cleaned up when the update finishes.
+	}
+
+	// The surge allowance lets the RCs temporarily desire more than
+	// targetDesired, so it counts as capacity we can add without removing
+	// an old node.
+	capacityIncrease := clampToZero(targetDesired + maxSurge - (oldDesired + newDesired))
 	if capacityIncrease > 0 {
 		// If we intend to schedule new nodes (nodes not currently managed by either RC),
 		// then we increase headroom by the capacity difference.
@@ -1008,22 +1699,8 @@ func rollAlgorithm(old, new, oldDesired, newDesired, targetDesired, minHealthy i
 		// on the assumption that there may be healthy nodes we don't know about.
 		// This is particularly useful when migrating from other deployment systems.
 		headroom += capacityIncrease
-	} else {
-		// We're not yet sure what the effects of a capacity decrease in a rolling update will be.
-		capacityIncrease = 0
 	}
 
-	// how many nodes do we have left to go? we can't schedule more than this
-	// or we'll go over the target
-	// note that remaining < headroom is possible depending on how many
-	// old nodes are still alive
-	remaining := targetDesired - newDesired
-
-	// heuristic time:
-	if remaining <= 0 {
-		// no nodes remaining, noop out
-		return 0, 0
-	}
 	if new >= minHealthy {
 		// minimum is satisfied by new nodes, doesn't matter how many old ones
 		// we kill. this includes the edge case where minHealthy==0
@@ -0,0 +1,106 @@
+package roll
+
+import (
+	"fmt"
+
+	"github.com/square/p2/pkg/roll/fields"
+	"github.com/square/p2/pkg/util"
+)
+
+// maxSimulatedSteps bounds SimulateUpdate in case the roll algorithm never
+// converges. An update that hasn't finished after this many steps is almost
+// certainly misconfigured.
+const maxSimulatedSteps = 10000
+
+// A SimulatedStep is one transfer of replicas from the old RC to the new RC
+// during a simulated rolling update
+type SimulatedStep struct {
+	NodesToRemove int
+	NodesToAdd    int
+
+	// OldDesired and NewDesired are the RCs' replica counts after the step
+	OldDesired int
+	NewDesired int
+
+	// AwaitsPromotion is true if the update would pause after this step
+	// until an operator promotes it to the next stage
+	AwaitsPromotion bool
+}
+
+// A Simulation is the outcome of replaying a rolling update without touching
+// either RC
+type Simulation struct {
+	Steps []SimulatedStep
+
+	// MinimumHealthy is the number of nodes the update keeps healthy
+	MinimumHealthy int
+
+	// Blocked is true if the update would stop making progress before it
+	// finishes. BlockedReason explains why.
+	Blocked       bool
+	BlockedReason string
+}
+
+// SimulateUpdate replays the rolling update algorithm for u, starting from the
+// given replica counts and health of the old and new RCs. Every pod the new RC
+// schedules is assumed to become healthy before the next step and every old
+// pod that is removed is assumed to have been healthy. Stages are assumed to
+// be promoted as soon as they are reached.
+func SimulateUpdate(u fields.Update, oldDesired, oldHealthy, newDesired, newHealthy int) (Simulation, error) {
+	minHealthy, err := u.MinimumHealthy()
+	if err != nil {
+		return Simulation{}, err
+	}
+	maxSurge, err := u.SurgeReplicas()
+	if err != nil {
+		return Simulation{}, err
+	}
+
+	sim := Simulation{MinimumHealthy: minHealthy}
+	for len(sim.Steps) < maxSimulatedSteps {
+		if newDesired >= u.DesiredReplicas && (u.LeaveOld || oldDesired <= 0) {
+			return sim, nil
+		}
+
+		target, err := u.StageTarget()
+		if err != nil {
+			return Simulation{}, err
+		}
+		if newDesired >= target && newDesired < u.DesiredReplicas {
+			if len(sim.Steps) > 0 {
+				sim.Steps[len(sim.Steps)-1].AwaitsPromotion = true
+			}
+			u.PromotedStages++
+			continue
+		}
+
+		// mirror rollAlgorithmParams
+		old := oldHealthy
+		if oldDesired < old {
+			old = oldDesired
+		}
+		nextRemove, nextAdd := rollAlgorithm(old, newHealthy, oldDesired-(u.DesiredReplicas-target), newDesired, target, minHealthy, maxSurge)
+		if nextRemove == 0 && nextAdd == 0 {
+			sim.Blocked = true
+			sim.BlockedReason = fmt.Sprintf(
+				"%d nodes would be healthy but %d must stay healthy, so no node can be replaced",
+				old+newHealthy,
+				minHealthy,
+			)
+			return sim, nil
+		}
+
+		oldDesired -= nextRemove
+		newDesired += nextAdd
+		oldHealthy = clampToZero(oldHealthy - nextRemove)
+		newHealthy += nextAdd
+		sim.Steps = append(sim.Steps, SimulatedStep{
+			NodesToRemove: nextRemove,
+			NodesToAdd:    nextAdd,
+			OldDesired:    oldDesired,
+			NewDesired:    newDesired,
+		})
+	}
+
+	return Simulation{}, util.Errorf("simulated update did not finish after %d steps", maxSimulatedSteps)
+}
@@ -0,0 +1,230 @@
+package roll
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/rc"
+	rcf "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/Sirupsen/logrus"
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+// advanceTopology keeps a topology-aware update within its current failure
+// domain. It sets u.domainTarget to the number of replicas the new RC may
+// have once every old node in the domain has been replaced, and moves the
+// update on to the next domain when the current one is finished and healthy.
+// Moving between domains pauses the update. If the update has to wait before
+// it can continue, a reason is returned.
+//
+// Only the new RC is confined to the domain, through its node selector. The
+// old RC's replica count is decremented as usual and the old RC chooses which
+// of its nodes to give up, so on nodes the two RCs don't share an old pod
+// outside the domain may be removed before the domain is finished.
+func (u *update) advanceTopology(ctx context.Context, checks map[types.NodeName]health.Result, newNodes rcNodeCounts) (string, error) {
+	oldDomains, err := u.podDomains(u.OldRC)
+	if err != nil {
+		return "", err
+	}
+
+	started := u.Topology.Domain != "" || len(u.Topology.Completed) > 0
+	if u.Topology.Domain != "" {
+		oldInDomain := 0
+		for _, domain := range oldDomains {
+			if domain == u.Topology.Domain {
+				oldInDomain++
+			}
+		}
+
+		if oldInDomain > 0 || newNodes.Current < newNodes.Desired {
+			// Nodes that the new RC hasn't scheduled yet will replace old
+			// nodes in the domain, so they are already counted
+			u.domainTarget = newNodes.Current + oldInDomain
+			if u.domainTarget < newNodes.Desired {
+				u.domainTarget = newNodes.Desired
+			}
+			return "", u.syncDomainSelector(ctx)
+		}
+
+		u.domainTarget = newNodes.Desired
+		newDomains, err := u.podDomains(u.NewRC)
+		if err != nil {
+			return "", err
+		}
+		for node, domain := range newDomains {
+			if domain == u.Topology.Domain && checks[node].Status != health.Passing {
+				return fmt.Sprintf("waiting for nodes in %s=%s to become healthy", u.Topology.Key, domain), u.syncDomainSelector(ctx)
+			}
+		}
+	} else if started {
+		// every domain has been rolled
+		u.domainTarget = u.DesiredReplicas
+		return "", u.syncDomainSelector(ctx)
+	}
+
+	next := *u.Topology
+	if !started {
+		newRC, err := u.rcStore.Get(u.NewRC)
+		if err != nil {
+			return "", err
+		}
+		next.NodeSelector = newRC.NodeSelector.String()
+	} else {
+		next.Completed = append(append([]string(nil), next.Completed...), next.Domain)
+	}
+
+	completed := make(map[string]bool)
+	for _, domain := range next.Completed {
+		completed[domain] = true
+	}
+	var remaining []string
+	for _, domain := range oldDomains {
+		if !completed[domain] {
+			remaining = append(remaining, domain)
+			completed[domain] = true
+		}
+	}
+	sort.Strings(remaining)
+	next.Domain = ""
+	if len(remaining) > 0 {
+		next.Domain = remaining[0]
+	}
+
+	// Pause before starting each domain after the first one so that an
+	// operator can check on the domain that just finished
+	pause := u.Topology.Domain != "" && next.Domain != ""
+	stored, err := u.rollStore.SetTopology(u.ID(), next, pause)
+	if err != nil {
+		return "", err
+	}
+	u.logger.WithFields(logrus.Fields{
+		"key":       next.Key,
+		"domain":    next.Domain,
+		"completed": next.Completed,
+	}).Infoln("Moving to next failure domain")
+	u.Topology = stored.Topology
+	u.Paused = stored.Paused
+
+	// The next tick will compute how far the new domain can be rolled
+	u.domainTarget = newNodes.Desired
+	return "", u.syncDomainSelector(ctx)
+}
+
+// pausedReason describes why a paused update is paused
+func (u *update) pausedReason() string {
+	if u.Topology != nil && u.Topology.Domain != "" && len(u.Topology.Completed) > 0 {
+		return fmt.Sprintf(
+			"finished %s=%s, resume the update to start on %s=%s",
+			u.Topology.Key,
+			u.Topology.Completed[len(u.Topology.Completed)-1],
+			u.Topology.Key,
+			u.Topology.Domain,
+		)
+	}
+	return "paused by an operator"
+}
+
+// syncDomainSelector makes sure the new RC's node selector only allows the
+// domains the update has rolled so far. Once the last domain is finished the
+// new RC's original node selector is restored.
+func (u *update) syncDomainSelector(ctx context.Context) error {
+	if u.Topology.Domain == "" && len(u.Topology.Completed) == 0 {
+		// the update hasn't restricted the new RC yet
+		return nil
+	}
+
+	selector, err := klabels.Parse(u.Topology.NodeSelector)
+	if err != nil {
+		return util.Errorf("could not parse original node selector of RC %s: %s", u.NewRC, err)
+	}
+	if u.Topology.Domain != "" {
+		domains := append(append([]string(nil), u.Topology.Completed...), u.Topology.Domain)
+		selector = selector.Add(u.Topology.Key, klabels.InOperator, domains)
+	}
+
+	return u.setNewRCSelector(ctx, selector)
+}
+
+// setNewRCSelector replaces the new RC's node selector if it differs from the
+// given one
+func (u *update) setNewRCSelector(ctx context.Context, selector klabels.Selector) error {
+	newRC, err := u.rcStore.Get(u.NewRC)
+	if err != nil {
+		return err
+	}
+	if newRC.NodeSelector.String() == selector.String() {
+		return nil
+	}
+
+	// branch off of the passed ctx which implicitly ensures that RC locks are held
+	selectorCtx, cancel := transaction.New(ctx)
+	defer cancel()
+	err = u.rcStore.UpdateNodeSelectorTxn(selectorCtx, u.NewRC, selector)
+	if err != nil {
+		return err
+	}
+	err = transaction.MustCommit(selectorCtx, u.txner)
+	if err != nil {
+		return err
+	}
+	u.logger.WithField("node_selector", selector.String()).Infoln("Updated node selector of new RC")
+	return nil
+}
+
+// restoreNodeSelector gives the new RC back the node selector it had before
+// a topology-aware update restricted it
+func (u *update) restoreNodeSelector(ctx context.Context) error {
+	if u.Topology.Domain == "" {
+		return u.syncDomainSelector(ctx)
+	}
+
+	done := *u.Topology
+	done.Completed = append(append([]string(nil), done.Completed...), done.Domain)
+	done.Domain = ""
+	stored, err := u.rollStore.SetTopology(u.ID(), done, false)
+	if err != nil {
+		return err
+	}
+	u.Topology = stored.Topology
+	return u.syncDomainSelector(ctx)
+}
+
+// podDomains returns the failure domain of every node the given RC has a pod
+// on. Nodes without a value for the topology key are an error because the
+// update can't tell when they should be rolled.
+func (u *update) podDomains(id rcf.ID) (map[types.NodeName]string, error) {
+	currentPods, err := rc.CurrentPods(id, u.labeler)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[types.NodeName]string)
+	for _, pod := range currentPods {
+		nodeLabels, err := u.labeler.GetLabels(labels.NODE, pod.Node.String())
+		if err != nil {
+			return nil, err
+		}
+		domain := nodeLabels.Labels.Get(u.Topology.Key)
+		if domain == "" {
+			return nil, util.Errorf("node %s has no value for topology key %s", pod.Node, u.Topology.Key)
+		}
+		ret[pod.Node] = domain
+	}
+	return ret, nil
+}
+
+// topologyTarget caps a replica target at the current domain's target for
+// topology-aware updates
+func (u *update) topologyTarget(target int) int {
+	if u.Topology == nil || u.domainTarget >= target {
+		return target
+	}
+	return u.domainTarget
+}
@@ -7,12 +7,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/square/p2/pkg/alerting"
 	"github.com/square/p2/pkg/audit"
+	freeze_fields "github.com/square/p2/pkg/freeze/fields"
 	"github.com/square/p2/pkg/health"
 	checkertest "github.com/square/p2/pkg/health/checker/test"
 	"github.com/square/p2/pkg/labels"
@@ -22,16 +24,20 @@ import (
 	"github.com/square/p2/pkg/rc"
 	rc_fields "github.com/square/p2/pkg/rc/fields"
 	"github.com/square/p2/pkg/roll/fields"
+	"github.com/square/p2/pkg/scheduler"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/auditlogstore"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/rcstore"
 	"github.com/square/p2/pkg/store/consul/rollstore"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/rollstatus"
 	"github.com/square/p2/pkg/store/consul/transaction"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
 
 	. "github.com/anthonybishopric/gotcha"
+	"github.com/hashicorp/consul/api"
 	klabels "k8s.io/kubernetes/pkg/labels"
 )
 
@@ -66,7 +72,7 @@ const (
 func uniformRollAlgorithm(t *testing.T, old, new, want, need int) int {
 	// For these, oldDesired + newDesired should == targetDesired.
 	// We'll just craft numbers that meet this requirement.
-	remove, add := rollAlgorithm(old, new, want-new, new, want, need)
+	remove, add := rollAlgorithm(old, new, want-new, new, want, need, 0)
 
 	Assert(t).AreEqual(remove, add, "expected nodes removed and nodes added to be equal")
 	return add
@@ -86,7 +92,7 @@ func TestWouldBlock(t *testing.T) {
 func assertRollAlgorithmResults(t *testing.T, old, new, final, need, remove, add int, message string) {
 	// For these, oldDesired == oldHealthy, newDesired == newHealthy.
 	// This may allow oldDesired + newDesired < final.
-	gotRemove, gotAdd := rollAlgorithm(old, new, old, new, final, need)
+	gotRemove, gotAdd := rollAlgorithm(old, new, old, new, final, need, 0)
 	Assert(t).AreEqual(gotRemove, remove, "removed nodes incorrect: "+message)
 	Assert(t).AreEqual(gotAdd, add, "added nodes incorrect: "+message)
 }
@@ -96,7 +102,7 @@ func TestRollAlgorithmDoesNotExceed(t *testing.T) {
 	// In this case, we schedule the remaining nodes.
 	// We want to ensure that remaining == targetDesired - newDesired
 	// instead of targetDesired - newHealthy
-	gotRemove, gotAdd := rollAlgorithm(1, 1, 1, 2, 3, 1)
+	gotRemove, gotAdd := rollAlgorithm(1, 1, 1, 2, 3, 1, 0)
 	Assert(t).AreEqual(gotRemove, 1, "expected only one node to be removed")
 	Assert(t).AreEqual(gotAdd, 1, "expected only one node to be added")
 }
@@ -112,6 +118,106 @@ func TestRollAlgorithmIncreases(t *testing.T) {
 	assertRollAlgorithmResults(t, 3, 0, 4, 3, 0, 1, "should schedule only new node if increasing capacity with existing nodes and no headroom")
 }
 
+func TestRollAlgorithmDecreases(t *testing.T) {
+	assertRollAlgorithmResults(t, 5, 0, 3, 2, 2, 0, "should remove extra old nodes first if decreasing capacity")
+	assertRollAlgorithmResults(t, 5, 0, 3, 0, 2, 0, "should remove all extra old nodes if decreasing capacity with no minimum")
+	assertRollAlgorithmResults(t, 4, 2, 3, 2, 3, 0, "should remove all extra old nodes if decreasing capacity and new nodes satisfy minimum")
+	assertRollAlgorithmResults(t, 5, 0, 3, 3, 1, 0, "should only remove extra old nodes down to one node of headroom")
+	assertRollAlgorithmResults(t, 5, 0, 3, 4, 1, 1, "should replace nodes if extra old nodes can't be removed without blocking")
+	assertRollAlgorithmResults(t, 3, 1, 3, 3, 1, 1, "should replace nodes if extra old nodes can't be removed without blocking partway through")
+	assertRollAlgorithmResults(t, 5, 0, 3, 5, 0, 0, "should do nothing if decreasing capacity at minimum")
+	assertRollAlgorithmResults(t, 2, 3, 3, 2, 2, 0, "should remove leftover old nodes once the new RC desires every node")
+	assertRollAlgorithmResults(t, 0, 3, 3, 2, 0, 0, "should do nothing if done")
+
+	// two of the new RC's three nodes aren't healthy yet
+	gotRemove, gotAdd := rollAlgorithm(2, 1, 2, 3, 3, 2, 0)
+	Assert(t).AreEqual(gotRemove, 1, "should remove leftover old nodes only down to the minimum")
+	Assert(t).AreEqual(gotAdd, 0, "should not add nodes once the new RC desires every node")
+
+	gotRemove, gotAdd = rollAlgorithm(1, 1, 1, 3, 3, 2, 0)
+	Assert(t).AreEqual(gotRemove, 0, "should not remove leftover old nodes if that would go below the minimum")
+	Assert(t).AreEqual(gotAdd, 0, "should not add nodes once the new RC desires every node")
+}
+
+func assertSurgeResults(t *testing.T, old, new, final, need, surge, remove, add int, message string) {
+	gotRemove, gotAdd := rollAlgorithm(old, new, old, new, final, need, surge)
+	Assert(t).AreEqual(gotRemove, remove, "removed nodes incorrect: "+message)
+	Assert(t).AreEqual(gotAdd, add, "added nodes incorrect: "+message)
+}
+
+func TestRollAlgorithmSurges(t *testing.T) {
+	assertSurgeResults(t, 3, 0, 3, 3, 1, 0, 1, "should add a surge node without removing if at minimum")
+	assertSurgeResults(t, 4, 0, 4, 2, 2, 2, 4, "should add surge nodes on top of headroom")
+	assertSurgeResults(t, 3, 1, 3, 3, 1, 1, 1, "should keep replacing nodes within the surge once the surge node is healthy")
+	assertSurgeResults(t, 3, 1, 3, 2, 1, 1, 0, "should remove the extra old node once the surge node is healthy")
+	assertSurgeResults(t, 3, 0, 3, 0, 2, 1, 3, "should only remove nodes beyond the surge if no minimum")
+	assertSurgeResults(t, 0, 0, 3, 2, 1, 0, 2, "should count surge as capacity when increasing from zero")
+	assertSurgeResults(t, 1, 3, 3, 2, 1, 1, 0, "should remove the surge node from the old RC once the new RC desires every node")
+	assertSurgeResults(t, 2, 10, 10, 8, 2, 2, 0, "should remove every surge node from the old RC once the new RC desires every node")
+}
+
+func TestSimulateUpdate(t *testing.T) {
+	u := fields.Update{DesiredReplicas: 3, MinimumReplicas: 2}
+	sim, err := SimulateUpdate(u, 3, 3, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sim.Blocked {
+		t.Fatalf("expected update to finish but it blocked: %s", sim.BlockedReason)
+	}
+	if len(sim.Steps) != 3 {
+		t.Fatalf("expected 3 steps but there were %d: %+v", len(sim.Steps), sim.Steps)
+	}
+	for _, step := range sim.Steps {
+		if step.NodesToAdd != 1 || step.NodesToRemove != 1 {
+			t.Errorf("expected every step to replace one node but got %+v", step)
+		}
+	}
+	last := sim.Steps[len(sim.Steps)-1]
+	if last.OldDesired != 0 || last.NewDesired != 3 {
+		t.Errorf("expected update to end with all replicas on the new RC but got %+v", last)
+	}
+
+	u.MinimumReplicas = 3
+	sim, err = SimulateUpdate(u, 3, 3, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sim.Blocked || len(sim.Steps) != 0 {
+		t.Errorf("expected update to block right away when every node must stay healthy, got %+v", sim)
+	}
+
+	u.MinimumReplicas = 1
+	u.Stages = []fields.Stage{"1"}
+	sim, err = SimulateUpdate(u, 3, 3, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sim.Steps) == 0 || !sim.Steps[0].AwaitsPromotion || sim.Steps[0].NewDesired != 1 {
+		t.Errorf("expected the first step to stop at the first stage, got %+v", sim.Steps)
+	}
+	if sim.Steps[len(sim.Steps)-1].NewDesired != 3 {
+		t.Errorf("expected the update to finish after promotion, got %+v", sim.Steps)
+	}
+
+	for _, u := range []fields.Update{
+		{DesiredReplicas: 3, MinimumReplicas: 2, MaxSurge: "1"},
+		{DesiredReplicas: 10, MinimumReplicas: 8, MaxSurge: "2"},
+	} {
+		sim, err = SimulateUpdate(u, u.DesiredReplicas, u.DesiredReplicas, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sim.Blocked {
+			t.Fatalf("expected surge update to finish but it blocked: %s", sim.BlockedReason)
+		}
+		last := sim.Steps[len(sim.Steps)-1]
+		if last.OldDesired != 0 || last.NewDesired != u.DesiredReplicas {
+			t.Errorf("expected surge update to end with all replicas on the new RC but got %+v", sim.Steps)
+		}
+	}
+}
+
 func TestShouldContinue(t *testing.T) {
 	u := update{Update: fields.Update{DesiredReplicas: 3}}
 	oldNodes := rcNodeCounts{Desired: 3, Current: 3}
@@ -133,6 +239,23 @@ func TestShouldStopIfNodesCurrent(t *testing.T) {
 	Assert(t).AreEqual(u.shouldStop(oldNodes, newNodes), ruShouldTerminate, "RU should terminate if enough nodes are current")
 }
 
+func TestShouldContinueIfOldRCHasLeftoverNodes(t *testing.T) {
+	u := update{Update: fields.Update{DesiredReplicas: 3}}
+	oldNodes := rcNodeCounts{Desired: 1, Current: 1}
+	newNodes := rcNodeCounts{Desired: 3, Current: 3}
+	Assert(t).AreEqual(u.shouldStop(oldNodes, newNodes), ruShouldContinue, "RU should continue until the old RC desires no nodes")
+}
+
+func TestShouldStopIfOldRCKeepsLeftoverNodes(t *testing.T) {
+	u := update{Update: fields.Update{DesiredReplicas: 3}, logger: logging.TestLogger()}
+	oldNodes := rcNodeCounts{Desired: 1, Current: 1}
+	newNodes := rcNodeCounts{Desired: 3, Current: 3}
+	Assert(t).AreEqual(u.shouldStop(oldNodes, newNodes), ruShouldContinue, "RU should continue while the old RC's leftover nodes are removed")
+
+	u.leftoverSince = time.Now().Add(-leftoverOldNodesTimeout)
+	Assert(t).AreEqual(u.shouldStop(oldNodes, newNodes), ruShouldTerminate, "RU should terminate so the old RC's replica count is alerted on once the wait is over")
+}
+
 func TestShouldBlockIfWaitingForCurrentNodes(t *testing.T) {
 	u := update{Update: fields.Update{DesiredReplicas: 3}}
 	oldNodes := rcNodeCounts{Desired: 0, Current: 0}
@@ -141,19 +264,60 @@ func TestShouldBlockIfWaitingForCurrentNodes(t *testing.T) {
 }
 
 func TestShouldBlockIfWaitingForCurrentCanaryNodes(t *testing.T) {
-	u := update{Update: fields.Update{DesiredReplicas: 1}}
+	u := update{Update: fields.Update{DesiredReplicas: 1, LeaveOld: true}}
 	oldNodes := rcNodeCounts{Desired: 2, Current: 2}
 	newNodes := rcNodeCounts{Desired: 1, Current: 0}
 	Assert(t).AreEqual(u.shouldStop(oldNodes, newNodes), ruShouldBlock, "RU should block if canary node isn't yet current")
 }
 
 func TestShouldTerminateIfCanaryFinished(t *testing.T) {
-	u := update{Update: fields.Update{DesiredReplicas: 1}}
+	u := update{Update: fields.Update{DesiredReplicas: 1, LeaveOld: true}}
 	oldNodes := rcNodeCounts{Desired: 2, Current: 2}
 	newNodes := rcNodeCounts{Desired: 1, Current: 1}
 	Assert(t).AreEqual(u.shouldStop(oldNodes, newNodes), ruShouldTerminate, "RU should terminate if canary node is current")
 }
 
+func TestShouldAwaitPromotionAtStageBoundary(t *testing.T) {
+	u := update{Update: fields.Update{DesiredReplicas: 10, Stages: []fields.Stage{"1", "50%"}}}
+	oldNodes := rcNodeCounts{Desired: 9, Current: 9}
+	newNodes := rcNodeCounts{Desired: 1, Current: 1}
+	Assert(t).AreEqual(u.shouldStop(oldNodes, newNodes), ruShouldAwaitPromotion, "RU should wait for promotion once the first stage is scheduled")
+
+	u.PromotedStages = 1
+	Assert(t).AreEqual(u.shouldStop(oldNodes, newNodes), ruShouldContinue, "RU should continue once the first stage was promoted")
+
+	oldNodes = rcNodeCounts{Desired: 5, Current: 5}
+	newNodes = rcNodeCounts{Desired: 5, Current: 5}
+	Assert(t).AreEqual(u.shouldStop(oldNodes, newNodes), ruShouldAwaitPromotion, "RU should wait for promotion once the second stage is scheduled")
+
+	u.PromotedStages = 2
+	Assert(t).AreEqual(u.shouldStop(oldNodes, newNodes), ruShouldContinue, "RU should continue once every stage was promoted")
+}
+
+func TestRollAlgorithmParamsStageTarget(t *testing.T) {
+	u := &update{Update: fields.Update{
+		MinimumReplicas: 2,
+		DesiredReplicas: 10,
+		Stages:          []fields.Stage{"1", "50%"},
+	}}
+	oldHealth := rcNodeCounts{Healthy: 10, Desired: 10}
+	newHealth := rcNodeCounts{}
+	_, _, _, _, targetDesired, _, _ := u.rollAlgorithmParams(oldHealth, newHealth)
+	Assert(t).AreEqual(targetDesired, 1, "target should be the first stage")
+
+	remove, add := rollAlgorithm(u.rollAlgorithmParams(oldHealth, newHealth))
+	Assert(t).AreEqual(remove, 1, "should remove one old node for the canary stage")
+	Assert(t).AreEqual(add, 1, "should add one new node for the canary stage")
+
+	u.PromotedStages = 1
+	_, _, _, _, targetDesired, _, _ = u.rollAlgorithmParams(oldHealth, newHealth)
+	Assert(t).AreEqual(targetDesired, 5, "target should be the second stage after promotion")
+
+	u.PromotedStages = 2
+	_, _, _, _, targetDesired, _, _ = u.rollAlgorithmParams(oldHealth, newHealth)
+	Assert(t).AreEqual(targetDesired, 10, "target should be desired replicas after all stages are promoted")
+}
+
 func TestRollAlgorithmParams(t *testing.T) {
 	u := &update{Update: fields.Update{
 		MinimumReplicas: 4096,
@@ -175,20 +339,37 @@ func TestRollAlgorithmParams(t *testing.T) {
 		Unknown:   1024,
 		Desired:   2048,
 	}
-	old, new, oldDesired, newDesired, targetDesired, minHealthy := u.rollAlgorithmParams(oldHealth, newHealth)
+	old, new, oldDesired, newDesired, targetDesired, minHealthy, maxSurge := u.rollAlgorithmParams(oldHealth, newHealth)
 	Assert(t).AreEqual(old, 4, "incorrect old healthy param")
 	Assert(t).AreEqual(new, 256, "incorrect new healthy param")
 	Assert(t).AreEqual(oldDesired, 32, "incorrect old desired param")
 	Assert(t).AreEqual(newDesired, 2048, "incorrect new desired param")
 	Assert(t).AreEqual(targetDesired, 8192, "incorrect target desired param")
 	Assert(t).AreEqual(minHealthy, 4096, "incorrect min healthy param")
+	Assert(t).AreEqual(maxSurge, 0, "incorrect max surge param")
+}
+
+func TestRollAlgorithmParamsMaxUnavailableAndSurge(t *testing.T) {
+	u := &update{Update: fields.Update{
+		MinimumReplicas: 1,
+		DesiredReplicas: 10,
+		MaxUnavailable:  "25%",
+		MaxSurge:        "25%",
+	}}
+	_, _, _, _, _, minHealthy, maxSurge := u.rollAlgorithmParams(rcNodeCounts{}, rcNodeCounts{})
+	Assert(t).AreEqual(minHealthy, 8, "max unavailable percentage should round down")
+	Assert(t).AreEqual(maxSurge, 3, "max surge percentage should round up")
+
+	u.MinimumReplicas = 9
+	_, _, _, _, _, minHealthy, _ = u.rollAlgorithmParams(rcNodeCounts{}, rcNodeCounts{})
+	Assert(t).AreEqual(minHealthy, 9, "minimum replicas should win if it is larger")
 }
 
 func TestRollAlgorithmParamsFewerDesiredThanHealthy(t *testing.T) {
 	u := &update{}
 	oldHealth := rcNodeCounts{Healthy: 4, Desired: 3}
 	newHealth := rcNodeCounts{}
-	old, _, _, _, _, _ := u.rollAlgorithmParams(oldHealth, newHealth)
+	old, _, _, _, _, _, _ := u.rollAlgorithmParams(oldHealth, newHealth)
 	Assert(t).AreEqual(old, 3, "incorrect old healthy param (expected to be old desired, since it's smaller than old healthy)")
 }
 
@@ -327,8 +508,14 @@ func SimulateRollingUpgrade(t *testing.T, full, nonew, strictRemove bool) {
 		Assert(t).IsTrue(len(old)+len(new) >= minimum, fmt.Sprintf("went below %d minimum nodes (nodes %v)\n", minimum, nodes))
 		Assert(t).IsTrue(len(new) <= target, fmt.Sprintf("went above %d target nodes (nodes %v)\n", target, nodes))
 		if len(new) == target {
-			nextRemove, nextAdd := rollAlgorithm(len(old), len(new), len(old), target, target, minimum)
-			Assert(t).AreEqual(nextRemove, 0, "update should be done, should remove nothing")
+			// only leftover old nodes the old RC still desires may be removed
+			oldDesired := 0
+			if strictRemove {
+				oldDesired = len(old)
+			}
+			nextRemove, nextAdd := rollAlgorithm(len(old), len(new), oldDesired, target, target, minimum, 0)
+			Assert(t).IsTrue(nextRemove <= oldDesired, "update should be done, should remove at most the leftover old nodes")
+			Assert(t).IsTrue(len(old)+len(new)-nextRemove >= minimum, "update should not remove leftover old nodes below the minimum")
 			Assert(t).AreEqual(nextAdd, 0, "update should be done, should add nothing")
 			t.Logf("Simulation complete\n\n")
 			break
@@ -339,14 +526,16 @@ func SimulateRollingUpgrade(t *testing.T, full, nonew, strictRemove bool) {
 		if strictRemove {
 			oldDesired = len(old)
 		}
-		nextRemove, nextAdd := rollAlgorithm(len(old), len(new), oldDesired, len(new), target, minimum)
+		nextRemove, nextAdd := rollAlgorithm(len(old), len(new), oldDesired, len(new), target, minimum, 0)
 
 		if !strictRemove {
 			Assert(t).AreEqual(nextRemove, nextAdd, "got asymmetric update, not expected for this fuzz test")
 		}
 
 		t.Logf("Scheduling %d new out of %v eligible\n", nextAdd, eligible)
-		Assert(t).AreNotEqual(nextAdd, 0, "got noop update, would never terminate")
+		// capacity decreases may remove extra old nodes without adding
+		// any new ones
+		Assert(t).IsTrue(nextAdd > 0 || nextRemove > 0, "got noop update, would never terminate")
 
 		if strictRemove {
 			// choose nodes from the old list, randomly, and remove the pod from them.
@@ -513,9 +702,12 @@ func updateWithHealth(t *testing.T,
 		labeler:                     applicator,
 		logger:                      logger,
 		Update:                      ru,
+		watched:                     make(chan fields.Update, 1),
+		stored:                      ru,
 		auditLogStore:               auditLogStore,
 		shouldCreateAuditLogRecords: true,
 		rollStore:                   rollStore,
+		rollStatusStore:             rollstatus.NewConsul(statusstore.NewConsul(fixture.Client), "test"),
 	}, oldManifest, newManifest, rcs, fixture.Stop
 }
 
@@ -905,6 +1097,7 @@ func failOnError(ctx context.Context, t *testing.T, desc string, errs <-chan err
 
 type testLabeler interface {
 	SetLabel(labels.Type, string, string, string) error
+	RemoveLabel(labels.Type, string, string) error
 }
 
 // Transfers the named node from the old RC to the new RC
@@ -1100,6 +1293,103 @@ func TestRollLoopTypicalCase(t *testing.T) {
 	}
 }
 
+func TestRollLoopSurgeDrainsOldRC(t *testing.T) {
+	nodes := map[types.NodeName]bool{
+		"node1": true,
+		"node2": true,
+		"node3": true,
+	}
+	upd, _, manifest, rcWatcher, f := updateWithHealth(t, 3, 0, nodes, nil, nil, nil, rc_fields.StaticStrategy)
+	defer f()
+	upd.DesiredReplicas = 3
+	upd.MinimumReplicas = 2
+	upd.MaxSurge = "1"
+
+	healths := make(chan map[types.NodeName]health.Result)
+	checks := map[types.NodeName]health.Result{
+		"node1": {Status: health.Passing},
+		"node2": {Status: health.Passing},
+		"node3": {Status: health.Passing},
+		"node4": {Status: health.Passing},
+	}
+	upd.hcheck = cannedWatchServiceChecker{
+		watchServiceCh: healths,
+		serviceResult:  checks,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	oldRCCh := watchRCOrFail(ctx, t, rcWatcher, upd.OldRC, "old RC", &wg)
+	newRCCh := watchRCOrFail(ctx, t, rcWatcher, upd.NewRC, "new RC", &wg)
+
+	rollLoopResult := make(chan bool)
+
+	go func() {
+		rollLoopResult <- upd.Run(ctx)
+		close(rollLoopResult)
+	}()
+
+	assertRCUpdates(t, oldRCCh, 3, "old RC")
+	assertRCUpdates(t, newRCCh, 0, "new RC")
+	healths <- checks
+
+	// the surge node lets the new RC schedule two nodes while the old RC
+	// only gives up one
+	assertRCUpdates(t, oldRCCh, 2, "old RC")
+	assertRCUpdates(t, newRCCh, 2, "new RC")
+
+	for _, node := range []types.NodeName{"node4", "node1"} {
+		err := transferNode(node, manifest, upd)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	healths <- checks
+
+	assertRCUpdates(t, oldRCCh, 1, "old RC")
+	assertRCUpdates(t, newRCCh, 2, "new RC")
+
+	healths <- checks
+
+	assertRCUpdates(t, oldRCCh, 1, "old RC")
+	assertRCUpdates(t, newRCCh, 3, "new RC")
+
+	err := transferNode("node2", manifest, upd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	healths <- checks
+
+	// the new RC desires every node, so the surge node left on the old RC
+	// has to be removed before the update can finish
+	assertRCUpdates(t, oldRCCh, 0, "old RC")
+	assertRCUpdates(t, newRCCh, 3, "new RC")
+
+	err = upd.labeler.(testLabeler).RemoveLabel(labels.POD, labels.MakePodLabelKey("node3", manifest.ID()), rc.RCIDLabel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	healths <- checks
+
+	assertRollLoopResult(t, rollLoopResult, true)
+
+	cancel()
+	wg.Wait()
+
+	ru, err := upd.rollStore.(rollstore.ConsulStore).Get(upd.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ru.NewRC != "" {
+		t.Fatal("expected RU to be deleted before Run() exits")
+	}
+}
+
 func TestRollLoopNilAuditLogDetails(t *testing.T) {
 	nodes := map[types.NodeName]bool{
 		"node1": true,
@@ -1211,6 +1501,779 @@ func TestRollLoopNilAuditLogDetails(t *testing.T) {
 	cancel()
 }
 
+func TestRollLoopRollsBackWhenNewNodesCritical(t *testing.T) {
+	upd, _, manifest, rcWatcher, f := updateWithHealth(t, 3, 0, map[types.NodeName]bool{
+		"node1": true,
+		"node2": true,
+		"node3": true,
+	}, nil, nil, nil, rc_fields.StaticStrategy)
+	defer f()
+	upd.DesiredReplicas = 3
+	upd.MinimumReplicas = 2
+	upd.RollbackPolicy = &fields.RollbackPolicy{
+		MaxCriticalNodes: 0,
+		CriticalDuration: 0,
+	}
+	alerter := &fakeAlerter{}
+	upd.alerter = alerter
+
+	healths := make(chan map[types.NodeName]health.Result)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wg sync.WaitGroup
+	oldRCCh := watchRCOrFail(ctx, t, rcWatcher, upd.OldRC, "old RC", &wg)
+	newRCCh := watchRCOrFail(ctx, t, rcWatcher, upd.NewRC, "new RC", &wg)
+
+	rollLoopResult := make(chan bool)
+
+	go func() {
+		rollLoopResult <- upd.rollLoop(ctx, manifest.ID(), healths, nil, false, manifest.GetStatusStanza())
+		close(rollLoopResult)
+	}()
+
+	checks := map[types.NodeName]health.Result{
+		"node1": {Status: health.Passing},
+		"node2": {Status: health.Passing},
+		"node3": {Status: health.Passing},
+	}
+	healths <- checks
+
+	assertRCUpdates(t, oldRCCh, 3, "old RC")
+	assertRCUpdates(t, newRCCh, 0, "new RC")
+
+	healths <- checks
+
+	assertRCUpdates(t, oldRCCh, 2, "old RC")
+	assertRCUpdates(t, newRCCh, 1, "new RC")
+
+	err := transferNode("node1", manifest, upd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks["node1"] = health.Result{Status: health.Critical}
+	healths <- checks
+
+	assertRollLoopResult(t, rollLoopResult, false)
+
+	oldRC, err := upd.rcStore.Get(upd.OldRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oldRC.ReplicasDesired != 3 {
+		t.Errorf("expected old RC to be returned to 3 replicas but it had %d", oldRC.ReplicasDesired)
+	}
+	if oldRC.Disabled {
+		t.Error("expected old RC to be enabled after rollback")
+	}
+
+	newRC, err := upd.rcStore.Get(upd.NewRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newRC.ReplicasDesired != 0 {
+		t.Errorf("expected new RC to have 0 replicas after rollback but it had %d", newRC.ReplicasDesired)
+	}
+
+	ru, err := upd.rollStore.Get(upd.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ru.NewRC != "" {
+		t.Error("expected the RU to be deleted after rollback")
+	}
+
+	if alerter.numCalls != 1 {
+		t.Errorf("Expected Alert() to have been called 1 time, was %d", alerter.numCalls)
+	}
+
+	als, err := upd.auditLogStore.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(als) != 1 {
+		t.Fatalf("expected 1 audit log record but there were %d", len(als))
+	}
+	for _, al := range als {
+		if al.EventType != audit.RURollbackEvent {
+			t.Errorf("expected audit log record of type %s but was %s", audit.RURollbackEvent, al.EventType)
+		}
+	}
+
+	cancel()
+	wg.Wait()
+}
+
+func TestRollbackRestoresNewRCNodeSelector(t *testing.T) {
+	upd, _, _, _, f := updateWithHealth(t, 3, 0, map[types.NodeName]bool{
+		"node1": true,
+		"node2": true,
+		"node3": true,
+	}, nil, nil, nil, rc_fields.StaticStrategy)
+	defer f()
+	upd.DesiredReplicas = 3
+	upd.alerter = &fakeAlerter{}
+	upd.BlueGreen = &fields.BlueGreen{
+		Nodes:        []types.NodeName{"node4"},
+		NodeSelector: "role=web",
+	}
+	storeUpdate(t, upd)
+
+	applicator := upd.labeler.(labels.Applicator)
+	upd.nodeLabeler = applicator
+	err := applicator.SetLabel(labels.NODE, "node4", BlueGreenLabel, upd.NewRC.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err = upd.syncBlueGreenSelector(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = upd.rollback(ctx, rcNodeCounts{Desired: 3}, rcNodeCounts{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newRC, err := upd.rcStore.Get(upd.NewRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newRC.NodeSelector.String() != "role=web" {
+		t.Errorf("expected new RC's node selector to be restored after rollback but it was %q", newRC.NodeSelector.String())
+	}
+
+	nodeLabels, err := applicator.GetLabels(labels.NODE, "node4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := nodeLabels.Labels[BlueGreenLabel]; ok {
+		t.Error("expected blue/green label to be removed after rollback")
+	}
+}
+
+func TestRollLoopDoesNothingWhilePaused(t *testing.T) {
+	upd, _, manifest, _, f := updateWithHealth(t, 3, 0, map[types.NodeName]bool{
+		"node1": true,
+		"node2": true,
+		"node3": true,
+	}, nil, nil, nil, rc_fields.StaticStrategy)
+	defer f()
+	upd.DesiredReplicas = 3
+	upd.MinimumReplicas = 2
+
+	stored, err := upd.rollStore.(rollstore.ConsulStore).SetPaused(upd.ID(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upd.Watched(stored)
+
+	healths := make(chan map[types.NodeName]health.Result)
+	// health errors are only used to wait for the roll loop to finish
+	// handling the previous health check
+	healthErrs := make(chan error)
+	waitForLoop := func() {
+		healthErrs <- util.Errorf("sync")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rollLoopResult := make(chan bool)
+
+	go func() {
+		rollLoopResult <- upd.rollLoop(ctx, manifest.ID(), healths, healthErrs, false, manifest.GetStatusStanza())
+		close(rollLoopResult)
+	}()
+
+	checks := map[types.NodeName]health.Result{
+		"node1": {Status: health.Passing},
+		"node2": {Status: health.Passing},
+		"node3": {Status: health.Passing},
+	}
+
+	assertDesired := func(id rc_fields.ID, expect int) {
+		rc, err := upd.rcStore.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rc.ReplicasDesired != expect {
+			t.Fatalf("expected replicas desired count to be %d but was %d", expect, rc.ReplicasDesired)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		healths <- checks
+	}
+	waitForLoop()
+	assertDesired(upd.OldRC, 3)
+	assertDesired(upd.NewRC, 0)
+
+	stored, err = upd.rollStore.(rollstore.ConsulStore).SetPaused(upd.ID(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upd.Watched(stored)
+
+	healths <- checks
+	waitForLoop()
+	assertDesired(upd.OldRC, 2)
+	assertDesired(upd.NewRC, 1)
+
+	cancel()
+	assertRollLoopResult(t, rollLoopResult, false)
+}
+
+func TestRollLoopRechecksPauseAfterRollDelay(t *testing.T) {
+	checks := map[types.NodeName]health.Result{
+		"node1": {Status: health.Passing},
+		"node2": {Status: health.Passing},
+		"node3": {Status: health.Passing},
+	}
+	upd, _, manifest, _, f := updateWithHealth(t, 3, 0, map[types.NodeName]bool{
+		"node1": true,
+		"node2": true,
+		"node3": true,
+	}, nil, nil, checks, rc_fields.StaticStrategy)
+	defer f()
+	upd.DesiredReplicas = 3
+	upd.MinimumReplicas = 2
+	upd.RollDelay = time.Second
+
+	healths := make(chan map[types.NodeName]health.Result)
+	// health errors are only used to wait for the roll loop to finish
+	// handling the previous health check
+	healthErrs := make(chan error)
+	waitForLoop := func() {
+		healthErrs <- util.Errorf("sync")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rollLoopResult := make(chan bool)
+
+	go func() {
+		rollLoopResult <- upd.rollLoop(ctx, manifest.ID(), healths, healthErrs, false, manifest.GetStatusStanza())
+		close(rollLoopResult)
+	}()
+
+	assertDesired := func(id rc_fields.ID, expect int) {
+		rc, err := upd.rcStore.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rc.ReplicasDesired != expect {
+			t.Fatalf("expected replicas desired count to be %d but was %d", expect, rc.ReplicasDesired)
+		}
+	}
+
+	// nothing has been added to the new RC yet, so there is no delay
+	healths <- checks
+	waitForLoop()
+	assertDesired(upd.OldRC, 2)
+	assertDesired(upd.NewRC, 1)
+
+	err := transferNode("node1", manifest, upd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// pause the update while the roll loop waits out the delay
+	healths <- checks
+	time.Sleep(upd.RollDelay / 2)
+	stored, err := upd.rollStore.(rollstore.ConsulStore).SetPaused(upd.ID(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upd.Watched(stored)
+	waitForLoop()
+	assertDesired(upd.OldRC, 2)
+	assertDesired(upd.NewRC, 1)
+
+	cancel()
+	assertRollLoopResult(t, rollLoopResult, false)
+}
+
+func TestRollLoopPublishesStatus(t *testing.T) {
+	upd, _, manifest, _, f := updateWithHealth(t, 3, 0, map[types.NodeName]bool{
+		"node1": true,
+		"node2": true,
+		"node3": true,
+	}, nil, nil, nil, rc_fields.StaticStrategy)
+	defer f()
+	upd.DesiredReplicas = 3
+	upd.MinimumReplicas = 2
+	upd.initStatus()
+
+	healths := make(chan map[types.NodeName]health.Result)
+	// health errors are only used to wait for the roll loop to finish
+	// handling the previous health check
+	healthErrs := make(chan error)
+	waitForLoop := func() {
+		healthErrs <- util.Errorf("sync")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rollLoopResult := make(chan bool)
+
+	go func() {
+		rollLoopResult <- upd.rollLoop(ctx, manifest.ID(), healths, healthErrs, false, manifest.GetStatusStanza())
+		close(rollLoopResult)
+	}()
+
+	checks := map[types.NodeName]health.Result{
+		"node1": {Status: health.Passing},
+		"node2": {Status: health.Passing},
+		"node3": {Status: health.Passing},
+	}
+	healths <- checks
+	waitForLoop()
+
+	status, _, err := upd.rollStatusStore.Get(upd.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Phase != rollstatus.PhaseRolling {
+		t.Errorf("expected phase to be %s but was %s", rollstatus.PhaseRolling, status.Phase)
+	}
+	if status.LastStep.NodesToAdd != 1 || status.LastStep.NodesToRemove != 1 {
+		t.Errorf("expected last step to add and remove 1 node but was %+v", status.LastStep)
+	}
+	if status.OldRC.Healthy != 3 {
+		t.Errorf("expected 3 healthy old nodes but there were %d", status.OldRC.Healthy)
+	}
+	if status.StartTime.IsZero() {
+		t.Error("expected start time to be set")
+	}
+
+	err = transferNode("node1", manifest, upd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks["node1"] = health.Result{Status: health.Critical}
+	healths <- checks
+	waitForLoop()
+
+	status, _, err = upd.rollStatusStore.Get(upd.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Phase != rollstatus.PhaseBlocked {
+		t.Errorf("expected phase to be %s but was %s", rollstatus.PhaseBlocked, status.Phase)
+	}
+	if status.BlockedReason != "minimum health not satisfied" {
+		t.Errorf("expected update to be blocked on minimum health but reason was %q", status.BlockedReason)
+	}
+	if status.BlockedSince == nil {
+		t.Error("expected blocked since to be set")
+	}
+	if status.NewRC.Desired != 1 || status.NewRC.Unhealthy != 1 {
+		t.Errorf("expected 1 desired and unhealthy new node but counts were %+v", status.NewRC)
+	}
+
+	cancel()
+	assertRollLoopResult(t, rollLoopResult, false)
+}
+
+type fakeFreezeStore []freeze_fields.Window
+
+func (f fakeFreezeStore) List() ([]freeze_fields.Window, error) {
+	return f, nil
+}
+
+func TestRollLoopBlocksDuringFreeze(t *testing.T) {
+	upd, _, manifest, _, f := updateWithHealth(t, 3, 0, map[types.NodeName]bool{
+		"node1": true,
+		"node2": true,
+		"node3": true,
+	}, nil, nil, nil, rc_fields.StaticStrategy)
+	defer f()
+	upd.DesiredReplicas = 3
+	upd.MinimumReplicas = 2
+	upd.initStatus()
+
+	now := time.Now()
+	freeze := freeze_fields.Window{
+		ID:     "holiday",
+		Start:  now.Add(-time.Hour),
+		End:    now.Add(time.Hour),
+		PodID:  manifest.ID(),
+		Reason: "holiday",
+	}
+	upd.freezeStore = fakeFreezeStore{freeze}
+
+	healths := make(chan map[types.NodeName]health.Result)
+	// health errors are only used to wait for the roll loop to finish
+	// handling the previous health check
+	healthErrs := make(chan error)
+	waitForLoop := func() {
+		healthErrs <- util.Errorf("sync")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rollLoopResult := make(chan bool)
+
+	go func() {
+		rollLoopResult <- upd.rollLoop(ctx, manifest.ID(), healths, healthErrs, false, manifest.GetStatusStanza())
+		close(rollLoopResult)
+	}()
+
+	checks := map[types.NodeName]health.Result{
+		"node1": {Status: health.Passing},
+		"node2": {Status: health.Passing},
+		"node3": {Status: health.Passing},
+	}
+	healths <- checks
+	waitForLoop()
+
+	newRC, err := upd.rcStore.Get(upd.NewRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newRC.ReplicasDesired != 0 {
+		t.Errorf("expected no replicas to be transferred during the freeze but new RC desires %d", newRC.ReplicasDesired)
+	}
+	status, _, err := upd.rollStatusStore.Get(upd.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Phase != rollstatus.PhaseBlocked || !strings.Contains(status.BlockedReason, "holiday") {
+		t.Errorf("expected update to be blocked by the freeze but status was %s: %q", status.Phase, status.BlockedReason)
+	}
+
+	// once the new RC is overridden the update proceeds
+	freeze.Overrides = []rc_fields.ID{upd.NewRC}
+	upd.freezeStore = fakeFreezeStore{freeze}
+	healths <- checks
+	waitForLoop()
+
+	newRC, err = upd.rcStore.Get(upd.NewRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newRC.ReplicasDesired != 1 {
+		t.Errorf("expected a replica to be transferred once the freeze was overridden but new RC desires %d", newRC.ReplicasDesired)
+	}
+
+	cancel()
+	assertRollLoopResult(t, rollLoopResult, false)
+}
+
+// storeUpdate overwrites the stored RU with the update's fields, for tests
+// that need settings updateWithHealth doesn't provide
+func storeUpdate(t *testing.T, upd update) {
+	rollPath, err := rollstore.RollPath(upd.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ruBytes, err := json.Marshal(upd.Update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = upd.consulClient.KV().Put(&api.KVPair{Key: rollPath, Value: ruBytes}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRollLoopRollsOneDomainAtATime(t *testing.T) {
+	upd, _, manifest, _, f := updateWithHealth(t, 3, 0, map[types.NodeName]bool{
+		"node1": true,
+		"node2": true,
+		"node3": true,
+	}, nil, nil, nil, rc_fields.StaticStrategy)
+	defer f()
+	upd.DesiredReplicas = 3
+	upd.MinimumReplicas = 2
+	upd.Topology = &fields.Topology{Key: "zone"}
+
+	fullLabeler := upd.labeler.(testLabeler)
+	for node, zone := range map[string]string{"node1": "a", "node2": "a", "node3": "b"} {
+		err := fullLabeler.SetLabel(labels.NODE, node, "zone", zone)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// make the stored update topology-aware as well
+	storeUpdate(t, upd)
+	rollStore := upd.rollStore.(rollstore.ConsulStore)
+	beforePause := upd.Update
+
+	healths := make(chan map[types.NodeName]health.Result)
+	// health errors are only used to wait for the roll loop to finish
+	// handling the previous health check
+	healthErrs := make(chan error)
+	waitForLoop := func() {
+		healthErrs <- util.Errorf("sync")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rollLoopResult := make(chan bool)
+
+	go func() {
+		rollLoopResult <- upd.rollLoop(ctx, manifest.ID(), healths, healthErrs, false, manifest.GetStatusStanza())
+		close(rollLoopResult)
+	}()
+
+	checks := map[types.NodeName]health.Result{
+		"node1": {Status: health.Passing},
+		"node2": {Status: health.Passing},
+		"node3": {Status: health.Passing},
+	}
+
+	assertDesired := func(id rc_fields.ID, expect int) {
+		rc, err := upd.rcStore.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rc.ReplicasDesired != expect {
+			t.Fatalf("expected replicas desired count to be %d but was %d", expect, rc.ReplicasDesired)
+		}
+	}
+	assertSelector := func(expect string) {
+		rc, err := upd.rcStore.Get(upd.NewRC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rc.NodeSelector.String() != expect {
+			t.Fatalf("expected new RC node selector to be %q but was %q", expect, rc.NodeSelector.String())
+		}
+	}
+	oldRC, err := upd.rcStore.Get(upd.OldRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldSelector := oldRC.NodeSelector.String()
+	assertOldSelector := func() {
+		rc, err := upd.rcStore.Get(upd.OldRC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rc.NodeSelector.String() != oldSelector {
+			t.Fatalf("expected old RC node selector to stay %q but was %q", oldSelector, rc.NodeSelector.String())
+		}
+	}
+
+	// the first tick picks the first domain, the second starts rolling it.
+	// Only the new RC is confined to the domain: the old RC keeps its node
+	// selector and picks its own removals
+	healths <- checks
+	healths <- checks
+	waitForLoop()
+	assertSelector("zone in (a)")
+	assertOldSelector()
+	assertDesired(upd.OldRC, 2)
+	assertDesired(upd.NewRC, 1)
+
+	err = transferNode("node1", manifest, upd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	healths <- checks
+	waitForLoop()
+	assertDesired(upd.OldRC, 1)
+	assertDesired(upd.NewRC, 2)
+
+	// domain b must not be started until domain a is finished and the
+	// update is resumed
+	err = transferNode("node2", manifest, upd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	healths <- checks
+	healths <- checks
+	waitForLoop()
+	assertDesired(upd.OldRC, 1)
+	assertDesired(upd.NewRC, 2)
+	assertSelector("zone in (a,b)")
+	assertOldSelector()
+
+	ru, err := rollStore.Get(upd.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ru.Paused {
+		t.Error("expected update to be paused after finishing the first domain")
+	}
+	if ru.Topology == nil || ru.Topology.Domain != "b" || len(ru.Topology.Completed) != 1 || ru.Topology.Completed[0] != "a" {
+		t.Errorf("expected update to have completed domain a and be on domain b but topology was %+v", ru.Topology)
+	}
+
+	status, _, err := upd.rollStatusStore.Get(upd.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Phase != rollstatus.PhasePaused {
+		t.Errorf("expected phase to be %s but was %s", rollstatus.PhasePaused, status.Phase)
+	}
+
+	// the update from before it paused itself must not resume it
+	upd.Watched(beforePause)
+	healths <- checks
+	waitForLoop()
+	assertDesired(upd.OldRC, 1)
+	assertDesired(upd.NewRC, 2)
+
+	stored, err := rollStore.SetPaused(upd.ID(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upd.Watched(stored)
+	healths <- checks
+	waitForLoop()
+	assertDesired(upd.OldRC, 0)
+	assertDesired(upd.NewRC, 3)
+
+	err = transferNode("node3", manifest, upd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	healths <- checks
+	assertRollLoopResult(t, rollLoopResult, true)
+	assertSelector("")
+}
+
+func TestRollLoopBlueGreen(t *testing.T) {
+	upd, _, manifest, _, f := updateWithHealth(t, 3, 0, map[types.NodeName]bool{
+		"node1": true,
+		"node2": true,
+		"node3": true,
+	}, nil, nil, nil, rc_fields.StaticStrategy)
+	defer f()
+	upd.DesiredReplicas = 3
+	upd.BlueGreen = &fields.BlueGreen{}
+	storeUpdate(t, upd)
+
+	applicator := upd.labeler.(labels.Applicator)
+	upd.nodeLabeler = applicator
+	upd.scheduler = scheduler.NewApplicatorScheduler(applicator)
+	for i := 1; i <= 6; i++ {
+		err := applicator.SetLabel(labels.NODE, fmt.Sprintf("node%d", i), "role", "web")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	healths := make(chan map[types.NodeName]health.Result)
+	// health errors are only used to wait for the roll loop to finish
+	// handling the previous health check
+	healthErrs := make(chan error)
+	waitForLoop := func() {
+		healthErrs <- util.Errorf("sync")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rollLoopResult := make(chan bool)
+
+	go func() {
+		rollLoopResult <- upd.rollLoop(ctx, manifest.ID(), healths, healthErrs, false, manifest.GetStatusStanza())
+		close(rollLoopResult)
+	}()
+
+	checks := map[types.NodeName]health.Result{
+		"node1": {Status: health.Passing},
+		"node2": {Status: health.Passing},
+		"node3": {Status: health.Passing},
+	}
+
+	assertDesired := func(id rc_fields.ID, expect int) {
+		rc, err := upd.rcStore.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rc.ReplicasDesired != expect {
+			t.Fatalf("expected replicas desired count to be %d but was %d", expect, rc.ReplicasDesired)
+		}
+	}
+
+	// the new RC is scaled up all at once without touching the old RC
+	healths <- checks
+	waitForLoop()
+	assertDesired(upd.OldRC, 3)
+	assertDesired(upd.NewRC, 3)
+
+	newRC, err := upd.rcStore.Get(upd.NewRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !newRC.NodeSelector.Matches(klabels.Set{BlueGreenLabel: upd.NewRC.String()}) || newRC.NodeSelector.Matches(klabels.Set{}) {
+		t.Errorf("expected new RC to be restricted to blue/green nodes but its node selector was %q", newRC.NodeSelector.String())
+	}
+	for _, node := range []types.NodeName{"node4", "node5", "node6"} {
+		nodeLabels, err := applicator.GetLabels(labels.NODE, node.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nodeLabels.Labels[BlueGreenLabel] != upd.NewRC.String() {
+			t.Errorf("expected %s to be labeled for the new RC", node)
+		}
+	}
+
+	// the old RC must not be touched until every new node is healthy
+	for _, node := range []types.NodeName{"node4", "node5", "node6"} {
+		err = transferNode(node, manifest, upd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checks[node] = health.Result{Status: health.Critical}
+	}
+	checks["node4"] = health.Result{Status: health.Passing}
+	healths <- checks
+	waitForLoop()
+	assertDesired(upd.OldRC, 3)
+
+	checks["node5"] = health.Result{Status: health.Passing}
+	checks["node6"] = health.Result{Status: health.Passing}
+	healths <- checks
+	waitForLoop()
+	assertDesired(upd.OldRC, 0)
+	assertDesired(upd.NewRC, 3)
+
+	healths <- checks
+	assertRollLoopResult(t, rollLoopResult, true)
+
+	newRC, err = upd.rcStore.Get(upd.NewRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newRC.NodeSelector.String() != "" {
+		t.Errorf("expected new RC's node selector to be restored but it was %q", newRC.NodeSelector.String())
+	}
+	nodeLabels, err := applicator.GetLabels(labels.NODE, "node4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := nodeLabels.Labels[BlueGreenLabel]; ok {
+		t.Error("expected blue/green label to be removed after the cut over")
+	}
+
+	als, err := upd.auditLogStore.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(als) != 1 {
+		t.Fatalf("expected 1 audit log record but there were %d", len(als))
+	}
+	for _, al := range als {
+		if al.EventType != audit.RUCutOverEvent {
+			t.Errorf("expected audit log record of type %s but was %s", audit.RUCutOverEvent, al.EventType)
+		}
+	}
+}
+
 func failIfRCDesireChanges(t *testing.T, rcCh <-chan rc_fields.RC, expected int) {
 	for rc := range rcCh {
 		if rc.ReplicasDesired != expected {
@@ -0,0 +1,470 @@
+package scheduler
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/cordon"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/manifest"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/size"
+)
+
+const (
+	// CPUCapacityLabel is the node label holding the number of logical CPUs
+	// pods may use on the node
+	CPUCapacityLabel = "p2_cpus"
+
+	// MemoryCapacityLabel is the node label holding the amount of memory
+	// pods may use on the node, e.g. "64G"
+	MemoryCapacityLabel = "p2_memory"
+)
+
+type PodLister interface {
+	ListPods(podPrefix consul.PodPrefix, nodename types.NodeName) ([]consul.ManifestResult, time.Duration, error)
+}
+
+// Resources are the CPUs and memory a pod requests or a node offers
+type Resources struct {
+	CPUs   int
+	Memory size.ByteCount
+}
+
+func (r Resources) add(other Resources) Resources {
+	return Resources{CPUs: r.CPUs + other.CPUs, Memory: r.Memory + other.Memory}
+}
+
+func (r Resources) sub(other Resources) Resources {
+	return Resources{CPUs: r.CPUs - other.CPUs, Memory: r.Memory - other.Memory}
+}
+
+// ManifestResources returns the resources a pod requests. The pod's cgroup is
+// used when it has one, otherwise the cgroups of its launchables are summed.
+func ManifestResources(man manifest.Manifest) Resources {
+	if cgroup := man.GetResourceLimits().Cgroup; cgroup != nil {
+		return Resources{CPUs: cgroup.CPUs, Memory: cgroup.Memory}
+	}
+
+	var ret Resources
+	for _, stanza := range man.GetLaunchableStanzas() {
+		ret = ret.add(Resources{CPUs: stanza.CgroupConfig.CPUs, Memory: stanza.CgroupConfig.Memory})
+	}
+	return ret
+}
+
+// nodeCapacity returns the resources a node offers according to its labels,
+// or false if the node doesn't declare one of them
+func nodeCapacity(nodeLabels klabels.Set) (Resources, bool, error) {
+	if !nodeLabels.Has(CPUCapacityLabel) || !nodeLabels.Has(MemoryCapacityLabel) {
+		return Resources{}, false, nil
+	}
+
+	cpus, err := strconv.Atoi(nodeLabels.Get(CPUCapacityLabel))
+	if err != nil {
+		return Resources{}, false, util.Errorf("could not parse %s label: %s", CPUCapacityLabel, err)
+	}
+	memory, err := size.Parse(nodeLabels.Get(MemoryCapacityLabel))
+	if err != nil {
+		return Resources{}, false, util.Errorf("could not parse %s label: %s", MemoryCapacityLabel, err)
+	}
+	return Resources{CPUs: cpus, Memory: memory}, true, nil
+}
+
+type reservation struct {
+	podID     types.PodID
+	resources Resources
+}
+
+type reservationKey struct {
+	nodeSelector string
+	node         types.NodeName
+}
+
+// BinPackingScheduler only considers nodes that have room for a pod, based on
+// each node's capacity labels and the pods already scheduled on it, and
+// allocates the nodes the pod fits most tightly on. Nodes without capacity
+// labels are only eligible for pods that don't request any resources.
+//
+// Allocated nodes have the pod's resources reserved until they are
+// deallocated or the pod appears in the node's intent, so that concurrent
+// allocations don't overcommit a node in between. Reservations are held in
+// memory.
+type BinPackingScheduler struct {
+	labeler NodeLabeler
+	pods    PodLister
+
+	mu           sync.Mutex
+	reservations map[reservationKey][]reservation
+}
+
+func NewBinPackingScheduler(labeler NodeLabeler, pods PodLister) *BinPackingScheduler {
+	return &BinPackingScheduler{
+		labeler:      labeler,
+		pods:         pods,
+		reservations: make(map[reservationKey][]reservation),
+	}
+}
+
+// candidate is a node that has room for a pod
+type candidate struct {
+	node   types.NodeName
+	labels klabels.Set
+
+	// lower scores are tighter fits
+	score float64
+}
+
+type byScore []candidate
+
+func (c byScore) Len() int      { return len(c) }
+func (c byScore) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c byScore) Less(i, j int) bool {
+	if c[i].score != c[j].score {
+		return c[i].score < c[j].score
+	}
+	return c[i].node < c[j].node
+}
+
+// EligibleNodes returns the nodes matching the selector that have room for
+// the pod, tightest fit first. Pods with the manifest's ID don't count against
+// a node, since the pod would replace them.
+func (s *BinPackingScheduler) EligibleNodes(man manifest.Manifest, selector klabels.Selector) ([]types.NodeName, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	candidates, err := s.candidates(man, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]types.NodeName, len(candidates))
+	for i, c := range candidates {
+		ret[i] = c.node
+	}
+	return ret, nil
+}
+
+// AllocateNodes picks the nodes the pod fits most tightly on, skipping nodes
+// the RC already has pods on, cordoned nodes, and nodes that break its spread
+// constraints, and reserves the pod's resources on them. Unless force is set, either every
+// requested node is allocated or none are.
+func (s *BinPackingScheduler) AllocateNodes(man manifest.Manifest, selector klabels.Selector, allocationCount int, force bool, spread rc_fields.Spread) ([]types.NodeName, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	candidates, err := s.candidates(man, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	current := types.NewNodeSet(spread.CurrentNodes...)
+	domains := newDomainCounts(spread, candidates)
+
+	requested := ManifestResources(man)
+	var allocated []types.NodeName
+	for _, c := range candidates {
+		if len(allocated) >= allocationCount {
+			break
+		}
+		if current.Has(c.node.String()) || c.labels.Has(cordon.StateLabel) || !domains.allows(c.labels) {
+			continue
+		}
+		allocated = append(allocated, c.node)
+		domains.add(c.labels)
+	}
+
+	if len(allocated) < allocationCount && !force {
+		return nil, util.Errorf("only %d of %d requested nodes have room for %s", len(allocated), allocationCount, man.ID())
+	}
+
+	for _, node := range allocated {
+		key := reservationKey{nodeSelector: selector.String(), node: node}
+		s.reservations[key] = append(s.reservations[key], reservation{podID: man.ID(), resources: requested})
+	}
+	return allocated, nil
+}
+
+// DeallocateNodes frees a reservation made by AllocateNodes with the same
+// selector on each of the nodes. Nodes without a reservation are ignored.
+func (s *BinPackingScheduler) DeallocateNodes(selector klabels.Selector, nodes []types.NodeName) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, node := range nodes {
+		key := reservationKey{nodeSelector: selector.String(), node: node}
+		reservations := s.reservations[key]
+		switch len(reservations) {
+		case 0:
+		case 1:
+			delete(s.reservations, key)
+		default:
+			s.reservations[key] = reservations[:len(reservations)-1]
+		}
+	}
+	return nil
+}
+
+// Preemption is a node that would have room for a pod if the victim pods were
+// removed from it
+type Preemption struct {
+	Node    types.NodeName
+	Victims []types.PodID
+}
+
+type byVictims []Preemption
+
+func (p byVictims) Len() int      { return len(p) }
+func (p byVictims) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p byVictims) Less(i, j int) bool {
+	if len(p[i].Victims) != len(p[j].Victims) {
+		return len(p[i].Victims) < len(p[j].Victims)
+	}
+	return p[i].Node < p[j].Node
+}
+
+// PreemptionCandidates returns the nodes matching the selector that don't
+// have room for the pod but would if some of the pods on them were removed.
+// Only pods that evictable returns true for are considered, the largest
+// first, and nodes needing the fewest evictions are returned first.
+// Cordoned nodes are skipped.
+func (s *BinPackingScheduler) PreemptionCandidates(man manifest.Manifest, selector klabels.Selector, evictable func(types.PodLocation) bool) ([]Preemption, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nodes, err := s.labeler.GetMatches(selector, labels.NODE)
+	if err != nil {
+		return nil, err
+	}
+
+	requested := ManifestResources(man)
+	var ret []Preemption
+	for _, node := range nodes {
+		nodeName := types.NodeName(node.ID)
+		capacity, ok, err := nodeCapacity(node.Labels)
+		if err != nil {
+			return nil, util.Errorf("node %s has invalid capacity: %s", nodeName, err)
+		}
+		// nodes without capacity labels have no room to make
+		if !ok || node.Labels.Has(cordon.StateLabel) {
+			continue
+		}
+
+		used, err := s.used(nodeName, man.ID())
+		if err != nil {
+			return nil, err
+		}
+		remaining := capacity.sub(used).sub(requested)
+		if fits(remaining) {
+			continue
+		}
+
+		results, _, err := s.pods.ListPods(consul.INTENT_TREE, nodeName)
+		if err != nil {
+			return nil, util.Errorf("could not list pods on %s: %s", nodeName, err)
+		}
+		var candidates []manifest.Manifest
+		for _, result := range results {
+			podID := result.Manifest.ID()
+			if podID != man.ID() && evictable(types.PodLocation{Node: nodeName, PodID: podID}) {
+				candidates = append(candidates, result.Manifest)
+			}
+		}
+		sort.Sort(largestFirst{manifests: candidates, capacity: capacity})
+
+		var victims []types.PodID
+		for _, candidate := range candidates {
+			if fits(remaining) {
+				break
+			}
+			remaining = remaining.add(ManifestResources(candidate))
+			victims = append(victims, candidate.ID())
+		}
+		if fits(remaining) {
+			ret = append(ret, Preemption{Node: nodeName, Victims: victims})
+		}
+	}
+
+	sort.Sort(byVictims(ret))
+	return ret, nil
+}
+
+func fits(remaining Resources) bool {
+	return remaining.CPUs >= 0 && remaining.Memory >= 0
+}
+
+// largestFirst sorts manifests by the share of a node's capacity they use
+type largestFirst struct {
+	manifests []manifest.Manifest
+	capacity  Resources
+}
+
+func (l largestFirst) Len() int      { return len(l.manifests) }
+func (l largestFirst) Swap(i, j int) { l.manifests[i], l.manifests[j] = l.manifests[j], l.manifests[i] }
+func (l largestFirst) Less(i, j int) bool {
+	return l.share(l.manifests[i]) > l.share(l.manifests[j])
+}
+
+func (l largestFirst) share(man manifest.Manifest) float64 {
+	r := ManifestResources(man)
+	return fraction(float64(r.CPUs), float64(l.capacity.CPUs)) + fraction(float64(r.Memory), float64(l.capacity.Memory))
+}
+
+// candidates returns the nodes matching the selector that have room for the
+// pod, sorted by score. s.mu must be held.
+func (s *BinPackingScheduler) candidates(man manifest.Manifest, selector klabels.Selector) ([]candidate, error) {
+	nodes, err := s.labeler.GetMatches(selector, labels.NODE)
+	if err != nil {
+		return nil, err
+	}
+
+	requested := ManifestResources(man)
+	var ret []candidate
+	for _, node := range nodes {
+		nodeName := types.NodeName(node.ID)
+		capacity, ok, err := nodeCapacity(node.Labels)
+		if err != nil {
+			return nil, util.Errorf("node %s has invalid capacity: %s", nodeName, err)
+		}
+		if !ok {
+			if requested == (Resources{}) {
+				ret = append(ret, candidate{node: nodeName, labels: node.Labels, score: 1})
+			}
+			continue
+		}
+
+		used, err := s.used(nodeName, man.ID())
+		if err != nil {
+			return nil, err
+		}
+		remaining := capacity.sub(used).sub(requested)
+		if !fits(remaining) {
+			continue
+		}
+		ret = append(ret, candidate{
+			node:   nodeName,
+			labels: node.Labels,
+			score:  fraction(float64(remaining.CPUs), float64(capacity.CPUs)) + fraction(float64(remaining.Memory), float64(capacity.Memory)),
+		})
+	}
+
+	sort.Sort(byScore(ret))
+	return ret, nil
+}
+
+// used sums the resources of the pods scheduled on the node and of the
+// reservations on it for pods that haven't been scheduled yet. Reservations
+// for pods that have been scheduled are dropped. The given pod ID is not
+// counted. s.mu must be held.
+func (s *BinPackingScheduler) used(node types.NodeName, exclude types.PodID) (Resources, error) {
+	results, _, err := s.pods.ListPods(consul.INTENT_TREE, node)
+	if err != nil {
+		return Resources{}, util.Errorf("could not list pods on %s: %s", node, err)
+	}
+
+	var used Resources
+	scheduled := make(map[types.PodID]bool)
+	for _, result := range results {
+		podID := result.Manifest.ID()
+		scheduled[podID] = true
+		if podID != exclude {
+			used = used.add(ManifestResources(result.Manifest))
+		}
+	}
+	for key, reservations := range s.reservations {
+		if key.node != node {
+			continue
+		}
+		var pending []reservation
+		for _, r := range reservations {
+			if scheduled[r.podID] {
+				continue
+			}
+			pending = append(pending, r)
+			if r.podID != exclude {
+				used = used.add(r.resources)
+			}
+		}
+		if len(pending) == 0 {
+			delete(s.reservations, key)
+		} else {
+			s.reservations[key] = pending
+		}
+	}
+	return used, nil
+}
+
+func fraction(part float64, whole float64) float64 {
+	if whole <= 0 {
+		return 0
+	}
+	return part / whole
+}
+
+// domainCounts tracks the number of an RC's pods in each value of its spread
+// constraints' topology keys
+type domainCounts struct {
+	constraints []rc_fields.SpreadConstraint
+	counts      []map[string]int
+}
+
+func newDomainCounts(spread rc_fields.Spread, candidates []candidate) domainCounts {
+	current := types.NewNodeSet(spread.CurrentNodes...)
+	d := domainCounts{constraints: spread.Constraints}
+	for _, constraint := range spread.Constraints {
+		counts := make(map[string]int)
+		for _, c := range candidates {
+			if !c.labels.Has(constraint.TopologyKey) {
+				continue
+			}
+			domain := c.labels.Get(constraint.TopologyKey)
+			if current.Has(c.node.String()) {
+				counts[domain]++
+			} else if _, ok := counts[domain]; !ok {
+				counts[domain] = 0
+			}
+		}
+		d.counts = append(d.counts, counts)
+	}
+	return d
+}
+
+// allows returns whether adding a pod to a node with the given labels keeps
+// every spread constraint satisfied
+func (d domainCounts) allows(nodeLabels klabels.Set) bool {
+	for i, constraint := range d.constraints {
+		if !nodeLabels.Has(constraint.TopologyKey) {
+			return false
+		}
+		count := d.counts[i][nodeLabels.Get(constraint.TopologyKey)]
+		if constraint.OnePerValue {
+			if count > 0 {
+				return false
+			}
+			continue
+		}
+		least := count
+		for _, other := range d.counts[i] {
+			if other < least {
+				least = other
+			}
+		}
+		if count+1-least > constraint.MaxSkew {
+			return false
+		}
+	}
+	return true
+}
+
+func (d domainCounts) add(nodeLabels klabels.Set) {
+	for i, constraint := range d.constraints {
+		d.counts[i][nodeLabels.Get(constraint.TopologyKey)]++
+	}
+}
@@ -0,0 +1,265 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/cgroups"
+	"github.com/square/p2/pkg/cordon"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/manifest"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util/size"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+type fakePodLister map[types.NodeName][]manifest.Manifest
+
+func (f fakePodLister) ListPods(_ consul.PodPrefix, node types.NodeName) ([]consul.ManifestResult, time.Duration, error) {
+	var ret []consul.ManifestResult
+	for _, man := range f[node] {
+		ret = append(ret, consul.ManifestResult{Manifest: man})
+	}
+	return ret, 0, nil
+}
+
+func testManifest(id types.PodID, cpus int, memory size.ByteCount) manifest.Manifest {
+	builder := manifest.NewBuilder()
+	builder.SetID(id)
+	builder.SetResourceLimits(manifest.ResourceLimitsStanza{
+		Cgroup: &cgroups.Config{CPUs: cpus, Memory: memory},
+	})
+	return builder.GetManifest()
+}
+
+func setupBinPacking(t *testing.T, pods fakePodLister) *BinPackingScheduler {
+	applicator := labels.NewFakeApplicator()
+	nodes := map[string]map[string]string{
+		"small": {CPUCapacityLabel: "4", MemoryCapacityLabel: "8G", "zone": "a"},
+		"large": {CPUCapacityLabel: "16", MemoryCapacityLabel: "64G", "zone": "b"},
+		"bare":  {"zone": "a"},
+	}
+	for node, nodeLabels := range nodes {
+		err := applicator.SetLabels(labels.NODE, node, nodeLabels)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewBinPackingScheduler(applicator, pods)
+}
+
+func TestEligibleNodesOrdersByBestFit(t *testing.T) {
+	s := setupBinPacking(t, fakePodLister{})
+
+	nodes, err := s.EligibleNodes(testManifest("web", 2, 4*size.Gibibyte), klabels.Everything())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 || nodes[0] != "small" || nodes[1] != "large" {
+		t.Errorf("expected [small large], got %s", nodes)
+	}
+}
+
+func TestEligibleNodesExcludesFullNodes(t *testing.T) {
+	s := setupBinPacking(t, fakePodLister{
+		"small": {testManifest("other", 3, size.Gibibyte)},
+	})
+
+	nodes, err := s.EligibleNodes(testManifest("web", 2, 4*size.Gibibyte), klabels.Everything())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0] != "large" {
+		t.Errorf("expected [large], got %s", nodes)
+	}
+
+	// a pod with the same ID would be replaced, so it doesn't count
+	nodes, err = s.EligibleNodes(testManifest("other", 4, size.Gibibyte), klabels.Everything())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 {
+		t.Errorf("expected both nodes with capacity to be eligible, got %s", nodes)
+	}
+}
+
+func TestEligibleNodesWithoutCapacityLabels(t *testing.T) {
+	s := setupBinPacking(t, fakePodLister{})
+
+	nodes, err := s.EligibleNodes(testManifest("web", 0, 0), klabels.Everything())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 3 {
+		t.Errorf("expected a pod without resources to fit everywhere, got %s", nodes)
+	}
+}
+
+func TestAllocateNodesReservesUntilDeallocated(t *testing.T) {
+	s := setupBinPacking(t, fakePodLister{})
+	man := testManifest("web", 3, 4*size.Gibibyte)
+
+	nodes, err := s.AllocateNodes(man, klabels.Everything(), 1, false, rc_fields.Spread{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0] != "small" {
+		t.Fatalf("expected [small], got %s", nodes)
+	}
+
+	other := testManifest("other", 2, size.Gibibyte)
+	eligible, err := s.EligibleNodes(other, klabels.Everything())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eligible) != 1 || eligible[0] != "large" {
+		t.Errorf("expected the reservation to leave only large eligible, got %s", eligible)
+	}
+
+	err = s.DeallocateNodes(klabels.Everything(), nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eligible, err = s.EligibleNodes(other, klabels.Everything())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eligible) != 2 {
+		t.Errorf("expected deallocation to free small, got %s", eligible)
+	}
+}
+
+func TestAllocateNodesDropsReservationsOfScheduledPods(t *testing.T) {
+	pods := fakePodLister{}
+	s := setupBinPacking(t, pods)
+	man := testManifest("web", 3, 4*size.Gibibyte)
+
+	nodes, err := s.AllocateNodes(man, klabels.Everything(), 1, false, rc_fields.Spread{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0] != "small" {
+		t.Fatalf("expected [small], got %s", nodes)
+	}
+
+	pods["small"] = []manifest.Manifest{man}
+	_, err = s.AllocateNodes(testManifest("other", 1, size.Gibibyte), klabels.Everything(), 1, false, rc_fields.Spread{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, reservations := range s.reservations {
+		for _, r := range reservations {
+			if key.node == "small" && r.podID == "web" {
+				t.Errorf("expected the reservation for web to be dropped once it was scheduled")
+			}
+		}
+	}
+}
+
+func TestAllocateNodesAllOrNothing(t *testing.T) {
+	s := setupBinPacking(t, fakePodLister{})
+	man := testManifest("web", 8, 4*size.Gibibyte)
+
+	_, err := s.AllocateNodes(man, klabels.Everything(), 2, false, rc_fields.Spread{})
+	if err == nil {
+		t.Fatal("expected an error allocating more nodes than have room")
+	}
+	if len(s.reservations) != 0 {
+		t.Errorf("expected a failed allocation not to reserve anything, got %d reservations", len(s.reservations))
+	}
+
+	nodes, err := s.AllocateNodes(man, klabels.Everything(), 2, true, rc_fields.Spread{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0] != "large" {
+		t.Errorf("expected a forced allocation to return [large], got %s", nodes)
+	}
+}
+
+func TestAllocateNodesSkipsCurrentNodes(t *testing.T) {
+	s := setupBinPacking(t, fakePodLister{})
+	man := testManifest("web", 1, size.Gibibyte)
+
+	nodes, err := s.AllocateNodes(man, klabels.Everything(), 1, false, rc_fields.Spread{
+		CurrentNodes: []types.NodeName{"small"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0] != "large" {
+		t.Errorf("expected [large], got %s", nodes)
+	}
+}
+
+func TestAllocateNodesSkipsCordonedNodes(t *testing.T) {
+	applicator := labels.NewFakeApplicator()
+	err := applicator.SetLabels(labels.NODE, "small", map[string]string{
+		CPUCapacityLabel:    "4",
+		MemoryCapacityLabel: "8G",
+		cordon.StateLabel:   string(cordon.Cordoned),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = applicator.SetLabels(labels.NODE, "large", map[string]string{CPUCapacityLabel: "16", MemoryCapacityLabel: "64G"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewBinPackingScheduler(applicator, fakePodLister{})
+
+	nodes, err := s.AllocateNodes(testManifest("web", 1, size.Gibibyte), klabels.Everything(), 1, false, rc_fields.Spread{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0] != "large" {
+		t.Errorf("expected [large], got %s", nodes)
+	}
+}
+
+func TestPreemptionCandidatesEvictsFewestPods(t *testing.T) {
+	s := setupBinPacking(t, fakePodLister{
+		"small": {testManifest("batch1", 2, size.Gibibyte), testManifest("batch2", 2, size.Gibibyte)},
+		"large": {testManifest("batch3", 10, size.Gibibyte), testManifest("protected", 6, size.Gibibyte)},
+	})
+	evictable := func(pod types.PodLocation) bool {
+		return pod.PodID != "protected"
+	}
+
+	// web needs 4 CPUs, so it needs all of small or one pod off large
+	preemptions, err := s.PreemptionCandidates(testManifest("web", 4, size.Gibibyte), klabels.Everything(), evictable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preemptions) != 2 {
+		t.Fatalf("expected both nodes with capacity to be candidates, got %+v", preemptions)
+	}
+	if preemptions[0].Node != "large" || len(preemptions[0].Victims) != 1 || preemptions[0].Victims[0] != "batch3" {
+		t.Errorf("expected evicting batch3 from large to come first, got %+v", preemptions[0])
+	}
+	if preemptions[1].Node != "small" || len(preemptions[1].Victims) != 2 {
+		t.Errorf("expected evicting both pods from small to come second, got %+v", preemptions[1])
+	}
+}
+
+func TestPreemptionCandidatesSkipsNodesWithRoomOrNoVictims(t *testing.T) {
+	s := setupBinPacking(t, fakePodLister{
+		"large": {testManifest("protected", 14, size.Gibibyte)},
+	})
+	evictable := func(pod types.PodLocation) bool {
+		return pod.PodID != "protected"
+	}
+
+	// small already has room, and large can't make room without evicting
+	// the protected pod
+	preemptions, err := s.PreemptionCandidates(testManifest("web", 4, size.Gibibyte), klabels.Everything(), evictable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preemptions) != 0 {
+		t.Errorf("expected no preemption candidates, got %+v", preemptions)
+	}
+}
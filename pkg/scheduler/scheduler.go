@@ -5,6 +5,7 @@ import (
 
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/manifest"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
 )
@@ -36,7 +37,7 @@ func (sel *ApplicatorScheduler) EligibleNodes(_ manifest.Manifest, selector klab
 	return result, nil
 }
 
-func (sel *ApplicatorScheduler) AllocateNodes(manifest.Manifest, klabels.Selector, int, bool) ([]types.NodeName, error) {
+func (sel *ApplicatorScheduler) AllocateNodes(manifest.Manifest, klabels.Selector, int, bool, rc_fields.Spread) ([]types.NodeName, error) {
 	return nil, util.Errorf("AllocateNodes() not yet implemented")
 }
 
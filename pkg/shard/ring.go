@@ -0,0 +1,81 @@
+package shard
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// pointsPerMember is the number of points each member has on the ring. More
+// points spread IDs more evenly between members.
+const pointsPerMember = 128
+
+type point struct {
+	hash   uint32
+	member string
+}
+
+type byHash []point
+
+func (p byHash) Len() int      { return len(p) }
+func (p byHash) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p byHash) Less(i, j int) bool {
+	if p[i].hash != p[j].hash {
+		return p[i].hash < p[j].hash
+	}
+	return p[i].member < p[j].member
+}
+
+// Ring assigns IDs to members by consistent hashing. When a member joins or
+// leaves, only the IDs it gains or loses change owners.
+type Ring struct {
+	points  []point
+	members []string
+}
+
+func NewRing(members []string) Ring {
+	unique := make(map[string]bool)
+	var ring Ring
+	for _, member := range members {
+		if unique[member] {
+			continue
+		}
+		unique[member] = true
+		ring.members = append(ring.members, member)
+		for i := 0; i < pointsPerMember; i++ {
+			ring.points = append(ring.points, point{
+				hash:   hash(member + "#" + strconv.Itoa(i)),
+				member: member,
+			})
+		}
+	}
+	sort.Strings(ring.members)
+	sort.Sort(byHash(ring.points))
+	return ring
+}
+
+// Owner returns the member the ID is assigned to, or false if the ring has no
+// members
+func (r Ring) Owner(id string) (string, bool) {
+	if len(r.points) == 0 {
+		return "", false
+	}
+
+	h := hash(id)
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= h
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].member, true
+}
+
+// Members returns the members of the ring in sorted order
+func (r Ring) Members() []string {
+	return append([]string(nil), r.members...)
+}
+
+func hash(s string) uint32 {
+	return crc32.ChecksumIEEE([]byte(s))
+}
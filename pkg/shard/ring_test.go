@@ -0,0 +1,64 @@
+package shard
+
+import (
+	"fmt"
+	"testing"
+)
+
+func testIDs(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("6c1d8f2e-%04d-4b6a-9f3e-%012d", i, i*7919)
+	}
+	return ids
+}
+
+func TestEmptyRingOwnsNothing(t *testing.T) {
+	_, ok := NewRing(nil).Owner("some_id")
+	if ok {
+		t.Fatal("expected an empty ring to have no owner")
+	}
+}
+
+func TestRingSpreadsIDs(t *testing.T) {
+	ring := NewRing([]string{"a", "b", "c", "d"})
+	counts := make(map[string]int)
+	ids := testIDs(4000)
+	for _, id := range ids {
+		owner, ok := ring.Owner(id)
+		if !ok {
+			t.Fatalf("expected %s to have an owner", id)
+		}
+		counts[owner]++
+	}
+
+	for _, member := range ring.Members() {
+		// each member should own roughly a quarter of the IDs
+		if counts[member] < 600 || counts[member] > 1400 {
+			t.Errorf("expected %s to own about 1000 of 4000 IDs, owned %d", member, counts[member])
+		}
+	}
+}
+
+func TestRingOnlyMovesIDsOfChangedMember(t *testing.T) {
+	before := NewRing([]string{"a", "b", "c"})
+	after := NewRing([]string{"a", "b", "c", "d"})
+
+	for _, id := range testIDs(2000) {
+		oldOwner, _ := before.Owner(id)
+		newOwner, _ := after.Owner(id)
+		if oldOwner != newOwner && newOwner != "d" {
+			t.Fatalf("expected %s to stay on %s or move to the new member, moved to %s", id, oldOwner, newOwner)
+		}
+	}
+
+	// removing a member again restores the old assignment
+	removed := NewRing([]string{"c", "b", "a"})
+	for _, id := range testIDs(2000) {
+		oldOwner, _ := before.Owner(id)
+		newOwner, _ := removed.Owner(id)
+		if oldOwner != newOwner {
+			t.Fatalf("expected %s to be owned by %s regardless of member order, was %s", id, oldOwner, newOwner)
+		}
+	}
+}
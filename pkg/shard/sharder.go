@@ -0,0 +1,158 @@
+// Package shard splits the work of farms, such as the RC, rolling update and
+// daemon set farms, between the instances running them. Each instance
+// registers itself in a group in Consul and owns the IDs that consistent
+// hashing assigns to it, so instances don't compete for every lock.
+package shard
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+)
+
+// How long to wait before registering again after it fails, for example
+// because a member's previous session hasn't expired yet
+const registerRetryInterval = 5 * time.Second
+
+type Store interface {
+	Register(group string, member string, session string) error
+	WatchMembers(group string, quit <-chan struct{}) (<-chan []string, <-chan error)
+}
+
+// Sharder splits the IDs a farm works on between the farm instances sharing
+// it.
+//
+// Farms only lock the IDs they own, but still watch every ID and skip the
+// ones they don't own. IDs are random UUIDs stored under a single prefix, so
+// there is no range of keys that corresponds to a member's share of the ring
+// for Consul to return.
+type Sharder interface {
+	// Owns returns whether this instance should work on the ID
+	Owns(id string) bool
+
+	// Subscribe returns a channel that receives a value whenever the IDs
+	// this instance owns may have changed
+	Subscribe() <-chan struct{}
+}
+
+// RingSharder tracks the members of a group of farm instances and decides
+// which IDs this instance owns. Membership is held by the instance's session, so
+// when an instance's session expires its IDs move to the remaining members
+// once their own locks on them expire too.
+//
+// Nothing is owned until the instance has registered and seen itself among
+// the members, or after its session ends.
+type RingSharder struct {
+	store    Store
+	group    string
+	member   string
+	sessions <-chan string
+	logger   logging.Logger
+
+	mu          sync.RWMutex
+	ring        Ring
+	subscribers []chan struct{}
+}
+
+func NewRingSharder(store Store, group string, member string, sessions <-chan string, logger logging.Logger) *RingSharder {
+	return &RingSharder{
+		store:    store,
+		group:    group,
+		member:   member,
+		sessions: sessions,
+		logger: logger.SubLogger(logrus.Fields{
+			"shard_group":  group,
+			"shard_member": member,
+		}),
+	}
+}
+
+// Start is a blocking function that registers this instance whenever it has
+// a session and follows the group's membership. Closing the quit channel
+// will cause this function to return.
+func (s *RingSharder) Start(quit <-chan struct{}) {
+	consulutil.WithSession(quit, s.sessions, func(sessionQuit <-chan struct{}, session string) {
+		defer s.setRing(NewRing(nil))
+
+		for {
+			err := s.store.Register(s.group, s.member, session)
+			if err == nil {
+				break
+			}
+			s.logger.WithError(err).Errorln("Could not register farm instance")
+			select {
+			case <-sessionQuit:
+				return
+			case <-time.After(registerRetryInterval):
+			}
+		}
+		s.logger.NoFields().Infoln("Registered farm instance")
+
+		membersCh, errCh := s.store.WatchMembers(s.group, sessionQuit)
+		for {
+			select {
+			case <-sessionQuit:
+				s.logger.NoFields().Infoln("Session expired, giving up owned IDs")
+				return
+			case err := <-errCh:
+				s.logger.WithError(err).Errorln("Could not watch farm instances")
+			case members, ok := <-membersCh:
+				if !ok {
+					return
+				}
+				s.setRing(NewRing(members))
+			}
+		}
+	})
+}
+
+// Owns returns whether this instance should work on the given ID
+func (s *RingSharder) Owns(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	owner, ok := s.ring.Owner(id)
+	return ok && owner == s.member
+}
+
+// Subscribe returns a channel that receives a value whenever the IDs this
+// instance owns may have changed. Values are dropped while one is pending.
+func (s *RingSharder) Subscribe() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch := make(chan struct{}, 1)
+	s.subscribers = append(s.subscribers, ch)
+	return ch
+}
+
+func (s *RingSharder) setRing(ring Ring) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if equalMembers(s.ring.Members(), ring.Members()) {
+		return
+	}
+
+	s.logger.WithField("members", ring.Members()).Infoln("Farm instances changed")
+	s.ring = ring
+	for _, ch := range s.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func equalMembers(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
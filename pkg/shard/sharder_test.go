@@ -0,0 +1,83 @@
+package shard
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+)
+
+type fakeStore struct {
+	registered chan string
+	members    chan []string
+}
+
+func (f fakeStore) Register(group string, member string, session string) error {
+	f.registered <- member
+	return nil
+}
+
+func (f fakeStore) WatchMembers(group string, quit <-chan struct{}) (<-chan []string, <-chan error) {
+	return f.members, nil
+}
+
+func ownedBy(ring Ring, member string) string {
+	for _, id := range testIDs(100) {
+		if owner, _ := ring.Owner(id); owner == member {
+			return id
+		}
+	}
+	return ""
+}
+
+func TestSharderOwnsItsShareWhileRegistered(t *testing.T) {
+	store := fakeStore{
+		registered: make(chan string, 1),
+		members:    make(chan []string),
+	}
+	sessions := make(chan string)
+	sharder := NewRingSharder(store, "some_group", "farm1", sessions, logging.DefaultLogger)
+	changes := sharder.Subscribe()
+
+	quit := make(chan struct{})
+	defer close(quit)
+	go sharder.Start(quit)
+
+	ring := NewRing([]string{"farm1", "farm2"})
+	mine := ownedBy(ring, "farm1")
+	theirs := ownedBy(ring, "farm2")
+	if sharder.Owns(mine) {
+		t.Fatal("expected nothing to be owned before registering")
+	}
+
+	sessions <- "some_session"
+	select {
+	case <-store.registered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the sharder to register once it had a session")
+	}
+
+	store.members <- []string{"farm2", "farm1"}
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected subscribers to hear about the new members")
+	}
+	if !sharder.Owns(mine) || sharder.Owns(theirs) {
+		t.Fatalf("expected farm1 to own only %s of %s and %s", mine, mine, theirs)
+	}
+
+	// farm2 leaves, so farm1 owns everything
+	store.members <- []string{"farm1"}
+	<-changes
+	if !sharder.Owns(theirs) {
+		t.Fatalf("expected farm1 to own %s once farm2 left", theirs)
+	}
+
+	// losing the session gives up everything
+	sessions <- ""
+	<-changes
+	if sharder.Owns(mine) {
+		t.Fatal("expected nothing to be owned without a session")
+	}
+}
@@ -0,0 +1,125 @@
+package autoscalestore
+
+import (
+	"encoding/json"
+	"errors"
+	"path"
+
+	"github.com/square/p2/pkg/autoscale/fields"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/pborman/uuid"
+)
+
+const autoscalerTree string = "autoscalers"
+
+var NoAutoscaler error = errors.New("No autoscaler found")
+
+func IsNotExist(err error) bool {
+	return err == NoAutoscaler
+}
+
+type consulKV interface {
+	Get(key string, opts *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error)
+	Put(pair *api.KVPair, opts *api.WriteOptions) (*api.WriteMeta, error)
+	Delete(key string, w *api.WriteOptions) (*api.WriteMeta, error)
+	List(prefix string, opts *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error)
+}
+
+// ConsulStore stores autoscalers in Consul. Autoscalers are run by the
+// autoscale farm in p2-rctl-server.
+type ConsulStore struct {
+	kv consulKV
+}
+
+func NewConsul(client consulutil.ConsulClient) ConsulStore {
+	return ConsulStore{
+		kv: client.KV(),
+	}
+}
+
+// Create stores a new autoscaler, assigning it an ID
+func (s ConsulStore) Create(autoscaler fields.Autoscaler) (fields.Autoscaler, error) {
+	err := autoscaler.Validate()
+	if err != nil {
+		return fields.Autoscaler{}, err
+	}
+
+	autoscaler.ID = fields.ID(uuid.New())
+	autoscalerBytes, err := json.Marshal(autoscaler)
+	if err != nil {
+		return fields.Autoscaler{}, util.Errorf("could not marshal autoscaler as json: %s", err)
+	}
+
+	key := autoscalerPath(autoscaler.ID)
+	_, err = s.kv.Put(&api.KVPair{Key: key, Value: autoscalerBytes}, nil)
+	if err != nil {
+		return fields.Autoscaler{}, consulutil.NewKVError("put", key, err)
+	}
+	return autoscaler, nil
+}
+
+// Get returns the autoscaler with the given ID. NoAutoscaler is returned if
+// it doesn't exist.
+func (s ConsulStore) Get(id fields.ID) (fields.Autoscaler, error) {
+	key := autoscalerPath(id)
+	kvp, _, err := s.kv.Get(key, nil)
+	if err != nil {
+		return fields.Autoscaler{}, consulutil.NewKVError("get", key, err)
+	}
+	if kvp == nil {
+		return fields.Autoscaler{}, NoAutoscaler
+	}
+	return kvpToAutoscaler(kvp)
+}
+
+// List returns every autoscaler
+func (s ConsulStore) List() ([]fields.Autoscaler, error) {
+	listed, _, err := s.kv.List(autoscalerTree+"/", nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("list", autoscalerTree+"/", err)
+	}
+
+	ret := make([]fields.Autoscaler, 0, len(listed))
+	for _, kvp := range listed {
+		autoscaler, err := kvpToAutoscaler(kvp)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, autoscaler)
+	}
+	return ret, nil
+}
+
+// Delete removes an autoscaler. Deleting an autoscaler that doesn't exist is
+// not an error.
+func (s ConsulStore) Delete(id fields.ID) error {
+	key := autoscalerPath(id)
+	_, err := s.kv.Delete(key, nil)
+	if err != nil {
+		return consulutil.NewKVError("delete", key, err)
+	}
+	return nil
+}
+
+// LockPath is the lock held by the farm running the autoscaler, so that only
+// one farm scales an RC at a time
+func LockPath(id fields.ID) string {
+	return path.Join(consul.LOCK_TREE, autoscalerPath(id))
+}
+
+func kvpToAutoscaler(kvp *api.KVPair) (fields.Autoscaler, error) {
+	var autoscaler fields.Autoscaler
+	err := json.Unmarshal(kvp.Value, &autoscaler)
+	if err != nil {
+		return fields.Autoscaler{}, util.Errorf("could not unmarshal autoscaler at %s: %s", kvp.Key, err)
+	}
+	return autoscaler, nil
+}
+
+func autoscalerPath(id fields.ID) string {
+	return path.Join(autoscalerTree, id.String())
+}
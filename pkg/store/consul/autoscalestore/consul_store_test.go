@@ -0,0 +1,54 @@
+// +build !race
+
+package autoscalestore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/autoscale/fields"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+)
+
+func TestCreateListDelete(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+	store := NewConsul(fixture.Client)
+
+	created, err := store.Create(fields.Autoscaler{
+		RCID:              "some_rc",
+		MinReplicas:       1,
+		MaxReplicas:       5,
+		Metric:            fields.Metric{Type: fields.HealthMetric},
+		TargetValue:       0.8,
+		ScaleDownCooldown: 10 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("could not create autoscaler: %s", err)
+	}
+	if created.ID == "" {
+		t.Fatal("expected created autoscaler to have an ID")
+	}
+
+	autoscalers, err := store.List()
+	if err != nil {
+		t.Fatalf("could not list autoscalers: %s", err)
+	}
+	if len(autoscalers) != 1 || autoscalers[0] != created {
+		t.Fatalf("expected to list the created autoscaler but got %+v", autoscalers)
+	}
+
+	err = store.Delete(created.ID)
+	if err != nil {
+		t.Fatalf("could not delete autoscaler: %s", err)
+	}
+	_, err = store.Get(created.ID)
+	if !IsNotExist(err) {
+		t.Errorf("expected deleted autoscaler not to exist but got error %v", err)
+	}
+
+	_, err = store.Create(fields.Autoscaler{RCID: "some_rc"})
+	if err == nil {
+		t.Error("expected an error creating an autoscaler without a replica range")
+	}
+}
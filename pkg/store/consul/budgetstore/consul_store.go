@@ -0,0 +1,118 @@
+package budgetstore
+
+import (
+	"encoding/json"
+	"errors"
+	"path"
+
+	"github.com/square/p2/pkg/budget/fields"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/pborman/uuid"
+)
+
+const budgetTree string = "disruption_budgets"
+
+var NoBudget error = errors.New("No disruption budget found")
+
+func IsNotExist(err error) bool {
+	return err == NoBudget
+}
+
+type consulKV interface {
+	Get(key string, opts *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error)
+	Put(pair *api.KVPair, opts *api.WriteOptions) (*api.WriteMeta, error)
+	Delete(key string, w *api.WriteOptions) (*api.WriteMeta, error)
+	List(prefix string, opts *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error)
+}
+
+// ConsulStore stores disruption budgets in Consul. Budgets are consulted by
+// anything that voluntarily takes pods down.
+type ConsulStore struct {
+	kv consulKV
+}
+
+func NewConsul(client consulutil.ConsulClient) ConsulStore {
+	return ConsulStore{
+		kv: client.KV(),
+	}
+}
+
+// Create stores a new disruption budget, assigning it an ID
+func (s ConsulStore) Create(budget fields.Budget) (fields.Budget, error) {
+	err := budget.Validate()
+	if err != nil {
+		return fields.Budget{}, err
+	}
+
+	budget.ID = fields.ID(uuid.New())
+	budgetBytes, err := json.Marshal(budget)
+	if err != nil {
+		return fields.Budget{}, util.Errorf("could not marshal disruption budget as json: %s", err)
+	}
+
+	key := budgetPath(budget.ID)
+	_, err = s.kv.Put(&api.KVPair{Key: key, Value: budgetBytes}, nil)
+	if err != nil {
+		return fields.Budget{}, consulutil.NewKVError("put", key, err)
+	}
+	return budget, nil
+}
+
+// Get returns the disruption budget with the given ID. NoBudget is returned
+// if it doesn't exist.
+func (s ConsulStore) Get(id fields.ID) (fields.Budget, error) {
+	key := budgetPath(id)
+	kvp, _, err := s.kv.Get(key, nil)
+	if err != nil {
+		return fields.Budget{}, consulutil.NewKVError("get", key, err)
+	}
+	if kvp == nil {
+		return fields.Budget{}, NoBudget
+	}
+	return kvpToBudget(kvp)
+}
+
+// List returns every disruption budget
+func (s ConsulStore) List() ([]fields.Budget, error) {
+	listed, _, err := s.kv.List(budgetTree+"/", nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("list", budgetTree+"/", err)
+	}
+
+	ret := make([]fields.Budget, 0, len(listed))
+	for _, kvp := range listed {
+		budget, err := kvpToBudget(kvp)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, budget)
+	}
+	return ret, nil
+}
+
+// Delete removes a disruption budget. Deleting a budget that doesn't exist is
+// not an error.
+func (s ConsulStore) Delete(id fields.ID) error {
+	key := budgetPath(id)
+	_, err := s.kv.Delete(key, nil)
+	if err != nil {
+		return consulutil.NewKVError("delete", key, err)
+	}
+	return nil
+}
+
+func kvpToBudget(kvp *api.KVPair) (fields.Budget, error) {
+	var budget fields.Budget
+	err := json.Unmarshal(kvp.Value, &budget)
+	if err != nil {
+		return fields.Budget{}, util.Errorf("could not unmarshal disruption budget at %s: %s", kvp.Key, err)
+	}
+	return budget, nil
+}
+
+func budgetPath(id fields.ID) string {
+	return path.Join(budgetTree, id.String())
+}
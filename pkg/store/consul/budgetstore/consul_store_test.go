@@ -0,0 +1,50 @@
+// +build !race
+
+package budgetstore
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/budget/fields"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+)
+
+func TestCreateListDelete(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+	store := NewConsul(fixture.Client)
+
+	created, err := store.Create(fields.Budget{
+		PodID:        "web",
+		Selector:     "environment=production",
+		MinAvailable: 2,
+	})
+	if err != nil {
+		t.Fatalf("could not create disruption budget: %s", err)
+	}
+	if created.ID == "" {
+		t.Fatal("expected created disruption budget to have an ID")
+	}
+
+	budgets, err := store.List()
+	if err != nil {
+		t.Fatalf("could not list disruption budgets: %s", err)
+	}
+	if len(budgets) != 1 || budgets[0] != created {
+		t.Fatalf("expected to list the created disruption budget but got %+v", budgets)
+	}
+
+	err = store.Delete(created.ID)
+	if err != nil {
+		t.Fatalf("could not delete disruption budget: %s", err)
+	}
+	_, err = store.Get(created.ID)
+	if !IsNotExist(err) {
+		t.Errorf("expected deleted disruption budget not to exist but got error %v", err)
+	}
+
+	_, err = store.Create(fields.Budget{PodID: "web"})
+	if err == nil {
+		t.Error("expected an error creating a disruption budget without a limit")
+	}
+}
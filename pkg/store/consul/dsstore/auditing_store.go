@@ -40,9 +40,11 @@ func (a AuditingStore) Create(
 	nodeSelector klabels.Selector,
 	podID types.PodID,
 	timeout time.Duration,
+	maxInFlight fields.MaxInFlight,
+	batchPause time.Duration,
 	user string,
 ) (fields.DaemonSet, error) {
-	ds, err := a.innerStore.Create(ctx, manifest, minHealth, name, nodeSelector, podID, timeout)
+	ds, err := a.innerStore.Create(ctx, manifest, minHealth, name, nodeSelector, podID, timeout, maxInFlight, batchPause)
 	if err != nil {
 		return fields.DaemonSet{}, err
 	}
@@ -132,6 +134,144 @@ func (a AuditingStore) UpdateManifest(
 	return ds, nil
 }
 
+// Rollback sets the daemon set's manifest back to the newest prior manifest
+// whose SHA starts with shaPrefix, or to the newest prior manifest if shaPrefix
+// is empty. The replaced manifest is added to the history in turn, so a
+// rollback can itself be rolled back.
+func (a AuditingStore) Rollback(
+	ctx context.Context,
+	id fields.ID,
+	shaPrefix string,
+	user string,
+) (fields.DaemonSet, error) {
+	history, err := a.innerStore.History(id)
+	if err != nil {
+		return fields.DaemonSet{}, err
+	}
+	revision, err := history.Find(shaPrefix)
+	if err != nil {
+		return fields.DaemonSet{}, err
+	}
+	man, err := revision.GetManifest()
+	if err != nil {
+		return fields.DaemonSet{}, util.Errorf("could not parse manifest %s from daemon set history: %s", revision.SHA, err)
+	}
+
+	var fromSHA string
+	mutator := func(ds fields.DaemonSet) (fields.DaemonSet, error) {
+		fromSHA, err = ds.Manifest.SHA()
+		if err != nil {
+			return fields.DaemonSet{}, err
+		}
+		if fromSHA == revision.SHA {
+			return fields.DaemonSet{}, util.Errorf("daemon set %s already has manifest %s", id, revision.SHA)
+		}
+		ds.Manifest = man
+		return ds, nil
+	}
+
+	ds, err := a.innerStore.MutateDSTxn(ctx, id, mutator)
+	if err != nil {
+		return fields.DaemonSet{}, err
+	}
+
+	details, err := audit.NewDaemonSetRollbackDetails(ds, fromSHA, revision.SHA, user)
+	if err != nil {
+		return fields.DaemonSet{}, err
+	}
+	err = a.auditLogStore.Create(ctx, audit.DSRolledBackEvent, details)
+	if err != nil {
+		return fields.DaemonSet{}, util.Errorf("could not create audit log record for daemon set rollback: %s", err)
+	}
+
+	return ds, nil
+}
+
+// ExcludeNodes adds the nodes to the daemon set's exclusion list, or removes
+// them from it if include is true
+func (a AuditingStore) ExcludeNodes(
+	ctx context.Context,
+	id fields.ID,
+	nodes []types.NodeName,
+	include bool,
+	user string,
+) (fields.DaemonSet, error) {
+	mutator := func(ds fields.DaemonSet) (fields.DaemonSet, error) {
+		excluded := types.NewNodeSet(ds.ExcludedNodes...)
+		for _, node := range nodes {
+			if include {
+				excluded.DeleteNode(node)
+			} else {
+				excluded.InsertNode(node)
+			}
+		}
+		ds.ExcludedNodes = excluded.ListNodes()
+		if len(ds.ExcludedNodes) == 0 {
+			ds.ExcludedNodes = nil
+		}
+		return ds, nil
+	}
+
+	ds, err := a.innerStore.MutateDSTxn(ctx, id, mutator)
+	if err != nil {
+		return fields.DaemonSet{}, err
+	}
+
+	details, err := audit.NewDaemonSetDetails(ds, user)
+	if err != nil {
+		return fields.DaemonSet{}, err
+	}
+	err = a.auditLogStore.Create(ctx, audit.DSExcludedNodesUpdatedEvent, details)
+	if err != nil {
+		return fields.DaemonSet{}, util.Errorf("could not create audit log record for daemon set excluded nodes update: %s", err)
+	}
+
+	return ds, nil
+}
+
+// PinNode pins the node to the manifest with the given SHA, or unpins it if
+// manifestSHA is empty
+func (a AuditingStore) PinNode(
+	ctx context.Context,
+	id fields.ID,
+	node types.NodeName,
+	manifestSHA string,
+	user string,
+) (fields.DaemonSet, error) {
+	mutator := func(ds fields.DaemonSet) (fields.DaemonSet, error) {
+		pinned := make(map[types.NodeName]string)
+		for pinnedNode, sha := range ds.PinnedNodes {
+			pinned[pinnedNode] = sha
+		}
+		if manifestSHA == "" {
+			delete(pinned, node)
+		} else {
+			pinned[node] = manifestSHA
+		}
+		ds.PinnedNodes = pinned
+		if len(ds.PinnedNodes) == 0 {
+			ds.PinnedNodes = nil
+		}
+		return ds, nil
+	}
+
+	ds, err := a.innerStore.MutateDSTxn(ctx, id, mutator)
+	if err != nil {
+		return fields.DaemonSet{}, err
+	}
+
+	details, err := audit.NewDaemonSetDetails(ds, user)
+	if err != nil {
+		return fields.DaemonSet{}, err
+	}
+	err = a.auditLogStore.Create(ctx, audit.DSPinnedNodesUpdatedEvent, details)
+	if err != nil {
+		return fields.DaemonSet{}, util.Errorf("could not create audit log record for daemon set pinned nodes update: %s", err)
+	}
+
+	return ds, nil
+}
+
 func (a AuditingStore) UpdateNodeSelector(
 	ctx context.Context,
 	id fields.ID,
@@ -14,6 +14,7 @@ import (
 	"github.com/square/p2/pkg/store/consul/auditlogstore"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
 
 	klabels "k8s.io/kubernetes/pkg/labels"
 )
@@ -30,7 +31,7 @@ func TestCreateWithAudit(t *testing.T) {
 
 	ctx, cancel := transaction.New(context.Background())
 	defer cancel()
-	ds, err := auditingStore.Create(ctx, testManifest(), 1, "some_name", klabels.Everything(), "some_pod", 0, "some_user")
+	ds, err := auditingStore.Create(ctx, testManifest(), 1, "some_name", klabels.Everything(), "some_pod", 0, "", 0, "some_user")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -112,7 +113,7 @@ func TestDisableWithAudit(t *testing.T) {
 
 	ctx, cancel := transaction.New(context.Background())
 	defer cancel()
-	ds, err := dsStore.Create(ctx, testManifest(), 1, "some_name", klabels.Everything(), "some_pod", 0)
+	ds, err := dsStore.Create(ctx, testManifest(), 1, "some_name", klabels.Everything(), "some_pod", 0, "", 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -208,7 +209,7 @@ func TestEnableWithAudit(t *testing.T) {
 
 	ctx, cancel := transaction.New(context.Background())
 	defer cancel()
-	ds, err := dsStore.Create(ctx, testManifest(), 1, "some_name", klabels.Everything(), "some_pod", 0)
+	ds, err := dsStore.Create(ctx, testManifest(), 1, "some_name", klabels.Everything(), "some_pod", 0, "", 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -327,7 +328,7 @@ func TestUpdateManifest(t *testing.T) {
 
 	ctx, cancel := transaction.New(context.Background())
 	defer cancel()
-	ds, err := dsStore.Create(ctx, testManifest(), 1, "some_name", klabels.Everything(), "some_pod", 0)
+	ds, err := dsStore.Create(ctx, testManifest(), 1, "some_name", klabels.Everything(), "some_pod", 0, "", 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -453,6 +454,220 @@ func TestUpdateManifest(t *testing.T) {
 	}
 }
 
+func TestRollbackWithAudit(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+
+	logger := logging.TestLogger()
+	dsStore := NewConsul(fixture.Client, 0, &logger)
+	auditLogStore := auditlogstore.NewConsulStore(fixture.Client.KV())
+
+	auditingStore := NewAuditingStore(dsStore, auditLogStore)
+
+	ctx, cancel := transaction.New(context.Background())
+	defer cancel()
+	ds, err := dsStore.Create(ctx, testManifest(), 1, "some_name", klabels.Everything(), "some_pod", 0, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = transaction.MustCommit(ctx, fixture.Client.KV())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel = transaction.New(context.Background())
+	defer cancel()
+	_, err = auditingStore.Rollback(ctx, ds.ID, "", "some_user")
+	if err == nil {
+		t.Error("expected an error rolling back a daemon set without prior manifests")
+	}
+
+	builder := manifest.NewBuilder()
+	builder.SetID("some_pod")
+	err = builder.SetConfig(map[interface{}]interface{}{"foo": "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newManifest := builder.GetManifest()
+
+	ctx, cancel = transaction.New(context.Background())
+	defer cancel()
+	_, err = auditingStore.UpdateManifest(ctx, ds.ID, newManifest, "some_user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = transaction.MustCommit(ctx, fixture.Client.KV())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testSHA, err := testManifest().SHA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newManifestSHA, err := newManifest.SHA()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel = transaction.New(context.Background())
+	defer cancel()
+	_, err = auditingStore.Rollback(ctx, ds.ID, "not_a_sha", "some_user")
+	if err == nil {
+		t.Error("expected an error rolling back to a manifest that isn't in the history")
+	}
+
+	ctx, cancel = transaction.New(context.Background())
+	defer cancel()
+	_, err = auditingStore.Rollback(ctx, ds.ID, testSHA[:8], "some_user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = transaction.MustCommit(ctx, fixture.Client.KV())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ds, _, err = dsStore.Get(ds.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dsSHA, err := ds.Manifest.SHA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dsSHA != testSHA {
+		t.Errorf("expected the daemon set's manifest to be rolled back to %s but was %s", testSHA, dsSHA)
+	}
+
+	// the replaced manifest should be available to roll forward to
+	history, err := dsStore.History(ds.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revision, err := history.Find("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revision.SHA != newManifestSHA {
+		t.Errorf("expected the newest revision to be the replaced manifest %s but was %s", newManifestSHA, revision.SHA)
+	}
+
+	alMap, err := auditLogStore.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, v := range alMap {
+		if v.EventType != audit.DSRolledBackEvent {
+			continue
+		}
+		found = true
+
+		var details audit.DSRollbackEventDetails
+		err = json.Unmarshal([]byte(*v.EventDetails), &details)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if details.User != "some_user" {
+			t.Errorf("expected user name on audit record to be %q but was %q", "some_user", details.User)
+		}
+		if details.DaemonSet.ID != ds.ID {
+			t.Errorf("expected daemon set in audit log record to have ID %s but was %s", ds.ID, details.DaemonSet.ID)
+		}
+		if details.FromSHA != newManifestSHA || details.ToSHA != testSHA {
+			t.Errorf("expected rollback from %s to %s but audit log record had %s to %s", newManifestSHA, testSHA, details.FromSHA, details.ToSHA)
+		}
+	}
+	if !found {
+		t.Errorf("expected an audit log record with type %q", audit.DSRolledBackEvent)
+	}
+}
+
+func TestExcludeAndPinWithAudit(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+
+	logger := logging.TestLogger()
+	dsStore := NewConsul(fixture.Client, 0, &logger)
+	auditLogStore := auditlogstore.NewConsulStore(fixture.Client.KV())
+
+	auditingStore := NewAuditingStore(dsStore, auditLogStore)
+
+	ctx, cancel := transaction.New(context.Background())
+	defer cancel()
+	ds, err := dsStore.Create(ctx, testManifest(), 1, "some_name", klabels.Everything(), "some_pod", 0, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = transaction.MustCommit(ctx, fixture.Client.KV())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, update := range []func(ctx context.Context) error{
+		func(ctx context.Context) error {
+			_, err := auditingStore.ExcludeNodes(ctx, ds.ID, []types.NodeName{"node1", "node2"}, false, "some_user")
+			return err
+		},
+		func(ctx context.Context) error {
+			_, err := auditingStore.ExcludeNodes(ctx, ds.ID, []types.NodeName{"node1"}, true, "some_user")
+			return err
+		},
+		func(ctx context.Context) error {
+			_, err := auditingStore.PinNode(ctx, ds.ID, "node3", "some_sha", "some_user")
+			return err
+		},
+		func(ctx context.Context) error {
+			_, err := auditingStore.PinNode(ctx, ds.ID, "node4", "some_other_sha", "some_user")
+			return err
+		},
+		func(ctx context.Context) error {
+			_, err := auditingStore.PinNode(ctx, ds.ID, "node4", "", "some_user")
+			return err
+		},
+	} {
+		ctx, cancel := transaction.New(context.Background())
+		defer cancel()
+		err = update(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = transaction.MustCommit(ctx, fixture.Client.KV())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ds, _, err = dsStore.Get(ds.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds.ExcludedNodes) != 1 || !ds.Excluded("node2") {
+		t.Errorf("expected only node2 to be excluded but excluded nodes were %s", ds.ExcludedNodes)
+	}
+	if len(ds.PinnedNodes) != 1 || ds.PinnedNodes["node3"] != "some_sha" {
+		t.Errorf("expected only node3 to be pinned to some_sha but pinned nodes were %v", ds.PinnedNodes)
+	}
+
+	alMap, err := auditLogStore.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[audit.EventType]int)
+	for _, v := range alMap {
+		counts[v.EventType]++
+	}
+	if counts[audit.DSExcludedNodesUpdatedEvent] != 2 {
+		t.Errorf("expected 2 %q audit log records but there were %d", audit.DSExcludedNodesUpdatedEvent, counts[audit.DSExcludedNodesUpdatedEvent])
+	}
+	if counts[audit.DSPinnedNodesUpdatedEvent] != 3 {
+		t.Errorf("expected 3 %q audit log records but there were %d", audit.DSPinnedNodesUpdatedEvent, counts[audit.DSPinnedNodesUpdatedEvent])
+	}
+}
+
 func TestUpdateNodeSelector(t *testing.T) {
 	fixture := consulutil.NewFixture(t)
 	defer fixture.Stop()
@@ -465,7 +680,7 @@ func TestUpdateNodeSelector(t *testing.T) {
 
 	ctx, cancel := transaction.New(context.Background())
 	defer cancel()
-	ds, err := dsStore.Create(ctx, testManifest(), 1, "some_name", klabels.Everything(), "some_pod", 0)
+	ds, err := dsStore.Create(ctx, testManifest(), 1, "some_name", klabels.Everything(), "some_pod", 0, "", 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -565,7 +780,7 @@ func TestDeleteWithAudit(t *testing.T) {
 
 	ctx, cancel := transaction.New(context.Background())
 	defer cancel()
-	ds, err := dsStore.Create(ctx, testManifest(), 1, "some_name", klabels.Everything(), "some_pod", 0)
+	ds, err := dsStore.Create(ctx, testManifest(), 1, "some_name", klabels.Everything(), "some_pod", 0, "", 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -673,7 +888,7 @@ func TestUpdateMinHealth(t *testing.T) {
 
 	ctx, cancel := transaction.New(context.Background())
 	defer cancel()
-	ds, err := dsStore.Create(ctx, testManifest(), 1, "some_name", klabels.Everything(), "some_pod", 0)
+	ds, err := dsStore.Create(ctx, testManifest(), 1, "some_name", klabels.Everything(), "some_pod", 0, "", 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -772,7 +987,7 @@ func TestUpdateTimeout(t *testing.T) {
 
 	ctx, cancel := transaction.New(context.Background())
 	defer cancel()
-	ds, err := dsStore.Create(ctx, testManifest(), 1, "some_name", klabels.Everything(), "some_pod", 0)
+	ds, err := dsStore.Create(ctx, testManifest(), 1, "some_name", klabels.Everything(), "some_pod", 0, "", 0)
 	if err != nil {
 		t.Fatal(err)
 	}
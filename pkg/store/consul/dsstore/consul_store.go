@@ -24,6 +24,11 @@ import (
 
 const dsTree string = "daemon_sets"
 
+// historyTree holds the prior manifests of each daemon set, keyed by daemon
+// set ID. It is kept out of dsTree so that watches on daemon sets don't see
+// history changes.
+const historyTree string = "daemon_set_history"
+
 var NoDaemonSet error = errors.New("No daemon set found")
 
 type consulKV interface {
@@ -31,6 +36,7 @@ type consulKV interface {
 	Delete(key string, w *api.WriteOptions) (*api.WriteMeta, error)
 	Get(key string, opts *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error)
 	List(prefix string, opts *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error)
+	Txn(txn api.KVTxnOps, q *api.QueryOptions) (bool, *api.KVTxnResponse, *api.QueryMeta, error)
 }
 
 // store represents an interface for persisting daemon set to Consul,
@@ -67,12 +73,14 @@ func (s *ConsulStore) Create(
 	nodeSelector klabels.Selector,
 	podID types.PodID,
 	timeout time.Duration,
+	maxInFlight fields.MaxInFlight,
+	batchPause time.Duration,
 ) (fields.DaemonSet, error) {
 	if err := checkManifestPodID(podID, manifest); err != nil {
 		return fields.DaemonSet{}, util.Errorf("Error verifying manifest pod id: %v", err)
 	}
 
-	ds, err := s.innerCreate(ctx, manifest, minHealth, name, nodeSelector, podID, timeout)
+	ds, err := s.innerCreate(ctx, manifest, minHealth, name, nodeSelector, podID, timeout, maxInFlight, batchPause)
 	if err != nil {
 		return fields.DaemonSet{}, util.Errorf("Error creating daemon set: %v", err)
 	}
@@ -88,6 +96,8 @@ func (s *ConsulStore) innerCreate(
 	nodeSelector klabels.Selector,
 	podID types.PodID,
 	timeout time.Duration,
+	maxInFlight fields.MaxInFlight,
+	batchPause time.Duration,
 ) (fields.DaemonSet, error) {
 	id := fields.ID(uuid.New())
 	dsPath, err := s.dsPath(id)
@@ -103,6 +113,8 @@ func (s *ConsulStore) innerCreate(
 		NodeSelector: nodeSelector,
 		PodID:        podID,
 		Timeout:      timeout,
+		MaxInFlight:  maxInFlight,
+		BatchPause:   batchPause,
 	}
 	// Marshals ds into []bytes using overloaded MarshalJSON
 	rawDS, err := json.Marshal(ds)
@@ -134,6 +146,12 @@ func (s *ConsulStore) Delete(id fields.ID) error {
 		return consulutil.NewKVError("delete", dsPath, err)
 	}
 
+	historyPath := s.historyPath(id)
+	_, err = s.kv.Delete(historyPath, nil)
+	if err != nil {
+		return consulutil.NewKVError("delete", historyPath, err)
+	}
+
 	return nil
 }
 
@@ -154,7 +172,11 @@ func (s *ConsulStore) DeleteTxn(ctx context.Context, id fields.ID) error {
 		return err
 
 	}
-	return nil
+
+	return transaction.Add(ctx, api.KVTxnOp{
+		Verb: api.KVDelete,
+		Key:  s.historyPath(id),
+	})
 }
 
 // Get retrieves a daemon set by ID. If it does not exist, it will produce an error
@@ -201,49 +223,20 @@ func (s *ConsulStore) MutateDS(
 	id fields.ID,
 	mutator func(fields.DaemonSet) (fields.DaemonSet, error),
 ) (fields.DaemonSet, error) {
-	ds, metadata, err := s.Get(id)
-	if err != nil {
-		if err == NoDaemonSet {
-			// we need to pass this through so callers can distinguish this from other errors
-			return fields.DaemonSet{}, err
-		}
-
-		return fields.DaemonSet{}, util.Errorf("Error getting daemon set: %v", err)
-	}
-
-	ds, err = mutator(ds)
-	if err != nil {
-		return fields.DaemonSet{}, util.Errorf("Error mutating daemon set: %v", err)
-	}
-	if ds.ID != id {
-		// If the user wants a new uuid, they should delete it and create it
-		return fields.DaemonSet{},
-			util.Errorf("Explicitly changing daemon set ID is not permitted: Wanted '%s' got '%s'", id, ds.ID)
-	}
-	if err := checkManifestPodID(ds.PodID, ds.Manifest); err != nil {
-		return fields.DaemonSet{}, util.Errorf("Error verifying manifest pod id: %v", err)
-	}
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
 
-	rawDS, err := json.Marshal(ds)
-	if err != nil {
-		return fields.DaemonSet{}, util.Errorf("Could not marshal DS as json: %s", err)
-	}
-
-	dsPath, err := s.dsPath(id)
+	ds, err := s.MutateDSTxn(ctx, id, mutator)
 	if err != nil {
-		return fields.DaemonSet{}, util.Errorf("Error getting daemon set path: %v", err)
+		return fields.DaemonSet{}, err
 	}
 
-	success, _, err := s.kv.CAS(&api.KVPair{
-		Key:         dsPath,
-		Value:       rawDS,
-		ModifyIndex: metadata.LastIndex,
-	}, nil)
+	success, _, err := transaction.Commit(ctx, s.kv)
 	if err != nil {
-		return fields.DaemonSet{}, consulutil.NewKVError("cas", dsPath, err)
+		return fields.DaemonSet{}, err
 	}
-
 	if !success {
+		dsPath, _ := s.dsPath(id)
 		return fields.DaemonSet{}, CASError(dsPath)
 	}
 
@@ -268,6 +261,7 @@ func (s *ConsulStore) MutateDSTxn(
 		return fields.DaemonSet{}, util.Errorf("Error getting daemon set: %v", err)
 	}
 
+	prior := ds.Manifest
 	ds, err = mutator(ds)
 	if err != nil {
 		return fields.DaemonSet{}, util.Errorf("Error mutating daemon set: %v", err)
@@ -302,9 +296,81 @@ func (s *ConsulStore) MutateDSTxn(
 		return fields.DaemonSet{}, err
 	}
 
+	err = s.addToHistoryTxn(ctx, id, prior, ds.Manifest)
+	if err != nil {
+		return fields.DaemonSet{}, err
+	}
+
 	return ds, nil
 }
 
+// addToHistoryTxn adds the KV operations required to add the prior manifest to
+// the daemon set's history to ctx, if it was replaced by a different one
+func (s *ConsulStore) addToHistoryTxn(ctx context.Context, id fields.ID, prior manifest.Manifest, man manifest.Manifest) error {
+	if prior == nil || man == nil {
+		return nil
+	}
+	priorSHA, err := prior.SHA()
+	if err != nil {
+		return err
+	}
+	newSHA, err := man.SHA()
+	if err != nil {
+		return err
+	}
+	if priorSHA == newSHA {
+		return nil
+	}
+
+	history, index, err := s.getHistory(id)
+	if err != nil {
+		return err
+	}
+	history, err = history.Add(prior, time.Now())
+	if err != nil {
+		return err
+	}
+
+	historyBytes, err := json.Marshal(history)
+	if err != nil {
+		return util.Errorf("could not marshal daemon set history as JSON: %s", err)
+	}
+	// check-and-set the history so the transaction fails if it changes
+	// before it is committed
+	return transaction.Add(ctx, api.KVTxnOp{
+		Verb:  api.KVCAS,
+		Key:   s.historyPath(id),
+		Index: index,
+		Value: historyBytes,
+	})
+}
+
+// History returns the prior manifests of the daemon set with the given ID,
+// oldest first. A daemon set whose manifest has never changed has an empty
+// history.
+func (s *ConsulStore) History(id fields.ID) (fields.History, error) {
+	history, _, err := s.getHistory(id)
+	return history, err
+}
+
+func (s *ConsulStore) getHistory(id fields.ID) (fields.History, uint64, error) {
+	historyPath := s.historyPath(id)
+	kvp, _, err := s.kv.Get(historyPath, nil)
+	if err != nil {
+		return fields.History{}, 0, consulutil.NewKVError("get", historyPath, err)
+	}
+	if kvp == nil {
+		return fields.History{}, 0, nil
+	}
+
+	var history fields.History
+	err = json.Unmarshal(kvp.Value, &history)
+	if err != nil {
+		return fields.History{}, 0, util.Errorf("could not unmarshal daemon set history at %s: %s", historyPath, err)
+	}
+	return history, kvp.ModifyIndex, nil
+}
+
 // Disable sets a flag on the daemon set to prevent it from operating.
 func (s *ConsulStore) Disable(id fields.ID) (fields.DaemonSet, error) {
 	mutator := func(dsToUpdate fields.DaemonSet) (fields.DaemonSet, error) {
@@ -537,6 +603,10 @@ func (s *ConsulStore) dsPath(dsID fields.ID) (string, error) {
 	return path.Join(dsTree, dsID.String()), nil
 }
 
+func (s *ConsulStore) historyPath(dsID fields.ID) string {
+	return path.Join(historyTree, dsID.String())
+}
+
 func (s *ConsulStore) dsLockPath(dsID fields.ID) (string, error) {
 	dsPath, err := s.dsPath(dsID)
 	if err != nil {
@@ -47,12 +47,12 @@ func TestCreate(t *testing.T) {
 
 	ctx, cancelFunc := transaction.New(context.Background())
 	defer cancelFunc()
-	if _, err := store.Create(ctx, podManifest, minHealth, clusterName, selector, podID, timeout); err == nil {
+	if _, err := store.Create(ctx, podManifest, minHealth, clusterName, selector, podID, timeout, "", 0); err == nil {
 		t.Error("Expected create to fail on bad pod id")
 	}
 
 	podID = types.PodID("pod_id")
-	if _, err := store.Create(ctx, podManifest, minHealth, clusterName, selector, podID, timeout); err == nil {
+	if _, err := store.Create(ctx, podManifest, minHealth, clusterName, selector, podID, timeout, "", 0); err == nil {
 		t.Error("Expected create to fail on bad manifest pod id")
 	}
 
@@ -60,7 +60,7 @@ func TestCreate(t *testing.T) {
 	manifestBuilder.SetID("different_pod_id")
 
 	podManifest = manifestBuilder.GetManifest()
-	if _, err := store.Create(ctx, podManifest, minHealth, clusterName, selector, podID, timeout); err == nil {
+	if _, err := store.Create(ctx, podManifest, minHealth, clusterName, selector, podID, timeout, "", 0); err == nil {
 		t.Error("Expected create to fail on pod id and manifest pod id mismatch")
 	}
 }
@@ -83,7 +83,7 @@ func createDaemonSet(store *ConsulStore, txner transaction.Txner, t *testing.T)
 
 	ctx, cancelFunc := transaction.New(context.Background())
 	defer cancelFunc()
-	ds, err := store.Create(ctx, manifest, minHealth, clusterName, selector, podID, timeout)
+	ds, err := store.Create(ctx, manifest, minHealth, clusterName, selector, podID, timeout, "", 0)
 	if err != nil {
 		t.Fatalf("Unable to create daemon set: %s", err)
 	}
@@ -169,10 +169,12 @@ func TestGet(t *testing.T) {
 	manifest := manifestBuilder.GetManifest()
 
 	timeout := replication.NoTimeout
+	maxInFlight := ds_fields.MaxInFlight("10%")
+	batchPause := 30 * time.Second
 
 	ctx, cancelFunc := transaction.New(context.Background())
 	defer cancelFunc()
-	ds, err := store.Create(ctx, manifest, minHealth, clusterName, selector, podID, timeout)
+	ds, err := store.Create(ctx, manifest, minHealth, clusterName, selector, podID, timeout, maxInFlight, batchPause)
 	if err != nil {
 		t.Fatalf("Unable to create daemon set: %s", err)
 	}
@@ -200,6 +202,8 @@ func TestGet(t *testing.T) {
 	Assert(t).AreEqual(ds.MinHealth, getDS.MinHealth, "Daemon set should have equal minimum healths")
 	Assert(t).AreEqual(ds.Name, getDS.Name, "Daemon set should have equal names")
 	Assert(t).AreEqual(ds.Disabled, getDS.Disabled, "Daemon set should have same disabled fields")
+	Assert(t).AreEqual(getDS.MaxInFlight, maxInFlight, "Daemon set should have the max in flight it was created with")
+	Assert(t).AreEqual(getDS.BatchPause, batchPause, "Daemon set should have the batch pause it was created with")
 
 	testLabels := klabels.Set{
 		pc_fields.AvailabilityZoneLabel: azLabel.String(),
@@ -248,7 +252,7 @@ func TestList(t *testing.T) {
 
 	ctx, cancelFunc := transaction.New(context.Background())
 	defer cancelFunc()
-	firstDS, err := store.Create(ctx, firstManifest, minHealth, clusterName, selector, firstPodID, timeout)
+	firstDS, err := store.Create(ctx, firstManifest, minHealth, clusterName, selector, firstPodID, timeout, "", 0)
 	if err != nil {
 		t.Fatalf("Unable to create daemon set: %s", err)
 	}
@@ -267,7 +271,7 @@ func TestList(t *testing.T) {
 	secondManifest := manifestBuilder.GetManifest()
 	ctx2, cancelFunc2 := transaction.New(context.Background())
 	defer cancelFunc2()
-	secondDS, err := store.Create(ctx2, secondManifest, minHealth, clusterName, selector, secondPodID, timeout)
+	secondDS, err := store.Create(ctx2, secondManifest, minHealth, clusterName, selector, secondPodID, timeout, "", 0)
 	if err != nil {
 		t.Fatalf("Unable to create daemon set: %s", err)
 	}
@@ -318,7 +322,7 @@ func TestMutate(t *testing.T) {
 
 	ctx, cancelFunc := transaction.New(context.Background())
 	defer cancelFunc()
-	ds, err := store.Create(ctx, podManifest, minHealth, clusterName, selector, podID, timeout)
+	ds, err := store.Create(ctx, podManifest, minHealth, clusterName, selector, podID, timeout, "", 0)
 	if err != nil {
 		t.Fatalf("Unable to create daemon set: %s", err)
 	}
@@ -440,6 +444,106 @@ func TestMutate(t *testing.T) {
 	Assert(t).AreEqual(someOtherSHA, dsSHA, "Daemon set shas were not equal")
 }
 
+func TestHistory(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+	store := newStore(fixture.Client.KV())
+
+	podID := types.PodID("some_pod_id")
+	manifestWithConfig := func(i int) manifest.Manifest {
+		manifestBuilder := manifest.NewBuilder()
+		manifestBuilder.SetID(podID)
+		err := manifestBuilder.SetConfig(map[interface{}]interface{}{"version": i})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return manifestBuilder.GetManifest()
+	}
+
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
+	ds, err := store.Create(ctx, manifestWithConfig(0), 0, "some_name", klabels.Everything(), podID, replication.NoTimeout, "", 0)
+	if err != nil {
+		t.Fatalf("Unable to create daemon set: %s", err)
+	}
+	err = transaction.MustCommit(ctx, fixture.Client.KV())
+	if err != nil {
+		t.Fatalf("unable to commit daemon set: %s", err)
+	}
+
+	history, err := store.History(ds.ID)
+	if err != nil {
+		t.Fatalf("Unable to get daemon set history: %s", err)
+	}
+	if len(history.Revisions) != 0 {
+		t.Fatalf("expected a new daemon set to have no history but there were %d revisions", len(history.Revisions))
+	}
+
+	updates := ds_fields.MaxRevisions + 2
+	for i := 1; i <= updates; i++ {
+		man := manifestWithConfig(i)
+		_, err = store.MutateDS(ds.ID, func(dsToMutate ds_fields.DaemonSet) (ds_fields.DaemonSet, error) {
+			dsToMutate.Manifest = man
+			return dsToMutate, nil
+		})
+		if err != nil {
+			t.Fatalf("Unable to mutate daemon set: %s", err)
+		}
+	}
+
+	// changes that don't touch the manifest shouldn't be recorded
+	_, err = store.MutateDS(ds.ID, func(dsToMutate ds_fields.DaemonSet) (ds_fields.DaemonSet, error) {
+		dsToMutate.MinHealth = 1
+		return dsToMutate, nil
+	})
+	if err != nil {
+		t.Fatalf("Unable to mutate daemon set: %s", err)
+	}
+
+	history, err = store.History(ds.ID)
+	if err != nil {
+		t.Fatalf("Unable to get daemon set history: %s", err)
+	}
+	if len(history.Revisions) != ds_fields.MaxRevisions {
+		t.Fatalf("expected history to be trimmed to %d revisions but there were %d", ds_fields.MaxRevisions, len(history.Revisions))
+	}
+
+	// the newest revision should be the manifest replaced by the last update
+	// and the oldest ones should have been dropped
+	for i, revision := range history.Revisions {
+		expectedSHA, err := manifestWithConfig(updates - ds_fields.MaxRevisions + i).SHA()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if revision.SHA != expectedSHA {
+			t.Errorf("expected revision %d to have SHA %s but was %s", i, expectedSHA, revision.SHA)
+		}
+		revisionManifest, err := revision.GetManifest()
+		if err != nil {
+			t.Fatalf("Unable to parse revision manifest: %s", err)
+		}
+		revisionSHA, err := revisionManifest.SHA()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if revisionSHA != revision.SHA {
+			t.Errorf("expected revision %d manifest to have SHA %s but was %s", i, revision.SHA, revisionSHA)
+		}
+	}
+
+	err = store.Delete(ds.ID)
+	if err != nil {
+		t.Fatalf("Unable to delete daemon set: %s", err)
+	}
+	history, err = store.History(ds.ID)
+	if err != nil {
+		t.Fatalf("Unable to get daemon set history: %s", err)
+	}
+	if len(history.Revisions) != 0 {
+		t.Errorf("expected history to be deleted with the daemon set but there were %d revisions", len(history.Revisions))
+	}
+}
+
 func TestWatch(t *testing.T) {
 	fixture := consulutil.NewFixture(t)
 	defer fixture.Stop()
@@ -463,7 +567,7 @@ func TestWatch(t *testing.T) {
 
 	ctx, cancelFunc := transaction.New(context.Background())
 	defer cancelFunc()
-	ds, err := store.Create(ctx, podManifest, minHealth, clusterName, selector, podID, timeout)
+	ds, err := store.Create(ctx, podManifest, minHealth, clusterName, selector, podID, timeout, "", 0)
 	if err != nil {
 		t.Fatalf("Unable to create daemon set: %s", err)
 	}
@@ -484,7 +588,7 @@ func TestWatch(t *testing.T) {
 
 	ctx2, cancelFunc2 := transaction.New(context.Background())
 	defer cancelFunc2()
-	someOtherDS, err := store.Create(ctx2, someOtherManifest, minHealth, clusterName, selector, someOtherPodID, timeout)
+	someOtherDS, err := store.Create(ctx2, someOtherManifest, minHealth, clusterName, selector, someOtherPodID, timeout, "", 0)
 	if err != nil {
 		t.Fatalf("Unable to create daemon set: %s", err)
 	}
@@ -600,7 +704,7 @@ func TestWatchAll(t *testing.T) {
 
 	ctx, cancelFunc := transaction.New(context.Background())
 	defer cancelFunc()
-	ds, err := store.Create(ctx, podManifest, minHealth, clusterName, selector, podID, timeout)
+	ds, err := store.Create(ctx, podManifest, minHealth, clusterName, selector, podID, timeout, "", 0)
 	if err != nil {
 		t.Fatalf("Unable to create daemon set: %s", err)
 	}
@@ -620,7 +724,7 @@ func TestWatchAll(t *testing.T) {
 
 	ctx2, cancelFunc2 := transaction.New(context.Background())
 	defer cancelFunc2()
-	someOtherDS, err := store.Create(ctx2, someOtherManifest, minHealth, clusterName, selector, someOtherPodID, timeout)
+	someOtherDS, err := store.Create(ctx2, someOtherManifest, minHealth, clusterName, selector, someOtherPodID, timeout, "", 0)
 	if err != nil {
 		t.Fatalf("Unable to create daemon set: %s", err)
 	}
@@ -727,7 +831,7 @@ func TestEnableTxnAndDisableTxn(t *testing.T) {
 
 	ctx, cancelFunc := transaction.New(context.Background())
 	defer cancelFunc()
-	ds, err := store.Create(ctx, podManifest, minHealth, clusterName, selector, podID, timeout)
+	ds, err := store.Create(ctx, podManifest, minHealth, clusterName, selector, podID, timeout, "", 0)
 	if err != nil {
 		t.Fatalf("Unable to create daemon set: %s", err)
 	}
@@ -0,0 +1,159 @@
+package freezestore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path"
+
+	"github.com/square/p2/pkg/freeze/fields"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/pborman/uuid"
+)
+
+const freezeTree string = "freezes"
+
+var NoFreezeWindow error = errors.New("No freeze window found")
+
+func IsNotExist(err error) bool {
+	return err == NoFreezeWindow
+}
+
+type consulKV interface {
+	Get(key string, opts *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error)
+	Put(pair *api.KVPair, opts *api.WriteOptions) (*api.WriteMeta, error)
+	Delete(key string, w *api.WriteOptions) (*api.WriteMeta, error)
+	List(prefix string, opts *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error)
+}
+
+// ConsulStore stores deploy freeze windows in Consul. Windows are read by the
+// RC and roll farms to decide whether an RC may be changed.
+type ConsulStore struct {
+	kv consulKV
+}
+
+func NewConsul(client consulutil.ConsulClient) ConsulStore {
+	return ConsulStore{
+		kv: client.KV(),
+	}
+}
+
+// Create stores a new freeze window, assigning it an ID
+func (s ConsulStore) Create(window fields.Window) (fields.Window, error) {
+	err := window.Validate()
+	if err != nil {
+		return fields.Window{}, err
+	}
+
+	window.ID = fields.ID(uuid.New())
+	window.Overrides = nil
+	windowBytes, err := json.Marshal(window)
+	if err != nil {
+		return fields.Window{}, util.Errorf("could not marshal freeze window as json: %s", err)
+	}
+
+	key := freezePath(window.ID)
+	_, err = s.kv.Put(&api.KVPair{Key: key, Value: windowBytes}, nil)
+	if err != nil {
+		return fields.Window{}, consulutil.NewKVError("put", key, err)
+	}
+	return window, nil
+}
+
+// Get returns the freeze window with the given ID. NoFreezeWindow is returned
+// if it doesn't exist.
+func (s ConsulStore) Get(id fields.ID) (fields.Window, error) {
+	window, _, err := s.getWithIndex(id)
+	return window, err
+}
+
+func (s ConsulStore) getWithIndex(id fields.ID) (fields.Window, uint64, error) {
+	key := freezePath(id)
+	kvp, _, err := s.kv.Get(key, nil)
+	if err != nil {
+		return fields.Window{}, 0, consulutil.NewKVError("get", key, err)
+	}
+	if kvp == nil {
+		return fields.Window{}, 0, NoFreezeWindow
+	}
+
+	window, err := kvpToWindow(kvp)
+	if err != nil {
+		return fields.Window{}, 0, err
+	}
+	return window, kvp.ModifyIndex, nil
+}
+
+// List returns every freeze window, including ones that have ended
+func (s ConsulStore) List() ([]fields.Window, error) {
+	listed, _, err := s.kv.List(freezeTree+"/", nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("list", freezeTree+"/", err)
+	}
+
+	ret := make([]fields.Window, 0, len(listed))
+	for _, kvp := range listed {
+		window, err := kvpToWindow(kvp)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, window)
+	}
+	return ret, nil
+}
+
+// Delete removes a freeze window. Deleting a window that doesn't exist is not
+// an error.
+func (s ConsulStore) Delete(id fields.ID) error {
+	key := freezePath(id)
+	_, err := s.kv.Delete(key, nil)
+	if err != nil {
+		return consulutil.NewKVError("delete", key, err)
+	}
+	return nil
+}
+
+// OverrideTxn adds an operation to the transaction in ctx that allows the
+// given RC to change during the freeze window. Callers are expected to record
+// the override in the audit log in the same transaction. The operation will
+// fail if the window is modified before the transaction is committed.
+func (s ConsulStore) OverrideTxn(ctx context.Context, id fields.ID, rcID rc_fields.ID) error {
+	window, index, err := s.getWithIndex(id)
+	if err != nil {
+		return err
+	}
+	if window.Overridden(rcID) {
+		return nil
+	}
+
+	window.Overrides = append(window.Overrides, rcID)
+	windowBytes, err := json.Marshal(window)
+	if err != nil {
+		return util.Errorf("could not marshal freeze window as json: %s", err)
+	}
+
+	return transaction.Add(ctx, api.KVTxnOp{
+		Verb:  api.KVCAS,
+		Key:   freezePath(id),
+		Value: windowBytes,
+		Index: index,
+	})
+}
+
+func kvpToWindow(kvp *api.KVPair) (fields.Window, error) {
+	var window fields.Window
+	err := json.Unmarshal(kvp.Value, &window)
+	if err != nil {
+		return fields.Window{}, util.Errorf("could not unmarshal freeze window at %s: %s", kvp.Key, err)
+	}
+	return window, nil
+}
+
+func freezePath(id fields.ID) string {
+	return path.Join(freezeTree, id.String())
+}
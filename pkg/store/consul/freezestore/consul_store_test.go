@@ -0,0 +1,116 @@
+// +build !race
+
+package freezestore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/freeze/fields"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/store/consul/transaction"
+)
+
+func TestCreateListDelete(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+	store := NewConsul(fixture.Client)
+
+	now := time.Now()
+	created, err := store.Create(fields.Window{
+		Start:    now,
+		End:      now.Add(time.Hour),
+		PodID:    "web",
+		Selector: "environment=production",
+		Reason:   "holiday",
+	})
+	if err != nil {
+		t.Fatalf("could not create freeze window: %s", err)
+	}
+	if created.ID == "" {
+		t.Fatal("expected created freeze window to have an ID")
+	}
+
+	windows, err := store.List()
+	if err != nil {
+		t.Fatalf("could not list freeze windows: %s", err)
+	}
+	if len(windows) != 1 || windows[0].ID != created.ID || windows[0].Reason != "holiday" {
+		t.Fatalf("expected to list the created freeze window but got %+v", windows)
+	}
+
+	err = store.Delete(created.ID)
+	if err != nil {
+		t.Fatalf("could not delete freeze window: %s", err)
+	}
+	_, err = store.Get(created.ID)
+	if !IsNotExist(err) {
+		t.Errorf("expected deleted freeze window not to exist but got error %v", err)
+	}
+
+	_, err = store.Create(fields.Window{Start: now, End: now.Add(-time.Hour)})
+	if err == nil {
+		t.Error("expected an error creating a freeze window that ends before it starts")
+	}
+}
+
+func TestOverrideTxn(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+	store := NewConsul(fixture.Client)
+
+	now := time.Now()
+	created, err := store.Create(fields.Window{
+		Start:  now,
+		End:    now.Add(time.Hour),
+		Reason: "holiday",
+	})
+	if err != nil {
+		t.Fatalf("could not create freeze window: %s", err)
+	}
+
+	ctx, cancel := transaction.New(context.Background())
+	defer cancel()
+	err = store.OverrideTxn(ctx, created.ID, "some-rc")
+	if err != nil {
+		t.Fatalf("could not build override transaction: %s", err)
+	}
+	err = transaction.MustCommit(ctx, fixture.Client.KV())
+	if err != nil {
+		t.Fatalf("could not commit override transaction: %s", err)
+	}
+
+	window, err := store.Get(created.ID)
+	if err != nil {
+		t.Fatalf("could not get freeze window: %s", err)
+	}
+	if !window.Overridden("some-rc") {
+		t.Errorf("expected freeze window to be overridden for some-rc but overrides were %v", window.Overrides)
+	}
+	if window.Overridden("other-rc") {
+		t.Error("expected freeze window not to be overridden for other-rc")
+	}
+
+	// a transaction built before the window changes must not clobber it
+	staleCtx, staleCancel := transaction.New(context.Background())
+	defer staleCancel()
+	err = store.OverrideTxn(staleCtx, created.ID, "other-rc")
+	if err != nil {
+		t.Fatalf("could not build override transaction: %s", err)
+	}
+	overrideCtx, overrideCancel := transaction.New(context.Background())
+	defer overrideCancel()
+	err = store.OverrideTxn(overrideCtx, created.ID, "third-rc")
+	if err != nil {
+		t.Fatalf("could not build override transaction: %s", err)
+	}
+	err = transaction.MustCommit(overrideCtx, fixture.Client.KV())
+	if err != nil {
+		t.Fatalf("could not commit override transaction: %s", err)
+	}
+	err = transaction.MustCommit(staleCtx, fixture.Client.KV())
+	if err == nil {
+		t.Error("expected a stale override transaction to fail")
+	}
+}
@@ -31,6 +31,7 @@ const (
 	// Don't change this, it affects where status keys are read and written from
 	PreparerPodStatusNamespace statusstore.Namespace = "preparer"
 	RCStatusNamespace          statusstore.Namespace = "replication_controller"
+	RollStatusNamespace        statusstore.Namespace = "roll_farm"
 )
 
 type ManifestResult struct {
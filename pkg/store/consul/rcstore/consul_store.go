@@ -37,6 +37,10 @@ const (
 
 const rcTree string = "replication_controllers"
 
+// historyTree holds the prior manifests of each RC, keyed by RC ID. It is kept
+// out of rcTree so that watches on RCs don't see history changes.
+const historyTree string = "replication_controller_history"
+
 var NoReplicationController error = errors.New("No replication controller found")
 
 func IsNotExist(err error) bool {
@@ -76,6 +80,7 @@ type consulKV interface {
 	List(prefix string, opts *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error)
 	CAS(pair *api.KVPair, opts *api.WriteOptions) (bool, *api.WriteMeta, error)
 	DeleteCAS(pair *api.KVPair, opts *api.WriteOptions) (bool, *api.WriteMeta, error)
+	Delete(key string, opts *api.WriteOptions) (*api.WriteMeta, error)
 	Txn(txn api.KVTxnOps, q *api.QueryOptions) (bool, *api.KVTxnResponse, *api.QueryMeta, error)
 }
 
@@ -220,20 +225,42 @@ func (s *ConsulStore) innerCreate(manifest manifest.Manifest, nodeSelector klabe
 
 // TODO: replace innerCreate() with this function
 func (s *ConsulStore) innerCreateTxn(ctx context.Context, manifest manifest.Manifest, nodeSelector klabels.Selector, podLabels klabels.Set, allocationStrategy fields.Strategy) (fields.RC, error) {
-	id := fields.ID(uuid.New())
-	rcp, err := s.rcPath(id)
-	if err != nil {
-		return fields.RC{}, err
-	}
-
-	rc := fields.RC{
-		ID:                 id,
+	return s.createFromTemplateTxn(ctx, fields.RC{
 		Manifest:           manifest,
 		NodeSelector:       nodeSelector,
 		PodLabels:          podLabels,
-		ReplicasDesired:    0,
-		Disabled:           false,
 		AllocationStrategy: allocationStrategy,
+	})
+}
+
+// CreateFromTemplateTxn adds the KV operations required to create a new RC
+// to ctx. The RC gets every field of the passed template except for its ID,
+// which is generated, and its replica count and disabled flag, which start
+// off as zero and false respectively.
+func (s *ConsulStore) CreateFromTemplateTxn(ctx context.Context, template fields.RC, additionalLabels klabels.Set) (fields.RC, error) {
+	rc, err := s.createFromTemplateTxn(ctx, template)
+	if err != nil {
+		return fields.RC{}, err
+	}
+
+	labelsToSet := s.computeLabels(rc, additionalLabels)
+	err = s.labeler.SetLabelsTxn(ctx, labels.RC, rc.ID.String(), labelsToSet)
+	if err != nil {
+		return fields.RC{}, err
+	}
+
+	return rc, nil
+}
+
+func (s *ConsulStore) createFromTemplateTxn(ctx context.Context, template fields.RC) (fields.RC, error) {
+	rc := template
+	rc.ID = fields.ID(uuid.New())
+	rc.ReplicasDesired = 0
+	rc.Disabled = false
+
+	rcp, err := s.rcPath(rc.ID)
+	if err != nil {
+		return fields.RC{}, err
 	}
 
 	jsonRC, err := json.Marshal(rc)
@@ -628,6 +655,15 @@ func (s *ConsulStore) EnableTxn(ctx context.Context, id fields.ID) error {
 	})
 }
 
+// UpdateNodeSelectorTxn adds the KV operations required to replace the RC's
+// node selector to ctx.
+func (s *ConsulStore) UpdateNodeSelectorTxn(ctx context.Context, id fields.ID, nodeSelector klabels.Selector) error {
+	return s.mutateRCTxn(ctx, id, func(rc fields.RC) (fields.RC, error) {
+		rc.NodeSelector = nodeSelector
+		return rc, nil
+	})
+}
+
 // SetDesiredReplicas updates the replica count for the RC with the
 // given ID.
 func (s *ConsulStore) SetDesiredReplicas(id fields.ID, n int) error {
@@ -662,22 +698,45 @@ func (s *ConsulStore) CASDesiredReplicas(id fields.ID, expected int, n int) erro
 	})
 }
 
+// CASDesiredReplicasTxn adds the KV operations required to set the RC's
+// desired replica count to n to ctx, returning an error if it isn't currently
+// expected. The transaction will fail if the RC changes before it is committed.
+func (s *ConsulStore) CASDesiredReplicasTxn(ctx context.Context, id fields.ID, expected int, n int) error {
+	return s.mutateRCTxn(ctx, id, func(rc fields.RC) (fields.RC, error) {
+		if rc.ReplicasDesired != expected {
+			return rc, util.Errorf("replication controller %s has %d desired replicas instead of %d, not setting to %d", rc.ID, rc.ReplicasDesired, expected, n)
+		}
+		rc.ReplicasDesired = n
+		return rc, nil
+	})
+}
+
 // Delete removes the RC with the given ID the targeted RC, returning an error
 // if it does not exist.  Normally an RC can only be deleted if its desired
 // replica count is zero; pass force=true to override this check.
 func (s *ConsulStore) Delete(id fields.ID, force bool) error {
-	return s.retryMutate(id, func(rc fields.RC) (fields.RC, error) {
+	err := s.retryMutate(id, func(rc fields.RC) (fields.RC, error) {
 		if !force && rc.ReplicasDesired != 0 {
 			return fields.RC{}, fmt.Errorf("replication controller %s has %d desired replicas (must reduce to 0 before deleting)", rc.ID, rc.ReplicasDesired)
 		}
 		return fields.RC{}, nil
 	})
+	if err != nil {
+		return err
+	}
+
+	historyPath := s.historyPath(id)
+	_, err = s.kv.Delete(historyPath, nil)
+	if err != nil {
+		return consulutil.NewKVError("delete", historyPath, err)
+	}
+	return nil
 }
 
 // DeleteTxn adds a deletion operation to the passed context rather than
 // immediately deleting ig
 func (s *ConsulStore) DeleteTxn(ctx context.Context, id fields.ID, force bool) error {
-	return s.mutateRCTxn(ctx, id, func(rc fields.RC) (fields.RC, error) {
+	err := s.mutateRCTxn(ctx, id, func(rc fields.RC) (fields.RC, error) {
 		if force {
 			return fields.RC{}, nil
 		}
@@ -688,15 +747,170 @@ func (s *ConsulStore) DeleteTxn(ctx context.Context, id fields.ID, force bool) e
 
 		return fields.RC{}, nil
 	})
+	if err != nil {
+		return err
+	}
+
+	return transaction.Add(ctx, api.KVTxnOp{
+		Verb: api.KVDelete,
+		Key:  s.historyPath(id),
+	})
 }
 
 // UpdateManifest will set the manifest on the RC at the given ID. Be careful with this function!
-func (s *ConsulStore) UpdateManifest(id fields.ID, man manifest.Manifest) error {
-	manifestUpdater := func(rc fields.RC) (fields.RC, error) {
+// The replaced manifest is added to the RC's history, attributed to user.
+func (s *ConsulStore) UpdateManifest(id fields.ID, man manifest.Manifest, user string) error {
+	err := s.updateManifest(id, man, user)
+	for i := 0; i < s.retries; i++ {
+		if _, ok := err.(CASError); ok {
+			err = s.updateManifest(id, man, user)
+		} else {
+			break
+		}
+	}
+	return err
+}
+
+func (s *ConsulStore) updateManifest(id fields.ID, man manifest.Manifest, user string) error {
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
+
+	err := s.UpdateManifestTxn(ctx, id, man, user)
+	if err != nil {
+		return err
+	}
+
+	ok, _, err := transaction.Commit(ctx, s.kv)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		rcp, _ := s.rcPath(id)
+		return CASError(rcp)
+	}
+	return nil
+}
+
+// UpdateManifestTxn adds the KV operations required to set the manifest of
+// the RC, and to add the manifest it replaces to the RC's history, to ctx
+func (s *ConsulStore) UpdateManifestTxn(ctx context.Context, id fields.ID, man manifest.Manifest, user string) error {
+	var prior manifest.Manifest
+	err := s.mutateRCTxn(ctx, id, func(rc fields.RC) (fields.RC, error) {
+		prior = rc.Manifest
 		rc.Manifest = man
 		return rc, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if prior == nil {
+		return nil
+	}
+	priorSHA, err := prior.SHA()
+	if err != nil {
+		return err
+	}
+	newSHA, err := man.SHA()
+	if err != nil {
+		return err
+	}
+	if priorSHA == newSHA {
+		return nil
+	}
+
+	return s.mutateHistoryTxn(ctx, id, func(history fields.History) (fields.History, error) {
+		return history.Add(prior, time.Now(), user)
+	})
+}
+
+// History returns the prior manifests of the RC with the given ID, oldest
+// first. An RC whose manifest has never changed has an empty history.
+func (s *ConsulStore) History(id fields.ID) (fields.History, error) {
+	history, _, err := s.getHistory(id)
+	return history, err
+}
+
+// InheritHistoryTxn adds the KV operations required to make the history of
+// the "from" RC, followed by its current manifest, the start of the history
+// of the "to" RC. It is used when a rolling update replaces one RC with
+// another so that the replaced manifest can still be rolled back to.
+func (s *ConsulStore) InheritHistoryTxn(ctx context.Context, from fields.ID, to fields.ID, user string) error {
+	fromRC, err := s.Get(from)
+	if err != nil {
+		return err
+	}
+	inherited, _, err := s.getHistory(from)
+	if err != nil {
+		return err
 	}
-	return s.retryMutate(id, manifestUpdater)
+	if fromRC.Manifest != nil {
+		inherited, err = inherited.Add(fromRC.Manifest, time.Now(), user)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.mutateHistoryTxn(ctx, to, func(history fields.History) (fields.History, error) {
+		// renumber any revisions the new RC already has so they follow
+		// the inherited ones
+		next := 1
+		if len(inherited.Revisions) > 0 {
+			next = inherited.Revisions[len(inherited.Revisions)-1].Number + 1
+		}
+		revisions := inherited.Revisions
+		for _, revision := range history.Revisions {
+			revision.Number = next
+			next++
+			revisions = append(revisions, revision)
+		}
+		if len(revisions) > fields.MaxRevisions {
+			revisions = revisions[len(revisions)-fields.MaxRevisions:]
+		}
+		return fields.History{Revisions: revisions}, nil
+	})
+}
+
+func (s *ConsulStore) getHistory(id fields.ID) (fields.History, uint64, error) {
+	historyPath := s.historyPath(id)
+	kvp, _, err := s.kv.Get(historyPath, nil)
+	if err != nil {
+		return fields.History{}, 0, consulutil.NewKVError("get", historyPath, err)
+	}
+	if kvp == nil {
+		return fields.History{}, 0, nil
+	}
+
+	var history fields.History
+	err = json.Unmarshal(kvp.Value, &history)
+	if err != nil {
+		return fields.History{}, 0, util.Errorf("could not unmarshal RC history at %s: %s", historyPath, err)
+	}
+	return history, kvp.ModifyIndex, nil
+}
+
+// mutateHistoryTxn adds a check-and-set of the RC's history to ctx, so the
+// transaction fails if the history changes before it is committed
+func (s *ConsulStore) mutateHistoryTxn(ctx context.Context, id fields.ID, mutator func(fields.History) (fields.History, error)) error {
+	history, index, err := s.getHistory(id)
+	if err != nil {
+		return err
+	}
+	history, err = mutator(history)
+	if err != nil {
+		return err
+	}
+
+	historyBytes, err := json.Marshal(history)
+	if err != nil {
+		return util.Errorf("could not marshal RC history as JSON: %s", err)
+	}
+	return transaction.Add(ctx, api.KVTxnOp{
+		Verb:  api.KVCAS,
+		Key:   s.historyPath(id),
+		Index: index,
+		Value: historyBytes,
+	})
 }
 
 func (s *ConsulStore) UpdateStrategy(id fields.ID, strategy fields.Strategy) error {
@@ -711,6 +925,33 @@ func (s *ConsulStore) UpdateStrategy(id fields.ID, strategy fields.Strategy) err
 	return s.retryMutate(id, strategyUpdater)
 }
 
+// UpdateSpreadConstraints replaces the spread constraints of the RC at the
+// given ID. An empty list removes all constraints.
+func (s *ConsulStore) UpdateSpreadConstraints(id fields.ID, constraints []fields.SpreadConstraint) error {
+	for _, constraint := range constraints {
+		err := constraint.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	spreadUpdater := func(rc fields.RC) (fields.RC, error) {
+		rc.SpreadConstraints = constraints
+		return rc, nil
+	}
+	return s.retryMutate(id, spreadUpdater)
+}
+
+// UpdatePriority sets the priority the RC at the given ID uses to preempt
+// pods of other RCs
+func (s *ConsulStore) UpdatePriority(id fields.ID, priority int) error {
+	priorityUpdater := func(rc fields.RC) (fields.RC, error) {
+		rc.Priority = priority
+		return rc, nil
+	}
+	return s.retryMutate(id, priorityUpdater)
+}
+
 // TODO: this function is almost a verbatim copy of pkg/labels retryMutate, can
 // we find some way to combine them?
 func (s *ConsulStore) retryMutate(id fields.ID, mutator func(fields.RC) (fields.RC, error)) error {
@@ -896,6 +1137,10 @@ func (s *ConsulStore) Watch(rcID fields.ID, quit <-chan struct{}) (<-chan fields
 	return updated, errors
 }
 
+func (s *ConsulStore) historyPath(rcID fields.ID) string {
+	return path.Join(historyTree, rcID.String())
+}
+
 func (s *ConsulStore) rcLockRoot() string {
 	return path.Join(consul.LOCK_TREE, rcTree)
 }
@@ -87,6 +87,10 @@ func (s *fakeStore) CreateTxn(
 	panic("transactions not implemented in fake rc store")
 }
 
+func (s *fakeStore) CreateFromTemplateTxn(ctx context.Context, template fields.RC, additionalLabels labels.Set) (fields.RC, error) {
+	panic("transactions not implemented in fake rc store")
+}
+
 func (s *fakeStore) Get(id fields.ID) (fields.RC, error) {
 	entry, ok := s.rcs[id]
 	if !ok {
@@ -154,6 +158,10 @@ func (s *fakeStore) EnableTxn(ctx context.Context, id fields.ID) error {
 	return util.Errorf("EnableTxn isn't implemented in fake RC store. use a real store if this functionality is needed")
 }
 
+func (s *fakeStore) UpdateNodeSelectorTxn(ctx context.Context, id fields.ID, nodeSelector labels.Selector) error {
+	return util.Errorf("UpdateNodeSelectorTxn isn't implemented in fake RC store. use a real store if this functionality is needed")
+}
+
 func (s *fakeStore) SetDesiredReplicas(id fields.ID, n int) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -206,6 +214,10 @@ func (s *fakeStore) CASDesiredReplicas(id fields.ID, expected int, n int) error
 	return nil
 }
 
+func (s *fakeStore) CASDesiredReplicasTxn(ctx context.Context, id fields.ID, expected int, n int) error {
+	return util.Errorf("CASDesiredReplicasTxn isn't implemented in fake RC store. use a real store if this functionality is needed")
+}
+
 func (s *fakeStore) Delete(id fields.ID, force bool) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -305,6 +305,52 @@ func TestDisableTxnFailsIfChanged(t *testing.T) {
 	}
 }
 
+func TestCASDesiredReplicasTxn(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+
+	applicator := labels.NewConsulApplicator(fixture.Client, 0, 0)
+	rcStore := NewConsul(fixture.Client, applicator, 0)
+
+	rc, err := rcStore.Create(testManifest(), klabels.Everything(), "some_az", "some_cn", nil, nil, "some_strategy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := transaction.New(context.Background())
+	defer cancel()
+	err = rcStore.CASDesiredReplicasTxn(ctx, rc.ID, 1, 3)
+	if err == nil {
+		t.Fatal("expected an error when the RC doesn't have the expected replica count")
+	}
+
+	err = rcStore.CASDesiredReplicasTxn(ctx, rc.ID, 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err = rcStore.Get(rc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc.ReplicasDesired != 0 {
+		t.Fatal("rc's replica count was changed before transaction was committed")
+	}
+
+	err = transaction.MustCommit(ctx, fixture.Client.KV())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err = rcStore.Get(rc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc.ReplicasDesired != 3 {
+		t.Fatalf("expected rc to have 3 desired replicas but it had %d", rc.ReplicasDesired)
+	}
+}
+
 func TestEnableTxn(t *testing.T) {
 	fixture := consulutil.NewFixture(t)
 	defer fixture.Stop()
@@ -469,3 +515,115 @@ func testManifest() manifest.Manifest {
 	builder.SetID("some_pod_id")
 	return builder.GetManifest()
 }
+
+func TestUpdateManifestRecordsHistory(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+
+	applicator := labels.NewConsulApplicator(fixture.Client, 0, 0)
+	rcStore := NewConsul(fixture.Client, applicator, 0)
+
+	rc, err := rcStore.Create(testManifest(), klabels.Everything(), "some_az", "some_cn", nil, nil, "some_strategy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder := testManifest().GetBuilder()
+	builder.SetConfig(map[interface{}]interface{}{"version": 2})
+	newManifest := builder.GetManifest()
+	err = rcStore.UpdateManifest(rc.ID, newManifest, "some_user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// setting the same manifest again should not add a revision
+	err = rcStore.UpdateManifest(rc.ID, newManifest, "some_user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := rcStore.History(rc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Revisions) != 1 {
+		t.Fatalf("expected one revision in the history but found %d", len(history.Revisions))
+	}
+	revision := history.Revisions[0]
+	originalSHA, _ := testManifest().SHA()
+	if revision.SHA != originalSHA {
+		t.Errorf("expected the revision to hold the original manifest %s but had %s", originalSHA, revision.SHA)
+	}
+	if revision.User != "some_user" {
+		t.Errorf("expected the revision to be attributed to some_user but was %s", revision.User)
+	}
+
+	rc, err = rcStore.Get(rc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSHA, _ := newManifest.SHA()
+	currentSHA, _ := rc.Manifest.SHA()
+	if currentSHA != newSHA {
+		t.Errorf("expected the RC's manifest to be updated to %s but was %s", newSHA, currentSHA)
+	}
+}
+
+func TestInheritHistoryTxn(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+
+	applicator := labels.NewConsulApplicator(fixture.Client, 0, 0)
+	rcStore := NewConsul(fixture.Client, applicator, 0)
+
+	oldRC, err := rcStore.Create(testManifest(), klabels.Everything(), "some_az", "some_cn", nil, nil, "some_strategy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := testManifest().GetBuilder()
+	builder.SetConfig(map[interface{}]interface{}{"version": 2})
+	err = rcStore.UpdateManifest(oldRC.ID, builder.GetManifest(), "some_user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder.SetConfig(map[interface{}]interface{}{"version": 3})
+	newRC, err := rcStore.Create(builder.GetManifest(), klabels.Everything(), "some_az", "some_cn", nil, nil, "some_strategy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := transaction.New(context.Background())
+	defer cancel()
+	err = rcStore.InheritHistoryTxn(ctx, oldRC.ID, newRC.ID, "some_update")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rcStore.DeleteTxn(ctx, oldRC.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = transaction.MustCommit(ctx, fixture.Client.KV())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := rcStore.History(newRC.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Revisions) != 2 {
+		t.Fatalf("expected the new RC to inherit two revisions but found %d", len(history.Revisions))
+	}
+	if history.Revisions[1].Number != 2 || history.Revisions[1].User != "some_update" {
+		t.Errorf("expected the old RC's last manifest to be revision 2 attributed to the update but got %+v", history.Revisions[1])
+	}
+
+	oldHistory, err := rcStore.History(oldRC.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(oldHistory.Revisions) != 0 {
+		t.Errorf("expected the deleted RC's history to be deleted but it had %d revisions", len(oldHistory.Revisions))
+	}
+}
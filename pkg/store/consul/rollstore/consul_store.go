@@ -72,6 +72,7 @@ type ReplicationControllerStore interface {
 		additionalLabels klabels.Set,
 		allocationStrategy rc_fields.Strategy,
 	) (rc_fields.RC, error)
+	CreateFromTemplateTxn(ctx context.Context, template rc_fields.RC, additionalLabels klabels.Set) (rc_fields.RC, error)
 	Delete(id rc_fields.ID, force bool) error
 	UpdateCreationLockPath(rcID rc_fields.ID) (string, error)
 
@@ -322,6 +323,47 @@ func (s ConsulStore) CreateRollingUpdateFromOneExistingRCWithID(
 	newRCLabels klabels.Set,
 	rollLabels klabels.Set,
 	newAllocationStrategy rc_fields.Strategy,
+) (roll_fields.Update, error) {
+	createRC := func() (rc_fields.RC, error) {
+		return s.rcstore.CreateTxn(ctx, newRCManifest, newRCNodeSelector, availabilityZone, clusterName, newRCPodLabels, newRCLabels, newAllocationStrategy)
+	}
+	return s.createRollingUpdateFromOneExistingRC(ctx, oldRCID, desiredReplicas, minimumReplicas, leaveOld, rollDelay, rollLabels, createRC)
+}
+
+// CreateRollingUpdateFromRCTemplateWithID is like
+// CreateRollingUpdateFromOneExistingRCWithID except the new RC copies every
+// field of newRCTemplate other than its ID, replica count and disabled flag.
+// This lets callers such as rollbacks preserve fields like spread constraints
+// and priority without a second transaction.
+func (s ConsulStore) CreateRollingUpdateFromRCTemplateWithID(
+	ctx context.Context,
+	oldRCID rc_fields.ID,
+	desiredReplicas int,
+	minimumReplicas int,
+	leaveOld bool,
+	rollDelay time.Duration,
+	newRCTemplate rc_fields.RC,
+	newRCLabels klabels.Set,
+	rollLabels klabels.Set,
+) (roll_fields.Update, error) {
+	createRC := func() (rc_fields.RC, error) {
+		return s.rcstore.CreateFromTemplateTxn(ctx, newRCTemplate, newRCLabels)
+	}
+	return s.createRollingUpdateFromOneExistingRC(ctx, oldRCID, desiredReplicas, minimumReplicas, leaveOld, rollDelay, rollLabels, createRC)
+}
+
+// createRollingUpdateFromOneExistingRC locks the old RC, adds the operations
+// to create the new RC using createRC to ctx, and then locks the new RC and
+// adds the operations to create the RU.
+func (s ConsulStore) createRollingUpdateFromOneExistingRC(
+	ctx context.Context,
+	oldRCID rc_fields.ID,
+	desiredReplicas int,
+	minimumReplicas int,
+	leaveOld bool,
+	rollDelay time.Duration,
+	rollLabels klabels.Set,
+	createRC func() (rc_fields.RC, error),
 ) (roll_fields.Update, error) {
 	session, err := s.newRUCreationSession()
 	if err != nil {
@@ -344,7 +386,7 @@ func (s ConsulStore) CreateRollingUpdateFromOneExistingRCWithID(
 		return roll_fields.Update{}, err
 	}
 
-	rc, err := s.rcstore.CreateTxn(ctx, newRCManifest, newRCNodeSelector, availabilityZone, clusterName, newRCPodLabels, newRCLabels, newAllocationStrategy)
+	rc, err := createRC()
 	if err != nil {
 		return roll_fields.Update{}, err
 	}
@@ -508,6 +550,115 @@ func (s ConsulStore) Delete(ctx context.Context, id roll_fields.ID) error {
 	return nil
 }
 
+// Promote advances a staged rolling update past the stage it is currently
+// paused at. The farm running the update will notice the change the next time
+// it checks whether it may continue. An error is returned if the update does
+// not exist, has no stages, or has already been promoted through every stage.
+func (s ConsulStore) Promote(id roll_fields.ID) (roll_fields.Update, error) {
+	return s.mutateRU(id, func(u *roll_fields.Update) error {
+		if len(u.Stages) == 0 {
+			return util.Errorf("RU %s is not a staged rolling update", id)
+		}
+		if u.PromotedStages >= len(u.Stages) {
+			return util.Errorf("RU %s has already been promoted through all %d stages", id, len(u.Stages))
+		}
+		u.PromotedStages++
+		return nil
+	})
+}
+
+// SetPaused pauses or resumes the rolling update with the given ID. A paused
+// update is left in place, along with its locks on both RCs, but the farm
+// running it will not make any further progress until it is resumed.
+func (s ConsulStore) SetPaused(id roll_fields.ID, paused bool) (roll_fields.Update, error) {
+	return s.mutateRU(id, func(u *roll_fields.Update) error {
+		if u.Paused == paused {
+			if paused {
+				return util.Errorf("RU %s is already paused", id)
+			}
+			return util.Errorf("RU %s is not paused", id)
+		}
+		u.Paused = paused
+		return nil
+	})
+}
+
+// SetTopology records the progress of a topology-aware rolling update. If
+// pause is true the update is paused as part of the same write, so that an
+// operator has to resume it before the next failure domain is rolled.
+func (s ConsulStore) SetTopology(id roll_fields.ID, topology roll_fields.Topology, pause bool) (roll_fields.Update, error) {
+	return s.mutateRU(id, func(u *roll_fields.Update) error {
+		if u.Topology == nil {
+			return util.Errorf("RU %s is not a topology-aware rolling update", id)
+		}
+		u.Topology = &topology
+		if pause {
+			u.Paused = true
+		}
+		return nil
+	})
+}
+
+// SetBlueGreen records the nodes a blue/green rolling update has chosen for
+// its new RC.
+func (s ConsulStore) SetBlueGreen(id roll_fields.ID, blueGreen roll_fields.BlueGreen) (roll_fields.Update, error) {
+	return s.mutateRU(id, func(u *roll_fields.Update) error {
+		if u.BlueGreen == nil {
+			return util.Errorf("RU %s is not a blue/green rolling update", id)
+		}
+		u.BlueGreen = &blueGreen
+		return nil
+	})
+}
+
+// mutateRU reads the rolling update with the given ID, applies mutate to it
+// and writes it back using a check-and-set on the index it was read at. This
+// guarantees that concurrent mutations will not clobber each other; the
+// caller is expected to retry if the CAS fails.
+func (s ConsulStore) mutateRU(id roll_fields.ID, mutate func(*roll_fields.Update) error) (roll_fields.Update, error) {
+	key, err := RollPath(id)
+	if err != nil {
+		return roll_fields.Update{}, err
+	}
+
+	kvp, _, err := s.kv.Get(key, nil)
+	if err != nil {
+		return roll_fields.Update{}, consulutil.NewKVError("get", key, err)
+	}
+	if kvp == nil {
+		return roll_fields.Update{}, util.Errorf("RU %s does not exist", id)
+	}
+
+	ru, err := kvpToRU(kvp)
+	if err != nil {
+		return roll_fields.Update{}, err
+	}
+
+	err = mutate(&ru)
+	if err != nil {
+		return roll_fields.Update{}, err
+	}
+
+	b, err := json.Marshal(ru)
+	if err != nil {
+		return roll_fields.Update{}, util.Errorf("could not marshal RU as JSON: %s", err)
+	}
+
+	ok, _, err := s.kv.CAS(&api.KVPair{
+		Key:         key,
+		Value:       b,
+		ModifyIndex: kvp.ModifyIndex,
+	}, nil)
+	if err != nil {
+		return roll_fields.Update{}, consulutil.NewKVError("cas", key, err)
+	}
+	if !ok {
+		return roll_fields.Update{}, util.Errorf("RU %s was modified concurrently, please retry", id)
+	}
+
+	return ru, nil
+}
+
 // Lock takes a lock on a rolling update by ID. Before taking ownership of an
 // Update, its new RC ID, and old RC ID if any, should both be locked. If the
 // error return is nil, then the boolean indicates whether the lock was
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"testing"
 	"time"
 
@@ -16,6 +17,7 @@ import (
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/rcstore"
 	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
 
 	"github.com/hashicorp/consul/api"
 	klabels "k8s.io/kubernetes/pkg/labels"
@@ -170,6 +172,149 @@ func TestList(t *testing.T) {
 	}
 }
 
+func TestPromote(t *testing.T) {
+	staged := testRollValue(testRCId)
+	staged.Stages = []fields.Stage{"1", "50%"}
+	rollstore, _ := newRollStoreWithFakeConsul(t, []fields.Update{staged, testRollValue(testRCId2)})
+
+	for i := 1; i <= 2; i++ {
+		promoted, err := rollstore.Promote(fields.ID(testRCId))
+		if err != nil {
+			t.Fatalf("Unexpected error promoting roll: %s", err)
+		}
+		if promoted.PromotedStages != i {
+			t.Errorf("Expected roll to have %d promoted stages, had %d", i, promoted.PromotedStages)
+		}
+
+		entry, err := rollstore.Get(fields.ID(testRCId))
+		if err != nil {
+			t.Fatalf("Unexpected error retrieving roll from roll store: %s", err)
+		}
+		if entry.PromotedStages != i {
+			t.Errorf("Expected stored roll to have %d promoted stages, had %d", i, entry.PromotedStages)
+		}
+	}
+
+	_, err := rollstore.Promote(fields.ID(testRCId))
+	if err == nil {
+		t.Error("Expected an error promoting a roll past its last stage")
+	}
+
+	_, err = rollstore.Promote(fields.ID(testRCId2))
+	if err == nil {
+		t.Error("Expected an error promoting a roll without stages")
+	}
+
+	_, err = rollstore.Promote(fields.ID("nonexistent"))
+	if err == nil {
+		t.Error("Expected an error promoting a roll that doesn't exist")
+	}
+}
+
+func TestSetPaused(t *testing.T) {
+	ru := testRollValue(testRCId)
+	ru.MinimumReplicas = 2
+	ru.RollDelay = time.Minute
+	rollstore, _ := newRollStoreWithFakeConsul(t, []fields.Update{ru})
+
+	_, err := rollstore.SetPaused(fields.ID(testRCId), false)
+	if err == nil {
+		t.Error("Expected an error resuming a roll that isn't paused")
+	}
+
+	for _, paused := range []bool{true, false} {
+		updated, err := rollstore.SetPaused(fields.ID(testRCId), paused)
+		if err != nil {
+			t.Fatalf("Unexpected error setting paused to %t: %s", paused, err)
+		}
+		if updated.Paused != paused {
+			t.Errorf("Expected returned roll to have paused %t", paused)
+		}
+
+		entry, err := rollstore.Get(fields.ID(testRCId))
+		if err != nil {
+			t.Fatalf("Unexpected error retrieving roll from roll store: %s", err)
+		}
+		if entry.Paused != paused {
+			t.Errorf("Expected stored roll to have paused %t", paused)
+		}
+		if entry.MinimumReplicas != ru.MinimumReplicas || entry.RollDelay != ru.RollDelay {
+			t.Error("Expected pausing a roll to leave the rest of the roll unchanged")
+		}
+	}
+
+	_, err = rollstore.SetPaused(fields.ID("nonexistent"), true)
+	if err == nil {
+		t.Error("Expected an error pausing a roll that doesn't exist")
+	}
+}
+
+func TestSetTopology(t *testing.T) {
+	ru := testRollValue(testRCId)
+	ru.Topology = &fields.Topology{Key: "zone"}
+	plain := testRollValue(testRCId2)
+	rollstore, _ := newRollStoreWithFakeConsul(t, []fields.Update{ru, plain})
+
+	topology := fields.Topology{
+		Key:          "zone",
+		Domain:       "b",
+		Completed:    []string{"a"},
+		NodeSelector: "role=web",
+	}
+	updated, err := rollstore.SetTopology(fields.ID(testRCId), topology, true)
+	if err != nil {
+		t.Fatalf("Unexpected error setting topology: %s", err)
+	}
+	if !updated.Paused {
+		t.Error("Expected setting topology with pause to pause the roll")
+	}
+
+	entry, err := rollstore.Get(fields.ID(testRCId))
+	if err != nil {
+		t.Fatalf("Unexpected error retrieving roll from roll store: %s", err)
+	}
+	if entry.Topology == nil || !reflect.DeepEqual(*entry.Topology, topology) {
+		t.Errorf("Expected stored topology to be %+v but was %+v", topology, entry.Topology)
+	}
+	if !entry.Paused {
+		t.Error("Expected stored roll to be paused")
+	}
+
+	_, err = rollstore.SetTopology(fields.ID(testRCId2), topology, false)
+	if err == nil {
+		t.Error("Expected an error setting topology of a roll that isn't topology-aware")
+	}
+}
+
+func TestSetBlueGreen(t *testing.T) {
+	ru := testRollValue(testRCId)
+	ru.BlueGreen = &fields.BlueGreen{}
+	plain := testRollValue(testRCId2)
+	rollstore, _ := newRollStoreWithFakeConsul(t, []fields.Update{ru, plain})
+
+	blueGreen := fields.BlueGreen{
+		Nodes:        []types.NodeName{"node1", "node2"},
+		NodeSelector: "role=web",
+	}
+	_, err := rollstore.SetBlueGreen(fields.ID(testRCId), blueGreen)
+	if err != nil {
+		t.Fatalf("Unexpected error setting blue/green nodes: %s", err)
+	}
+
+	entry, err := rollstore.Get(fields.ID(testRCId))
+	if err != nil {
+		t.Fatalf("Unexpected error retrieving roll from roll store: %s", err)
+	}
+	if entry.BlueGreen == nil || !reflect.DeepEqual(*entry.BlueGreen, blueGreen) {
+		t.Errorf("Expected stored blue/green settings to be %+v but were %+v", blueGreen, entry.BlueGreen)
+	}
+
+	_, err = rollstore.SetBlueGreen(fields.ID(testRCId2), blueGreen)
+	if err == nil {
+		t.Error("Expected an error setting blue/green nodes of a roll that isn't blue/green")
+	}
+}
+
 // Test that if a conflicting update exists, a new one will not be admitted
 func TestCreateExistingRCsMutualExclusion(t *testing.T) {
 	newRCID := rc_fields.ID("new_rc")
@@ -161,6 +161,64 @@ func TestCreateRollingUpdateFromOneExistingRCWithID(t *testing.T) {
 	}
 }
 
+func TestCreateRollingUpdateFromRCTemplateWithID(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+	rollstore, rcStore := newRollStoreWithRealConsul(t, fixture, nil)
+
+	oldRC, err := rollstore.rcstore.Create(testManifest(), testNodeSelector(), "some_az", "some_cn", podLabels(), nil, "some_strategy")
+	if err != nil {
+		t.Fatalf("Unable to create old rc: %s", err)
+	}
+
+	template := oldRC
+	template.ReplicasDesired = 3
+	template.SpreadConstraints = []rc_fields.SpreadConstraint{{TopologyKey: "az", MaxSkew: 1}}
+	template.Priority = 10
+
+	txn, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
+	newUpdate, err := rollstore.CreateRollingUpdateFromRCTemplateWithID(
+		txn,
+		oldRC.ID,
+		3,
+		2,
+		false,
+		0,
+		template,
+		nil,
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("Unable to create rolling update: %s", err)
+	}
+
+	err = transaction.MustCommit(txn, fixture.Client.KV())
+	if err != nil {
+		t.Fatalf("unexpected error committing update transaction: %s", err)
+	}
+
+	newRC, err := rcStore.Get(newUpdate.NewRC)
+	if err != nil {
+		t.Fatalf("Shouldn't have failed to fetch new RC: %s", err)
+	}
+	if newRC.ID == oldRC.ID {
+		t.Fatal("expected the new RC to get its own ID")
+	}
+	if newRC.ReplicasDesired != 0 {
+		t.Errorf("expected new RC to start with 0 replicas but it had %d", newRC.ReplicasDesired)
+	}
+	if newRC.NodeSelector.String() != oldRC.NodeSelector.String() {
+		t.Errorf("expected new RC's node selector to be %q but was %q", oldRC.NodeSelector.String(), newRC.NodeSelector.String())
+	}
+	if newRC.Priority != 10 {
+		t.Errorf("expected new RC's priority to be copied but was %d", newRC.Priority)
+	}
+	if len(newRC.SpreadConstraints) != 1 || newRC.SpreadConstraints[0].TopologyKey != "az" {
+		t.Errorf("expected new RC's spread constraints to be copied but were %+v", newRC.SpreadConstraints)
+	}
+}
+
 func TestCreateRollingUpdateFromOneExistingRCWithIDMutualExclusion(t *testing.T) {
 	fixture := consulutil.NewFixture(t)
 	defer fixture.Stop()
@@ -0,0 +1,102 @@
+package shardstore
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/hashicorp/consul/api"
+)
+
+const membersTree string = "farm_members"
+
+type consulKV interface {
+	Acquire(p *api.KVPair, q *api.WriteOptions) (bool, *api.WriteMeta, error)
+	List(prefix string, opts *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error)
+}
+
+// ConsulStore registers the farm instances that split work between them in
+// Consul. Each member's key is held by its session, so a member leaves its
+// group when its session expires.
+type ConsulStore struct {
+	kv consulKV
+}
+
+func NewConsul(client consulutil.ConsulClient) ConsulStore {
+	return ConsulStore{
+		kv: client.KV(),
+	}
+}
+
+// Register adds the member to the group for as long as the session lives.
+// Registering a member that another session holds fails.
+func (s ConsulStore) Register(group string, member string, session string) error {
+	if group == "" || member == "" || strings.Contains(group, "/") || strings.Contains(member, "/") {
+		return util.Errorf("group %q and member %q must be non-empty and not contain '/'", group, member)
+	}
+
+	key := memberPath(group, member)
+	ok, _, err := s.kv.Acquire(&api.KVPair{Key: key, Session: session}, nil)
+	if err != nil {
+		return consulutil.NewKVError("acquire", key, err)
+	}
+	if !ok {
+		return util.Errorf("%s is already registered in %s by another session", member, group)
+	}
+	return nil
+}
+
+// Members returns the members currently registered in the group
+func (s ConsulStore) Members(group string) ([]string, error) {
+	prefix := groupPath(group)
+	pairs, _, err := s.kv.List(prefix, nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("list", prefix, err)
+	}
+	return pairsToMembers(pairs), nil
+}
+
+// WatchMembers sends the members of the group whenever they change, until
+// quit is closed
+func (s ConsulStore) WatchMembers(group string, quit <-chan struct{}) (<-chan []string, <-chan error) {
+	inCh := make(chan api.KVPairs)
+	errCh := make(chan error)
+	outCh := make(chan []string)
+	go consulutil.WatchPrefix(groupPath(group), s.kv, inCh, quit, errCh, 0, 5*time.Second)
+
+	go func() {
+		defer close(outCh)
+		for pairs := range inCh {
+			select {
+			case <-quit:
+				return
+			case outCh <- pairsToMembers(pairs):
+			}
+		}
+	}()
+	return outCh, errCh
+}
+
+// pairsToMembers returns the members whose keys are held by a session. Keys
+// are left behind without one if a session is released rather than deleted.
+func pairsToMembers(pairs api.KVPairs) []string {
+	var members []string
+	for _, pair := range pairs {
+		if pair.Session == "" {
+			continue
+		}
+		members = append(members, path.Base(pair.Key))
+	}
+	return members
+}
+
+func groupPath(group string) string {
+	return path.Join(membersTree, group) + "/"
+}
+
+func memberPath(group string, member string) string {
+	return path.Join(membersTree, group, member)
+}
@@ -0,0 +1,74 @@
+// +build !race
+
+package shardstore
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+
+	"github.com/hashicorp/consul/api"
+)
+
+func TestMembersLeaveWhenSessionsEnd(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+	store := NewConsul(fixture.Client)
+
+	sessions := make(map[string]string)
+	for _, member := range []string{"farm1", "farm2"} {
+		session, _, err := fixture.Client.Session().Create(&api.SessionEntry{Behavior: api.SessionBehaviorDelete}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = store.Register("some_group", member, session)
+		if err != nil {
+			t.Fatalf("could not register %s: %s", member, err)
+		}
+		sessions[member] = session
+	}
+
+	err := store.Register("some_group", "farm1", sessions["farm2"])
+	if err == nil {
+		t.Fatal("expected registering a member held by another session to fail")
+	}
+
+	quit := make(chan struct{})
+	defer close(quit)
+	membersCh, errCh := store.WatchMembers("some_group", quit)
+	waitForMembers := func(expected []string) {
+		timeout := time.After(5 * time.Second)
+		var members []string
+		for {
+			select {
+			case members = <-membersCh:
+				sort.Strings(members)
+				if reflect.DeepEqual(members, expected) {
+					return
+				}
+			case err := <-errCh:
+				t.Fatalf("error watching members: %s", err)
+			case <-timeout:
+				t.Fatalf("expected members %s, last saw %s", expected, members)
+			}
+		}
+	}
+	waitForMembers([]string{"farm1", "farm2"})
+
+	_, err = fixture.Client.Session().Destroy(sessions["farm1"], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForMembers([]string{"farm2"})
+
+	members, err := store.Members("some_group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(members, []string{"farm2"}) {
+		t.Fatalf("expected only farm2 to be a member, was %s", members)
+	}
+}
@@ -1,5 +1,9 @@
 package daemonsetstatus
 
+import (
+	"github.com/square/p2/pkg/types"
+)
+
 type Status struct {
 	// ManifestSHA is the sha of the manifest that was most recently
 	// deployed
@@ -12,4 +16,65 @@ type Status struct {
 	NodesDeployed int `json:"nodes_deployed"`
 
 	ReplicationInProgress bool `json:"replication_in_progress"`
+
+	// Nodes breaks down the daemon set's nodes by how far along the
+	// deployment of manifest_sha they are. Like NodesDeployed it is
+	// periodically sampled
+	Nodes NodeBreakdown `json:"nodes"`
+
+	// HaltReason explains why the daemon set disabled itself, if it did so
+	// because its replication exceeded its failure budget. It is cleared
+	// once the daemon set is enabled again
+	HaltReason string `json:"halt_reason,omitempty"`
+}
+
+// NodeBreakdown lists the daemon set's nodes by their state. Current and
+// Outdated together make up every node the daemon set is scheduled on, while
+// Unhealthy and TimedOut may overlap with either of them.
+type NodeBreakdown struct {
+	// Current nodes are running the manifest with the status's
+	// ManifestSHA
+	Current []types.NodeName `json:"current,omitempty"`
+
+	// Outdated nodes are scheduled but are running an older manifest, or
+	// no manifest yet
+	Outdated []types.NodeName `json:"outdated,omitempty"`
+
+	// Unhealthy nodes are scheduled but their pod isn't passing its health
+	// checks
+	Unhealthy []types.NodeName `json:"unhealthy,omitempty"`
+
+	// TimedOut nodes timed out in the replication of the current manifest
+	// and haven't been deployed to successfully since
+	TimedOut []types.NodeName `json:"timed_out,omitempty"`
+
+	// Unscheduled nodes are eligible for the daemon set but it hasn't
+	// scheduled its pod on them yet
+	Unscheduled []types.NodeName `json:"unscheduled,omitempty"`
+}
+
+// Equal returns whether the two statuses are the same, as Status can't be
+// compared with == due to the node lists
+func (s Status) Equal(other Status) bool {
+	return s.ManifestSHA == other.ManifestSHA &&
+		s.NodesDeployed == other.NodesDeployed &&
+		s.ReplicationInProgress == other.ReplicationInProgress &&
+		s.HaltReason == other.HaltReason &&
+		nodesEqual(s.Nodes.Current, other.Nodes.Current) &&
+		nodesEqual(s.Nodes.Outdated, other.Nodes.Outdated) &&
+		nodesEqual(s.Nodes.Unhealthy, other.Nodes.Unhealthy) &&
+		nodesEqual(s.Nodes.TimedOut, other.Nodes.TimedOut) &&
+		nodesEqual(s.Nodes.Unscheduled, other.Nodes.Unscheduled)
+}
+
+func nodesEqual(a []types.NodeName, b []types.NodeName) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
 }
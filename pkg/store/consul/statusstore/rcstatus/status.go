@@ -10,6 +10,12 @@ import (
 
 type Status struct {
 	NodeTransfer *NodeTransfer `json:"node_transfer"`
+
+	// Unfrozen is the RC as it was the last time no deploy freeze window
+	// covered it. It is kept here rather than in the farm's memory so that
+	// changes made during a freeze stay held back across farm restarts and
+	// lock handoffs.
+	Unfrozen *Unfrozen `json:"unfrozen,omitempty"`
 }
 
 type NodeTransferID string
@@ -24,6 +30,15 @@ type NodeTransfer struct {
 	ID NodeTransferID `json:"id"`
 }
 
+type Unfrozen struct {
+	ReplicasDesired int    `json:"replicas_desired"`
+	ManifestSHA     string `json:"manifest_sha"`
+
+	// Manifest is the marshaled manifest, used to replace pods lost during
+	// a freeze
+	Manifest string `json:"manifest"`
+}
+
 func rawStatusToStatus(rawStatus statusstore.Status) (Status, error) {
 	var status Status
 
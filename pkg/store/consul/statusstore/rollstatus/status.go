@@ -0,0 +1,88 @@
+package rollstatus
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/util"
+)
+
+// Phase describes what a rolling update is currently doing
+type Phase string
+
+const (
+	// PhaseRolling means the update is moving replicas from the old RC to
+	// the new RC
+	PhaseRolling Phase = "rolling"
+
+	// PhaseBlocked means the update cannot make progress until more nodes
+	// become healthy. BlockedReason explains what it is waiting for
+	PhaseBlocked Phase = "blocked"
+
+	// PhaseAwaitingPromotion means a staged update has finished its current
+	// stage and is waiting for an operator to promote it
+	PhaseAwaitingPromotion Phase = "awaiting_promotion"
+
+	// PhasePaused means an operator has paused the update
+	PhasePaused Phase = "paused"
+)
+
+// Status is the progress of a rolling update as observed by the farm that is
+// running it.
+type Status struct {
+	Phase Phase `json:"phase"`
+
+	// OldRC and NewRC are the node counts of the two RCs the last time the
+	// update inspected their health
+	OldRC NodeCounts `json:"old_rc"`
+	NewRC NodeCounts `json:"new_rc"`
+
+	// LastStep is the most recent replica transfer performed by the update
+	LastStep Step `json:"last_step"`
+
+	// BlockedReason and BlockedSince are only set when the update is not
+	// in PhaseRolling
+	BlockedReason string     `json:"blocked_reason,omitempty"`
+	BlockedSince  *time.Time `json:"blocked_since,omitempty"`
+
+	// StartTime is when the update was first picked up by a farm. It is
+	// preserved if the update moves to a different farm
+	StartTime time.Time `json:"start_time"`
+}
+
+// NodeCounts mirrors the node counts the roll farm computes for each RC
+type NodeCounts struct {
+	Desired   int `json:"desired"`
+	Current   int `json:"current"`
+	Real      int `json:"real"`
+	Healthy   int `json:"healthy"`
+	Unhealthy int `json:"unhealthy"`
+	Unknown   int `json:"unknown"`
+}
+
+// Step is a single replica transfer from the old RC to the new RC
+type Step struct {
+	NodesToAdd    int `json:"nodes_to_add"`
+	NodesToRemove int `json:"nodes_to_remove"`
+}
+
+func rawStatusToStatus(rawStatus statusstore.Status) (Status, error) {
+	var status Status
+
+	err := json.Unmarshal(rawStatus.Bytes(), &status)
+	if err != nil {
+		return Status{}, util.Errorf("Could not unmarshal raw status as rolling update status: %s", err)
+	}
+
+	return status, nil
+}
+
+func statusToRawStatus(status Status) (statusstore.Status, error) {
+	bytes, err := json.Marshal(status)
+	if err != nil {
+		return statusstore.Status{}, util.Errorf("Could not marshal rolling update status as json bytes: %s", err)
+	}
+
+	return statusstore.Status(bytes), nil
+}
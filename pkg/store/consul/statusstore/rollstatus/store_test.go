@@ -0,0 +1,70 @@
+package rollstatus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	roll_fields "github.com/square/p2/pkg/roll/fields"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/transaction"
+)
+
+func TestSetGetAndDeleteStatus(t *testing.T) {
+	consulFixture := consulutil.NewFixture(t)
+	defer consulFixture.Stop()
+
+	store := NewConsul(statusstore.NewConsul(consulFixture.Client), "test")
+	id := roll_fields.ID("roll_id")
+	blockedSince := time.Now().Add(-time.Minute).UTC()
+	status := Status{
+		Phase:         PhaseBlocked,
+		OldRC:         NodeCounts{Desired: 2, Current: 2, Real: 2, Healthy: 2},
+		NewRC:         NodeCounts{Desired: 1, Current: 1, Real: 1, Unhealthy: 1},
+		LastStep:      Step{NodesToAdd: 1, NodesToRemove: 1},
+		BlockedReason: "minimum health not satisfied",
+		BlockedSince:  &blockedSince,
+		StartTime:     blockedSince.Add(-time.Hour),
+	}
+
+	_, _, err := store.Get(id)
+	if !statusstore.IsNoStatus(err) {
+		t.Fatalf("Expected no status error, got: %s", err)
+	}
+
+	err = store.Set(id, status)
+	if err != nil {
+		t.Fatalf("Unexpected error setting status: %s", err)
+	}
+
+	got, _, err := store.Get(id)
+	if err != nil {
+		t.Fatalf("Unexpected error getting status: %s", err)
+	}
+	if got.Phase != status.Phase || got.OldRC != status.OldRC || got.NewRC != status.NewRC || got.LastStep != status.LastStep {
+		t.Errorf("Status was %+v, wanted %+v", got, status)
+	}
+	if got.BlockedReason != status.BlockedReason || got.BlockedSince == nil || !got.BlockedSince.Equal(blockedSince) {
+		t.Errorf("Blocked reason and time were %q and %v, wanted %q and %v", got.BlockedReason, got.BlockedSince, status.BlockedReason, blockedSince)
+	}
+	if !got.StartTime.Equal(status.StartTime) {
+		t.Errorf("Start time was %s, wanted %s", got.StartTime, status.StartTime)
+	}
+
+	ctx, cancel := transaction.New(context.Background())
+	defer cancel()
+	err = store.DeleteTxn(ctx, id)
+	if err != nil {
+		t.Fatalf("Unexpected error deleting status: %s", err)
+	}
+	err = transaction.MustCommit(ctx, consulFixture.Client.KV())
+	if err != nil {
+		t.Fatalf("Unexpected error committing status deletion: %s", err)
+	}
+
+	_, _, err = store.Get(id)
+	if !statusstore.IsNoStatus(err) {
+		t.Errorf("Expected error to be NoStatus but was %s", err)
+	}
+}
@@ -21,6 +21,7 @@ const (
 	POD = ResourceType("pods")
 	DS  = ResourceType("daemon_sets")
 	RC  = ResourceType("replication_controllers")
+	RU  = ResourceType("rolls")
 )
 
 // Unfortunately each ResourceType will carry along with it a different "ID"
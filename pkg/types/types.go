@@ -126,6 +126,13 @@ func (n NodeSet) Intersection(other NodeSet) NodeSet {
 	}
 }
 
+func (n NodeSet) Union(other NodeSet) NodeSet {
+	union := n.String.Union(other.String)
+	return NodeSet{
+		String: union,
+	}
+}
+
 func (n NodeSet) Equal(other NodeSet) bool {
 	return n.String.Equal(other.String)
 }